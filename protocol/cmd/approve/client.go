@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/odysseyhack/planet-society/protocol/models"
+	"github.com/odysseyhack/planet-society/protocol/protocol"
+)
+
+const pendingFields = `transactionID received expires
+    notification { transactionID title description requesterName RequesterPublicKey date riskScore analysis verification item { Item Fields } }`
+
+const pendingQuery = `query { pendingTransactions { ` + pendingFields + ` } }`
+
+const pendingSubscription = `subscription { pendingTransactions { ` + pendingFields + ` } }`
+
+const reminderSubscription = `subscription { obligationReminders { id transaction_id kind description deadline } }`
+
+const approveMutation = `mutation($transactionID: String!, $fields: [ItemFieldInput!], $selection: [ItemSelectionInput!]) {
+  transactionApprove(transactionID: $transactionID, fields: $fields, selection: $selection) { transactionID accepted }
+}`
+
+const denyMutation = `mutation($transactionID: String!) {
+  transactionDeny(transactionID: $transactionID) { transactionID accepted }
+}`
+
+const identitiesQuery = `query { identity { id display_name } }`
+
+const itemsQuery = `query($identity: ID!) {
+  addressList(identity: $identity) { id display_name }
+  passportList(identity: $identity) { id display_name }
+  paymentCardList(identity: $identity) { id display_name }
+  identityDocumentList(identity: $identity) { id display_name }
+}`
+
+type request struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+type response struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func (r *response) decode(v interface{}) error {
+	if len(r.Errors) > 0 {
+		return fmt.Errorf("%s", r.Errors[0].Message)
+	}
+	return json.Unmarshal(r.Data, v)
+}
+
+// client talks to GraphQL API of the responder as the owner
+type client struct {
+	endpoint string
+	token    string
+	http     *http.Client
+}
+
+func newClient(endpoint, token string) *client {
+	return &client{endpoint: endpoint, token: token, http: &http.Client{Timeout: time.Second * 15}}
+}
+
+// header returns header authenticating the owner
+func (c *client) header() http.Header {
+	header := make(http.Header)
+	header.Set(protocol.OwnerTokenHeader, "Bearer "+c.token)
+	return header
+}
+
+func (c *client) do(query string, variables map[string]interface{}, v interface{}) error {
+	data, err := json.Marshal(&request{Query: query, Variables: variables})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header = c.header()
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var reply response
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return fmt.Errorf("response status %d: %s", resp.StatusCode, err)
+	}
+	return reply.decode(v)
+}
+
+// pending lists transactions waiting for the owner
+func (c *client) pending() ([]models.PendingTransaction, error) {
+	var data struct {
+		PendingTransactions []models.PendingTransaction `json:"pendingTransactions"`
+	}
+	err := c.do(pendingQuery, nil, &data)
+	return data.PendingTransactions, err
+}
+
+// approve approves transaction, nil fields approve everything requested
+// and nil selection shares default selection of requester
+func (c *client) approve(transactionID string, fields []models.ItemField, selection []models.ItemSelection) error {
+	var data struct {
+		TransactionApprove models.PermissionNotificationResponse `json:"transactionApprove"`
+	}
+	variables := map[string]interface{}{"transactionID": transactionID, "fields": fields, "selection": selection}
+	return c.do(approveMutation, variables, &data)
+}
+
+// choice is stored identity or item the owner can choose
+type choice struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"display_name"`
+}
+
+func (c *client) identities() ([]choice, error) {
+	var data struct {
+		Identity []choice `json:"identity"`
+	}
+	if err := c.do(identitiesQuery, nil, &data); err != nil {
+		return nil, err
+	}
+	return data.Identity, nil
+}
+
+// items lists stored items of identity by selectable item
+func (c *client) items(identity string) (map[string][]choice, error) {
+	var data struct {
+		AddressList          []choice `json:"addressList"`
+		PassportList         []choice `json:"passportList"`
+		PaymentCardList      []choice `json:"paymentCardList"`
+		IdentityDocumentList []choice `json:"identityDocumentList"`
+	}
+	if err := c.do(itemsQuery, map[string]interface{}{"identity": identity}, &data); err != nil {
+		return nil, err
+	}
+
+	return map[string][]choice{
+		protocol.SelectAddress:          data.AddressList,
+		protocol.SelectPassport:         data.PassportList,
+		protocol.SelectPaymentCard:      data.PaymentCardList,
+		protocol.SelectIdentityDocument: data.IdentityDocumentList,
+	}, nil
+}
+
+func (c *client) deny(transactionID string) error {
+	var data struct {
+		TransactionDeny models.PermissionNotificationResponse `json:"transactionDeny"`
+	}
+	return c.do(denyMutation, map[string]interface{}{"transactionID": transactionID}, &data)
+}
+
+// operation is message of graphql-ws protocol used by subscriptions
+type operation struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// subscribe passes transactions queued on responder to handle and obligation
+// reminders to remind until connection fails
+func (c *client) subscribe(handle func(models.PendingTransaction), remind func(models.Obligation)) error {
+	address, err := url.Parse(c.endpoint)
+	if err != nil {
+		return err
+	}
+	if address.Scheme == "https" {
+		address.Scheme = "wss"
+	} else {
+		address.Scheme = "ws"
+	}
+
+	dialer := websocket.Dialer{Subprotocols: []string{"graphql-ws"}, HandshakeTimeout: time.Second * 15}
+	conn, _, err := dialer.Dial(address.String(), c.header())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.WriteJSON(&operation{Type: "connection_init"}); err != nil {
+		return err
+	}
+
+	for id, query := range map[string]string{"pending": pendingSubscription, "reminders": reminderSubscription} {
+		payload, err := json.Marshal(&request{Query: query})
+		if err != nil {
+			return err
+		}
+		if err := conn.WriteJSON(&operation{ID: id, Type: "start", Payload: payload}); err != nil {
+			return err
+		}
+	}
+
+	for {
+		var message operation
+		if err := conn.ReadJSON(&message); err != nil {
+			return err
+		}
+
+		switch message.Type {
+		case "data":
+			var reply response
+			if err := json.Unmarshal(message.Payload, &reply); err != nil {
+				return err
+			}
+
+			var data struct {
+				PendingTransactions *models.PendingTransaction `json:"pendingTransactions"`
+				ObligationReminders *models.Obligation         `json:"obligationReminders"`
+			}
+			if err := reply.decode(&data); err != nil {
+				return err
+			}
+
+			if data.PendingTransactions != nil {
+				handle(*data.PendingTransactions)
+			}
+			if data.ObligationReminders != nil {
+				remind(*data.ObligationReminders)
+			}
+		case "error", "connection_error":
+			return fmt.Errorf("subscription failed: %s", message.Payload)
+		case "complete":
+			return fmt.Errorf("subscription completed by responder")
+		}
+	}
+}
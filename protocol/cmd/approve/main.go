@@ -0,0 +1,230 @@
+// approve lets the owner decide transactions pending on the responder from the terminal.
+// Responder has to run with -approval local, approve authenticates with owner token of the responder.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/models"
+	"github.com/odysseyhack/planet-society/protocol/protocol"
+	"github.com/odysseyhack/planet-society/protocol/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	endpoint  = flag.String("endpoint", "http://127.0.0.1:8088/query", "GraphQL endpoint of the responder")
+	tokenFile = flag.String("token", filepath.Join(os.Getenv("HOME"), ".planet-responder", "owner.token"), "owner token file in data directory of the responder")
+)
+
+func main() {
+	flag.Parse()
+	utils.ConfigureLogger()
+
+	token, err := ioutil.ReadFile(*tokenFile)
+	if err != nil {
+		log.Fatalln("failed to read owner token:", err)
+	}
+
+	if err := run(newClient(*endpoint, strings.TrimSpace(string(token))), bufio.NewReader(os.Stdin), os.Stdout); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func run(c *client, in *bufio.Reader, out io.Writer) error {
+	queued := make(chan models.PendingTransaction, 16)
+	reminders := make(chan models.Obligation, 16)
+	failed := make(chan error, 1)
+	go func() {
+		failed <- c.subscribe(func(transaction models.PendingTransaction) {
+			queued <- transaction
+		}, func(obligation models.Obligation) {
+			reminders <- obligation
+		})
+	}()
+
+	pending, err := c.pending()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "%d transactions pending, waiting for new ones\n", len(pending))
+	decided := make(map[string]bool)
+	for {
+		var transaction models.PendingTransaction
+		if len(pending) > 0 {
+			transaction, pending = pending[0], pending[1:]
+		} else {
+			select {
+			case transaction = <-queued:
+			case obligation := <-reminders:
+				fmt.Fprintf(out, "reminder: %q of transaction %s ends at %s\n", obligation.Description, obligation.TransactionID, obligation.Deadline)
+				continue
+			case err := <-failed:
+				return err
+			}
+		}
+
+		if decided[transaction.TransactionID] {
+			continue
+		}
+		decided[transaction.TransactionID] = true
+
+		if err := decide(c, &transaction, in, out); err != nil {
+			return err
+		}
+	}
+}
+
+// decide shows transaction and sends decision of the owner to responder
+func decide(c *client, transaction *models.PendingTransaction, in *bufio.Reader, out io.Writer) error {
+	expires, err := time.Parse(time.RFC3339, transaction.Expires)
+	if err == nil && time.Now().After(expires) {
+		fmt.Fprintf(out, "transaction %s expired at %s\n", transaction.TransactionID, transaction.Expires)
+		return nil
+	}
+
+	show(&transaction.Notification, out)
+	answer, err := ask(in, out, "approve all [a], select fields [s], choose shared items [c] or deny [d]? ")
+	if err != nil {
+		return err
+	}
+
+	switch answer {
+	case "a":
+		err = c.approve(transaction.TransactionID, nil, nil)
+	case "s":
+		var fields []models.ItemField
+		if fields, err = selectFields(&transaction.Notification, in, out); err != nil {
+			return err
+		}
+		err = c.approve(transaction.TransactionID, fields, nil)
+	case "c":
+		var selection []models.ItemSelection
+		if selection, err = chooseItems(c, in, out); err != nil {
+			return err
+		}
+		err = c.approve(transaction.TransactionID, nil, selection)
+	default:
+		err = c.deny(transaction.TransactionID)
+	}
+
+	if err != nil {
+		fmt.Fprintf(out, "decision not accepted: %s\n", err)
+		return nil
+	}
+	fmt.Fprintf(out, "transaction %s decided\n", transaction.TransactionID)
+	return nil
+}
+
+func show(notification *models.PermissionNotificationRequest, out io.Writer) {
+	fmt.Fprintf(out, "\ntransaction %s from %s (%s)\n", notification.TransactionID, notification.RequesterName, notification.RequesterPublicKey)
+	fmt.Fprintf(out, "  %s: %s\n", notification.Title, notification.Description)
+	fmt.Fprintf(out, "  risk score %d\n", notification.RiskScore)
+	for _, line := range notification.Analysis {
+		fmt.Fprintf(out, "  - %s\n", line)
+	}
+	for _, item := range notification.Item {
+		fmt.Fprintf(out, "  %s: %s\n", item.Item, strings.Join(item.Fields, ", "))
+	}
+}
+
+// selectFields asks which requested fields of every item are shared
+func selectFields(notification *models.PermissionNotificationRequest, in *bufio.Reader, out io.Writer) (fields []models.ItemField, err error) {
+	fields = []models.ItemField{}
+	for _, item := range notification.Item {
+		answer, err := ask(in, out, fmt.Sprintf("%s fields to share, comma separated, empty for all, - for none [%s]: ",
+			item.Item, strings.Join(item.Fields, ", ")))
+		if err != nil {
+			return nil, err
+		}
+
+		switch answer {
+		case "":
+			fields = append(fields, item)
+		case "-":
+		default:
+			selected := models.ItemField{Item: item.Item}
+			for _, field := range strings.Split(answer, ",") {
+				if field = strings.TrimSpace(field); field != "" {
+					selected.Fields = append(selected.Fields, field)
+				}
+			}
+			fields = append(fields, selected)
+		}
+	}
+	return fields, nil
+}
+
+// chooseItems asks which identity and which of its items of every type are shared
+func chooseItems(c *client, in *bufio.Reader, out io.Writer) ([]models.ItemSelection, error) {
+	identities, err := c.identities()
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := choose(in, out, protocol.SelectIdentity, identities)
+	if err != nil || identity == "" {
+		return nil, err
+	}
+	selection := []models.ItemSelection{{Item: protocol.SelectIdentity, ID: identity}}
+
+	items, err := c.items(identity)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range []string{protocol.SelectAddress, protocol.SelectPassport, protocol.SelectPaymentCard, protocol.SelectIdentityDocument} {
+		id, err := choose(in, out, item, items[item])
+		if err != nil {
+			return nil, err
+		}
+		if id != "" {
+			selection = append(selection, models.ItemSelection{Item: item, ID: id})
+		}
+	}
+	return selection, nil
+}
+
+// choose asks for one of choices, empty answer takes the first one
+func choose(in *bufio.Reader, out io.Writer, item string, choices []choice) (string, error) {
+	if len(choices) == 0 {
+		return "", nil
+	}
+
+	for i := range choices {
+		fmt.Fprintf(out, "  [%d] %s\n", i+1, choices[i].DisplayName)
+	}
+
+	for {
+		answer, err := ask(in, out, fmt.Sprintf("%s to share, empty for the first: ", item))
+		if err != nil {
+			return "", err
+		}
+		if answer == "" {
+			return choices[0].ID, nil
+		}
+
+		if index, err := strconv.Atoi(answer); err == nil && index >= 1 && index <= len(choices) {
+			return choices[index-1].ID, nil
+		}
+		fmt.Fprintf(out, "choose number from 1 to %d\n", len(choices))
+	}
+}
+
+func ask(in *bufio.Reader, out io.Writer, question string) (string, error) {
+	fmt.Fprint(out, question)
+	answer, err := in.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(answer), nil
+}
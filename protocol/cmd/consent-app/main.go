@@ -0,0 +1,84 @@
+// consent-app is local stand-in of the owner's app. It connects to consent
+// channel of the responder and answers every notification with the same decision
+// signed with its device keychain. Device is paired with the responder using
+// payload of devicePairingStart mutation given in -pair.
+package main
+
+import (
+	"flag"
+	"net/http"
+	"os"
+
+	"github.com/odysseyhack/planet-society/protocol/consent"
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+	"github.com/odysseyhack/planet-society/protocol/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	channel   = flag.String("channel", "websocket", "consent channel type: webhook, sse or websocket")
+	responder = flag.String("responder", "127.0.0.1:8090", "address of responder consent channel")
+	secret    = flag.String("secret", "", "webhook secret or app token shared with responder")
+	listen    = flag.String("listen", ":8091", "address receiving webhook notifications")
+	accept    = flag.Bool("accept", true, "accept or reject notifications")
+	keychain  = flag.String("keychain", "consent-app.keychain", "device keychain file, created when missing")
+	pair      = flag.String("pair", "", "pairing payload shown by responder, device is paired before receiving notifications")
+	name      = flag.String("name", "consent-app", "device name shown to the owner")
+)
+
+func main() {
+	flag.Parse()
+	utils.ConfigureLogger()
+
+	if err := run(); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func run() error {
+	device, err := loadKeychain(*keychain)
+	if err != nil {
+		return err
+	}
+
+	if *pair != "" {
+		if err := pairDevice(*pair, *name, device); err != nil {
+			return err
+		}
+	}
+
+	replyURL := "http://" + *responder + consent.ReplyPath
+	switch *channel {
+	case "webhook":
+		log.Infoln("receiving webhook notifications at:", *listen)
+		return http.ListenAndServe(*listen, consent.WebhookReceiver(*secret, replyURL, device, decide))
+	case "sse":
+		log.Infoln("connecting to events stream of:", *responder)
+		return consent.ReceiveSSE("http://"+*responder+consent.EventsPath, replyURL, *secret, device, decide)
+	case "websocket":
+		log.Infoln("connecting to push channel of:", *responder)
+		return consent.ReceiveWebsocket("ws://"+*responder+consent.WebsocketPath, *secret, device, decide)
+	}
+	return consent.ErrUnknownChannel
+}
+
+func decide(notification *models.PermissionNotificationRequest) *models.PermissionNotificationResponse {
+	log.Infof("notification %s from %s, risk score %d, accepted: %t",
+		notification.TransactionID, notification.RequesterName, notification.RiskScore, *accept)
+	return &models.PermissionNotificationResponse{TransactionID: notification.TransactionID, Accepted: *accept}
+}
+
+// loadKeychain loads device keychain from path, new keychain is created when file does not exist
+func loadKeychain(path string) (*cryptography.Keychain, error) {
+	device, err := cryptography.LoadKeychain(path)
+	if !os.IsNotExist(err) {
+		return device, err
+	}
+
+	log.Infoln("creating device keychain:", path)
+	if device, err = cryptography.OneShotKeychain(); err != nil {
+		return nil, err
+	}
+	return device, cryptography.SaveKeychain(path, device)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+	"github.com/odysseyhack/planet-society/protocol/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+const devicePairMutation = `mutation($input: DevicePairInput!) {
+  devicePair(input: $input) { id display_name paired }
+}`
+
+type graphQLRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+type graphQLResponse struct {
+	Data struct {
+		DevicePair *struct {
+			ID          string `json:"id"`
+			DisplayName string `json:"display_name"`
+			Paired      string `json:"paired"`
+		} `json:"devicePair"`
+	} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// pairDevice accepts pairing offer of responder, device keys signed
+// with device keychain are sent to the endpoint given in offer
+func pairDevice(payload, name string, device *cryptography.Keychain) error {
+	var offer models.DevicePairing
+	if err := json.Unmarshal([]byte(payload), &offer); err != nil {
+		return fmt.Errorf("invalid pairing payload: %s", err)
+	}
+
+	input := &models.DevicePairInput{
+		Code:         offer.Code,
+		DisplayName:  name,
+		PublicKey:    models.Key32{Key: device.MainPublicKey},
+		SignatureKey: models.SignatureKey32{Key: device.SignaturePublicKey},
+	}
+	if err := protocol.SignPairing(input, device); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(&graphQLRequest{
+		Query: devicePairMutation,
+		Variables: map[string]interface{}{"input": map[string]string{
+			"code":          input.Code,
+			"display_name":  input.DisplayName,
+			"public_key":    device.MainPublicKey.String(),
+			"signature_key": device.SignaturePublicKey.String(),
+			"signature":     input.Signature,
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.Post(offer.Endpoint, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result graphQLResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("pairing response: %s", err)
+	}
+
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("pairing failed: %s", result.Errors[0].Message)
+	}
+
+	if result.Data.DevicePair == nil {
+		return fmt.Errorf("pairing failed: empty response")
+	}
+
+	log.Infof("paired as device %s (%s) at %s, responder key %s",
+		result.Data.DevicePair.ID, result.Data.DevicePair.DisplayName, result.Data.DevicePair.Paired, offer.ResponderPublicKey.Key.String())
+	return nil
+}
@@ -1,14 +1,58 @@
 package main
 
 import (
+	"flag"
+	"os"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
 	"github.com/odysseyhack/planet-society/protocol/utils"
 	log "github.com/sirupsen/logrus"
 )
 
+var (
+	listen    = flag.String("listen", ":80", "address of notification server")
+	dbPath    = flag.String("db", "notification-server.db", "path to mailboxes database")
+	keys      = flag.String("keychain", "notification-server.keychain", "path to keychain devices prove their box keys to")
+	ttl       = flag.Duration("ttl", time.Minute*10, "time notifications and replies are kept")
+	redeliver = flag.Duration("redeliver", time.Second*30, "time after which notification without reply is delivered again")
+)
+
 func main() {
+	flag.Parse()
 	utils.ConfigureLogger()
-	server := &Server{}
-	if err := server.Listen(":80"); err != nil {
-		log.Fatalln(err)
+
+	keychain, err := loadKeychain(*keys)
+	if err != nil {
+		log.Fatalln("failed to load keychain:", err)
 	}
+
+	store, err := OpenStore(*dbPath, *ttl, *redeliver)
+	if err != nil {
+		log.Fatalln("failed to open mailboxes:", err)
+	}
+	defer store.Close()
+
+	server := NewServer(store, keychain)
+	if err := server.Listen(*listen); err != nil {
+		log.Errorln(err)
+	}
+}
+
+// loadKeychain loads keychain of the server from path, keychain is generated on the first run
+func loadKeychain(path string) (*cryptography.Keychain, error) {
+	keychain, err := cryptography.LoadKeychain(path)
+	if os.IsNotExist(err) {
+		log.Infoln("generating keychain:", path)
+		if keychain, err = cryptography.OneShotKeychain(); err != nil {
+			return nil, err
+		}
+		err = cryptography.SaveKeychain(path, keychain)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infoln("server box key:", keychain.MainPublicKey.String())
+	return keychain, nil
 }
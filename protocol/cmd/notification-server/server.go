@@ -5,27 +5,50 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
-	"github.com/odysseyhack/planet-society/protocol/models"
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/relay"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	maxBodySize   = 64 * 1024
+	sweepInterval = time.Minute
+
+	// maxWait limits time long-poll requests wait for messages
+	maxWait = time.Second * 60
+	// keepAliveInterval is time between comments keeping idle streams open
+	keepAliveInterval = time.Second * 15
 )
 
 type Server struct {
-	notification *models.PermissionNotificationRequest
-	reply        *models.PermissionNotificationResponse
-	server       *http.Server
+	store *Store
+	// keychain box key receives proofs of device registrations
+	keychain *cryptography.Keychain
+	server   *http.Server
+	waiters  *waiters
+	quit     chan struct{}
+}
+
+// NewServer creates notification server keeping mailboxes in store, devices prove their keys to keychain
+func NewServer(store *Store, keychain *cryptography.Keychain) *Server {
+	return &Server{store: store, keychain: keychain, waiters: newWaiters(), quit: make(chan struct{})}
 }
 
 func (s *Server) Listen(addr string) error {
+	// write timeout is not set because long-poll requests and streams keep responses open
 	s.server = &http.Server{
-		Addr:         addr,
-		WriteTimeout: time.Second * 15,
-		ReadTimeout:  time.Second * 15,
-		IdleTimeout:  time.Second * 60,
-		Handler:      s.createRouter(),
+		Addr:        addr,
+		ReadTimeout: time.Second * 15,
+		IdleTimeout: time.Second * 60,
+		Handler:     s.createRouter(),
 	}
 
+	go s.sweepLoop()
 	if err := s.server.ListenAndServe(); err != http.ErrServerClosed {
 		return err
 	}
@@ -33,87 +56,436 @@ func (s *Server) Listen(addr string) error {
 }
 
 func (s *Server) Stop() error {
+	close(s.quit)
 	return s.server.Close()
 }
 
 func (s *Server) createRouter() *mux.Router {
 	router := mux.NewRouter()
-	router.HandleFunc("/notification-get", s.notificationGet)
-	router.HandleFunc("/notification-put", s.notificationPut)
-	router.HandleFunc("/reply-put", s.replyPut)
-	router.HandleFunc("/reply-get", s.replyGet)
+	router.HandleFunc("/server-key", s.serverKey).Methods(http.MethodGet)
+	router.HandleFunc("/device-register", s.deviceRegister).Methods(http.MethodPost)
+	router.HandleFunc("/notification-get", s.notificationGet).Methods(http.MethodGet)
+	router.HandleFunc("/notification-stream", s.notificationStream).Methods(http.MethodGet)
+	router.HandleFunc("/notification-put", s.notificationPut).Methods(http.MethodPost)
+	router.HandleFunc("/reply-put", s.replyPut).Methods(http.MethodPost)
+	router.HandleFunc("/reply-get", s.replyGet).Methods(http.MethodGet)
+	router.HandleFunc("/reply-stream", s.replyStream).Methods(http.MethodGet)
 	return router
 }
 
+// sweepLoop removes expired messages until server is stopped
+func (s *Server) sweepLoop() {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			removed, err := s.store.Sweep(now)
+			if err != nil {
+				log.Warningln("sweep failed:", err)
+			} else if removed > 0 {
+				log.Infof("removed %d expired messages", removed)
+			}
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+func (s *Server) serverKey(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, &relay.ServerKey{PublicKey: s.keychain.MainPublicKey.String()})
+}
+
+func (s *Server) deviceRegister(w http.ResponseWriter, r *http.Request) {
+	body, err := readBody(w, r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var registration relay.Registration
+	if err := json.Unmarshal(body, &registration); err != nil {
+		writeError(w, relay.ErrInvalidRegistration)
+		return
+	}
+
+	publicKey, signatureKey, err := relay.VerifyRegistration(&registration, s.keychain, time.Now())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	token, err := s.store.Register(publicKey, signatureKey, time.Now())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	log.Infoln("registered device:", registration.PublicKey)
+	writeJSON(w, &relay.RegistrationResult{Token: token})
+}
+
+// notificationGet returns notifications of device. Without cursor notifications not
+// replied are delivered again after redelivery interval, with cursor notifications
+// put after it are returned. Request given wait waits up to wait seconds for notification.
 func (s *Server) notificationGet(w http.ResponseWriter, r *http.Request) {
-	defer r.Body.Close()
-	if s.notification == nil {
-		fmt.Println(time.Now().Format(time.RFC3339), "notificationGet: no data")
-		w.WriteHeader(http.StatusInternalServerError)
+	device, err := s.store.Device(bearerToken(r))
+	if err != nil {
+		writeError(w, err)
 		return
 	}
 
-	data, err := json.Marshal(s.notification)
+	cursor, hasCursor, err := cursorParam(r)
 	if err != nil {
-		fmt.Println(time.Now().Format(time.RFC3339), "notificationGet: unmarshal", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	fmt.Println(time.Now().Format(time.RFC3339), "writing notification")
-	s.notification = nil
-	_, _ = w.Write(data)
+
+	wait, err := waitParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	deadline := time.After(wait)
+	for {
+		wake, done := s.waiters.wait(device.PublicKey.String())
+		var messages []relay.Message
+		if hasCursor {
+			messages, err = s.store.Since(device.PublicKey, cursor, time.Now())
+		} else {
+			messages, err = s.store.Pending(device.PublicKey, time.Now())
+		}
+
+		if err != nil || len(messages) > 0 || wait == 0 {
+			done()
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+
+			if messages == nil {
+				messages = []relay.Message{}
+			}
+			writeJSON(w, messages)
+			return
+		}
+
+		select {
+		case <-wake:
+			done()
+		case <-deadline:
+			done()
+			writeJSON(w, []relay.Message{})
+			return
+		case <-r.Context().Done():
+			done()
+			return
+		}
+	}
+}
+
+// notificationStream streams notifications of device as Server-Sent Events, event ID
+// is notification cursor so reconnecting client resumes with Last-Event-ID header
+func (s *Server) notificationStream(w http.ResponseWriter, r *http.Request) {
+	device, err := s.store.Device(bearerToken(r))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	cursor, _, err := cursorParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := startStream(w)
+	if !ok {
+		return
+	}
+
+	wake, done := s.waiters.wait(device.PublicKey.String())
+	defer done()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		messages, err := s.store.Since(device.PublicKey, cursor, time.Now())
+		if err != nil {
+			log.Warningln("notification stream failed:", err)
+			return
+		}
+
+		for i := range messages {
+			if err := writeEvent(w, "notification", &messages[i]); err != nil {
+				return
+			}
+			cursor = messages[i].Cursor
+		}
+		flusher.Flush()
+
+		select {
+		case <-wake:
+		case <-keepAlive.C:
+			if _, err := w.Write([]byte(": keep-alive\n\n")); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-s.quit:
+			return
+		}
+	}
 }
 
 func (s *Server) notificationPut(w http.ResponseWriter, r *http.Request) {
-	defer r.Body.Close()
-	data, err := ioutil.ReadAll(r.Body)
+	device, err := cryptography.Key32FromString(r.URL.Query().Get("device"))
+	if err != nil {
+		writeError(w, relay.ErrUnknownDevice)
+		return
+	}
+
+	transactionID := r.URL.Query().Get("transaction")
+	if transactionID == "" {
+		writeError(w, relay.ErrUnknownTransaction)
+		return
+	}
+
+	body, err := readBody(w, r)
 	if err != nil {
-		fmt.Println(time.Now().Format(time.RFC3339), "notificationGet: read err", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
-	var notification models.PermissionNotificationRequest
-	if err := json.Unmarshal(data, &notification); err != nil {
-		fmt.Println(time.Now().Format(time.RFC3339), "notificationGet: Unmarshal err", err)
-		w.WriteHeader(http.StatusInternalServerError)
+	replyToken, err := s.store.Put(device, transactionID, body, time.Now())
+	if err != nil {
+		writeError(w, err)
 		return
 	}
-	fmt.Println(time.Now().Format(time.RFC3339), "put new notification")
-	s.notification = &notification
+	s.waiters.wake(device.String())
+	log.Infoln("put notification of transaction:", transactionID)
+	writeJSON(w, &relay.PutResult{ReplyToken: replyToken})
 }
 
 func (s *Server) replyPut(w http.ResponseWriter, r *http.Request) {
-	defer r.Body.Close()
-	data, err := ioutil.ReadAll(r.Body)
+	device, err := s.store.Device(bearerToken(r))
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
-	var reply models.PermissionNotificationResponse
-	if err := json.Unmarshal(data, &reply); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+	body, err := readBody(w, r)
+	if err != nil {
+		writeError(w, err)
 		return
 	}
-	fmt.Println(time.Now().Format(time.RFC3339), "put new reply")
 
-	s.reply = &reply
+	transactionID := r.URL.Query().Get("transaction")
+	if err := s.store.Reply(device.PublicKey, transactionID, body, time.Now()); err != nil {
+		writeError(w, err)
+		return
+	}
+	s.waiters.wake(replyKey(device.PublicKey, transactionID))
+	log.Infoln("put reply of transaction:", transactionID)
+	w.WriteHeader(http.StatusOK)
 }
 
+// replyGet returns reply of device to notification of transaction, request
+// given wait waits up to wait seconds for reply
 func (s *Server) replyGet(w http.ResponseWriter, r *http.Request) {
-	defer r.Body.Close()
-	if s.reply == nil {
-		w.WriteHeader(http.StatusInternalServerError)
+	device, err := cryptography.Key32FromString(r.URL.Query().Get("device"))
+	if err != nil {
+		writeError(w, relay.ErrUnknownDevice)
+		return
+	}
+
+	wait, err := waitParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	data, err := json.Marshal(s.reply)
+	payload, err := s.waitReply(r, device, time.After(wait))
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, err)
+		return
+	}
+	_, _ = w.Write(payload)
+}
+
+// replyStream waits for reply of device to notification of transaction and sends
+// it as single Server-Sent Event, stream is closed after the reply
+func (s *Server) replyStream(w http.ResponseWriter, r *http.Request) {
+	device, err := cryptography.Key32FromString(r.URL.Query().Get("device"))
+	if err != nil {
+		writeError(w, relay.ErrUnknownDevice)
+		return
+	}
+
+	// fail before stream is started if reply cannot come
+	transactionID := r.URL.Query().Get("transaction")
+	payload, err := s.store.ReplyGet(device, transactionID, bearerToken(r), time.Now())
+	if err != nil && err != relay.ErrNoReply {
+		writeError(w, err)
 		return
 	}
 
-	s.reply = nil
+	flusher, ok := startStream(w)
+	if !ok {
+		return
+	}
+
+	if err == relay.ErrNoReply {
+		if payload, err = s.waitReply(r, device, time.After(s.store.ttl)); err != nil {
+			_ = writeEvent(w, "error", err.Error())
+			flusher.Flush()
+			return
+		}
+	}
+
+	message := relay.Message{TransactionID: transactionID, Payload: payload, Created: time.Now().Format(time.RFC3339)}
+	_ = writeEvent(w, "reply", &message)
+	flusher.Flush()
+}
+
+// waitReply reads reply until it comes, deadline passes or request is cancelled
+func (s *Server) waitReply(r *http.Request, device cryptography.Key32, deadline <-chan time.Time) ([]byte, error) {
+	transactionID := r.URL.Query().Get("transaction")
+	for {
+		wake, done := s.waiters.wait(replyKey(device, transactionID))
+		payload, err := s.store.ReplyGet(device, transactionID, bearerToken(r), time.Now())
+		if err != relay.ErrNoReply {
+			done()
+			return payload, err
+		}
+
+		select {
+		case <-wake:
+			done()
+		case <-deadline:
+			done()
+			return nil, relay.ErrNoReply
+		case <-r.Context().Done():
+			done()
+			return nil, relay.ErrNoReply
+		case <-s.quit:
+			done()
+			return nil, relay.ErrNoReply
+		}
+	}
+}
+
+func replyKey(device cryptography.Key32, transactionID string) string {
+	return device.String() + "/" + transactionID
+}
+
+// cursorParam returns cursor given in Last-Event-ID header or cursor parameter
+func cursorParam(r *http.Request) (cursor uint64, ok bool, err error) {
+	raw := r.Header.Get("Last-Event-ID")
+	if raw == "" {
+		raw = r.URL.Query().Get("cursor")
+	}
+
+	if raw == "" {
+		return 0, false, nil
+	}
+
+	if cursor, err = strconv.ParseUint(raw, 10, 64); err != nil {
+		return 0, false, fmt.Errorf("invalid cursor %q", raw)
+	}
+	return cursor, true, nil
+}
+
+// waitParam returns time request waits for messages given in seconds, at most maxWait
+func waitParam(r *http.Request) (time.Duration, error) {
+	raw := r.URL.Query().Get("wait")
+	if raw == "" {
+		return 0, nil
+	}
+
+	seconds, err := strconv.Atoi(raw)
+	if err != nil || seconds < 0 {
+		return 0, fmt.Errorf("invalid wait %q", raw)
+	}
+
+	wait := time.Second * time.Duration(seconds)
+	if wait > maxWait {
+		wait = maxWait
+	}
+	return wait, nil
+}
+
+func startStream(w http.ResponseWriter) (http.Flusher, bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	return flusher, true
+}
+
+// writeEvent writes Server-Sent Event with JSON encoded data, messages with cursor set event ID
+func writeEvent(w http.ResponseWriter, event string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	if message, ok := value.(*relay.Message); ok && message.Cursor != 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", message.Cursor); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
+
+func bearerToken(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	defer r.Body.Close()
+	return ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
 	_, _ = w.Write(data)
 }
+
+// writeError reports relay errors with their text so clients can recognize them
+func writeError(w http.ResponseWriter, err error) {
+	switch err {
+	case relay.ErrNoReply:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case relay.ErrUnauthorized:
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case relay.ErrKeyTaken, relay.ErrTransactionPending:
+		http.Error(w, err.Error(), http.StatusConflict)
+	case relay.ErrUnknownDevice, relay.ErrUnknownTransaction:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		if strings.HasPrefix(err.Error(), relay.ErrInvalidRegistration.Error()) ||
+			strings.HasPrefix(err.Error(), relay.ErrRegistrationExpired.Error()) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Warningln("request failed:", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+}
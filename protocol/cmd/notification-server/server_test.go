@@ -1,12 +1,71 @@
 package main
 
 import (
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/relay"
 )
 
+func testStore(t *testing.T, redeliver time.Duration) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "notification")
+	if err != nil {
+		t.Fatalf("failed to create temporary dir: %s", err)
+	}
+
+	store, err := OpenStore(filepath.Join(dir, "db"), time.Minute, redeliver)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("OpenStore() failed: %s", err)
+	}
+	return store, func() {
+		store.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func testKeychain(t *testing.T) *cryptography.Keychain {
+	keychain, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+	return keychain
+}
+
+// testServerKey returns box key registrations are proven to
+func testServerKey(t *testing.T, client *relay.Client) cryptography.Key32 {
+	key, err := client.ServerKey()
+	if err != nil {
+		t.Fatalf("ServerKey() failed: %s", err)
+	}
+	return key
+}
+
+func testDevice(t *testing.T, client *relay.Client) (*cryptography.Keychain, string) {
+	keychain := testKeychain(t)
+	registration, err := relay.NewRegistration(keychain, testServerKey(t, client), time.Now())
+	if err != nil {
+		t.Fatalf("NewRegistration() failed: %s", err)
+	}
+
+	token, err := client.Register(registration)
+	if err != nil {
+		t.Fatalf("Register() failed: %s", err)
+	}
+	return keychain, token
+}
+
 func TestServerClose(t *testing.T) {
-	server := Server{}
+	store, cleanup := testStore(t, time.Second)
+	defer cleanup()
+
+	server := NewServer(store, testKeychain(t))
 	done := make(chan bool)
 	go func() {
 		server.Listen(":12121")
@@ -25,3 +84,233 @@ func TestServerNewRouter(t *testing.T) {
 		t.Errorf("router creation failed")
 	}
 }
+
+func TestServerMailboxes(t *testing.T) {
+	store, cleanup := testStore(t, time.Hour)
+	defer cleanup()
+
+	relayServer := httptest.NewServer(NewServer(store, testKeychain(t)).createRouter())
+	defer relayServer.Close()
+	client := relay.NewClient(relayServer.URL)
+
+	first, firstToken := testDevice(t, client)
+	second, secondToken := testDevice(t, client)
+
+	if _, err := client.Put(cryptography.RandomKey32(), "transaction", []byte("payload")); err != relay.ErrUnknownDevice {
+		t.Errorf("Put() to unknown device returned %v", err)
+	}
+
+	firstReply, err := client.Put(first.MainPublicKey, "first", []byte("first payload"))
+	if err != nil {
+		t.Fatalf("Put() failed: %s", err)
+	}
+
+	secondReply, err := client.Put(second.MainPublicKey, "second", []byte("second payload"))
+	if err != nil {
+		t.Fatalf("Put() failed: %s", err)
+	}
+
+	messages, err := client.Notifications(firstToken)
+	if err != nil {
+		t.Fatalf("Notifications() failed: %s", err)
+	}
+
+	if len(messages) != 1 || messages[0].TransactionID != "first" || string(messages[0].Payload) != "first payload" {
+		t.Fatalf("Notifications() returned %+v", messages)
+	}
+
+	if messages, err := client.Notifications(firstToken); err != nil || len(messages) != 0 {
+		t.Errorf("Notifications() returned %+v %v, expected no redelivery", messages, err)
+	}
+
+	if _, err := client.Notifications("invalid"); err != relay.ErrUnauthorized {
+		t.Errorf("Notifications() with invalid token returned %v", err)
+	}
+
+	if err := client.Reply(firstToken, "second", []byte("hijack")); err != relay.ErrUnknownTransaction {
+		t.Errorf("Reply() to other device notification returned %v", err)
+	}
+
+	if _, err := client.ReplyGet(first.MainPublicKey, "first", firstReply); err != relay.ErrNoReply {
+		t.Errorf("ReplyGet() before reply returned %v", err)
+	}
+
+	if err := client.Reply(firstToken, "first", []byte("accepted")); err != nil {
+		t.Fatalf("Reply() failed: %s", err)
+	}
+
+	if _, err := client.ReplyGet(first.MainPublicKey, "first", secondReply); err != relay.ErrUnauthorized {
+		t.Errorf("ReplyGet() with other reply token returned %v", err)
+	}
+
+	reply, err := client.ReplyGet(first.MainPublicKey, "first", firstReply)
+	if err != nil || string(reply) != "accepted" {
+		t.Errorf("ReplyGet() returned %q %v", reply, err)
+	}
+
+	if _, err := client.ReplyGet(first.MainPublicKey, "first", firstReply); err != relay.ErrUnknownTransaction {
+		t.Errorf("second ReplyGet() returned %v", err)
+	}
+
+	if messages, err := client.Notifications(secondToken); err != nil || len(messages) != 1 {
+		t.Errorf("Notifications() of second device returned %+v %v", messages, err)
+	}
+}
+
+func TestServerRegistration(t *testing.T) {
+	store, cleanup := testStore(t, time.Hour)
+	defer cleanup()
+
+	relayServer := httptest.NewServer(NewServer(store, testKeychain(t)).createRouter())
+	defer relayServer.Close()
+	client := relay.NewClient(relayServer.URL)
+
+	keychain, token := testDevice(t, client)
+	server := testServerKey(t, client)
+
+	registration, err := relay.NewRegistration(keychain, server, time.Now().Add(-relay.RegistrationWindow*2))
+	if err != nil {
+		t.Fatalf("NewRegistration() failed: %s", err)
+	}
+	if _, err := client.Register(registration); err != relay.ErrRegistrationExpired {
+		t.Errorf("Register() of expired registration returned %v", err)
+	}
+
+	registration, err = relay.NewRegistration(keychain, server, time.Now())
+	if err != nil {
+		t.Fatalf("NewRegistration() failed: %s", err)
+	}
+	registration.Created = time.Now().Add(time.Second).UTC().Format(time.RFC3339)
+	if _, err := client.Register(registration); err != relay.ErrInvalidRegistration {
+		t.Errorf("Register() of tampered registration returned %v", err)
+	}
+
+	// box key of device is public, other key can't prove it
+	other := testKeychain(t)
+	other.MainPublicKey = keychain.MainPublicKey
+	registration, err = relay.NewRegistration(other, server, time.Now())
+	if err != nil {
+		t.Fatalf("NewRegistration() failed: %s", err)
+	}
+	if _, err := client.Register(registration); err != relay.ErrInvalidRegistration {
+		t.Errorf("Register() of mailbox without its box key returned %v", err)
+	}
+
+	other.MainPrivateKey = keychain.MainPrivateKey
+	registration, err = relay.NewRegistration(other, server, time.Now())
+	if err != nil {
+		t.Fatalf("NewRegistration() failed: %s", err)
+	}
+	if _, err := client.Register(registration); err != relay.ErrKeyTaken {
+		t.Errorf("Register() of taken mailbox returned %v", err)
+	}
+
+	registration, err = relay.NewRegistration(keychain, server, time.Now())
+	if err != nil {
+		t.Fatalf("NewRegistration() failed: %s", err)
+	}
+	renewed, err := client.Register(registration)
+	if err != nil {
+		t.Fatalf("Register() renewal failed: %s", err)
+	}
+
+	if _, err := client.Notifications(token); err != relay.ErrUnauthorized {
+		t.Errorf("Notifications() with replaced token returned %v", err)
+	}
+
+	if _, err := client.Notifications(renewed); err != nil {
+		t.Errorf("Notifications() with renewed token returned %v", err)
+	}
+}
+
+func TestServerLongPoll(t *testing.T) {
+	store, cleanup := testStore(t, time.Hour)
+	defer cleanup()
+
+	relayServer := httptest.NewServer(NewServer(store, testKeychain(t)).createRouter())
+	defer relayServer.Close()
+	client := relay.NewClient(relayServer.URL)
+
+	device, token := testDevice(t, client)
+
+	replyTokens := make(chan string, 1)
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		replyToken, err := client.Put(device.MainPublicKey, "transaction", []byte("payload"))
+		if err != nil {
+			t.Errorf("Put() failed: %s", err)
+		}
+		replyTokens <- replyToken
+	}()
+
+	started := time.Now()
+	messages, err := client.NotificationsSince(token, 0, time.Second*10)
+	if err != nil || len(messages) != 1 || messages[0].Cursor == 0 {
+		t.Fatalf("NotificationsSince() returned %+v %v", messages, err)
+	}
+
+	if elapsed := time.Since(started); elapsed > time.Second*5 {
+		t.Errorf("NotificationsSince() woke after %s", elapsed)
+	}
+
+	if messages, err := client.NotificationsSince(token, messages[0].Cursor, time.Second); err != nil || len(messages) != 0 {
+		t.Errorf("NotificationsSince() after last cursor returned %+v %v", messages, err)
+	}
+
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		if err := client.Reply(token, "transaction", []byte("accepted")); err != nil {
+			t.Errorf("Reply() failed: %s", err)
+		}
+	}()
+
+	reply, err := client.ReplyWait(device.MainPublicKey, "transaction", <-replyTokens, time.Second*10)
+	if err != nil || string(reply) != "accepted" {
+		t.Errorf("ReplyWait() returned %q %v", reply, err)
+	}
+}
+
+func TestServerStream(t *testing.T) {
+	store, cleanup := testStore(t, time.Hour)
+	defer cleanup()
+
+	relayServer := httptest.NewServer(NewServer(store, testKeychain(t)).createRouter())
+	defer relayServer.Close()
+	client := relay.NewClient(relayServer.URL)
+
+	device, token := testDevice(t, client)
+	for _, transactionID := range []string{"first", "second"} {
+		if _, err := client.Put(device.MainPublicKey, transactionID, []byte(transactionID)); err != nil {
+			t.Fatalf("Put() failed: %s", err)
+		}
+	}
+
+	stop := fmt.Errorf("stop")
+	var received []string
+	cursor, err := client.StreamNotifications(token, 0, func(message *relay.Message) error {
+		if message.TransactionID == "second" {
+			return stop
+		}
+		received = append(received, message.TransactionID)
+		return nil
+	})
+	if err != stop || len(received) != 1 || received[0] != "first" {
+		t.Fatalf("StreamNotifications() received %v, error %v", received, err)
+	}
+
+	// notification put while device is disconnected is received after resumption
+	if _, err := client.Put(device.MainPublicKey, "third", []byte("third")); err != nil {
+		t.Fatalf("Put() failed: %s", err)
+	}
+
+	_, err = client.StreamNotifications(token, cursor, func(message *relay.Message) error {
+		received = append(received, message.TransactionID)
+		if len(received) == 3 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || len(received) != 3 || received[1] != "second" || received[2] != "third" {
+		t.Errorf("resumed StreamNotifications() received %v, error %v", received, err)
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"sort"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/relay"
+)
+
+const (
+	bucketDevices       = "devices"
+	bucketTokens        = "tokens"
+	bucketNotifications = "notifications"
+	bucketReplies       = "replies"
+)
+
+// Device is registered mailbox
+type Device struct {
+	PublicKey    cryptography.Key32
+	SignatureKey cryptography.Key32
+	TokenHash    [sha256.Size]byte
+	Registered   time.Time
+}
+
+// Notification waits in device mailbox until device replies or it expires
+type Notification struct {
+	// Seq orders notifications, it is cursor of resumed streams
+	Seq            uint64
+	TransactionID  string
+	Payload        []byte
+	ReplyTokenHash [sha256.Size]byte
+	Created        time.Time
+	Expires        time.Time
+	// Delivered is time of last delivery, notification is delivered again
+	// if device does not reply within redelivery interval
+	Delivered time.Time
+	Attempts  int
+}
+
+// Reply waits until responder which put notification reads it or it expires
+type Reply struct {
+	Payload        []byte
+	ReplyTokenHash [sha256.Size]byte
+	Created        time.Time
+	Expires        time.Time
+}
+
+// Store keeps mailboxes of devices on disk, bolt transactions make
+// every operation safe for concurrent use
+type Store struct {
+	db        *bolt.DB
+	ttl       time.Duration
+	redeliver time.Duration
+}
+
+// OpenStore opens store at path, notifications and replies are kept for ttl,
+// notifications not replied are delivered again after redeliver
+func OpenStore(path string, ttl, redeliver time.Duration) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range []string{bucketDevices, bucketTokens, bucketNotifications, bucketReplies} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db, ttl: ttl, redeliver: redeliver}, nil
+}
+
+// Close closes store
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Register creates or renews device mailbox and returns new device token,
+// mailbox can be renewed only with the same signature key
+func (s *Store) Register(publicKey, signatureKey cryptography.Key32, now time.Time) (token string, err error) {
+	raw := cryptography.RandomKey32()
+	token = raw.String()
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		devices, tokens := tx.Bucket([]byte(bucketDevices)), tx.Bucket([]byte(bucketTokens))
+
+		var device Device
+		if err := get(devices, publicKey[:], &device); err == nil {
+			if !device.SignatureKey.Equal(signatureKey) {
+				return relay.ErrKeyTaken
+			}
+			if err := tokens.Delete(device.TokenHash[:]); err != nil {
+				return err
+			}
+		}
+
+		device = Device{
+			PublicKey:    publicKey,
+			SignatureKey: signatureKey,
+			TokenHash:    hashToken(token),
+			Registered:   now,
+		}
+		if err := tokens.Put(device.TokenHash[:], publicKey[:]); err != nil {
+			return err
+		}
+		return put(devices, publicKey[:], &device)
+	})
+	return token, err
+}
+
+// Device returns device authenticated by token
+func (s *Store) Device(token string) (device Device, err error) {
+	hash := hashToken(token)
+	err = s.db.View(func(tx *bolt.Tx) error {
+		publicKey := tx.Bucket([]byte(bucketTokens)).Get(hash[:])
+		if publicKey == nil {
+			return relay.ErrUnauthorized
+		}
+		return get(tx.Bucket([]byte(bucketDevices)), publicKey, &device)
+	})
+	return device, err
+}
+
+// Put stores notification of transaction in device mailbox and returns token of reply.
+// Transaction which notification or reply was not expired or read yet is refused,
+// otherwise anyone could replace reply token of the responder.
+func (s *Store) Put(device cryptography.Key32, transactionID string, payload []byte, now time.Time) (replyToken string, err error) {
+	raw := cryptography.RandomKey32()
+	replyToken = raw.String()
+	key := mailboxKey(device, transactionID)
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(bucketDevices)).Get(device[:]) == nil {
+			return relay.ErrUnknownDevice
+		}
+
+		notifications := tx.Bucket([]byte(bucketNotifications))
+		for _, bucket := range []*bolt.Bucket{notifications, tx.Bucket([]byte(bucketReplies))} {
+			var pending struct{ Expires time.Time }
+			if err := get(bucket, key, &pending); err == nil && !now.After(pending.Expires) {
+				return relay.ErrTransactionPending
+			}
+		}
+
+		seq, err := notifications.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		notification := Notification{
+			Seq:            seq,
+			TransactionID:  transactionID,
+			Payload:        payload,
+			ReplyTokenHash: hashToken(replyToken),
+			Created:        now,
+			Expires:        now.Add(s.ttl),
+		}
+		return put(notifications, key, &notification)
+	})
+	return replyToken, err
+}
+
+// Pending returns notifications waiting in device mailbox which were not
+// delivered within redelivery interval and marks them delivered
+func (s *Store) Pending(device cryptography.Key32, now time.Time) ([]relay.Message, error) {
+	return s.deliver(device, now, func(notification *Notification) bool {
+		return now.Sub(notification.Delivered) >= s.redeliver
+	})
+}
+
+// Since returns notifications waiting in device mailbox put after cursor
+// ordered by cursor and marks them delivered
+func (s *Store) Since(device cryptography.Key32, cursor uint64, now time.Time) ([]relay.Message, error) {
+	messages, err := s.deliver(device, now, func(notification *Notification) bool {
+		return notification.Seq > cursor
+	})
+	sort.Slice(messages, func(i, j int) bool { return messages[i].Cursor < messages[j].Cursor })
+	return messages, err
+}
+
+// deliver returns not expired notifications of device selected by filter and marks them delivered
+func (s *Store) deliver(device cryptography.Key32, now time.Time, filter func(notification *Notification) bool) (messages []relay.Message, err error) {
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(bucketNotifications))
+		prefix := mailboxKey(device, "")
+
+		var delivered [][]byte
+		var notifications []Notification
+		cursor := bucket.Cursor()
+		for k, v := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = cursor.Next() {
+			var notification Notification
+			if err := gob.NewDecoder(bytes.NewReader(v)).Decode(&notification); err != nil {
+				return err
+			}
+
+			if now.After(notification.Expires) || !filter(&notification) {
+				continue
+			}
+
+			messages = append(messages, relay.Message{
+				Cursor:        notification.Seq,
+				TransactionID: notification.TransactionID,
+				Payload:       notification.Payload,
+				Created:       notification.Created.Format(time.RFC3339),
+			})
+			notification.Delivered = now
+			notification.Attempts++
+			delivered = append(delivered, append([]byte(nil), k...))
+			notifications = append(notifications, notification)
+		}
+
+		for i := range delivered {
+			if err := put(bucket, delivered[i], &notifications[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return messages, err
+}
+
+// Reply stores device reply to notification of transaction and removes notification
+func (s *Store) Reply(device cryptography.Key32, transactionID string, payload []byte, now time.Time) error {
+	key := mailboxKey(device, transactionID)
+	return s.db.Update(func(tx *bolt.Tx) error {
+		notifications := tx.Bucket([]byte(bucketNotifications))
+
+		var notification Notification
+		if err := get(notifications, key, &notification); err != nil || now.After(notification.Expires) {
+			return relay.ErrUnknownTransaction
+		}
+
+		reply := Reply{
+			Payload:        payload,
+			ReplyTokenHash: notification.ReplyTokenHash,
+			Created:        now,
+			Expires:        now.Add(s.ttl),
+		}
+		if err := put(tx.Bucket([]byte(bucketReplies)), key, &reply); err != nil {
+			return err
+		}
+		return notifications.Delete(key)
+	})
+}
+
+// ReplyGet returns and removes reply to notification of transaction, relay.ErrNoReply
+// is returned when notification still waits for reply
+func (s *Store) ReplyGet(device cryptography.Key32, transactionID, replyToken string, now time.Time) (payload []byte, err error) {
+	key := mailboxKey(device, transactionID)
+	hash := hashToken(replyToken)
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		replies := tx.Bucket([]byte(bucketReplies))
+
+		var reply Reply
+		if err := get(replies, key, &reply); err == nil && !now.After(reply.Expires) {
+			if reply.ReplyTokenHash != hash {
+				return relay.ErrUnauthorized
+			}
+			payload = reply.Payload
+			return replies.Delete(key)
+		}
+
+		var notification Notification
+		if err := get(tx.Bucket([]byte(bucketNotifications)), key, &notification); err != nil || now.After(notification.Expires) {
+			return relay.ErrUnknownTransaction
+		}
+
+		if notification.ReplyTokenHash != hash {
+			return relay.ErrUnauthorized
+		}
+		return relay.ErrNoReply
+	})
+	return payload, err
+}
+
+// Sweep removes expired notifications and replies
+func (s *Store) Sweep(now time.Time) (removed int, err error) {
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{bucketNotifications, bucketReplies} {
+			count, err := sweepBucket(tx.Bucket([]byte(name)), now)
+			if err != nil {
+				return err
+			}
+			removed += count
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// sweepBucket removes expired messages, only expiration of message is decoded
+func sweepBucket(bucket *bolt.Bucket, now time.Time) (int, error) {
+	var expired [][]byte
+	err := bucket.ForEach(func(k, v []byte) error {
+		var message struct{ Expires time.Time }
+		if err := gob.NewDecoder(bytes.NewReader(v)).Decode(&message); err != nil {
+			return err
+		}
+		if now.After(message.Expires) {
+			expired = append(expired, append([]byte(nil), k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, k := range expired {
+		if err := bucket.Delete(k); err != nil {
+			return 0, err
+		}
+	}
+	return len(expired), nil
+}
+
+// mailboxKey orders messages of single device together
+func mailboxKey(device cryptography.Key32, transactionID string) []byte {
+	return append(append([]byte(nil), device[:]...), []byte(transactionID)...)
+}
+
+func hashToken(token string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(token))
+}
+
+func put(bucket *bolt.Bucket, key []byte, value interface{}) error {
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(value); err != nil {
+		return err
+	}
+	return bucket.Put(key, buffer.Bytes())
+}
+
+func get(bucket *bolt.Bucket, key []byte, value interface{}) error {
+	data := bucket.Get(key)
+	if data == nil {
+		return relay.ErrUnknownTransaction
+	}
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(value)
+}
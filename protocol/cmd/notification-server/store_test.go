@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/relay"
+)
+
+func TestStoreRedeliveryAndTTL(t *testing.T) {
+	store, cleanup := testStore(t, time.Second*10)
+	defer cleanup()
+
+	now := time.Now()
+	device := cryptography.RandomKey32()
+	if _, err := store.Register(device, cryptography.RandomKey32(), now); err != nil {
+		t.Fatalf("Register() failed: %s", err)
+	}
+
+	if _, err := store.Put(device, "transaction", []byte("payload"), now); err != nil {
+		t.Fatalf("Put() failed: %s", err)
+	}
+
+	for _, test := range []struct {
+		after    time.Duration
+		expected int
+	}{
+		{0, 1},
+		{time.Second * 5, 0},
+		{time.Second * 10, 1},
+		{time.Minute * 2, 0},
+	} {
+		messages, err := store.Pending(device, now.Add(test.after))
+		if err != nil {
+			t.Fatalf("Pending() failed: %s", err)
+		}
+
+		if len(messages) != test.expected {
+			t.Errorf("Pending() after %s returned %d messages, expected %d", test.after, len(messages), test.expected)
+		}
+	}
+
+	removed, err := store.Sweep(now.Add(time.Minute * 2))
+	if err != nil || removed != 1 {
+		t.Errorf("Sweep() removed %d messages, error %v", removed, err)
+	}
+}
+
+func TestStoreConcurrent(t *testing.T) {
+	store, cleanup := testStore(t, time.Hour)
+	defer cleanup()
+
+	now := time.Now()
+	device := cryptography.RandomKey32()
+	if _, err := store.Register(device, cryptography.RandomKey32(), now); err != nil {
+		t.Fatalf("Register() failed: %s", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			transactionID := fmt.Sprintf("transaction-%d", i)
+			replyToken, err := store.Put(device, transactionID, []byte(transactionID), now)
+			if err != nil {
+				t.Errorf("Put() failed: %s", err)
+				return
+			}
+
+			if err := store.Reply(device, transactionID, []byte(transactionID), now); err != nil {
+				t.Errorf("Reply() failed: %s", err)
+				return
+			}
+
+			reply, err := store.ReplyGet(device, transactionID, replyToken, now)
+			if err != nil || string(reply) != transactionID {
+				t.Errorf("ReplyGet() returned %q %v, expected %q", reply, err, transactionID)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestStorePutPending(t *testing.T) {
+	store, cleanup := testStore(t, time.Minute)
+	defer cleanup()
+
+	now := time.Now()
+	device := cryptography.RandomKey32()
+	if _, err := store.Register(device, cryptography.RandomKey32(), now); err != nil {
+		t.Fatalf("Register() failed: %s", err)
+	}
+
+	replyToken, err := store.Put(device, "transaction", []byte("payload"), now)
+	if err != nil {
+		t.Fatalf("Put() failed: %s", err)
+	}
+
+	if _, err := store.Put(device, "transaction", []byte("other"), now); err != relay.ErrTransactionPending {
+		t.Errorf("Put() of pending notification returned %v", err)
+	}
+
+	if err := store.Reply(device, "transaction", []byte("reply"), now); err != nil {
+		t.Fatalf("Reply() failed: %s", err)
+	}
+
+	if _, err := store.Put(device, "transaction", []byte("other"), now); err != relay.ErrTransactionPending {
+		t.Errorf("Put() of notification with unread reply returned %v", err)
+	}
+
+	if payload, err := store.ReplyGet(device, "transaction", replyToken, now); err != nil || string(payload) != "reply" {
+		t.Errorf("ReplyGet() returned %q %v", payload, err)
+	}
+
+	if _, err := store.Put(device, "transaction", []byte("again"), now); err != nil {
+		t.Errorf("Put() after reply was read failed: %s", err)
+	}
+
+	if _, err := store.Put(device, "expired", []byte("payload"), now); err != nil {
+		t.Fatalf("Put() failed: %s", err)
+	}
+	if _, err := store.Put(device, "expired", []byte("payload"), now.Add(time.Minute*2)); err != nil {
+		t.Errorf("Put() over expired notification failed: %s", err)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"sync"
+)
+
+// waiters wakes long-poll and stream requests waiting for messages.
+// Requests register before reading store so no message put in between is missed.
+type waiters struct {
+	sync.Mutex
+	waiting map[string]map[chan struct{}]struct{}
+}
+
+func newWaiters() *waiters {
+	return &waiters{waiting: make(map[string]map[chan struct{}]struct{})}
+}
+
+// wait registers waiter of key, returned function unregisters it
+func (w *waiters) wait(key string) (chan struct{}, func()) {
+	w.Lock()
+	defer w.Unlock()
+
+	wake := make(chan struct{}, 1)
+	if w.waiting[key] == nil {
+		w.waiting[key] = make(map[chan struct{}]struct{})
+	}
+	w.waiting[key][wake] = struct{}{}
+
+	return wake, func() {
+		w.Lock()
+		defer w.Unlock()
+		delete(w.waiting[key], wake)
+		if len(w.waiting[key]) == 0 {
+			delete(w.waiting, key)
+		}
+	}
+}
+
+// wake wakes all waiters of key, waiter already woken stays woken once
+func (w *waiters) wake(key string) {
+	w.Lock()
+	defer w.Unlock()
+	for wake := range w.waiting[key] {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
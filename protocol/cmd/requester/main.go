@@ -3,17 +3,19 @@ package main
 import (
 	"bytes"
 	"encoding/gob"
-	"encoding/hex"
+	"encoding/json"
+	"flag"
 	"fmt"
-	"net/url"
+	"io/ioutil"
 	"os"
-
-	"github.com/odysseyhack/planet-society/protocol/utils"
+	"path/filepath"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/odysseyhack/planet-society/protocol/cryptography"
 	"github.com/odysseyhack/planet-society/protocol/models"
 	"github.com/odysseyhack/planet-society/protocol/protocol"
+	sdk "github.com/odysseyhack/planet-society/protocol/requester"
 	"github.com/odysseyhack/planet-society/protocol/transport"
 )
 
@@ -41,22 +43,43 @@ query {
 `
 
 const (
-	responderAddress = ":15000"
-	requester        = "John Smith"
+	requester     = "John Smith"
+	legalTemplate = "digital-telecommunication-agreement"
+)
+
+var (
+	keychainFile     = flag.String("keychain", "", "path to requester keychain, created if it does not exist")
+	certificatesFile = flag.String("certificates", "", "path to requester certificate chain")
+	requesterName    = flag.String("name", requester, "requester name")
+	listenAddress    = flag.String("listen", "", "address serving data subject requests after transaction, e.g. :15001")
+	storeFile        = flag.String("store", "", "path to encrypted store of received data, temporary if not set")
+	retentionDays    = flag.Int("retention", 30, "days received data is kept, 0 keeps it until revocation")
+	responderAddress = flag.String("responder", "http://127.0.0.1:15000", "address of responder serving discovery document")
+	pinsFile         = flag.String("pins", defaultPinsFile(), "path to keys of responders pinned on first use")
+	purpose          = flag.String("purpose", "conclusion and performance of the telecommunication agreement", "purpose of data processing")
 )
 
 type Context struct {
 	keychain           *cryptography.Keychain
 	transactionID      *cryptography.Key32
 	responderPublicKey *cryptography.Key32
+	// responderSignatureKey is bound to received data, data subject requests have to be signed with it
+	responderSignatureKey cryptography.Key32
+	responderEndpoint     string
+	version               int
+	encryption            string
+	certificates          []string
+	store                 *sdk.Store
 }
 
 func main() {
+	flag.Parse()
 	fmt.Println("-> generating transaction context")
 	ctx, err := createContext()
 	if err != nil {
 		fail("-> generating transaction context failed:", err)
 	}
+	defer ctx.store.Close()
 	fmt.Println("-> connecting to the responder")
 
 	conn, err := connectToResponder(ctx)
@@ -80,11 +103,21 @@ func main() {
 		fmt.Println("-> transaction failed:", err)
 		os.Exit(1)
 	}
+
+	if *listenAddress != "" {
+		if err := serveDataSubjects(ctx); err != nil {
+			fmt.Println("-> serving data subject requests failed:", err)
+			os.Exit(1)
+		}
+	}
+}
+
+func defaultPinsFile() string {
+	return filepath.Join(os.Getenv("HOME"), ".planet-requester-pins.json")
 }
 
 func connectToResponder(ctx *Context) (*Transport, error) {
-	u := url.URL{Scheme: "ws", Host: responderAddress, Path: "/"}
-	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	conn, _, err := websocket.DefaultDialer.Dial(ctx.responderEndpoint, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -93,22 +126,92 @@ func connectToResponder(ctx *Context) (*Transport, error) {
 }
 
 func createContext() (*Context, error) {
-	k, err := cryptography.OneShotKeychain()
+	k, err := loadKeychain()
 	if err != nil {
 		return nil, err
 	}
 
-	responderKey, err := utils.ReadKeyFromDir()
+	responderKey, signatureKey, endpoint, err := discoverResponder()
+	if err != nil {
+		return nil, err
+	}
+
+	certificates, err := loadCertificates()
 	if err != nil {
 		return nil, err
 	}
 
 	tID := cryptography.RandomKey32()
-	return &Context{
-		keychain:           k,
-		transactionID:      &tID,
-		responderPublicKey: &responderKey,
-	}, nil
+	ctx := &Context{
+		keychain:              k,
+		transactionID:         &tID,
+		responderPublicKey:    &responderKey,
+		responderSignatureKey: signatureKey,
+		responderEndpoint:     endpoint,
+		certificates:          certificates,
+	}
+
+	if ctx.store, err = openStore(ctx); err != nil {
+		return nil, err
+	}
+	return ctx, nil
+}
+
+// discoverResponder fetches discovery document of the responder, keys are pinned on first use
+func discoverResponder() (key, signatureKey cryptography.Key32, endpoint string, err error) {
+	pins, err := sdk.LoadPins(*pinsFile)
+	if err != nil {
+		return key, signatureKey, "", err
+	}
+
+	discovery, err := pins.Discover(*responderAddress)
+	if err != nil {
+		return key, signatureKey, "", err
+	}
+
+	if endpoint, err = sdk.ProtocolEndpoint(*responderAddress, discovery); err != nil {
+		return key, signatureKey, "", err
+	}
+
+	if key, err = cryptography.Key32FromString(discovery.PublicKey); err != nil {
+		return key, signatureKey, "", err
+	}
+	signatureKey, err = cryptography.Key32FromString(discovery.SignatureKey)
+	return key, signatureKey, endpoint, err
+}
+
+func loadKeychain() (*cryptography.Keychain, error) {
+	if *keychainFile == "" {
+		return cryptography.OneShotKeychain()
+	}
+
+	if _, err := os.Stat(*keychainFile); err == nil {
+		return cryptography.LoadKeychain(*keychainFile)
+	}
+
+	fmt.Println("-> creating new keychain:", *keychainFile)
+	k, err := cryptography.OneShotKeychain()
+	if err != nil {
+		return nil, err
+	}
+	return k, cryptography.SaveKeychain(*keychainFile, k)
+}
+
+func loadCertificates() ([]string, error) {
+	if *certificatesFile == "" {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(*certificatesFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var chain []*protocol.SignedCertificate
+	if err := json.Unmarshal(data, &chain); err != nil {
+		return nil, fmt.Errorf("certificate chain %q: %s", *certificatesFile, err)
+	}
+	return protocol.EncodeCertificateChain(chain)
 }
 
 func fail(a ...interface{}) {
@@ -127,7 +230,7 @@ func (t *Transport) SendMessage(topic cryptography.Key32, payload interface{}, c
 		return err
 	}
 
-	msg := &protocol.Message{Header: protocol.Header{Source: ctx.keychain.MainPublicKey, Destination: *ctx.responderPublicKey, Topic: topic}, Body: protocol.Body{Payload: buffer.Bytes()}}
+	msg := &protocol.Message{Header: protocol.Header{Source: ctx.keychain.MainPublicKey, Destination: *ctx.responderPublicKey, Topic: topic, Version: ctx.version}, Body: protocol.Body{Payload: buffer.Bytes()}}
 	return t.conn.Write(msg)
 }
 
@@ -139,13 +242,17 @@ func (t *Transport) Read() (*protocol.Message, error) {
 	return t.conn.Read()
 }
 
-func makePretransactionRequest(ctx *Context) *models.PreTransactionRequest {
-	return &models.PreTransactionRequest{
+func makePretransactionRequest(ctx *Context) (*models.PreTransactionRequest, error) {
+	request := &models.PreTransactionRequest{
 		TransactionID:      models.Key32{Key: *ctx.transactionID},
 		SignaturePublicKey: models.Key32{Key: ctx.keychain.SignaturePublicKey},
 		MainPublicKey:      models.Key32{Key: ctx.keychain.MainPublicKey},
-		Requester:          "John Smith",
+		Requester:          *requesterName,
+		Capabilities:       protocol.DefaultCapabilities(),
+		Certificates:       ctx.certificates,
+		Endpoint:           endpoint(),
 	}
+	return request, protocol.ProvePossession(request, ctx.keychain, *ctx.responderPublicKey)
 }
 
 func decodePreTrasanctionReply(data []byte) (*models.PreTransactionReply, error) {
@@ -157,7 +264,11 @@ func decodePreTrasanctionReply(data []byte) (*models.PreTransactionReply, error)
 }
 
 func preTransact(conn *Transport, ctx *Context) error {
-	if err := conn.SendMessage(protocol.TopicPreTransactionRequest, makePretransactionRequest(ctx), ctx); err != nil {
+	request, err := makePretransactionRequest(ctx)
+	if err != nil {
+		return err
+	}
+	if err := conn.SendMessage(protocol.TopicPreTransactionRequest, request, ctx); err != nil {
 		return err
 	}
 	msg, err := conn.Read()
@@ -168,33 +279,55 @@ func preTransact(conn *Transport, ctx *Context) error {
 	if err != nil {
 		return err
 	}
+	if preTransactionReply.Error != nil {
+		return fmt.Errorf("pre transaction was not successful: %s", *preTransactionReply.Error)
+	}
 	if !preTransactionReply.Success {
 		return fmt.Errorf("pre transaction was not successful")
 	}
-	return nil
+	return checkAgreement(ctx, preTransactionReply)
 }
 
-func sign(ctx *Context) (string, error) {
-	signer := cryptography.NewSigner(ctx.keychain.SignaturePrivateKey, ctx.keychain.SignaturePublicKey)
-	signature, err := signer.Sign([]byte(query))
-	return hex.EncodeToString(signature), err
+func checkAgreement(ctx *Context, reply *models.PreTransactionReply) error {
+	local := protocol.DefaultCapabilities()
+	agreement, err := protocol.Negotiate(&local, &reply.Capabilities)
+	if err != nil {
+		return err
+	}
+	if agreement.Version != reply.Version {
+		return fmt.Errorf("%s: responder picked %d, expected %d", protocol.ErrVersionMismatch, reply.Version, agreement.Version)
+	}
+	if reply.Encryption != nil && *reply.Encryption != agreement.Encryption {
+		return fmt.Errorf("%s: responder picked %q, expected %q", protocol.ErrEncryptionMismatch, *reply.Encryption, agreement.Encryption)
+	}
+	fmt.Println("-> using protocol version:", agreement.Version)
+	ctx.version = agreement.Version
+	ctx.encryption = agreement.Encryption
+	return nil
 }
 
 func createTransactMessage(ctx *Context) (*models.TransactionRequest, error) {
-	signature, err := sign(ctx)
-	if err != nil {
-		return nil, err
+	template := legalTemplate
+	purpose := *purpose
+	request := &models.TransactionRequest{
+		TransactionID:   models.Key32{Key: *ctx.transactionID},
+		Query:           query,
+		Title:           "Provide permission for completing",
+		Description:     "T-mobile monthly plan(unlimited data), 65 euro, iPhone XR 256GB",
+		LawApplying:     "European Union",
+		Type:            "digital telecommunication agreement",
+		LegalTemplateID: &template,
+		RetentionDays:   retention(),
+		Purpose:         &purpose,
 	}
+	return request, protocol.SignTransactionRequest(request, ctx.keychain)
+}
 
-	return &models.TransactionRequest{
-		TransactionID: models.Key32{Key: *ctx.transactionID},
-		Query:         query,
-		Title:         "Provide permission for completing",
-		Description:   "T-mobile monthly plan(unlimited data), 65 euro, iPhone XR 256GB",
-		LawApplying:   "European Union",
-		Type:          "digital telecommunication agreement",
-		Signature:     signature,
-	}, nil
+func retention() *int {
+	if *retentionDays <= 0 {
+		return nil
+	}
+	return retentionDays
 }
 
 func transact(conn *Transport, ctx *Context) error {
@@ -212,10 +345,10 @@ func transact(conn *Transport, ctx *Context) error {
 	if err != nil {
 		return err
 	}
-	return handleTransactReply(msg)
+	return handleTransactReply(msg, ctx)
 }
 
-func handleTransactReply(msg *protocol.Message) error {
+func handleTransactReply(msg *protocol.Message, ctx *Context) error {
 	var transactionReply models.TransactionReply
 	if err := gob.NewDecoder(bytes.NewBuffer(msg.Body.Payload)).Decode(&transactionReply); err != nil {
 		return err
@@ -229,8 +362,17 @@ func handleTransactReply(msg *protocol.Message) error {
 		return fmt.Errorf("-> transaction failed: content is nil")
 	}
 
+	content := *transactionReply.Content
+	if ctx.encryption == protocol.EncryptionBox {
+		var err error
+		if content, err = protocol.DecryptContent(content, *ctx.responderPublicKey, ctx.keychain); err != nil {
+			return err
+		}
+		transactionReply.Content = &content
+	}
+
 	PrintReply(&transactionReply)
-	return nil
+	return ctx.store.Put(*ctx.responderPublicKey, ctx.responderSignatureKey, ctx.responderEndpoint, ctx.transactionID.String(), content, retainUntil(time.Now()))
 }
 
 func PrintReply(reply *models.TransactionReply) {
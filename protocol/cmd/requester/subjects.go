@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/protocol"
+	sdk "github.com/odysseyhack/planet-society/protocol/requester"
+	"github.com/odysseyhack/planet-society/protocol/transport"
+)
+
+// openStore opens store of data received from owners, temporary store is used when path is not given
+func openStore(ctx *Context) (*sdk.Store, error) {
+	path := *storeFile
+	if path == "" {
+		dir, err := ioutil.TempDir("", "requester")
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(dir, "store.db")
+	} else if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	return sdk.OpenStore(path, ctx.keychain.StoragePrivateKey)
+}
+
+// retainUntil returns time until which received data is kept, zero time means until revocation
+func retainUntil(now time.Time) time.Time {
+	if *retentionDays <= 0 {
+		return time.Time{}
+	}
+	return now.Add(time.Hour * 24 * time.Duration(*retentionDays))
+}
+
+// serveDataSubjects answers data subject requests of owners and enforces retention until the listener fails
+func serveDataSubjects(ctx *Context) error {
+	connections := make(chan protocol.Conn)
+	handler := sdk.NewDataSubjectHandler(ctx.keychain, ctx.store)
+	go handler.Listen(connections)
+
+	retention := sdk.NewRetention(ctx.store, ctx.keychain, transport.Dial)
+	go retention.Loop()
+	defer retention.Stop()
+
+	fmt.Println("-> serving data subject requests at:", *listenAddress)
+	return transport.NewWebsocket(connections).Listen(*listenAddress)
+}
+
+// endpoint returns endpoint sent to the responder
+func endpoint() *string {
+	if *listenAddress == "" {
+		return nil
+	}
+
+	address := *listenAddress
+	if strings.HasPrefix(address, ":") {
+		address = "127.0.0.1" + address
+	}
+	e := fmt.Sprintf("ws://%s/", address)
+	return &e
+}
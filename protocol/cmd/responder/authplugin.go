@@ -1,14 +1,14 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"net/http"
 	"time"
 
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
 	"github.com/odysseyhack/planet-society/protocol/models"
+	"github.com/odysseyhack/planet-society/protocol/protocol"
+	"github.com/odysseyhack/planet-society/protocol/relay"
+	log "github.com/sirupsen/logrus"
 )
 
 type AlwaysAcceptPlugin struct {
@@ -18,76 +18,123 @@ func (a *AlwaysAcceptPlugin) Authorize(input *models.PermissionNotificationReque
 	return &models.PermissionNotificationResponse{TransactionID: input.TransactionID, Accepted: true}, nil
 }
 
-const (
-	notificationPutAddr = "http://51.15.52.136/notification-put"
-	replyGetAddr        = "http://51.15.52.136/reply-get"
-)
-
+// IOSPlugin puts notification sealed to owner devices to their mailboxes
+// on notification server and waits for the first device to reply
 type IOSPlugin struct {
+	client   *relay.Client
+	keychain *cryptography.Keychain
+	devices  protocol.DeviceStore
+	timeout  time.Duration
 }
 
-func (i *IOSPlugin) Authorize(input *models.PermissionNotificationRequest) (*models.PermissionNotificationResponse, error) {
-	if err := sendPermissionNotificationRequest(input); err != nil {
-		return nil, err
-	}
-	return responseGetLoop()
-}
-
-func responseGetLoop() (*models.PermissionNotificationResponse, error) {
-	for i := 0; i < 120; i++ {
-		resp, err := getPermissionNotificationResponse()
-		if err == nil {
-			return resp, nil
-		}
-		time.Sleep(time.Second)
+// NewIOSPlugin creates plugin using notification server at url, notifications
+// are sent to devices paired with the owner and not revoked
+func NewIOSPlugin(url string, keychain *cryptography.Keychain, devices protocol.DeviceStore) *IOSPlugin {
+	return &IOSPlugin{
+		client:   relay.NewClient(url),
+		keychain: keychain,
+		devices:  devices,
+		timeout:  time.Second * 120,
 	}
-	return nil, fmt.Errorf("timeout")
 }
 
-func getPermissionNotificationResponse() (*models.PermissionNotificationResponse, error) {
-	client := http.Client{}
-	resp, err := client.Get(replyGetAddr)
+func (i *IOSPlugin) Authorize(input *models.PermissionNotificationRequest) (*models.PermissionNotificationResponse, error) {
+	devices, err := protocol.ActiveDevices(i.devices)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("sendPermissionNotificationRequest: got %v", resp.StatusCode)
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("no owner device paired")
 	}
 
-	data, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	replyTokens := make(map[cryptography.Key32]string)
+	for _, device := range devices {
+		sealed, err := relay.SealNotification(input, i.keychain, device.PublicKey.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		token, err := i.client.Put(device.PublicKey.Key, input.TransactionID, sealed)
+		if err != nil {
+			log.Warningf("putting notification to device %s failed: %s", device.ID, err)
+			continue
+		}
+		replyTokens[device.PublicKey.Key] = token
 	}
 
-	var notificationResponse models.PermissionNotificationResponse
-	if err := json.Unmarshal(data, &notificationResponse); err != nil {
-		return nil, err
+	if len(replyTokens) == 0 {
+		return nil, fmt.Errorf("notification not delivered to any device")
 	}
-	return &notificationResponse, err
+	return i.responseGetLoop(input.TransactionID, replyTokens)
 }
 
-func sendPermissionNotificationRequest(input *models.PermissionNotificationRequest) error {
-	data, err := json.Marshal(input)
-	if err != nil {
-		return err
-	}
-	client := http.Client{}
+// replyWait is time single long-poll request waits for device reply
+const replyWait = time.Second * 30
 
-	rq, err := http.NewRequest(http.MethodGet, notificationPutAddr, bytes.NewBuffer(data))
-	if err != nil {
-		return err
+// responseGetLoop waits for replies of all devices, the first valid reply decides
+func (i *IOSPlugin) responseGetLoop(transactionID string, replyTokens map[cryptography.Key32]string) (*models.PermissionNotificationResponse, error) {
+	deadline := time.Now().Add(i.timeout)
+	responses := make(chan *models.PermissionNotificationResponse, len(replyTokens))
+	done := make(chan struct{})
+	defer close(done)
+
+	for device, token := range replyTokens {
+		go func(device cryptography.Key32, token string) {
+			responses <- i.waitReply(device, transactionID, token, deadline, done)
+		}(device, token)
 	}
-	resp, err := client.Do(rq)
-	if err != nil {
-		return err
+
+	for range replyTokens {
+		if response := <-responses; response != nil {
+			return response, nil
+		}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("sendPermissionNotificationRequest: got %v", resp.StatusCode)
+	if time.Now().Before(deadline) {
+		return nil, fmt.Errorf("no device can reply")
 	}
+	return nil, fmt.Errorf("timeout")
+}
+
+// waitReply long-polls reply of device until deadline or done is closed, nil is
+// returned if device did not reply or its reply was rejected
+func (i *IOSPlugin) waitReply(device cryptography.Key32, transactionID, token string, deadline time.Time, done chan struct{}) *models.PermissionNotificationResponse {
+	for {
+		select {
+		case <-done:
+			return nil
+		default:
+		}
 
-	return nil
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return nil
+		}
+		if wait > replyWait {
+			wait = replyWait
+		}
+
+		data, err := i.client.ReplyWait(device, transactionID, token, wait)
+		if err == relay.ErrNoReply {
+			continue
+		}
+
+		if err != nil {
+			log.Warningf("getting reply from device %s failed: %s", device.String(), err)
+			return nil
+		}
+
+		response, err := relay.OpenReply(data, i.keychain, i.devices)
+		if err != nil {
+			log.Warningf("reply from device %s rejected: %s", device.String(), err)
+			return nil
+		}
+
+		if response.TransactionID != transactionID {
+			log.Warningf("device %s replied to transaction %s, expected %s", device.String(), response.TransactionID, transactionID)
+			return nil
+		}
+		return response
+	}
 }
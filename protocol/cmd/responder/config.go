@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/odysseyhack/planet-society/protocol/protocol"
+)
+
+const envPrefix = "PLANET_"
+
+// Config configures responder daemon. Values are taken from defaults, config file,
+// environment and flags, each source overrides the previous one.
+type Config struct {
+	// DataDir keeps database and keychain of the responder between runs
+	DataDir string `json:"data_dir"`
+	// GraphQLListen is address of GraphQL API used by the owner and the protocol, loopback by default
+	GraphQLListen string `json:"graphql_listen"`
+	// ProtocolListen is address requesters connect to
+	ProtocolListen string `json:"protocol_listen"`
+	// Endpoint is public GraphQL endpoint devices use to accept pairing, devices can't be paired if empty
+	Endpoint string `json:"endpoint"`
+	// ProtocolEndpoint is websocket endpoint published in discovery document. It is derived from
+	// ProtocolListen if empty, which is possible only for address of single interface and in demo.
+	ProtocolEndpoint string `json:"protocol_endpoint"`
+	Relay            string `json:"relay"`
+	Plugins          string `json:"plugins"`
+	Templates        string `json:"templates"`
+	Consent          string `json:"consent"`
+	Approval         string `json:"approval"`
+	// Seed fills newly created database with generated items
+	Seed bool `json:"seed"`
+	// Demo runs ephemeral responder in temporary directory with fresh keychain and generated items
+	Demo bool `json:"demo"`
+	// ConcurrentAuthorizations is maximal number of authorization prompts shown at once for single requester
+	ConcurrentAuthorizations int `json:"concurrent_authorizations"`
+}
+
+// DefaultConfig returns configuration used when no source sets the value
+func DefaultConfig() Config {
+	return Config{
+		DataDir:                  defaultDataDir(),
+		GraphQLListen:            "127.0.0.1:8088",
+		ProtocolListen:           ":15000",
+		Relay:                    "http://51.15.52.136",
+		Approval:                 "device",
+		ConcurrentAuthorizations: protocol.DefaultLimits().ConcurrentAuthorizations,
+	}
+}
+
+func defaultDataDir() string {
+	return filepath.Join(os.Getenv("HOME"), ".planet-responder")
+}
+
+// setting binds config field to flag and environment variable
+type setting struct {
+	flag  string
+	usage string
+	value interface{}
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{"data-dir", "directory with database and keychain", &c.DataDir},
+		{"graphql-listen", "listen address of GraphQL API", &c.GraphQLListen},
+		{"protocol-listen", "listen address of requester protocol", &c.ProtocolListen},
+		{"endpoint", "public GraphQL endpoint devices use to accept pairing, required for pairing", &c.Endpoint},
+		{"protocol-endpoint", "public websocket endpoint published to requesters, required if protocol-listen is wildcard address", &c.ProtocolEndpoint},
+		{"relay", "address of notification server", &c.Relay},
+		{"plugins", "path to plugins configuration file", &c.Plugins},
+		{"templates", "directory with legal template files", &c.Templates},
+		{"consent", "path to consent channel configuration file", &c.Consent},
+		{"approval", "where the owner decides transactions: device or local (GraphQL API and approve command)", &c.Approval},
+		{"seed", "fill newly created database with generated items", &c.Seed},
+		{"demo", "run ephemeral responder in temporary directory with generated items", &c.Demo},
+		{"concurrent-authorizations", "maximal number of authorization prompts shown at once for single requester", &c.ConcurrentAuthorizations},
+	}
+}
+
+// env returns name of environment variable of setting, e.g. PLANET_DATA_DIR
+func (s *setting) env() string {
+	return envPrefix + strings.ToUpper(strings.Replace(s.flag, "-", "_", -1))
+}
+
+func (s *setting) set(raw string) error {
+	switch value := s.value.(type) {
+	case *string:
+		*value = raw
+	case *bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %s", s.flag, err)
+		}
+		*value = parsed
+	case *int:
+		parsed, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %s", s.flag, err)
+		}
+		*value = parsed
+	}
+	return nil
+}
+
+// registerFlags defines flags of all settings on set, defaults are shown in usage only
+func registerFlags(set *flag.FlagSet) *string {
+	defaults := DefaultConfig()
+	for _, s := range defaults.settings() {
+		switch value := s.value.(type) {
+		case *string:
+			set.String(s.flag, *value, s.usage+" ("+s.env()+")")
+		case *bool:
+			set.Bool(s.flag, *value, s.usage+" ("+s.env()+")")
+		case *int:
+			set.Int(s.flag, *value, s.usage+" ("+s.env()+")")
+		}
+	}
+	return set.String("config", os.Getenv(envPrefix+"CONFIG"), "path to JSON configuration file ("+envPrefix+"CONFIG)")
+}
+
+// LoadConfig builds configuration from defaults, file at path, environment and flags set on parsed set
+func LoadConfig(path string, set *flag.FlagSet) (*Config, error) {
+	config := DefaultConfig()
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("config %q: %s", path, err)
+		}
+	}
+
+	explicit := make(map[string]bool)
+	settings := config.settings()
+	for i := range settings {
+		if raw, ok := os.LookupEnv(settings[i].env()); ok {
+			if err := settings[i].set(raw); err != nil {
+				return nil, err
+			}
+			explicit[settings[i].flag] = true
+		}
+	}
+
+	var err error
+	set.Visit(func(f *flag.Flag) {
+		for i := range settings {
+			if settings[i].flag == f.Name && err == nil {
+				err = settings[i].set(f.Value.String())
+				explicit[f.Name] = true
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// demo keeps filling database with generated items unless seeding is disabled explicitly
+	if config.Demo && !explicit["seed"] {
+		config.Seed = true
+	}
+
+	if config.ConcurrentAuthorizations < 1 {
+		return nil, fmt.Errorf("concurrent-authorizations: %d, at least one prompt is needed", config.ConcurrentAuthorizations)
+	}
+
+	if err := publicEndpoint(config.Endpoint); err != nil {
+		return nil, fmt.Errorf("endpoint: %s", err)
+	}
+
+	if config.ProtocolEndpoint == "" {
+		// requesters on other hosts can't reach loopback endpoint derived from wildcard address
+		if wildcard(config.ProtocolListen) && !config.Demo {
+			return nil, fmt.Errorf("protocol-endpoint: required for protocol-listen %q, requesters connect to it from other hosts", config.ProtocolListen)
+		}
+		config.ProtocolEndpoint = localURL("ws", config.ProtocolListen, "/")
+	}
+	return &config, nil
+}
+
+// publicEndpoint checks that endpoint is URL other hosts can reach, empty endpoint is not configured
+func publicEndpoint(endpoint string) error {
+	if endpoint == "" {
+		return nil
+	}
+
+	address, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+
+	if address.Host == "" || loopback(net.JoinHostPort(address.Hostname(), "0")) {
+		return fmt.Errorf("%q is not reachable from other hosts", endpoint)
+	}
+	return nil
+}
+
+// loopback reports if listen address accepts connections only from the node
+func loopback(listen string) bool {
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return false
+	}
+
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// localEndpoint returns GraphQL endpoint reachable on the node for listen address
+func localEndpoint(listen string) string {
+	return localURL("http", listen, "/query")
+}
+
+// localURL returns URL with scheme and path reachable on the node for listen address
+func localURL(scheme, listen, path string) string {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return scheme + "://" + listen + path
+	}
+
+	if wildcard(listen) {
+		host = "127.0.0.1"
+	}
+	return scheme + "://" + net.JoinHostPort(host, port) + path
+}
+
+// wildcard reports if listen address accepts connections on all interfaces
+func wildcard(listen string) bool {
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return false
+	}
+	return host == "" || host == "0.0.0.0" || host == "::"
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/odysseyhack/planet-society/protocol/protocol"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Fatalf("failed to create temporary dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.json")
+	data := `{"data_dir": "/var/lib/planet", "graphql_listen": ":9000", "relay": "http://file", "approval": "local"}`
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatalf("WriteFile() failed: %s", err)
+	}
+
+	os.Setenv("PLANET_RELAY", "http://env")
+	os.Setenv("PLANET_APPROVAL", "device")
+	defer os.Unsetenv("PLANET_RELAY")
+	defer os.Unsetenv("PLANET_APPROVAL")
+
+	set := flag.NewFlagSet("responder", flag.ContinueOnError)
+	registerFlags(set)
+	if err := set.Parse([]string{"-approval", "local", "--demo", "-concurrent-authorizations", "3"}); err != nil {
+		t.Fatalf("Parse() failed: %s", err)
+	}
+
+	config, err := LoadConfig(path, set)
+	if err != nil {
+		t.Fatalf("LoadConfig() failed: %s", err)
+	}
+
+	if config.DataDir != "/var/lib/planet" || config.ProtocolListen != ":15000" {
+		t.Errorf("file and default values not used: %+v", config)
+	}
+
+	if config.Relay != "http://env" {
+		t.Errorf("relay is %q, environment should override file", config.Relay)
+	}
+
+	if config.Approval != "local" {
+		t.Errorf("approval is %q, flag should override environment", config.Approval)
+	}
+
+	if !config.Demo || !config.Seed {
+		t.Errorf("demo should seed database: %+v", config)
+	}
+
+	if config.ConcurrentAuthorizations != 3 {
+		t.Errorf("concurrent authorizations is %d", config.ConcurrentAuthorizations)
+	}
+
+	if config.Endpoint != "" {
+		t.Errorf("endpoint is %q, devices can't reach endpoint derived from listen address", config.Endpoint)
+	}
+
+	if config.ProtocolEndpoint != "ws://127.0.0.1:15000/" {
+		t.Errorf("protocol endpoint is %q", config.ProtocolEndpoint)
+	}
+
+	set = flag.NewFlagSet("responder", flag.ContinueOnError)
+	registerFlags(set)
+	if err := set.Parse([]string{"--demo", "-seed=false"}); err != nil {
+		t.Fatalf("Parse() failed: %s", err)
+	}
+
+	if config, err = LoadConfig("", set); err != nil {
+		t.Fatalf("LoadConfig() failed: %s", err)
+	}
+	if config.Seed {
+		t.Errorf("seeding disabled by flag is enabled in demo")
+	}
+
+	if config.ConcurrentAuthorizations != protocol.DefaultLimits().ConcurrentAuthorizations {
+		t.Errorf("concurrent authorizations is %d, expected default", config.ConcurrentAuthorizations)
+	}
+
+	if !loopback(config.GraphQLListen) {
+		t.Errorf("GraphQL API listens at %q by default, expected loopback address", config.GraphQLListen)
+	}
+
+	set = flag.NewFlagSet("responder", flag.ContinueOnError)
+	registerFlags(set)
+	if err := set.Parse([]string{"-concurrent-authorizations", "0"}); err != nil {
+		t.Fatalf("Parse() failed: %s", err)
+	}
+
+	if _, err := LoadConfig("", set); err == nil {
+		t.Errorf("LoadConfig() accepted no concurrent authorizations")
+	}
+}
+
+func TestLoadConfigEndpoint(t *testing.T) {
+	set := flag.NewFlagSet("responder", flag.ContinueOnError)
+	registerFlags(set)
+	if err := set.Parse([]string{"-endpoint", "https://wallet.example.com/query", "-protocol-endpoint", "wss://wallet.example.com/planet"}); err != nil {
+		t.Fatalf("Parse() failed: %s", err)
+	}
+
+	config, err := LoadConfig("", set)
+	if err != nil {
+		t.Fatalf("LoadConfig() failed: %s", err)
+	}
+	if config.Endpoint != "https://wallet.example.com/query" {
+		t.Errorf("endpoint is %q", config.Endpoint)
+	}
+
+	for _, endpoint := range []string{"http://127.0.0.1:8088/query", "http://localhost:8088/query", "/query"} {
+		set = flag.NewFlagSet("responder", flag.ContinueOnError)
+		registerFlags(set)
+		if err := set.Parse([]string{"-endpoint", endpoint, "-protocol-endpoint", "wss://wallet.example.com/planet"}); err != nil {
+			t.Fatalf("Parse() failed: %s", err)
+		}
+
+		if _, err := LoadConfig("", set); err == nil {
+			t.Errorf("LoadConfig() accepted endpoint %q devices can't reach", endpoint)
+		}
+	}
+}
+
+func TestLoadConfigProtocolEndpoint(t *testing.T) {
+	tests := []struct {
+		args     []string
+		endpoint string
+	}{
+		{args: []string{"-protocol-endpoint", "wss://wallet.example.com/planet"}, endpoint: "wss://wallet.example.com/planet"},
+		{args: []string{"-protocol-listen", "10.0.0.1:15000"}, endpoint: "ws://10.0.0.1:15000/"},
+		{args: []string{"-protocol-listen", "0.0.0.0:15000", "--demo"}, endpoint: "ws://127.0.0.1:15000/"},
+		{args: []string{}},
+		{args: []string{"-protocol-listen", "[::]:15000"}},
+	}
+
+	for _, test := range tests {
+		set := flag.NewFlagSet("responder", flag.ContinueOnError)
+		registerFlags(set)
+		if err := set.Parse(test.args); err != nil {
+			t.Fatalf("Parse() failed: %s", err)
+		}
+
+		config, err := LoadConfig("", set)
+		if test.endpoint == "" {
+			if err == nil {
+				t.Errorf("LoadConfig(%v) published %q for wildcard listen address", test.args, config.ProtocolEndpoint)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("LoadConfig(%v) failed: %s", test.args, err)
+		} else if config.ProtocolEndpoint != test.endpoint {
+			t.Errorf("LoadConfig(%v) published %q, expected %q", test.args, config.ProtocolEndpoint, test.endpoint)
+		}
+	}
+}
+
+func TestLoopback(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1:8088": true,
+		"[::1]:8088":     true,
+		"localhost:8088": true,
+		":8088":          false,
+		"0.0.0.0:8088":   false,
+		"10.0.0.1:8088":  false,
+		"invalid":        false,
+	}
+
+	for listen, expected := range tests {
+		if loopback(listen) != expected {
+			t.Errorf("loopback(%q) returned %v", listen, !expected)
+		}
+	}
+}
@@ -3,14 +3,21 @@ package main
 import (
 	"context"
 	"encoding/hex"
+	"flag"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/99designs/gqlgen/handler"
 	"github.com/go-chi/chi"
+	"github.com/odysseyhack/planet-society/protocol/consent"
 	"github.com/odysseyhack/planet-society/protocol/cryptography"
 	"github.com/odysseyhack/planet-society/protocol/database"
 	"github.com/odysseyhack/planet-society/protocol/models"
@@ -22,78 +29,250 @@ import (
 )
 
 const (
-	dbFile = "hackaton_db.db"
+	dbFile             = "wallet.db"
+	keychainFile       = "keychain.json"
+	ownerTokenFile     = "owner.token"
+	permissionDuration = time.Hour * 120
+	approvalTimeout    = time.Second * 120
+	shutdownTimeout    = time.Second * 10
 )
 
-var (
-	keychain *cryptography.Keychain
-)
+var keychain *cryptography.Keychain
 
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			utils.ConfigureLogger()
+			if err := command(os.Args[2:]); err != nil {
+				log.Fatalln(err)
+			}
+			return
+		}
+	}
+
+	configPath := registerFlags(flag.CommandLine)
+	flag.Parse()
 	utils.ConfigureLogger()
-	log.Infoln("creating temporary directory")
-	dir, err := ioutil.TempDir("", "responder")
+
+	config, err := LoadConfig(*configPath, flag.CommandLine)
 	if err != nil {
-		log.Fatalln("failed to create temporary dir:", err)
+		log.Fatalln("failed to load configuration:", err)
+	}
+
+	if config.Demo {
+		log.Infoln("demo mode, creating temporary directory")
+		dir, err := ioutil.TempDir("", "responder")
+		if err != nil {
+			log.Fatalln("failed to create temporary dir:", err)
+		}
+		log.Infoln("using temporary directory:", dir)
+		config.DataDir = dir
+		defer cleanup(dir)
+	}
+
+	if err := run(config); err != nil {
+		log.Warningf("%s", err)
+	}
+}
+
+func cleanup(dir string) {
+	log.Infoln("removing temporary directory:", dir)
+	if err := os.RemoveAll(dir); err != nil {
+		log.Warningln("failed to clean temporary directory:", err)
 	}
-	log.Infoln("using temporary directory:", dir)
-	defer cleanup(dir)
+}
 
-	if err := createKeychain(); err != nil {
-		log.Fatalln("failed to generate keychain:", err)
+func run(config *Config) error {
+	log.Infoln("using data directory:", config.DataDir)
+	if err := os.MkdirAll(config.DataDir, 0700); err != nil {
+		return fmt.Errorf("failed to create data directory: %s", err)
 	}
 
-	db, err := createDatabase(dir)
+	if err := loadKeychain(config.DataDir); err != nil {
+		return fmt.Errorf("failed to load keychain: %s", err)
+	}
+
+	db, err := openDatabase(config)
 	if err != nil {
-		log.Fatalln("failed to create database:", err)
+		return fmt.Errorf("failed to open database: %s", err)
 	}
 
 	defer func() {
-		log.Infoln("closing database:", dir)
+		log.Infoln("closing database")
 		if err := db.Close(); err != nil {
 			log.Warningln("failed to close database:", err)
 		}
 	}()
 
-	if err := serve(db); err != nil {
-		log.Warningf("%s", err)
-	}
+	return serve(config, db)
 }
 
-func cleanup(dir string) {
-	log.Infoln("removing public key")
-	if err := utils.CleanKey(); err != nil {
-		log.Warningln("cleaning key failed:", err)
+// serve runs responder until it receives interrupt or terminate signal or listener fails
+func serve(config *Config, db *database.Database) error {
+	templates, err := loadLegalTemplates(db, config.Templates)
+	if err != nil {
+		return err
 	}
 
-	log.Infoln("removing temporary directory:", dir)
-	if err := os.RemoveAll(dir); err != nil {
-		log.Warningln("failed to clean temporary directory:", err)
+	discovery, err := protocol.DiscoveryHandler(keychain, protocol.DefaultCapabilities().Versions,
+		map[string]string{protocol.EndpointProtocol: config.ProtocolEndpoint})
+	if err != nil {
+		return err
 	}
-}
 
-func serve(db *database.Database) error {
+	tokenPath := filepath.Join(config.DataDir, ownerTokenFile)
+	token, err := protocol.LoadOwnerToken(tokenPath)
+	if err != nil {
+		return fmt.Errorf("failed to load owner token: %s", err)
+	}
+	log.Infoln("GraphQL API owner token:", tokenPath)
+
 	router := chi.NewRouter()
-	router.Use(Middleware(db))
-	resolver := protocol.NewResolver(db)
+	router.Use(protocol.OwnerMiddleware(token))
+	router.Use(Middleware(templates))
+	subjects := protocol.NewDataSubjects(db, keychain, transport.Dial)
+	pairing := protocol.NewPairing(db, keychain, config.Relay, config.Endpoint)
+	pending := protocol.NewPendingQueue(approvalTimeout)
+	reminders := protocol.NewObligationReminders()
+	resolver := protocol.NewResolver(db, keychain, templates, subjects, pairing, pending, reminders)
 	router.Handle("/", handler.Playground("GraphQL playground", "/query"))
-	router.Handle("/query", handler.GraphQL(protocol.NewExecutableSchema(protocol.Config{Resolvers: resolver})))
+	router.Handle("/query", handler.GraphQL(protocol.NewExecutableSchema(protocol.Config{Resolvers: resolver}),
+		handler.ResolverMiddleware(protocol.OwnerFields)))
+
+	if !loopback(config.GraphQLListen) {
+		log.Warningln("GraphQL API with wallet of the owner is reachable from other hosts at:", config.GraphQLListen)
+	}
+
+	failed := make(chan error, 2)
+	api := &http.Server{Addr: config.GraphQLListen, Handler: router}
 	go func() {
-		log.Warningln(http.ListenAndServe(":8088", router))
+		log.Infoln("starting GraphQL API at:", config.GraphQLListen)
+		if err := api.ListenAndServe(); err != http.ErrServerClosed {
+			failed <- fmt.Errorf("GraphQL API: %s", err)
+		}
 	}()
 
-	proto := protocol.NewProtocol(&IOSPlugin{})
+	limits := protocol.DefaultLimits()
+	limits.ConcurrentAuthorizations = config.ConcurrentAuthorizations
+	owner, err := ownerAuthorization(config, db, pending)
+	if err != nil {
+		api.Close()
+		return err
+	}
+	delegated := protocol.NewDelegatedAuthorization(db, keychain, transport.Dial, owner)
+	proto := protocol.NewProtocol(protocol.NewThresholdAuthorization(db, keychain, transport.Dial, owner, delegated))
+	proto.SetLimits(limits)
+	proto.SetRequesterLists(db)
+	proto.SetLegalTemplates(templates)
+	proto.SetAttestationStore(db)
+	proto.SetContactStore(db)
+	proto.SetKeychain(keychain)
+	proto.SetQueryEndpoint(localEndpoint(config.GraphQLListen))
+	proto.SetQueryToken(token)
+	if err := configurePlugins(proto, config.Plugins); err != nil {
+		api.Close()
+		return err
+	}
 	go proto.Loop()
 
+	watcher := protocol.NewObligationWatcher(db, reminders)
+	go watcher.Loop()
+
 	ws := transport.NewWebsocket(proto.Connections)
-	log.Infoln("starting listener at: :15000")
-	return ws.Listen(":15000")
+	ws.SetReadLimit(limits.FrameSize())
+	ws.Handle(protocol.WellKnownPath, discovery)
+	go func() {
+		log.Infoln("starting listener at:", config.ProtocolListen)
+		if err := ws.Listen(config.ProtocolListen); err != nil {
+			failed <- fmt.Errorf("protocol listener: %s", err)
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case sig := <-signals:
+		log.Infoln("received signal, shutting down:", sig)
+	case err = <-failed:
+	}
+
+	if err := ws.Stop(); err != nil {
+		log.Warningln("failed to stop protocol listener:", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := api.Shutdown(ctx); err != nil {
+		log.Warningln("failed to stop GraphQL API:", err)
+	}
+
+	proto.Stop()
+	watcher.Stop()
+	if stopper, ok := owner.(interface{ Stop() error }); ok {
+		if err := stopper.Stop(); err != nil {
+			log.Warningln("failed to stop consent channel:", err)
+		}
+	}
+	return err
+}
+
+func configurePlugins(proto *protocol.Protocol, path string) error {
+	if path == "" {
+		log.Infoln("no plugins configuration, using sanity validator")
+		proto.RegisterPreTransactionValidator(&protocol.SanityValidator{})
+		return nil
+	}
+
+	log.Infoln("loading plugins configuration:", path)
+	config, err := protocol.LoadPluginsConfig(path)
+	if err != nil {
+		return err
+	}
+	return proto.ConfigurePlugins(config)
+}
+
+// ownerAuthorization returns plugin asking the owner for consent over configured channel,
+// only decisions signed by devices paired with the owner are accepted. Local approval
+// keeps transactions pending until the owner decides them through GraphQL API.
+func ownerAuthorization(config *Config, devices protocol.DeviceStore, pending *protocol.PendingQueue) (protocol.AuthorizationPlugin, error) {
+	switch config.Approval {
+	case "local":
+		log.Infoln("owner approves transactions locally through GraphQL API")
+		return pending, nil
+	case "device":
+	default:
+		return nil, fmt.Errorf("unknown approval %q, expected device or local", config.Approval)
+	}
+
+	if config.Consent == "" {
+		log.Infoln("no consent channel configuration, using notification server:", config.Relay)
+		return NewIOSPlugin(config.Relay, keychain, devices), nil
+	}
+
+	log.Infoln("loading consent channel configuration:", config.Consent)
+	channel, err := consent.LoadConfig(config.Consent)
+	if err != nil {
+		return nil, err
+	}
+	return consent.NewPluginFromConfig(channel, devices)
+}
+
+func loadLegalTemplates(db *database.Database, dir string) (*protocol.LegalTemplates, error) {
+	templates := protocol.NewLegalTemplates(db)
+	if dir == "" {
+		return templates, nil
+	}
+
+	log.Infoln("loading legal templates from:", dir)
+	return templates, templates.LoadDir(dir)
 }
 
-func Middleware(db *database.Database) func(http.Handler) http.Handler {
+func Middleware(templates *protocol.LegalTemplates) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ctx := getMetadata(r)
+			ctx := getMetadata(r, templates)
 			r = r.WithContext(ctx)
 			next.ServeHTTP(w, r)
 		})
@@ -101,17 +280,38 @@ func Middleware(db *database.Database) func(http.Handler) http.Handler {
 }
 
 func permissionFromHeader(r *http.Request) *models.Permission {
+	created := time.Now()
 	return &models.Permission{
+		Created:            created.Format(time.RFC3339),
 		Title:              r.Header.Get("title"),
 		Description:        r.Header.Get("description"),
 		RequesterSignature: r.Header.Get("signature"),
 		ResponderSignature: sign(r.Header.Get("requester")),
-		Expiration:         time.Now().Add(time.Hour * 120).Format(time.RFC3339),
-		LawApplying:        "European Union",
+		Expiration:         created.Add(permissionDuration).Format(time.RFC3339),
+		LawApplying:        lawApplyingFromHeader(r),
+		RetentionUntil:     retentionFromHeader(r, created),
+		Purpose:            r.Header.Get("purpose"),
 	}
 }
 
-func getMetadata(r *http.Request) context.Context {
+// retentionFromHeader returns time until which requester keeps the data,
+// empty string means until revocation
+func retentionFromHeader(r *http.Request, created time.Time) string {
+	days, err := strconv.Atoi(r.Header.Get("retention-days"))
+	if err != nil || days <= 0 {
+		return ""
+	}
+	return created.Add(time.Hour * 24 * time.Duration(days)).Format(time.RFC3339)
+}
+
+func lawApplyingFromHeader(r *http.Request) string {
+	if law := r.Header.Get("law-applying"); law != "" {
+		return law
+	}
+	return protocol.DefaultLawApplying
+}
+
+func getMetadata(r *http.Request, templates *protocol.LegalTemplates) context.Context {
 	var ctx = r.Context()
 	transactionID := r.Header.Get("TransactionID")
 	if transactionID != "" {
@@ -121,26 +321,55 @@ func getMetadata(r *http.Request) context.Context {
 		tid := cryptography.RandomKey32()
 		ctx = context.WithValue(ctx, "TransactionID", tid.String())
 	}
-	k, _ := cryptography.Key32FromString(r.Header.Get("requester"))
+	if identities := r.Header.Get("identities"); identities != "" {
+		ctx = context.WithValue(ctx, "Identities", strings.Split(identities, ","))
+	}
+	if header := r.Header.Get("selection"); header != "" {
+		selection, err := protocol.ParseSelectionHeader(header)
+		if err != nil {
+			log.Warningln("ignoring invalid selection:", err)
+		} else {
+			ctx = context.WithValue(ctx, "Selection", selection)
+		}
+	}
+	k, err := cryptography.Key32FromString(r.Header.Get("requester"))
+	if err == nil {
+		ctx = context.WithValue(ctx, "Requester", k)
+	}
 	permission := permissionFromHeader(r)
 
 	permission.RequesterPublicKey = models.Key32{Key: k}
+	signatureKey, _ := cryptography.Key32FromString(r.Header.Get("requester-signature-key"))
+	permission.RequesterSignatureKey = models.Key32{Key: signatureKey}
+	permission.RequesterEndpoint = r.Header.Get("requester-endpoint")
 	permission.TransactionID = transactionID
 
-	checkPermissionType(r, permission)
+	applyLegalTemplate(r, templates, permission)
 	utils.AddPermission(permission)
 	return ctx
 }
 
-func checkPermissionType(r *http.Request, permission *models.Permission) {
-	if r.Header.Get("permission-type") == "digital telecommunication agreement" {
-		permission.LegalReliationships = models.LegalReliationships{
-			MyRights:       []string{"use telecommunication services until agreement expires"},
-			TheirDuties:    []string{"provide high availability telecommunication service"},
-			MyPowers:       []string{"cancel contract within 14 days from signing"},
-			TheirLiability: []string{"liable for the consequences of the agreement termination"},
-		}
+// applyLegalTemplate stores legal relationships of template resolved by the protocol on permission
+func applyLegalTemplate(r *http.Request, templates *protocol.LegalTemplates, permission *models.Permission) {
+	reference := r.Header.Get("legal-template")
+	if reference == "" {
+		return
 	}
+
+	template, err := templates.Get(reference)
+	if err != nil {
+		log.Warningln("failed to apply legal template:", err)
+		return
+	}
+
+	permission.LegalReliationships = template.LegalReliationships
+	permission.LegalTemplateID = template.ID
+	permission.LegalTemplateVersion = template.Version
+	permission.LawApplying = template.LawApplying
+
+	created, _ := time.Parse(time.RFC3339, permission.Created)
+	expiration, _ := time.Parse(time.RFC3339, permission.Expiration)
+	permission.Obligations = protocol.NewObligations(template, created, expiration)
 }
 
 func sign(data string) string {
@@ -149,14 +378,18 @@ func sign(data string) string {
 	return hex.EncodeToString(a)
 }
 
-func createKeychain() (err error) {
-	log.Infoln("generating one shot keychain")
-	keychain, err = cryptography.OneShotKeychain()
-	if err != nil {
-		return err
+// loadKeychain loads keychain of the responder from dir, keychain is generated on the first run
+func loadKeychain(dir string) (err error) {
+	path := filepath.Join(dir, keychainFile)
+	keychain, err = cryptography.LoadKeychain(path)
+	if os.IsNotExist(err) {
+		log.Infoln("generating keychain:", path)
+		if keychain, err = cryptography.OneShotKeychain(); err != nil {
+			return err
+		}
+		err = cryptography.SaveKeychain(path, keychain)
 	}
-
-	if err := utils.WriteKeyToDir(keychain.MainPublicKey); err != nil {
+	if err != nil {
 		return err
 	}
 
@@ -165,19 +398,26 @@ func createKeychain() (err error) {
 	return nil
 }
 
-func createDatabase(dir string) (*database.Database, error) {
-	filePath := filepath.Join(dir, dbFile)
+// openDatabase opens database in data directory, newly created database is seeded if configured
+func openDatabase(config *Config) (*database.Database, error) {
+	filePath := filepath.Join(config.DataDir, dbFile)
+	_, statErr := os.Stat(filePath)
+
 	log.Infoln("using database:", filePath)
 	db, err := database.LoadDatabase(filePath, keychain)
 	if err != nil {
 		return nil, err
 	}
 
+	if !os.IsNotExist(statErr) || !config.Seed {
+		return db, nil
+	}
+
 	log.Infoln("filling database with items")
 	dbGenerator := generator.NewGenerator()
 	if err := dbGenerator.Generate(db); err != nil {
+		db.Close()
 		return nil, err
 	}
-
 	return db, nil
 }
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/database"
+	"github.com/odysseyhack/planet-society/protocol/models"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	passphraseEnv = "PLANET_WALLET_PASSPHRASE"
+)
+
+// commands are wallet commands run instead of the responder, e.g. responder export -db wallet.db -keychain keychain.json -out wallet.json
+var commands = map[string]func(args []string) error{
+	"export": exportCommand,
+	"import": importCommand,
+}
+
+type walletFlags struct {
+	set        *flag.FlagSet
+	db         *string
+	keychain   *string
+	passphrase *string
+}
+
+func newWalletFlags(name string) *walletFlags {
+	set := flag.NewFlagSet(name, flag.ExitOnError)
+	return &walletFlags{
+		set:        set,
+		db:         set.String("db", "", "path to the wallet database"),
+		keychain:   set.String("keychain", "", "path to the keychain of the wallet, import creates it from the bundle if missing"),
+		passphrase: set.String("passphrase", "", "bundle passphrase, "+passphraseEnv+" is used if empty"),
+	}
+}
+
+// open opens wallet database with its keychain. Pseudonyms and signatures depend on the
+// keychain, so database is never opened with a generated one.
+func (w *walletFlags) open() (*database.Database, error) {
+	if *w.db == "" {
+		return nil, fmt.Errorf("%s: -db is required", w.set.Name())
+	}
+
+	if *w.keychain == "" {
+		return nil, fmt.Errorf("%s: -keychain is required", w.set.Name())
+	}
+
+	walletKeychain, err := cryptography.LoadKeychain(*w.keychain)
+	if err != nil {
+		return nil, err
+	}
+
+	return database.LoadDatabase(*w.db, walletKeychain)
+}
+
+// restoreKeychain saves keychain of the bundle if wallet keychain does not exist yet
+func (w *walletFlags) restoreKeychain(bundle *database.Bundle) error {
+	if *w.keychain == "" {
+		return fmt.Errorf("%s: -keychain is required", w.set.Name())
+	}
+
+	if _, err := os.Stat(*w.keychain); !os.IsNotExist(err) {
+		return err
+	}
+
+	if bundle.Keychain == nil {
+		return fmt.Errorf("%s: bundle does not contain keychain, existing -keychain is required", w.set.Name())
+	}
+
+	log.Infoln("restoring keychain from the bundle:", *w.keychain)
+	return cryptography.SaveKeychain(*w.keychain, bundle.Keychain)
+}
+
+func (w *walletFlags) bundlePassphrase() (string, error) {
+	passphrase := *w.passphrase
+	if passphrase == "" {
+		passphrase = os.Getenv(passphraseEnv)
+	}
+
+	if passphrase == "" {
+		return "", fmt.Errorf("%s: passphrase is required", w.set.Name())
+	}
+	return passphrase, nil
+}
+
+func exportCommand(args []string) error {
+	flags := newWalletFlags("export")
+	out := flags.set.String("out", "", "path of the exported bundle")
+	if err := flags.set.Parse(args); err != nil {
+		return err
+	}
+
+	if *out == "" {
+		return fmt.Errorf("export: -out is required")
+	}
+
+	passphrase, err := flags.bundlePassphrase()
+	if err != nil {
+		return err
+	}
+
+	// LoadDatabase creates missing database, mistyped path would export empty wallet
+	if _, err := os.Stat(*flags.db); err != nil {
+		return fmt.Errorf("export: %s", err)
+	}
+
+	db, err := flags.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	bundle, err := db.Export()
+	if err != nil {
+		return err
+	}
+
+	data, err := database.EncryptBundle(bundle, passphrase)
+	if err != nil {
+		return err
+	}
+
+	log.Infoln("exporting wallet to:", *out)
+	return ioutil.WriteFile(*out, data, 0600)
+}
+
+func importCommand(args []string) error {
+	flags := newWalletFlags("import")
+	in := flags.set.String("in", "", "path of the bundle to import")
+	conflict := flags.set.String("conflict", string(models.ImportConflictFail), "handling of existing items: FAIL, SKIP or OVERWRITE")
+	if err := flags.set.Parse(args); err != nil {
+		return err
+	}
+
+	if *in == "" {
+		return fmt.Errorf("import: -in is required")
+	}
+
+	passphrase, err := flags.bundlePassphrase()
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(*in)
+	if err != nil {
+		return err
+	}
+
+	bundle, err := database.DecryptBundle(data, passphrase)
+	if err != nil {
+		return err
+	}
+
+	if err := flags.restoreKeychain(bundle); err != nil {
+		return err
+	}
+
+	db, err := flags.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	result, err := db.Import(bundle, models.ImportConflict(*conflict))
+	if err != nil {
+		return err
+	}
+
+	log.Infof("imported wallet from %s: %d imported, %d skipped, %d replaced", *in, result.Imported, result.Skipped, result.Replaced)
+	return nil
+}
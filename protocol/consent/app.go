@@ -0,0 +1,169 @@
+package consent
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+	"github.com/odysseyhack/planet-society/protocol/protocol"
+)
+
+// Decider is app side of the channel making decision about notification
+type Decider func(notification *models.PermissionNotificationRequest) *models.PermissionNotificationResponse
+
+// decision asks decide about notification and signs the decision with device keychain
+func decision(decide Decider, notification *models.PermissionNotificationRequest, device *cryptography.Keychain) (*protocol.SignedDecision, error) {
+	return protocol.SignDecision(decide(notification), device)
+}
+
+// WebhookReceiver returns handler of webhook notifications, decisions signed
+// by device are posted to replyURL of the responder authenticated with secret
+func WebhookReceiver(secret, replyURL string, device *cryptography.Keychain, decide Decider) http.Handler {
+	client := &http.Client{}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if !VerifySignature(secret, body, r.Header.Get(SignatureHeader)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var notification models.PermissionNotificationRequest
+		if err := json.Unmarshal(body, &notification); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+
+		go func() {
+			signed, err := decision(decide, &notification, device)
+			if err != nil {
+				return
+			}
+
+			data, err := json.Marshal(signed)
+			if err != nil {
+				return
+			}
+			_ = postReply(client, replyURL, data, func(rq *http.Request) {
+				rq.Header.Set(SignatureHeader, Sign(secret, data))
+			})
+		}()
+	})
+}
+
+// ReceiveSSE reads notifications from events stream at url and posts decisions
+// signed by device to replyURL, it returns when stream is closed
+func ReceiveSSE(url, replyURL, token string, device *cryptography.Keychain, decide Decider) error {
+	client := &http.Client{}
+	rq, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	rq.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := client.Do(rq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("events stream returned %d", resp.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+
+		var notification models.PermissionNotificationRequest
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &notification); err != nil {
+			return err
+		}
+
+		signed, err := decision(decide, &notification, device)
+		if err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(signed)
+		if err != nil {
+			return err
+		}
+
+		if err := postReply(client, replyURL, data, func(rq *http.Request) {
+			rq.Header.Set("Authorization", "Bearer "+token)
+		}); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// ReceiveWebsocket reads notifications pushed over websocket at url and sends
+// decisions signed by device back, it returns when connection is closed
+func ReceiveWebsocket(url, token string, device *cryptography.Keychain, decide Decider) error {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+token)
+	conn, _, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		var notification models.PermissionNotificationRequest
+		if err := json.Unmarshal(data, &notification); err != nil {
+			return err
+		}
+
+		signed, err := decision(decide, &notification, device)
+		if err != nil {
+			return err
+		}
+
+		if err := conn.WriteJSON(signed); err != nil {
+			return err
+		}
+	}
+}
+
+func postReply(client *http.Client, url string, data []byte, authorize func(rq *http.Request)) error {
+	rq, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	rq.Header.Set("Content-Type", "application/json")
+	authorize(rq)
+
+	resp, err := client.Do(rq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("reply returned %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+// Package consent delivers permission notifications to the owner's app and
+// collects owner decisions over pluggable channels.
+package consent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/odysseyhack/planet-society/protocol/models"
+	"github.com/odysseyhack/planet-society/protocol/protocol"
+)
+
+// DefaultTimeout is time owner has to decide when configuration does not set it
+const DefaultTimeout = time.Second * 120
+
+var (
+	ErrTimeout            = errors.New("owner did not decide before timeout")
+	ErrUnknownTransaction = errors.New("no pending notification for transaction")
+	ErrDuplicate          = errors.New("notification for transaction already pending")
+	ErrUnknownChannel     = errors.New("unknown consent channel type")
+	ErrMissingParam       = errors.New("missing consent channel parameter")
+	ErrDeliveryFailed     = errors.New("notification delivery failed")
+)
+
+// Replies receives owner decisions from the channel, decisions
+// must be signed by device paired with the owner
+type Replies interface {
+	Reply(decision *protocol.SignedDecision) error
+}
+
+// Channel transports notifications to the owner's app. Decisions coming back
+// from the app are passed to Replies given to Start.
+type Channel interface {
+	Name() string
+	Start(replies Replies) error
+	Deliver(notification *models.PermissionNotificationRequest) error
+	Stop() error
+}
+
+// Plugin is authorization plugin waiting for owner decision delivered by channel.
+// Decisions are correlated with notifications by transaction ID.
+type Plugin struct {
+	sync.Mutex
+	channel Channel
+	timeout time.Duration
+	devices protocol.DeviceStore
+	pending map[string]chan models.PermissionNotificationResponse
+}
+
+// NewPlugin starts channel and returns plugin using it, decisions
+// are accepted only from devices paired in devices store
+func NewPlugin(channel Channel, timeout time.Duration, devices protocol.DeviceStore) (*Plugin, error) {
+	p := &Plugin{
+		channel: channel,
+		timeout: timeout,
+		devices: devices,
+		pending: make(map[string]chan models.PermissionNotificationResponse),
+	}
+
+	if err := channel.Start(p); err != nil {
+		return nil, fmt.Errorf("%s channel: %s", channel.Name(), err)
+	}
+	return p, nil
+}
+
+// Authorize delivers notification and waits for owner decision
+func (p *Plugin) Authorize(input *models.PermissionNotificationRequest) (*models.PermissionNotificationResponse, error) {
+	reply := make(chan models.PermissionNotificationResponse, 1)
+
+	p.Lock()
+	if _, ok := p.pending[input.TransactionID]; ok {
+		p.Unlock()
+		return nil, fmt.Errorf("%s: %s", ErrDuplicate, input.TransactionID)
+	}
+	p.pending[input.TransactionID] = reply
+	p.Unlock()
+
+	defer func() {
+		p.Lock()
+		delete(p.pending, input.TransactionID)
+		p.Unlock()
+	}()
+
+	if err := p.channel.Deliver(input); err != nil {
+		return nil, fmt.Errorf("%s: %s: %s", ErrDeliveryFailed, p.channel.Name(), err)
+	}
+
+	select {
+	case response := <-reply:
+		return &response, nil
+	case <-time.After(p.timeout):
+		return nil, fmt.Errorf("%s: %s", ErrTimeout, input.TransactionID)
+	}
+}
+
+// Reply verifies owner decision and passes it to pending Authorize call
+func (p *Plugin) Reply(decision *protocol.SignedDecision) error {
+	response, err := protocol.VerifyDecision(decision, p.devices)
+	if err != nil {
+		return err
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	reply, ok := p.pending[response.TransactionID]
+	if !ok {
+		return fmt.Errorf("%s: %s", ErrUnknownTransaction, response.TransactionID)
+	}
+	delete(p.pending, response.TransactionID)
+	reply <- *response
+	return nil
+}
+
+// Stop stops underlying channel
+func (p *Plugin) Stop() error {
+	return p.channel.Stop()
+}
+
+// ChannelFactory creates channel from configuration parameters
+type ChannelFactory func(params map[string]string) (Channel, error)
+
+// Config configures consent channel of the responder
+type Config struct {
+	Type           string            `json:"type"`
+	TimeoutSeconds int               `json:"timeout_seconds"`
+	Params         map[string]string `json:"params"`
+}
+
+var (
+	factoriesLock    sync.RWMutex
+	channelFactories = map[string]ChannelFactory{
+		"webhook":   NewWebhookFromParams,
+		"sse":       NewSSEFromParams,
+		"websocket": NewWebsocketFromParams,
+	}
+)
+
+// RegisterChannelFactory makes channel type available in configuration
+func RegisterChannelFactory(name string, factory ChannelFactory) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+	channelFactories[name] = factory
+}
+
+// LoadConfig reads consent channel configuration from JSON file
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("consent config %q: %s", path, err)
+	}
+	return &config, nil
+}
+
+// NewPluginFromConfig creates channel defined in configuration and plugin using it
+func NewPluginFromConfig(config *Config, devices protocol.DeviceStore) (*Plugin, error) {
+	factoriesLock.RLock()
+	factory, ok := channelFactories[config.Type]
+	factoriesLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%s: %q", ErrUnknownChannel, config.Type)
+	}
+
+	channel, err := factory(config.Params)
+	if err != nil {
+		return nil, fmt.Errorf("channel %q: %s", config.Type, err)
+	}
+
+	timeout := DefaultTimeout
+	if config.TimeoutSeconds > 0 {
+		timeout = time.Second * time.Duration(config.TimeoutSeconds)
+	}
+	return NewPlugin(channel, timeout, devices)
+}
+
+func requireParams(params map[string]string, names ...string) error {
+	for _, name := range names {
+		if params[name] == "" {
+			return fmt.Errorf("%s: %q", ErrMissingParam, name)
+		}
+	}
+	return nil
+}
+
+// listener is HTTP server channels use to receive app connections and replies
+type listener struct {
+	server *http.Server
+	addr   string
+}
+
+// serve starts serving router in background, write timeout is not set
+// because streaming channels keep responses open
+func (l *listener) serve(addr string, router *mux.Router) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	l.addr = ln.Addr().String()
+	l.server = &http.Server{
+		ReadTimeout: time.Second * 15,
+		IdleTimeout: time.Second * 60,
+		Handler:     router,
+	}
+	go func() {
+		_ = l.server.Serve(ln)
+	}()
+	return nil
+}
+
+// Addr returns address channel listens on
+func (l *listener) Addr() string {
+	return l.addr
+}
+
+func (l *listener) stop() error {
+	if l.server == nil {
+		return nil
+	}
+	return l.server.Close()
+}
+
+// replyHandler decodes owner decision from request body and passes it to replies,
+// authorize checks request before body is decoded
+func replyHandler(replies Replies, authorize func(r *http.Request, body []byte) bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if !authorize(r, body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var decision protocol.SignedDecision
+		if err := json.Unmarshal(body, &decision); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if err := replies.Reply(&decision); err != nil {
+			if strings.HasPrefix(err.Error(), ErrUnknownTransaction.Error()) {
+				w.WriteHeader(http.StatusNotFound)
+			} else {
+				w.WriteHeader(http.StatusForbidden)
+			}
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,222 @@
+package consent
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+	"github.com/odysseyhack/planet-society/protocol/protocol"
+)
+
+// testDevices is in-memory protocol.DeviceStore
+type testDevices map[string]models.Device
+
+func (t testDevices) DevicePut(device *models.Device) error {
+	t[device.ID] = *device
+	return nil
+}
+
+func (t testDevices) Device(id string) (models.Device, error) {
+	device, ok := t[id]
+	if !ok {
+		return device, fmt.Errorf("device %s not found", id)
+	}
+	return device, nil
+}
+
+func (t testDevices) DeviceList() (devices []models.Device, err error) {
+	for _, device := range t {
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+// pairedDevice returns keychain of device and store in which it is paired
+func pairedDevice(t *testing.T) (*cryptography.Keychain, testDevices) {
+	keychain, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+
+	devices := testDevices{}
+	devices.DevicePut(&models.Device{
+		ID:           keychain.MainPublicKey.String(),
+		PublicKey:    models.Key32{Key: keychain.MainPublicKey},
+		SignatureKey: models.Key32{Key: keychain.SignaturePublicKey},
+	})
+	return keychain, devices
+}
+
+func accept(notification *models.PermissionNotificationRequest) *models.PermissionNotificationResponse {
+	return &models.PermissionNotificationResponse{TransactionID: notification.TransactionID, Accepted: true}
+}
+
+func testAuthorize(t *testing.T, plugin *Plugin) {
+	for _, id := range []string{"first", "second"} {
+		response, err := plugin.Authorize(&models.PermissionNotificationRequest{TransactionID: id})
+		if err != nil {
+			t.Fatalf("Authorize(%s) failed: %s", id, err)
+		}
+
+		if response.TransactionID != id || !response.Accepted {
+			t.Errorf("Authorize(%s) returned %+v", id, response)
+		}
+	}
+}
+
+type testChannel struct {
+	replies   Replies
+	delivered chan *models.PermissionNotificationRequest
+}
+
+func (c *testChannel) Name() string                { return "test" }
+func (c *testChannel) Start(replies Replies) error { c.replies = replies; return nil }
+func (c *testChannel) Stop() error                 { return nil }
+func (c *testChannel) Deliver(notification *models.PermissionNotificationRequest) error {
+	c.delivered <- notification
+	return nil
+}
+
+func TestPlugin(t *testing.T) {
+	device, devices := pairedDevice(t)
+	channel := &testChannel{delivered: make(chan *models.PermissionNotificationRequest, 3)}
+	plugin, err := NewPlugin(channel, time.Millisecond*100, devices)
+	if err != nil {
+		t.Fatalf("NewPlugin() failed: %s", err)
+	}
+
+	unknown, err := protocol.SignDecision(&models.PermissionNotificationResponse{TransactionID: "unknown"}, device)
+	if err != nil {
+		t.Fatalf("SignDecision() failed: %s", err)
+	}
+	if err := plugin.Reply(unknown); err == nil || !strings.HasPrefix(err.Error(), ErrUnknownTransaction.Error()) {
+		t.Errorf("Reply() of unknown transaction returned %v", err)
+	}
+
+	unknown.Response.Accepted = true
+	if err := plugin.Reply(unknown); err == nil || !strings.HasPrefix(err.Error(), protocol.ErrDecisionSignature.Error()) {
+		t.Errorf("Reply() of altered decision returned %v", err)
+	}
+
+	other, _ := pairedDevice(t)
+	go func() {
+		for i := 0; i < 2; i++ {
+			notification := <-channel.delivered
+			forged, _ := protocol.SignDecision(accept(notification), other)
+			if err := plugin.Reply(forged); err == nil || !strings.HasPrefix(err.Error(), protocol.ErrUnknownDevice.Error()) {
+				t.Errorf("Reply() of unpaired device returned %v", err)
+			}
+
+			signed, _ := protocol.SignDecision(accept(notification), device)
+			_ = plugin.Reply(signed)
+		}
+	}()
+	testAuthorize(t, plugin)
+
+	if _, err := plugin.Authorize(&models.PermissionNotificationRequest{TransactionID: "third"}); err == nil ||
+		!strings.HasPrefix(err.Error(), ErrTimeout.Error()) {
+		t.Errorf("Authorize() without reply returned %v", err)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	device, devices := pairedDevice(t)
+	webhook := NewWebhook("", "secret", "127.0.0.1:0")
+	plugin, err := NewPlugin(webhook, time.Second*5, devices)
+	if err != nil {
+		t.Fatalf("NewPlugin() failed: %s", err)
+	}
+	defer plugin.Stop()
+
+	app := httptest.NewServer(WebhookReceiver("secret", "http://"+webhook.Addr()+ReplyPath, device, accept))
+	defer app.Close()
+	webhook.url = app.URL
+
+	testAuthorize(t, plugin)
+
+	resp, err := http.Post("http://"+webhook.Addr()+ReplyPath, "application/json",
+		bytes.NewBufferString(`{"transactionID":"first","accepted":true}`))
+	if err != nil {
+		t.Fatalf("Post() failed: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("unsigned reply returned %d, expected %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+
+	other := httptest.NewServer(WebhookReceiver("other", "http://"+webhook.Addr()+ReplyPath, device, accept))
+	defer other.Close()
+	webhook.url = other.URL
+	if _, err := plugin.Authorize(&models.PermissionNotificationRequest{TransactionID: "third"}); err == nil ||
+		!strings.HasPrefix(err.Error(), ErrDeliveryFailed.Error()) {
+		t.Errorf("Authorize() with wrong secret returned %v", err)
+	}
+}
+
+func TestSSE(t *testing.T) {
+	device, devices := pairedDevice(t)
+	sse := NewSSE("token", "127.0.0.1:0")
+	plugin, err := NewPlugin(sse, time.Second*5, devices)
+	if err != nil {
+		t.Fatalf("NewPlugin() failed: %s", err)
+	}
+	defer plugin.Stop()
+
+	base := "http://" + sse.Addr()
+	if err := ReceiveSSE(base+EventsPath, base+ReplyPath, "wrong", device, accept); err == nil {
+		t.Errorf("ReceiveSSE() with wrong token succeeded")
+	}
+
+	go func() {
+		_ = ReceiveSSE(base+EventsPath, base+ReplyPath, "token", device, accept)
+	}()
+	testAuthorize(t, plugin)
+}
+
+func TestWebsocket(t *testing.T) {
+	device, devices := pairedDevice(t)
+	ws := NewWebsocket("token", "127.0.0.1:0")
+	plugin, err := NewPlugin(ws, time.Second*5, devices)
+	if err != nil {
+		t.Fatalf("NewPlugin() failed: %s", err)
+	}
+	defer plugin.Stop()
+
+	url := "ws://" + ws.Addr() + WebsocketPath
+	if err := ReceiveWebsocket(url, "wrong", device, accept); err == nil {
+		t.Errorf("ReceiveWebsocket() with wrong token succeeded")
+	}
+
+	go func() {
+		_ = ReceiveWebsocket(url, "token", device, accept)
+	}()
+	testAuthorize(t, plugin)
+}
+
+func TestNewPluginFromConfig(t *testing.T) {
+	if _, err := NewPluginFromConfig(&Config{Type: "pigeon"}, testDevices{}); err == nil ||
+		!strings.HasPrefix(err.Error(), ErrUnknownChannel.Error()) {
+		t.Errorf("unknown channel returned %v", err)
+	}
+
+	if _, err := NewPluginFromConfig(&Config{Type: "sse", Params: map[string]string{"listen": "127.0.0.1:0"}}, testDevices{}); err == nil ||
+		!strings.Contains(err.Error(), ErrMissingParam.Error()) {
+		t.Errorf("missing token returned %v", err)
+	}
+
+	plugin, err := NewPluginFromConfig(&Config{Type: "websocket", Params: map[string]string{"token": "t", "listen": "127.0.0.1:0"}}, testDevices{})
+	if err != nil {
+		t.Fatalf("NewPluginFromConfig() failed: %s", err)
+	}
+	defer plugin.Stop()
+
+	if plugin.timeout != DefaultTimeout {
+		t.Errorf("timeout is %s, expected %s", plugin.timeout, DefaultTimeout)
+	}
+}
@@ -0,0 +1,175 @@
+package consent
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+const (
+	// EventsPath is path of Server-Sent Events stream with notifications
+	EventsPath = "/consent/events"
+
+	// maxQueued limits notifications kept for single app
+	maxQueued = 64
+)
+
+// authorized checks app token given as bearer token or, for clients
+// unable to set headers, as "token" query parameter
+func authorized(r *http.Request, token string) bool {
+	given := r.URL.Query().Get("token")
+	if header := r.Header.Get("Authorization"); header != "" {
+		given = strings.TrimPrefix(header, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+// subscribers keeps apps connected to streaming channel. Notifications
+// published while no app is connected are queued for the first app connecting.
+type subscribers struct {
+	sync.Mutex
+	clients map[chan []byte]struct{}
+	queue   [][]byte
+}
+
+func newSubscribers() *subscribers {
+	return &subscribers{clients: make(map[chan []byte]struct{})}
+}
+
+func (s *subscribers) subscribe() chan []byte {
+	s.Lock()
+	defer s.Unlock()
+
+	client := make(chan []byte, maxQueued)
+	for _, data := range s.queue {
+		client <- data
+	}
+	s.queue = nil
+	s.clients[client] = struct{}{}
+	return client
+}
+
+func (s *subscribers) unsubscribe(client chan []byte) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.clients, client)
+}
+
+// publish sends data to all connected apps, slow apps with full buffer miss notification
+func (s *subscribers) publish(data []byte) {
+	s.Lock()
+	defer s.Unlock()
+
+	if len(s.clients) == 0 {
+		if len(s.queue) == maxQueued {
+			s.queue = s.queue[1:]
+		}
+		s.queue = append(s.queue, data)
+		return
+	}
+
+	for client := range s.clients {
+		select {
+		case client <- data:
+		default:
+		}
+	}
+}
+
+// SSE streams notifications to apps connected to EventsPath, apps reply
+// by posting decision to ReplyPath. Both endpoints require app token.
+type SSE struct {
+	listener
+	token       string
+	listen      string
+	subscribers *subscribers
+	quit        chan struct{}
+}
+
+// NewSSE creates Server-Sent Events channel
+func NewSSE(token, listen string) *SSE {
+	return &SSE{
+		token:       token,
+		listen:      listen,
+		subscribers: newSubscribers(),
+		quit:        make(chan struct{}),
+	}
+}
+
+// NewSSEFromParams creates SSE using parameters: "token" of the app
+// and "listen" address of events stream
+func NewSSEFromParams(params map[string]string) (Channel, error) {
+	if err := requireParams(params, "token", "listen"); err != nil {
+		return nil, err
+	}
+	return NewSSE(params["token"], params["listen"]), nil
+}
+
+func (s *SSE) Name() string {
+	return "sse"
+}
+
+func (s *SSE) Start(replies Replies) error {
+	router := mux.NewRouter()
+	router.HandleFunc(EventsPath, s.events).Methods(http.MethodGet)
+	router.HandleFunc(ReplyPath, replyHandler(replies, func(r *http.Request, body []byte) bool {
+		return authorized(r, s.token)
+	})).Methods(http.MethodPost)
+	return s.serve(s.listen, router)
+}
+
+func (s *SSE) events(w http.ResponseWriter, r *http.Request) {
+	if !authorized(r, s.token) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	client := s.subscribers.subscribe()
+	defer s.subscribers.unsubscribe(client)
+
+	for {
+		select {
+		case data := <-client:
+			if _, err := fmt.Fprintf(w, "event: notification\ndata: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+func (s *SSE) Deliver(notification *models.PermissionNotificationRequest) error {
+	data, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	s.subscribers.publish(data)
+	return nil
+}
+
+func (s *SSE) Stop() error {
+	close(s.quit)
+	return s.stop()
+}
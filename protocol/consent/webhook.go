@@ -0,0 +1,107 @@
+package consent
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+const (
+	// SignatureHeader carries HMAC-SHA256 of request body, both notifications
+	// sent by webhook and replies sent by the app are signed
+	SignatureHeader = "X-Planet-Signature"
+	signaturePrefix = "sha256="
+
+	// ReplyPath is path on which channels accept owner decisions
+	ReplyPath = "/consent/reply"
+)
+
+// Sign returns signature header value of body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks signature header value of body
+func VerifySignature(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// Webhook posts signed notifications to app URL, app replies by posting
+// signed decision to ReplyPath on listen address
+type Webhook struct {
+	listener
+	url    string
+	secret string
+	listen string
+	client *http.Client
+}
+
+// NewWebhook creates webhook channel
+func NewWebhook(url, secret, listen string) *Webhook {
+	return &Webhook{
+		url:    url,
+		secret: secret,
+		listen: listen,
+		client: &http.Client{Timeout: time.Second * 15},
+	}
+}
+
+// NewWebhookFromParams creates Webhook using parameters: "url" of the app,
+// "secret" shared with the app and "listen" address for replies
+func NewWebhookFromParams(params map[string]string) (Channel, error) {
+	if err := requireParams(params, "url", "secret", "listen"); err != nil {
+		return nil, err
+	}
+	return NewWebhook(params["url"], params["secret"], params["listen"]), nil
+}
+
+func (w *Webhook) Name() string {
+	return "webhook"
+}
+
+func (w *Webhook) Start(replies Replies) error {
+	router := mux.NewRouter()
+	router.HandleFunc(ReplyPath, replyHandler(replies, func(r *http.Request, body []byte) bool {
+		return VerifySignature(w.secret, body, r.Header.Get(SignatureHeader))
+	})).Methods(http.MethodPost)
+	return w.serve(w.listen, router)
+}
+
+func (w *Webhook) Deliver(notification *models.PermissionNotificationRequest) error {
+	data, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	rq, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	rq.Header.Set("Content-Type", "application/json")
+	rq.Header.Set(SignatureHeader, Sign(w.secret, data))
+
+	resp, err := w.client.Do(rq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (w *Webhook) Stop() error {
+	return w.stop()
+}
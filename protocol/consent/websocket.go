@@ -0,0 +1,127 @@
+package consent
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/odysseyhack/planet-society/protocol/models"
+	"github.com/odysseyhack/planet-society/protocol/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// WebsocketPath is path on which apps open push connection
+const WebsocketPath = "/consent/ws"
+
+// Websocket pushes notifications as JSON text messages to apps connected
+// to WebsocketPath, apps send decisions back over the same connection
+type Websocket struct {
+	listener
+	token       string
+	listen      string
+	upgrader    websocket.Upgrader
+	replies     Replies
+	subscribers *subscribers
+	quit        chan struct{}
+}
+
+// NewWebsocket creates websocket push channel
+func NewWebsocket(token, listen string) *Websocket {
+	return &Websocket{
+		token:  token,
+		listen: listen,
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+		subscribers: newSubscribers(),
+		quit:        make(chan struct{}),
+	}
+}
+
+// NewWebsocketFromParams creates Websocket using parameters: "token" of the app
+// and "listen" address of push endpoint
+func NewWebsocketFromParams(params map[string]string) (Channel, error) {
+	if err := requireParams(params, "token", "listen"); err != nil {
+		return nil, err
+	}
+	return NewWebsocket(params["token"], params["listen"]), nil
+}
+
+func (ws *Websocket) Name() string {
+	return "websocket"
+}
+
+func (ws *Websocket) Start(replies Replies) error {
+	ws.replies = replies
+	router := mux.NewRouter()
+	router.HandleFunc(WebsocketPath, ws.connect)
+	return ws.serve(ws.listen, router)
+}
+
+func (ws *Websocket) connect(w http.ResponseWriter, r *http.Request) {
+	if !authorized(r, ws.token) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := ws.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	client := ws.subscribers.subscribe()
+	defer ws.subscribers.unsubscribe(client)
+
+	done := make(chan struct{})
+	go ws.read(conn, done)
+
+	for {
+		select {
+		case data := <-client:
+			if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		case <-done:
+			return
+		case <-ws.quit:
+			return
+		}
+	}
+}
+
+// read passes decisions sent by the app to replies until connection is closed
+func (ws *Websocket) read(conn *websocket.Conn, done chan struct{}) {
+	defer close(done)
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var decision protocol.SignedDecision
+		if err := json.Unmarshal(data, &decision); err != nil {
+			log.Warningln("consent websocket: invalid reply:", err)
+			continue
+		}
+
+		if err := ws.replies.Reply(&decision); err != nil {
+			log.Warningln("consent websocket:", err)
+		}
+	}
+}
+
+func (ws *Websocket) Deliver(notification *models.PermissionNotificationRequest) error {
+	data, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	ws.subscribers.publish(data)
+	return nil
+}
+
+func (ws *Websocket) Stop() error {
+	close(ws.quit)
+	return ws.stop()
+}
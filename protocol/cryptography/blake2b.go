@@ -12,3 +12,12 @@ func Hash16(data []byte) (ret [16]byte) {
 	copy(ret[:], hash[:])
 	return ret
 }
+
+// KeyedHash32 creates 32 byte blake2b MAC of data with the key
+func KeyedHash32(key Key32, data []byte) (ret Key32) {
+	// error is returned only for keys longer than 64 bytes
+	hash, _ := blake2b.New256(key[:])
+	_, _ = hash.Write(data)
+	copy(ret[:], hash.Sum(nil))
+	return ret
+}
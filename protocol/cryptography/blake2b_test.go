@@ -26,3 +26,16 @@ func TestHash16NonEmpty(t *testing.T) {
 		t.Errorf("Hash16 returned empty hash")
 	}
 }
+
+func TestKeyedHash32(t *testing.T) {
+	keyA, keyB := RandomKey32(), RandomKey32()
+	data := []byte("some random text")
+
+	if !KeyedHash32(keyA, data).Equal(KeyedHash32(keyA, data)) {
+		t.Errorf("KeyedHash32 is not deterministic")
+	}
+
+	if KeyedHash32(keyA, data).Equal(KeyedHash32(keyB, data)) {
+		t.Errorf("KeyedHash32 returned the same hash for different keys")
+	}
+}
@@ -0,0 +1,140 @@
+package cryptography
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// KeyType is algorithm of public key encoded in did:key identifier
+type KeyType int
+
+const (
+	// KeyTypeX25519 is key used for encryption, e.g. Keychain.MainPublicKey
+	KeyTypeX25519 KeyType = iota + 1
+	// KeyTypeEd25519 is key used for signatures, e.g. Keychain.SignaturePublicKey
+	KeyTypeEd25519
+)
+
+// DIDKeyPrefix starts every did:key identifier
+const DIDKeyPrefix = "did:key:"
+
+// multibaseBase58 is multibase prefix of base58btc encoding
+const multibaseBase58 = 'z'
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// multicodec returns varint encoded multicodec prefix of key type
+func (t KeyType) multicodec() []byte {
+	switch t {
+	case KeyTypeX25519:
+		return []byte{0xec, 0x01}
+	case KeyTypeEd25519:
+		return []byte{0xed, 0x01}
+	}
+	return nil
+}
+
+// String returns name of verification method type of the key
+func (t KeyType) String() string {
+	switch t {
+	case KeyTypeX25519:
+		return "X25519KeyAgreementKey2020"
+	case KeyTypeEd25519:
+		return "Ed25519VerificationKey2020"
+	}
+	return "unknown"
+}
+
+// MultibaseKey returns multibase encoded key with multicodec prefix, it is method specific id of did:key
+func MultibaseKey(key Key32, keyType KeyType) string {
+	return string(multibaseBase58) + base58Encode(append(keyType.multicodec(), key[:]...))
+}
+
+// EncodeDIDKey returns did:key identifier of the key
+func EncodeDIDKey(key Key32, keyType KeyType) string {
+	return DIDKeyPrefix + MultibaseKey(key, keyType)
+}
+
+// DecodeDIDKey returns key and its type encoded in did:key identifier, DID URL fragment is ignored
+func DecodeDIDKey(did string) (key Key32, keyType KeyType, err error) {
+	if !strings.HasPrefix(did, DIDKeyPrefix) {
+		return key, 0, fmt.Errorf("diddecode: %q is not did:key", did)
+	}
+
+	id := strings.TrimPrefix(did, DIDKeyPrefix)
+	if i := strings.IndexByte(id, '#'); i >= 0 {
+		id = id[:i]
+	}
+
+	if id == "" || id[0] != multibaseBase58 {
+		return key, 0, fmt.Errorf("diddecode: unsupported multibase encoding")
+	}
+
+	raw, err := base58Decode(id[1:])
+	if err != nil {
+		return key, 0, err
+	}
+
+	for _, t := range []KeyType{KeyTypeX25519, KeyTypeEd25519} {
+		prefix := t.multicodec()
+		if bytes.HasPrefix(raw, prefix) {
+			key, err = Key32FromByte(raw[len(prefix):])
+			return key, t, err
+		}
+	}
+	return key, 0, fmt.Errorf("diddecode: unsupported key type")
+}
+
+// MainDID returns did:key identifier of main public key
+func (k *Keychain) MainDID() string {
+	return EncodeDIDKey(k.MainPublicKey, KeyTypeX25519)
+}
+
+// SignatureDID returns did:key identifier of signature public key
+func (k *Keychain) SignatureDID() string {
+	return EncodeDIDKey(k.SignaturePublicKey, KeyTypeEd25519)
+}
+
+func base58Encode(data []byte) string {
+	value := new(big.Int).SetBytes(data)
+	base, mod := big.NewInt(58), new(big.Int)
+
+	var encoded []byte
+	for value.Sign() > 0 {
+		value.DivMod(value, base, mod)
+		encoded = append(encoded, base58Alphabet[mod.Int64()])
+	}
+
+	// leading zero bytes are encoded as leading ones
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		encoded = append(encoded, base58Alphabet[0])
+	}
+
+	for i, j := 0, len(encoded)-1; i < j; i, j = i+1, j-1 {
+		encoded[i], encoded[j] = encoded[j], encoded[i]
+	}
+	return string(encoded)
+}
+
+func base58Decode(encoded string) ([]byte, error) {
+	value, base := new(big.Int), big.NewInt(58)
+	for _, c := range encoded {
+		digit := strings.IndexRune(base58Alphabet, c)
+		if digit < 0 {
+			return nil, fmt.Errorf("base58decode: invalid character %q", c)
+		}
+		value.Mul(value, base)
+		value.Add(value, big.NewInt(int64(digit)))
+	}
+
+	var zeros int
+	for zeros < len(encoded) && encoded[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+	return append(make([]byte, zeros), value.Bytes()...), nil
+}
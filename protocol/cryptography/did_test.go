@@ -0,0 +1,55 @@
+package cryptography
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestEncodeDIDKey(t *testing.T) {
+	// test vector of did:key specification
+	raw, _ := hex.DecodeString("2e6fcce36701dc791488e0d0b1745cc1e33a4c1c9fcc41c63bd343dbbe0970e6")
+	key, err := Key32FromByte(raw)
+	if err != nil {
+		t.Fatalf("Key32FromByte() failed: %s", err)
+	}
+
+	did := EncodeDIDKey(key, KeyTypeEd25519)
+	if did != "did:key:z6MkhaXgBZDvotDkL5257faiztiGiC2QtKLGpbnnEGta2doK" {
+		t.Errorf("EncodeDIDKey() returned %s", did)
+	}
+
+	decoded, keyType, err := DecodeDIDKey(did + "#z6MkhaXgBZDvotDkL5257faiztiGiC2QtKLGpbnnEGta2doK")
+	if err != nil {
+		t.Fatalf("DecodeDIDKey() failed: %s", err)
+	}
+	if !decoded.Equal(key) || keyType != KeyTypeEd25519 {
+		t.Errorf("DecodeDIDKey() returned %x, %s", decoded, keyType)
+	}
+}
+
+func TestDIDKeyRoundTrip(t *testing.T) {
+	keychain, err := OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+
+	for did, expected := range map[string]Key32{keychain.MainDID(): keychain.MainPublicKey, keychain.SignatureDID(): keychain.SignaturePublicKey} {
+		key, _, err := DecodeDIDKey(did)
+		if err != nil {
+			t.Fatalf("DecodeDIDKey(%s) failed: %s", did, err)
+		}
+		if !key.Equal(expected) {
+			t.Errorf("DecodeDIDKey(%s) returned %x", did, key)
+		}
+	}
+
+	if _, keyType, _ := DecodeDIDKey(keychain.MainDID()); keyType != KeyTypeX25519 {
+		t.Errorf("main key decoded as %s", keyType)
+	}
+
+	for _, invalid := range []string{"did:web:example.com", "did:key:f1234", "did:key:z0OIl", "did:key:z6Mk"} {
+		if _, _, err := DecodeDIDKey(invalid); err == nil {
+			t.Errorf("DecodeDIDKey(%s) succeeded", invalid)
+		}
+	}
+}
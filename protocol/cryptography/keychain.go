@@ -1,5 +1,10 @@
 package cryptography
 
+import (
+	"encoding/json"
+	"io/ioutil"
+)
+
 type Keychain struct {
 	MainPublicKey       Key32
 	MainPrivateKey      Key32
@@ -24,3 +29,26 @@ func OneShotKeychain() (*Keychain, error) {
 	}
 	return &Keychain{MainPublicKey: mainBox.publicKey, MainPrivateKey: mainBox.privateKey, StoragePublicKey: storageBox.publicKey, StoragePrivateKey: storageBox.privateKey, SignaturePublicKey: signer.publicKey, SignaturePrivateKey: signer.privateKey}, nil
 }
+
+// SaveKeychain stores keychain in the file readable only by the owner
+func SaveKeychain(path string, keychain *Keychain) error {
+	data, err := json.Marshal(keychain)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// LoadKeychain reads keychain stored with SaveKeychain
+func LoadKeychain(path string) (*Keychain, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keychain Keychain
+	if err := json.Unmarshal(data, &keychain); err != nil {
+		return nil, err
+	}
+	return &keychain, nil
+}
@@ -1,6 +1,11 @@
 package cryptography
 
-import "testing"
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
 
 func TestOneShotKeychain(t *testing.T) {
 	keychain, err := OneShotKeychain()
@@ -12,3 +17,30 @@ func TestOneShotKeychain(t *testing.T) {
 		t.Errorf("OneShotKeychain returned nil keychain")
 	}
 }
+
+func TestSaveLoadKeychain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keychain")
+	if err != nil {
+		t.Fatalf("failed to create temporary dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	keychain, err := OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain failed: %s", err)
+	}
+
+	path := filepath.Join(dir, "keychain.json")
+	if err := SaveKeychain(path, keychain); err != nil {
+		t.Fatalf("SaveKeychain failed: %s", err)
+	}
+
+	loaded, err := LoadKeychain(path)
+	if err != nil {
+		t.Fatalf("LoadKeychain failed: %s", err)
+	}
+
+	if *loaded != *keychain {
+		t.Errorf("LoadKeychain returned different keychain")
+	}
+}
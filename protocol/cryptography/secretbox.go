@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
 )
 
 // SecretBox is structure performing cryptographic operations
@@ -41,3 +42,19 @@ func (s *SecretBox) Decrypt(encrypted []byte) ([]byte, error) {
 
 	return decrypted, nil
 }
+
+const (
+	// scrypt parameters recommended for interactive logins in 2017
+	passphraseN = 32768
+	passphraseR = 8
+	passphraseP = 1
+)
+
+// KeyFromPassphrase derives symmetric key from passphrase using scrypt
+func KeyFromPassphrase(passphrase, salt []byte) (key Key32, err error) {
+	derived, err := scrypt.Key(passphrase, salt, passphraseN, passphraseR, passphraseP, len(key))
+	if err != nil {
+		return key, err
+	}
+	return Key32FromByte(derived)
+}
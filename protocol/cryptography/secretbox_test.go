@@ -37,3 +37,29 @@ func TestSecretBox(t *testing.T) {
 		t.Errorf("secretbox.Decrypt returned %q, expected %q", string(decrypted), message)
 	}
 }
+
+func TestKeyFromPassphrase(t *testing.T) {
+	salt := []byte("salt")
+	first, err := KeyFromPassphrase([]byte("passphrase"), salt)
+	if err != nil {
+		t.Fatalf("KeyFromPassphrase failed: %s", err)
+	}
+
+	second, err := KeyFromPassphrase([]byte("passphrase"), salt)
+	if err != nil {
+		t.Fatalf("KeyFromPassphrase failed: %s", err)
+	}
+
+	if !first.Equal(second) {
+		t.Errorf("KeyFromPassphrase returned different keys for the same passphrase")
+	}
+
+	other, err := KeyFromPassphrase([]byte("other"), salt)
+	if err != nil {
+		t.Fatalf("KeyFromPassphrase failed: %s", err)
+	}
+
+	if first.Equal(other) {
+		t.Errorf("KeyFromPassphrase returned the same key for different passphrases")
+	}
+}
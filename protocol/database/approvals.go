@@ -0,0 +1,47 @@
+package database
+
+import (
+	"github.com/boltdb/bolt"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+// ApprovalPolicySet sets policy requiring several approvals of sensitive requests
+func (d *Database) ApprovalPolicySet(policy models.ApprovalPolicy) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(bucketSettings))
+		if err != nil {
+			return err
+		}
+		return d.put(bucket, []byte(approvalPolicyKey), &policy)
+	})
+}
+
+// ApprovalPolicy returns approval policy, nil is returned if policy is not set
+func (d *Database) ApprovalPolicy() (policy *models.ApprovalPolicy, err error) {
+	err = d.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(bucketSettings))
+		if bucket == nil {
+			return nil
+		}
+
+		raw := bucket.Get([]byte(approvalPolicyKey))
+		if raw == nil {
+			return nil
+		}
+
+		policy = &models.ApprovalPolicy{}
+		return d.decode(raw, policy)
+	})
+	return policy, err
+}
+
+// ApprovalPolicyDel removes approval policy, requests are approved by single decision again
+func (d *Database) ApprovalPolicyDel() error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(bucketSettings))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.Delete([]byte(approvalPolicyKey))
+	})
+}
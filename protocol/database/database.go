@@ -21,6 +21,19 @@ import (
 //              -> payment_cards [ID]
 //              -> passports [ID]
 //              -> identity_document [ID]
+//   -> requester_lists [Key32=requester public key]
+//   -> settings
+//       -> requester_policy
+//       -> approval_policy
+//   -> legal_templates [template ID@version]
+//   -> data_subject_requests [request ID]
+//   -> delegations [delegation ID]
+//   -> devices [device ID]
+//   -> selection_defaults [Key32=requester public key]
+//   -> metadata
+//       -> schema_version
+//
+// Obligations are stored inside of the permission they come from.
 
 type Database struct {
 	db       *bolt.DB
@@ -28,7 +41,8 @@ type Database struct {
 }
 
 // LoadDatabase loads database from the file and returns handler to it.
-// If the database is not existing it will be created and initialized with buckets.
+// If the database is not existing it will be created and initialized with buckets,
+// database created by older version is migrated to SchemaVersion.
 func LoadDatabase(filePath string, keychain *cryptography.Keychain) (*Database, error) {
 	directory, _ := filepath.Split(filePath)
 	if err := os.MkdirAll(directory, 0700); err != nil {
@@ -46,19 +60,27 @@ func LoadDatabase(filePath string, keychain *cryptography.Keychain) (*Database,
 		db:       db,
 		keychain: keychain,
 	}
-	if err := database.initialize(os.IsNotExist(statErr)); err != nil {
+	if err := database.initialize(os.IsNotExist(statErr), filePath); err != nil {
+		_ = db.Close()
 		return nil, err
 	}
 
 	return database, nil
 }
 
-// Initialize initializes database with proper buckets
-func (d *Database) initialize(run bool) error {
-	if run {
-		return d.db.Update(d.bucketInitialize)
+// initialize initializes new database with proper buckets and current schema version,
+// existing database is migrated
+func (d *Database) initialize(created bool, filePath string) error {
+	if !created {
+		return d.migrate(filePath)
 	}
-	return nil
+
+	return d.db.Update(func(tx *bolt.Tx) error {
+		if err := d.bucketInitialize(tx); err != nil {
+			return err
+		}
+		return d.setSchemaVersion(tx, SchemaVersion)
+	})
 }
 
 // Close closes database
@@ -243,7 +265,7 @@ func (d *Database) contactInputToContact(contact *models.ContactInput, newContac
 	newContact.ID = d.newID()
 	newContact.DisplayName = contact.DisplayName
 	newContact.PublicKey = contact.PublicKey
-	newContact.SignatureKey = contact.SignatureKey
+	newContact.SignatureKey = models.Key32(contact.SignatureKey)
 
 	if contact.Name != nil {
 		newContact.Name = *contact.Name
@@ -757,6 +779,19 @@ func (d *Database) permissionInputToPermission(permission, added *models.Permiss
 	added.ID = d.newID()
 	added.LawApplying = permission.LawApplying
 	added.LegalReliationships = permission.LegalReliationships
+	added.LegalTemplateID = permission.LegalTemplateID
+	added.LegalTemplateVersion = permission.LegalTemplateVersion
+	added.Created = permission.Created
+	added.RequesterEndpoint = permission.RequesterEndpoint
+	added.RetentionUntil = permission.RetentionUntil
+	added.Purpose = permission.Purpose
+	added.Obligations = nil
+	for _, obligation := range permission.Obligations {
+		obligation.ID = d.newID()
+		obligation.PermissionID = added.ID
+		obligation.TransactionID = added.TransactionID
+		added.Obligations = append(added.Obligations, obligation)
+	}
 }
 
 func (d *Database) PermissionAdd(permission models.Permission) (added models.Permission, err error) {
@@ -579,7 +579,7 @@ func TestContactAddReturnValidation(t *testing.T) {
 		Surname:      &surname,
 		Country:      &country,
 		Identity:     identity.ID,
-		SignatureKey: models.Key32{Key: cryptography.RandomKey32()},
+		SignatureKey: models.SignatureKey32{Key: cryptography.RandomKey32()},
 	}
 
 	addedContact, err := db.ContactAdd(newContact)
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"github.com/boltdb/bolt"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+// Contact returns contact with given id from any identity
+func (d *Database) Contact(id string) (contact models.Contact, err error) {
+	err = d.db.View(func(tx *bolt.Tx) error {
+		identitiesBucket := tx.Bucket([]byte(bucketIdentities))
+		if identitiesBucket == nil {
+			return ErrBucketNotFound(bucketIdentities)
+		}
+
+		found := false
+		err := identitiesBucket.ForEach(func(k, v []byte) error {
+			identityBucket := identitiesBucket.Bucket(k)
+			if identityBucket == nil || found {
+				return nil
+			}
+
+			contactsBucket := identityBucket.Bucket([]byte(bucketContacts))
+			if contactsBucket == nil || contactsBucket.Get([]byte(id)) == nil {
+				return nil
+			}
+
+			found = true
+			return d.get(contactsBucket, []byte(id), &contact)
+		})
+		if err != nil {
+			return err
+		}
+
+		if !found {
+			return ErrKeyNotFound([]byte(id))
+		}
+		return nil
+	})
+	return contact, err
+}
+
+// DelegationPut stores delegation granted by the owner
+func (d *Database) DelegationPut(delegation *models.Delegation) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(bucketDelegations))
+		if err != nil {
+			return err
+		}
+		return d.put(bucket, []byte(delegation.ID), delegation)
+	})
+}
+
+// DelegationList lists delegations granted by the owner
+func (d *Database) DelegationList() (list []models.Delegation, err error) {
+	err = d.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(bucketDelegations))
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			var delegation models.Delegation
+			if err := d.decode(v, &delegation); err != nil {
+				return err
+			}
+			list = append(list, delegation)
+			return nil
+		})
+	})
+	return list, err
+}
+
+// DelegationDel removes delegation, requests are not routed to the delegate anymore
+func (d *Database) DelegationDel(id string) (removedID string, err error) {
+	err = d.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(bucketDelegations))
+		if bucket == nil || bucket.Get([]byte(id)) == nil {
+			return ErrKeyNotFound([]byte(id))
+		}
+		return bucket.Delete([]byte(id))
+	})
+	return id, err
+}
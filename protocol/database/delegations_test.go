@@ -0,0 +1,124 @@
+package database
+
+import (
+	"os"
+	"testing"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+func TestDelegations(t *testing.T) {
+	const (
+		fileName = "/tmp/test_dir_i2i/delegations/file.db"
+	)
+
+	wallet, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+
+	db, err := LoadDatabase(fileName, wallet)
+	if err != nil {
+		t.Fatalf("LoadDatabase(%q) failed: %s", fileName, err)
+	}
+
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("Close failed: %s", err)
+		}
+
+		if err := os.RemoveAll("/tmp/test_dir_i2i"); err != nil {
+			t.Errorf("failed to clean after test: %s", err)
+		}
+	}()
+
+	identity, err := db.IdentityAdd(models.IdentityInput{DisplayName: "household"})
+	if err != nil {
+		t.Fatalf("IdentityAdd() failed: %s", err)
+	}
+
+	contact, err := db.ContactAdd(models.ContactInput{Identity: identity.ID, DisplayName: "guardian"})
+	if err != nil {
+		t.Fatalf("ContactAdd() failed: %s", err)
+	}
+
+	found, err := db.Contact(contact.ID)
+	if err != nil || found.DisplayName != "guardian" {
+		t.Fatalf("Contact() returned %+v, %v", found, err)
+	}
+
+	if _, err := db.Contact("unknown"); err == nil {
+		t.Errorf("Contact() of unknown contact succeeded")
+	}
+
+	delegation := &models.Delegation{ID: "delegation", Delegate: found, Scope: models.DelegationScope{MaxSensitivity: models.SensitivityLow}}
+	if err := db.DelegationPut(delegation); err != nil {
+		t.Fatalf("DelegationPut() failed: %s", err)
+	}
+
+	list, err := db.DelegationList()
+	if err != nil || len(list) != 1 || list[0].Delegate.ID != contact.ID {
+		t.Fatalf("DelegationList() returned %+v, %v", list, err)
+	}
+
+	if _, err := db.DelegationDel("delegation"); err != nil {
+		t.Fatalf("DelegationDel() failed: %s", err)
+	}
+
+	if _, err := db.DelegationDel("delegation"); err == nil {
+		t.Errorf("DelegationDel() of removed delegation succeeded")
+	}
+
+	if list, err := db.DelegationList(); err != nil || len(list) != 0 {
+		t.Errorf("DelegationList() returned %+v, %v", list, err)
+	}
+}
+
+func TestApprovalPolicy(t *testing.T) {
+	const (
+		fileName = "/tmp/test_dir_i2i/approvals/file.db"
+	)
+
+	wallet, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+
+	db, err := LoadDatabase(fileName, wallet)
+	if err != nil {
+		t.Fatalf("LoadDatabase(%q) failed: %s", fileName, err)
+	}
+
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("Close failed: %s", err)
+		}
+
+		if err := os.RemoveAll("/tmp/test_dir_i2i"); err != nil {
+			t.Errorf("failed to clean after test: %s", err)
+		}
+	}()
+
+	if policy, err := db.ApprovalPolicy(); err != nil || policy != nil {
+		t.Fatalf("ApprovalPolicy() returned %+v, %v, expected no policy", policy, err)
+	}
+
+	policy := models.ApprovalPolicy{Sensitivity: models.SensitivityHigh, Required: 2, OwnerApproves: true, Approvers: []string{"delegation"}}
+	if err := db.ApprovalPolicySet(policy); err != nil {
+		t.Fatalf("ApprovalPolicySet() failed: %s", err)
+	}
+
+	stored, err := db.ApprovalPolicy()
+	if err != nil || stored == nil || stored.Required != 2 || len(stored.Approvers) != 1 {
+		t.Fatalf("ApprovalPolicy() returned %+v, %v", stored, err)
+	}
+
+	if err := db.ApprovalPolicyDel(); err != nil {
+		t.Fatalf("ApprovalPolicyDel() failed: %s", err)
+	}
+
+	if stored, err := db.ApprovalPolicy(); err != nil || stored != nil {
+		t.Errorf("ApprovalPolicy() returned %+v, %v, expected no policy", stored, err)
+	}
+}
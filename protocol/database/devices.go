@@ -0,0 +1,69 @@
+package database
+
+import (
+	"github.com/boltdb/bolt"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+// DevicePut stores device paired with the owner
+func (d *Database) DevicePut(device *models.Device) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(bucketDevices))
+		if err != nil {
+			return err
+		}
+		return d.put(bucket, []byte(device.ID), device)
+	})
+}
+
+// Device returns paired device, revoked devices are returned as well
+func (d *Database) Device(id string) (device models.Device, err error) {
+	err = d.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(bucketDevices))
+		if bucket == nil || bucket.Get([]byte(id)) == nil {
+			return ErrKeyNotFound([]byte(id))
+		}
+		return d.get(bucket, []byte(id), &device)
+	})
+	return device, err
+}
+
+// DeviceList lists paired devices including revoked ones
+func (d *Database) DeviceList() (list []models.Device, err error) {
+	err = d.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(bucketDevices))
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			var device models.Device
+			if err := d.decode(v, &device); err != nil {
+				return err
+			}
+			list = append(list, device)
+			return nil
+		})
+	})
+	return list, err
+}
+
+// DeviceRevoke marks device revoked, responses signed by it are not accepted anymore
+func (d *Database) DeviceRevoke(id, revokedAt string) (device models.Device, err error) {
+	err = d.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(bucketDevices))
+		if bucket == nil || bucket.Get([]byte(id)) == nil {
+			return ErrKeyNotFound([]byte(id))
+		}
+
+		if err := d.get(bucket, []byte(id), &device); err != nil {
+			return err
+		}
+
+		if device.RevokedAt == nil {
+			device.RevokedAt = &revokedAt
+		}
+		return d.put(bucket, []byte(id), &device)
+	})
+	return device, err
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"os"
+	"testing"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+func TestDevices(t *testing.T) {
+	const (
+		fileName = "/tmp/test_dir_i2i/devices/file.db"
+	)
+
+	wallet, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+
+	db, err := LoadDatabase(fileName, wallet)
+	if err != nil {
+		t.Fatalf("LoadDatabase(%q) failed: %s", fileName, err)
+	}
+
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("Close failed: %s", err)
+		}
+
+		if err := os.RemoveAll("/tmp/test_dir_i2i"); err != nil {
+			t.Errorf("failed to clean after test: %s", err)
+		}
+	}()
+
+	device := &models.Device{ID: "device", DisplayName: "phone", Paired: "2019-04-01T00:00:00Z"}
+	if err := db.DevicePut(device); err != nil {
+		t.Fatalf("DevicePut() failed: %s", err)
+	}
+
+	found, err := db.Device("device")
+	if err != nil || found.DisplayName != "phone" || found.RevokedAt != nil {
+		t.Fatalf("Device() returned %+v, %v", found, err)
+	}
+
+	if _, err := db.Device("unknown"); err == nil {
+		t.Errorf("Device() of unknown device succeeded")
+	}
+
+	revoked, err := db.DeviceRevoke("device", "2019-04-02T00:00:00Z")
+	if err != nil || revoked.RevokedAt == nil || *revoked.RevokedAt != "2019-04-02T00:00:00Z" {
+		t.Fatalf("DeviceRevoke() returned %+v, %v", revoked, err)
+	}
+
+	// revoking again keeps the first revocation time
+	revoked, err = db.DeviceRevoke("device", "2019-04-03T00:00:00Z")
+	if err != nil || *revoked.RevokedAt != "2019-04-02T00:00:00Z" {
+		t.Errorf("second DeviceRevoke() returned %+v, %v", revoked, err)
+	}
+
+	if _, err := db.DeviceRevoke("unknown", "2019-04-02T00:00:00Z"); err == nil {
+		t.Errorf("DeviceRevoke() of unknown device succeeded")
+	}
+
+	list, err := db.DeviceList()
+	if err != nil || len(list) != 1 || list[0].RevokedAt == nil {
+		t.Errorf("DeviceList() returned %+v, %v", list, err)
+	}
+}
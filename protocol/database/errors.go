@@ -16,3 +16,13 @@ func ErrBucketNotFound(name string) error {
 func ErrAlreadyExist(name string) error {
 	return fmt.Errorf("db: item %q already exist", string(name))
 }
+
+// ErrSchemaVersion is returned when database was created by newer version
+func ErrSchemaVersion(version, supported int) error {
+	return fmt.Errorf("db: schema version %d is newer than supported version %d", version, supported)
+}
+
+// ErrInvalidValue is returned when item has invalid field value
+func ErrInvalidValue(field, value string) error {
+	return fmt.Errorf("db: invalid value %q of %q", value, field)
+}
@@ -17,6 +17,34 @@ func (d *Database) bucketInitialize(tx *bolt.Tx) error {
 		return err
 	}
 
+	if _, err := tx.CreateBucketIfNotExists([]byte(bucketRequesterLists)); err != nil {
+		return err
+	}
+
+	if _, err := tx.CreateBucketIfNotExists([]byte(bucketSettings)); err != nil {
+		return err
+	}
+
+	if _, err := tx.CreateBucketIfNotExists([]byte(bucketLegalTemplates)); err != nil {
+		return err
+	}
+
+	if _, err := tx.CreateBucketIfNotExists([]byte(bucketDataSubjects)); err != nil {
+		return err
+	}
+
+	if _, err := tx.CreateBucketIfNotExists([]byte(bucketDelegations)); err != nil {
+		return err
+	}
+
+	if _, err := tx.CreateBucketIfNotExists([]byte(bucketDevices)); err != nil {
+		return err
+	}
+
+	if _, err := tx.CreateBucketIfNotExists([]byte(bucketSelectionDefaults)); err != nil {
+		return err
+	}
+
 	bucket, err = tx.CreateBucketIfNotExists([]byte(personalDetailsBucket))
 	if err != nil {
 		return err
@@ -0,0 +1,118 @@
+package database
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/boltdb/bolt"
+	log "github.com/sirupsen/logrus"
+)
+
+// migration upgrades database from version-1 to version. Migrations run in order,
+// each one in its own transaction together with storing the new version.
+// Migrations must not change once released, new layout needs new migration.
+type migration struct {
+	version     int
+	description string
+	migrate     func(d *Database, tx *bolt.Tx) error
+}
+
+// migrations upgrade databases created by older versions, version 0 are databases created before versioning
+var migrations = []migration{
+	{version: 1, description: "create root buckets missing in databases created by older versions", migrate: migrateRootBuckets},
+}
+
+// SchemaVersion is version of database layout created and read by this version
+var SchemaVersion = migrations[len(migrations)-1].version
+
+// migrateRootBuckets creates root buckets which were added after the first release
+func migrateRootBuckets(d *Database, tx *bolt.Tx) error {
+	for _, name := range []string{bucketPermissionsGranted, bucketIdentities, personalDetailsBucket, bucketRequesterLists,
+		bucketSettings, bucketLegalTemplates, bucketDataSubjects, bucketDelegations, bucketDevices, bucketSelectionDefaults} {
+		if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// schemaVersion returns version of database layout, databases without metadata have version 0
+func (d *Database) schemaVersion(tx *bolt.Tx) (version int, err error) {
+	bucket := tx.Bucket([]byte(bucketMetadata))
+	if bucket == nil || bucket.Get([]byte(schemaVersionKey)) == nil {
+		return 0, nil
+	}
+	err = d.get(bucket, []byte(schemaVersionKey), &version)
+	return version, err
+}
+
+func (d *Database) setSchemaVersion(tx *bolt.Tx, version int) error {
+	bucket, err := tx.CreateBucketIfNotExists([]byte(bucketMetadata))
+	if err != nil {
+		return err
+	}
+	return d.put(bucket, []byte(schemaVersionKey), &version)
+}
+
+// SchemaVersion returns version of database layout
+func (d *Database) SchemaVersion() (version int, err error) {
+	err = d.db.View(func(tx *bolt.Tx) (err error) {
+		version, err = d.schemaVersion(tx)
+		return err
+	})
+	return version, err
+}
+
+// migrate upgrades database to SchemaVersion, copy of database is stored
+// next to the file before the first migration runs
+func (d *Database) migrate(filePath string) error {
+	version, err := d.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	if version > SchemaVersion {
+		return ErrSchemaVersion(version, SchemaVersion)
+	}
+
+	if version == SchemaVersion {
+		return nil
+	}
+
+	backup := backupPath(filePath, version)
+	log.Infof("db: backing up database version %d to %s", version, backup)
+	if err := d.db.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(backup, 0600)
+	}); err != nil {
+		return fmt.Errorf("db: backup before migration failed: %s", err)
+	}
+
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+
+		log.Infof("db: migrating to version %d: %s", m.version, m.description)
+		if err := d.db.Update(func(tx *bolt.Tx) error {
+			if err := m.migrate(d, tx); err != nil {
+				return err
+			}
+			return d.setSchemaVersion(tx, m.version)
+		}); err != nil {
+			return fmt.Errorf("db: migration to version %d failed, backup is in %s: %s", m.version, backup, err)
+		}
+	}
+	return nil
+}
+
+// backupPath returns path of database copy taken before migrating from version,
+// existing backup of the same version is not overwritten
+func backupPath(filePath string, version int) string {
+	path := fmt.Sprintf("%s.v%d.bak", filePath, version)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path
+		}
+		path = fmt.Sprintf("%s.v%d.%d.bak", filePath, version, i)
+	}
+}
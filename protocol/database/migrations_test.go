@@ -0,0 +1,137 @@
+package database
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+)
+
+// copyFixture copies database fixture from testdata to dir, fixtures are never modified by tests
+func copyFixture(t *testing.T, name, dir string) string {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %s", err)
+	}
+
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("failed to copy fixture: %s", err)
+	}
+	return path
+}
+
+// TestMigrateVersion0 loads database created before schema versioning. The fixture has only
+// permissions, identities and personal details buckets, identity identity-1 with address address-1
+// and personal details of John Smith.
+func TestMigrateVersion0(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Fatalf("failed to create temporary dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	wallet, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+
+	fileName := copyFixture(t, "v0.db", dir)
+	db, err := LoadDatabase(fileName, wallet)
+	if err != nil {
+		t.Fatalf("LoadDatabase(%q) failed: %s", fileName, err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("Close failed: %s", err)
+		}
+	}()
+
+	if version, err := db.SchemaVersion(); err != nil || version != SchemaVersion {
+		t.Errorf("SchemaVersion() returned %d, %v", version, err)
+	}
+
+	if _, err := os.Stat(fileName + ".v0.bak"); err != nil {
+		t.Errorf("backup of version 0 not found: %s", err)
+	}
+
+	for _, name := range []string{bucketRequesterLists, bucketSettings, bucketDevices, bucketSelectionDefaults} {
+		bucketExist(db.db, name, t)
+	}
+
+	details, err := db.PersonalDetails()
+	if err != nil || details.ID != "details-1" || details.Name != "John" {
+		t.Errorf("PersonalDetails() returned %+v, %v", details, err)
+	}
+
+	addresses, err := db.AddressList("identity-1")
+	if err != nil || len(addresses) != 1 || addresses[0].City != "Amsterdam" {
+		t.Errorf("AddressList() returned %+v, %v", addresses, err)
+	}
+
+	if _, err := db.IsContact(cryptography.RandomKey32()); err != nil {
+		t.Errorf("IsContact() failed: %s", err)
+	}
+
+	// migrated database is not migrated again
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close failed: %s", err)
+	}
+	reopened, err := LoadDatabase(fileName, wallet)
+	if err != nil {
+		t.Fatalf("LoadDatabase(%q) of migrated database failed: %s", fileName, err)
+	}
+	defer func() {
+		if err := reopened.Close(); err != nil {
+			t.Errorf("Close failed: %s", err)
+		}
+	}()
+
+	if _, err := os.Stat(fmt.Sprintf("%s.v%d.bak", fileName, SchemaVersion)); !os.IsNotExist(err) {
+		t.Errorf("backup of current version created")
+	}
+}
+
+func TestSchemaVersionNewer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Fatalf("failed to create temporary dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	wallet, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+
+	fileName := filepath.Join(dir, "file.db")
+	db, err := LoadDatabase(fileName, wallet)
+	if err != nil {
+		t.Fatalf("LoadDatabase(%q) failed: %s", fileName, err)
+	}
+
+	if version, err := db.SchemaVersion(); err != nil || version != SchemaVersion {
+		t.Errorf("SchemaVersion() of new database returned %d, %v", version, err)
+	}
+
+	if err := db.db.Update(func(tx *bolt.Tx) error {
+		return db.setSchemaVersion(tx, SchemaVersion+1)
+	}); err != nil {
+		t.Fatalf("setSchemaVersion() failed: %s", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close failed: %s", err)
+	}
+
+	if _, err := LoadDatabase(fileName, wallet); err == nil || err.Error() != ErrSchemaVersion(SchemaVersion+1, SchemaVersion).Error() {
+		t.Errorf("LoadDatabase() of newer database returned %v", err)
+	}
+
+	if matches, _ := filepath.Glob(fileName + ".*.bak"); len(matches) != 0 {
+		t.Errorf("backups of not migrated database created: %v", matches)
+	}
+}
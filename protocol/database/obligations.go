@@ -0,0 +1,45 @@
+package database
+
+import (
+	"github.com/boltdb/bolt"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+// ObligationList lists obligations of all permissions which are not revoked
+func (d *Database) ObligationList() (list []models.Obligation, err error) {
+	permissions, err := d.PermissionList()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range permissions {
+		if permissions[i].RevokedAt != "" {
+			continue
+		}
+		list = append(list, permissions[i].Obligations...)
+	}
+	return list, nil
+}
+
+// ObligationReminded marks that owner was reminded about obligation
+func (d *Database) ObligationReminded(permissionID, id string) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		permissionBucket := tx.Bucket([]byte(bucketPermissionsGranted))
+		if permissionBucket == nil {
+			return ErrBucketNotFound(bucketPermissionsGranted)
+		}
+
+		var permission models.Permission
+		if err := d.get(permissionBucket, []byte(permissionID), &permission); err != nil {
+			return err
+		}
+
+		for i := range permission.Obligations {
+			if permission.Obligations[i].ID == id {
+				permission.Obligations[i].Reminded = true
+				return d.put(permissionBucket, []byte(permissionID), &permission)
+			}
+		}
+		return ErrKeyNotFound([]byte(id))
+	})
+}
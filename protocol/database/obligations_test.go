@@ -0,0 +1,71 @@
+package database
+
+import (
+	"os"
+	"testing"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+func TestObligationReminded(t *testing.T) {
+	const (
+		fileName = "/tmp/test_dir_i2i/obligations/file.db"
+	)
+
+	wallet, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+
+	db, err := LoadDatabase(fileName, wallet)
+	if err != nil {
+		t.Fatalf("LoadDatabase(%q) failed: %s", fileName, err)
+	}
+
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("Close failed: %s", err)
+		}
+
+		if err := os.RemoveAll("/tmp/test_dir_i2i"); err != nil {
+			t.Errorf("failed to clean after test: %s", err)
+		}
+	}()
+
+	permission, err := db.PermissionAdd(models.Permission{
+		TransactionID: "transaction",
+		Obligations: []models.Obligation{
+			{Kind: models.ObligationKindPower, Description: "cancel contract", Deadline: "2019-04-15T12:00:00Z", RemindAt: "2019-04-12T12:00:00Z"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("PermissionAdd() failed: %s", err)
+	}
+
+	list, err := db.ObligationList()
+	if err != nil {
+		t.Fatalf("ObligationList() failed: %s", err)
+	}
+
+	if len(list) != 1 || list[0].PermissionID != permission.ID || list[0].TransactionID != "transaction" || list[0].ID == "" {
+		t.Fatalf("ObligationList() returned %+v", list)
+	}
+
+	if err := db.ObligationReminded(permission.ID, list[0].ID); err != nil {
+		t.Fatalf("ObligationReminded() failed: %s", err)
+	}
+
+	list, err = db.ObligationList()
+	if err != nil {
+		t.Fatalf("ObligationList() failed: %s", err)
+	}
+
+	if len(list) != 1 || !list[0].Reminded {
+		t.Errorf("ObligationList() returned %+v, expected reminded obligation", list)
+	}
+
+	if err := db.ObligationReminded(permission.ID, "unknown"); err == nil {
+		t.Errorf("ObligationReminded() expected to fail for unknown obligation")
+	}
+}
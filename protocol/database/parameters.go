@@ -15,4 +15,15 @@ const (
 	identityMetadataKey      = "data"
 	personalDetailsKey       = "personal_details"
 	personalDetailsBucket    = "personal_details"
+	bucketRequesterLists     = "requester_lists"
+	bucketSettings           = "settings"
+	requesterPolicyKey       = "requester_policy"
+	approvalPolicyKey        = "approval_policy"
+	bucketLegalTemplates     = "legal_templates"
+	bucketDataSubjects       = "data_subject_requests"
+	bucketDelegations        = "delegations"
+	bucketDevices            = "devices"
+	bucketSelectionDefaults  = "selection_defaults"
+	bucketMetadata           = "metadata"
+	schemaVersionKey         = "schema_version"
 )
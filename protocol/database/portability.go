@@ -0,0 +1,545 @@
+package database
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+const (
+	// BundleVersion is version of wallet bundle created by Export.
+	// Version 2 added keychain, approval policy, delegations, devices and selection defaults.
+	BundleVersion = 2
+	// MinBundleVersion is the oldest version of wallet bundle accepted by Import
+	MinBundleVersion = 1
+	// BundleFormat identifies encrypted wallet bundle
+	BundleFormat = "planet-society-wallet"
+
+	bundleSaltSize = 32
+)
+
+// Bundle contains whole wallet, it is used to move wallet between devices.
+// Keychain is part of the bundle as pseudonyms and signatures depend on it.
+type Bundle struct {
+	Version           int                               `json:"version"`
+	Created           string                            `json:"created"`
+	Keychain          *cryptography.Keychain            `json:"keychain"`
+	PersonalDetails   models.PersonalDetails            `json:"personal_details"`
+	Identities        []BundleIdentity                  `json:"identities"`
+	Permissions       []models.Permission               `json:"permissions"`
+	RequesterLists    []models.RequesterListEntry       `json:"requester_lists"`
+	RequesterPolicy   *models.RequesterPolicy           `json:"requester_policy"`
+	ApprovalPolicy    *models.ApprovalPolicy            `json:"approval_policy"`
+	LegalTemplates    []models.LegalTemplate            `json:"legal_templates"`
+	DataSubjects      []models.DataSubjectRequestRecord `json:"data_subject_requests"`
+	Delegations       []models.Delegation               `json:"delegations"`
+	Devices           []models.Device                   `json:"devices"`
+	SelectionDefaults []models.SelectionDefault         `json:"selection_defaults"`
+}
+
+// BundleIdentity contains identity with all items belonging to it
+type BundleIdentity struct {
+	Identity          models.Identity           `json:"identity"`
+	Contacts          []models.Contact          `json:"contacts"`
+	Addresses         []models.Address          `json:"addresses"`
+	PaymentCards      []models.PaymentCard      `json:"payment_cards"`
+	Passports         []models.Passport         `json:"passports"`
+	IdentityDocuments []models.IdentityDocument `json:"identity_documents"`
+}
+
+// EncryptedBundle is bundle encrypted with key derived from passphrase
+type EncryptedBundle struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	Salt    string `json:"salt"`
+	Data    string `json:"data"`
+}
+
+// Export exports whole wallet in a single read transaction
+func (d *Database) Export() (bundle *Bundle, err error) {
+	bundle = &Bundle{
+		Version:  BundleVersion,
+		Created:  time.Now().Format(time.RFC3339),
+		Keychain: d.keychain,
+	}
+
+	err = d.db.View(func(tx *bolt.Tx) error {
+		if err := d.exportPersonalDetails(tx, bundle); err != nil {
+			return err
+		}
+
+		if err := d.exportIdentities(tx, bundle); err != nil {
+			return err
+		}
+
+		if bucket := tx.Bucket([]byte(bucketPermissionsGranted)); bucket != nil {
+			if err := d.collectPermissions(&bundle.Permissions, bucket); err != nil {
+				return err
+			}
+		}
+
+		if bucket := tx.Bucket([]byte(bucketRequesterLists)); bucket != nil {
+			if err := d.collectRequesterLists(&bundle.RequesterLists, bucket); err != nil {
+				return err
+			}
+		}
+
+		if err := d.exportSettings(tx, bundle); err != nil {
+			return err
+		}
+
+		if bucket := tx.Bucket([]byte(bucketLegalTemplates)); bucket != nil {
+			if err := d.collectLegalTemplates(&bundle.LegalTemplates, bucket); err != nil {
+				return err
+			}
+		}
+
+		if err := d.exportItems(tx, bucketDataSubjects, func(v []byte) error {
+			var record models.DataSubjectRequestRecord
+			if err := d.decode(v, &record); err != nil {
+				return err
+			}
+			bundle.DataSubjects = append(bundle.DataSubjects, record)
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		if err := d.exportItems(tx, bucketDelegations, func(v []byte) error {
+			var delegation models.Delegation
+			if err := d.decode(v, &delegation); err != nil {
+				return err
+			}
+			bundle.Delegations = append(bundle.Delegations, delegation)
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		if err := d.exportItems(tx, bucketDevices, func(v []byte) error {
+			var device models.Device
+			if err := d.decode(v, &device); err != nil {
+				return err
+			}
+			bundle.Devices = append(bundle.Devices, device)
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		return d.exportItems(tx, bucketSelectionDefaults, func(v []byte) error {
+			var selection models.SelectionDefault
+			if err := d.decode(v, &selection); err != nil {
+				return err
+			}
+			bundle.SelectionDefaults = append(bundle.SelectionDefaults, selection)
+			return nil
+		})
+	})
+	return bundle, err
+}
+
+// exportItems calls item with every value of root bucket, missing bucket has no items
+func (d *Database) exportItems(tx *bolt.Tx, name string, item func(v []byte) error) error {
+	bucket := tx.Bucket([]byte(name))
+	if bucket == nil {
+		return nil
+	}
+	return bucket.ForEach(func(k, v []byte) error {
+		return item(v)
+	})
+}
+
+func (d *Database) exportSettings(tx *bolt.Tx, bundle *Bundle) error {
+	bucket := tx.Bucket([]byte(bucketSettings))
+	if bucket == nil {
+		return nil
+	}
+
+	if bucket.Get([]byte(requesterPolicyKey)) != nil {
+		var policy models.RequesterPolicy
+		if err := d.get(bucket, []byte(requesterPolicyKey), &policy); err != nil {
+			return err
+		}
+		bundle.RequesterPolicy = &policy
+	}
+
+	if bucket.Get([]byte(approvalPolicyKey)) != nil {
+		bundle.ApprovalPolicy = &models.ApprovalPolicy{}
+		return d.get(bucket, []byte(approvalPolicyKey), bundle.ApprovalPolicy)
+	}
+	return nil
+}
+
+func (d *Database) exportPersonalDetails(tx *bolt.Tx, bundle *Bundle) error {
+	bucket := tx.Bucket([]byte(personalDetailsBucket))
+	if bucket == nil {
+		return ErrBucketNotFound(personalDetailsBucket)
+	}
+	return d.get(bucket, []byte(personalDetailsKey), &bundle.PersonalDetails)
+}
+
+func (d *Database) exportIdentities(tx *bolt.Tx, bundle *Bundle) error {
+	identitiesBucket := tx.Bucket([]byte(bucketIdentities))
+	if identitiesBucket == nil {
+		return ErrBucketNotFound(bucketIdentities)
+	}
+
+	return identitiesBucket.ForEach(func(k, v []byte) error {
+		bucket := identitiesBucket.Bucket(k)
+		if bucket == nil {
+			return ErrBucketNotFound(string(k))
+		}
+
+		var identity BundleIdentity
+		if err := d.get(bucket, []byte(identityMetadataKey), &identity.Identity); err != nil {
+			return err
+		}
+
+		if sub := bucket.Bucket([]byte(bucketContacts)); sub != nil {
+			if err := d.collectContacts(&identity.Contacts, sub); err != nil {
+				return err
+			}
+		}
+
+		if sub := bucket.Bucket([]byte(bucketAddress)); sub != nil {
+			if err := d.collectAddresses(&identity.Addresses, sub); err != nil {
+				return err
+			}
+		}
+
+		if sub := bucket.Bucket([]byte(bucketPaymentCards)); sub != nil {
+			if err := d.collectPaymentCards(&identity.PaymentCards, sub); err != nil {
+				return err
+			}
+		}
+
+		if sub := bucket.Bucket([]byte(bucketPassports)); sub != nil {
+			if err := d.collectPassport(&identity.Passports, sub); err != nil {
+				return err
+			}
+		}
+
+		if sub := bucket.Bucket([]byte(bucketIdentityDocuments)); sub != nil {
+			if err := d.collectIdentityDocument(&identity.IdentityDocuments, sub); err != nil {
+				return err
+			}
+		}
+
+		bundle.Identities = append(bundle.Identities, identity)
+		return nil
+	})
+}
+
+// Import restores wallet from the bundle in a single transaction, either everything
+// is imported or nothing is. Items keep their IDs, items with IDs already present
+// in the database are handled according to conflict. Personal details conflict if
+// they are already filled in, public keys of personal details are not imported.
+// Bundles of older versions lack items added in later versions, those are left untouched.
+// Bundle with keychain is imported only into database opened with the same keychain.
+func (d *Database) Import(bundle *Bundle, conflict models.ImportConflict) (result models.ImportResult, err error) {
+	if !validBundleVersion(bundle.Version) {
+		return result, ErrInvalidValue("version", fmt.Sprint(bundle.Version))
+	}
+
+	if bundle.Keychain != nil && *bundle.Keychain != *d.keychain {
+		return result, ErrInvalidValue("keychain", bundle.Keychain.MainPublicKey.String())
+	}
+
+	if !conflict.IsValid() {
+		return result, ErrInvalidValue("conflict", conflict.String())
+	}
+
+	importer := &importer{database: d, conflict: conflict}
+	err = d.db.Update(func(tx *bolt.Tx) error {
+		if err := importer.personalDetails(tx, &bundle.PersonalDetails); err != nil {
+			return err
+		}
+
+		for i := range bundle.Identities {
+			if err := importer.identity(tx, &bundle.Identities[i]); err != nil {
+				return err
+			}
+		}
+
+		if err := importer.items(tx, bucketPermissionsGranted, len(bundle.Permissions), func(i int) (string, interface{}) {
+			return bundle.Permissions[i].ID, &bundle.Permissions[i]
+		}); err != nil {
+			return err
+		}
+
+		if err := importer.items(tx, bucketRequesterLists, len(bundle.RequesterLists), func(i int) (string, interface{}) {
+			return bundle.RequesterLists[i].PublicKey.Key.String(), &bundle.RequesterLists[i]
+		}); err != nil {
+			return err
+		}
+
+		if err := importer.items(tx, bucketLegalTemplates, len(bundle.LegalTemplates), func(i int) (string, interface{}) {
+			template := &bundle.LegalTemplates[i]
+			return LegalTemplateKey(template.ID, template.Version), template
+		}); err != nil {
+			return err
+		}
+
+		if err := importer.items(tx, bucketDataSubjects, len(bundle.DataSubjects), func(i int) (string, interface{}) {
+			return bundle.DataSubjects[i].ID, &bundle.DataSubjects[i]
+		}); err != nil {
+			return err
+		}
+
+		if err := importer.items(tx, bucketDelegations, len(bundle.Delegations), func(i int) (string, interface{}) {
+			return bundle.Delegations[i].ID, &bundle.Delegations[i]
+		}); err != nil {
+			return err
+		}
+
+		if err := importer.items(tx, bucketDevices, len(bundle.Devices), func(i int) (string, interface{}) {
+			return bundle.Devices[i].ID, &bundle.Devices[i]
+		}); err != nil {
+			return err
+		}
+
+		if err := importer.items(tx, bucketSelectionDefaults, len(bundle.SelectionDefaults), func(i int) (string, interface{}) {
+			return bundle.SelectionDefaults[i].RequesterPublicKey.Key.String(), &bundle.SelectionDefaults[i]
+		}); err != nil {
+			return err
+		}
+
+		if bundle.RequesterPolicy != nil {
+			if err := importer.items(tx, bucketSettings, 1, func(int) (string, interface{}) {
+				return requesterPolicyKey, bundle.RequesterPolicy
+			}); err != nil {
+				return err
+			}
+		}
+
+		if bundle.ApprovalPolicy == nil {
+			return nil
+		}
+		return importer.items(tx, bucketSettings, 1, func(int) (string, interface{}) {
+			return approvalPolicyKey, bundle.ApprovalPolicy
+		})
+	})
+
+	if err != nil {
+		return result, err
+	}
+	return importer.result, nil
+}
+
+// validBundleVersion checks if bundle of version can be imported
+func validBundleVersion(version int) bool {
+	return version >= MinBundleVersion && version <= BundleVersion
+}
+
+// importer imports bundle items inside of a single transaction
+type importer struct {
+	database *Database
+	conflict models.ImportConflict
+	result   models.ImportResult
+}
+
+// put stores object under key, existing key is handled according to conflict
+func (i *importer) put(bucket *bolt.Bucket, key string, object interface{}) error {
+	if bucket.Get([]byte(key)) != nil {
+		switch i.conflict {
+		case models.ImportConflictSkip:
+			i.result.Skipped++
+			return nil
+		case models.ImportConflictOverwrite:
+			i.result.Replaced++
+			return i.database.put(bucket, []byte(key), object)
+		default:
+			return ErrAlreadyExist(key)
+		}
+	}
+
+	i.result.Imported++
+	return i.database.put(bucket, []byte(key), object)
+}
+
+// items imports count items returned by item into root bucket
+func (i *importer) items(tx *bolt.Tx, name string, count int, item func(int) (string, interface{})) error {
+	bucket, err := tx.CreateBucketIfNotExists([]byte(name))
+	if err != nil {
+		return err
+	}
+
+	for n := 0; n < count; n++ {
+		key, object := item(n)
+		if err := i.put(bucket, key, object); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i *importer) personalDetails(tx *bolt.Tx, details *models.PersonalDetails) error {
+	bucket, err := tx.CreateBucketIfNotExists([]byte(personalDetailsBucket))
+	if err != nil {
+		return err
+	}
+
+	var existing models.PersonalDetails
+	if raw := bucket.Get([]byte(personalDetailsKey)); raw != nil {
+		if err := i.database.decode(raw, &existing); err != nil {
+			return err
+		}
+	}
+
+	imported := *details
+	imported.PublicKey = existing.PublicKey
+	imported.SignatureKey = existing.SignatureKey
+	if imported.PublicKey.Key == (cryptography.Key32{}) {
+		imported.PublicKey = models.Key32{Key: i.database.keychain.MainPublicKey}
+	}
+
+	filled := existing.Name != "" || existing.Surname != "" || existing.Country != "" || existing.BirthDate != ""
+	if !filled {
+		i.result.Imported++
+		return i.database.put(bucket, []byte(personalDetailsKey), &imported)
+	}
+	return i.put(bucket, personalDetailsKey, &imported)
+}
+
+func (i *importer) identity(tx *bolt.Tx, identity *BundleIdentity) error {
+	identitiesBucket, err := tx.CreateBucketIfNotExists([]byte(bucketIdentities))
+	if err != nil {
+		return err
+	}
+
+	if identity.Identity.ID == "" {
+		return ErrInvalidValue("id", identity.Identity.ID)
+	}
+
+	if identitiesBucket.Bucket([]byte(identity.Identity.ID)) == nil {
+		if err := i.database.createNewIdentitySubBuckets(identitiesBucket, &identity.Identity); err != nil {
+			return err
+		}
+		i.result.Imported++
+	} else if err := i.put(identitiesBucket.Bucket([]byte(identity.Identity.ID)), identityMetadataKey, &identity.Identity); err != nil {
+		return err
+	}
+
+	bucket := identitiesBucket.Bucket([]byte(identity.Identity.ID))
+	sub := func(name string, count int, item func(int) (string, interface{})) error {
+		subBucket, err := bucket.CreateBucketIfNotExists([]byte(name))
+		if err != nil {
+			return err
+		}
+
+		for n := 0; n < count; n++ {
+			key, object := item(n)
+			if err := i.put(subBucket, key, object); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := sub(bucketContacts, len(identity.Contacts), func(n int) (string, interface{}) {
+		return identity.Contacts[n].ID, &identity.Contacts[n]
+	}); err != nil {
+		return err
+	}
+
+	if err := sub(bucketAddress, len(identity.Addresses), func(n int) (string, interface{}) {
+		return identity.Addresses[n].ID, &identity.Addresses[n]
+	}); err != nil {
+		return err
+	}
+
+	if err := sub(bucketPaymentCards, len(identity.PaymentCards), func(n int) (string, interface{}) {
+		return identity.PaymentCards[n].ID, &identity.PaymentCards[n]
+	}); err != nil {
+		return err
+	}
+
+	if err := sub(bucketPassports, len(identity.Passports), func(n int) (string, interface{}) {
+		return identity.Passports[n].ID, &identity.Passports[n]
+	}); err != nil {
+		return err
+	}
+
+	return sub(bucketIdentityDocuments, len(identity.IdentityDocuments), func(n int) (string, interface{}) {
+		return identity.IdentityDocuments[n].ID, &identity.IdentityDocuments[n]
+	})
+}
+
+// EncryptBundle encrypts bundle with key derived from passphrase
+func EncryptBundle(bundle *Bundle, passphrase string) ([]byte, error) {
+	data, err := json.Marshal(bundle)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, bundleSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	key, err := cryptography.KeyFromPassphrase([]byte(passphrase), salt)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := cryptography.NewSecretBox(key).Encrypt(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(&EncryptedBundle{
+		Format:  BundleFormat,
+		Version: bundle.Version,
+		Salt:    hex.EncodeToString(salt),
+		Data:    hex.EncodeToString(encrypted),
+	}, "", "  ")
+}
+
+// DecryptBundle decrypts bundle encrypted by EncryptBundle
+func DecryptBundle(data []byte, passphrase string) (*Bundle, error) {
+	var encrypted EncryptedBundle
+	if err := json.Unmarshal(data, &encrypted); err != nil {
+		return nil, err
+	}
+
+	if encrypted.Format != BundleFormat {
+		return nil, ErrInvalidValue("format", encrypted.Format)
+	}
+
+	if !validBundleVersion(encrypted.Version) {
+		return nil, ErrInvalidValue("version", fmt.Sprint(encrypted.Version))
+	}
+
+	salt, err := hex.DecodeString(encrypted.Salt)
+	if err != nil {
+		return nil, ErrInvalidValue("salt", encrypted.Salt)
+	}
+
+	sealed, err := hex.DecodeString(encrypted.Data)
+	if err != nil || len(sealed) < 24 {
+		return nil, ErrInvalidValue("data", "")
+	}
+
+	key, err := cryptography.KeyFromPassphrase([]byte(passphrase), salt)
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted, err := cryptography.NewSecretBox(key).Decrypt(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("db: wrong passphrase or corrupted bundle")
+	}
+
+	var bundle Bundle
+	if err := json.Unmarshal(decrypted, &bundle); err != nil {
+		return nil, err
+	}
+	return &bundle, nil
+}
@@ -0,0 +1,386 @@
+package database
+
+import (
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+func loadTestDatabase(t *testing.T, fileName string) *Database {
+	wallet, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+
+	db, err := LoadDatabase(fileName, wallet)
+	if err != nil {
+		t.Fatalf("LoadDatabase(%q) failed: %s", fileName, err)
+	}
+	return db
+}
+
+// loadDestinationDatabase opens database with keychain of source, as bundle is imported only with the same keychain
+func loadDestinationDatabase(t *testing.T, fileName string, source *Database) *Database {
+	db, err := LoadDatabase(fileName, source.keychain)
+	if err != nil {
+		t.Fatalf("LoadDatabase(%q) failed: %s", fileName, err)
+	}
+	return db
+}
+
+func TestExportImport(t *testing.T) {
+	const (
+		sourceFile      = "/tmp/test_dir_i2i/portability/source.db"
+		destinationFile = "/tmp/test_dir_i2i/portability/destination.db"
+		passphrase      = "correct horse battery staple"
+	)
+
+	source := loadTestDatabase(t, sourceFile)
+	destination := loadDestinationDatabase(t, destinationFile, source)
+	defer func() {
+		if err := source.Close(); err != nil {
+			t.Errorf("Close failed: %s", err)
+		}
+
+		if err := destination.Close(); err != nil {
+			t.Errorf("Close failed: %s", err)
+		}
+
+		if err := os.RemoveAll("/tmp/test_dir_i2i"); err != nil {
+			t.Errorf("failed to clean after test: %s", err)
+		}
+	}()
+
+	name := "Tom"
+	if _, err := source.PersonalDetailsUpdate(models.PersonalDetailsInput{Name: &name}); err != nil {
+		t.Fatalf("PersonalDetailsUpdate() failed: %s", err)
+	}
+
+	identity, err := source.IdentityAdd(models.IdentityInput{DisplayName: "private"})
+	if err != nil {
+		t.Fatalf("IdentityAdd() failed: %s", err)
+	}
+
+	city := "Groningen"
+	address, err := source.AddressAdd(models.AddressInput{Identity: identity.ID, DisplayName: "home", City: &city})
+	if err != nil {
+		t.Fatalf("AddressAdd() failed: %s", err)
+	}
+
+	permission, err := source.PermissionAdd(models.Permission{TransactionID: "transaction"})
+	if err != nil {
+		t.Fatalf("PermissionAdd() failed: %s", err)
+	}
+
+	if _, err := source.RequesterPolicySet(models.RequesterPolicyAllowlistOnly); err != nil {
+		t.Fatalf("RequesterPolicySet() failed: %s", err)
+	}
+
+	bundle, err := source.Export()
+	if err != nil {
+		t.Fatalf("Export() failed: %s", err)
+	}
+
+	encrypted, err := EncryptBundle(bundle, passphrase)
+	if err != nil {
+		t.Fatalf("EncryptBundle() failed: %s", err)
+	}
+
+	if _, err := DecryptBundle(encrypted, "wrong passphrase"); err == nil {
+		t.Fatalf("DecryptBundle() expected to fail with wrong passphrase")
+	}
+
+	decrypted, err := DecryptBundle(encrypted, passphrase)
+	if err != nil {
+		t.Fatalf("DecryptBundle() failed: %s", err)
+	}
+
+	result, err := destination.Import(decrypted, models.ImportConflictFail)
+	if err != nil {
+		t.Fatalf("Import() failed: %s", err)
+	}
+
+	if result.Imported != 5 || result.Skipped != 0 || result.Replaced != 0 {
+		t.Errorf("Import() returned %+v, expected 5 imported items", result)
+	}
+
+	addresses, err := destination.AddressList(identity.ID)
+	if err != nil {
+		t.Fatalf("AddressList() failed: %s", err)
+	}
+
+	if len(addresses) != 1 || addresses[0].ID != address.ID || addresses[0].City != city {
+		t.Errorf("AddressList() returned %+v, expected imported address", addresses)
+	}
+
+	permissions, err := destination.PermissionList()
+	if err != nil {
+		t.Fatalf("PermissionList() failed: %s", err)
+	}
+
+	if len(permissions) != 1 || permissions[0].ID != permission.ID {
+		t.Errorf("PermissionList() returned %+v, expected imported permission", permissions)
+	}
+
+	details, err := destination.PersonalDetails()
+	if err != nil {
+		t.Fatalf("PersonalDetails() failed: %s", err)
+	}
+
+	if details.Name != name || !details.PublicKey.Key.Equal(destination.keychain.MainPublicKey) {
+		t.Errorf("PersonalDetails() returned %+v, expected imported name with local public key", details)
+	}
+
+	other := loadTestDatabase(t, "/tmp/test_dir_i2i/portability/other.db")
+	defer other.Close()
+	if _, err := other.Import(decrypted, models.ImportConflictFail); err == nil {
+		t.Errorf("Import() expected to fail with other keychain")
+	}
+
+	if _, err := destination.Import(decrypted, models.ImportConflictFail); err == nil {
+		t.Errorf("Import() expected to fail on conflicting items")
+	}
+
+	result, err = destination.Import(decrypted, models.ImportConflictSkip)
+	if err != nil {
+		t.Fatalf("Import() failed: %s", err)
+	}
+
+	if result.Imported != 0 || result.Skipped != 5 {
+		t.Errorf("Import() returned %+v, expected 5 skipped items", result)
+	}
+}
+
+func TestImportIsAtomic(t *testing.T) {
+	const (
+		fileName = "/tmp/test_dir_i2i/portability/file.db"
+	)
+
+	db := loadTestDatabase(t, fileName)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("Close failed: %s", err)
+		}
+
+		if err := os.RemoveAll("/tmp/test_dir_i2i"); err != nil {
+			t.Errorf("failed to clean after test: %s", err)
+		}
+	}()
+
+	permission, err := db.PermissionAdd(models.Permission{TransactionID: "transaction"})
+	if err != nil {
+		t.Fatalf("PermissionAdd() failed: %s", err)
+	}
+
+	bundle := &Bundle{
+		Version:    BundleVersion,
+		Identities: []BundleIdentity{{Identity: models.Identity{ID: "identity", DisplayName: "work"}}},
+		Permissions: []models.Permission{
+			{ID: permission.ID, TransactionID: "other"},
+		},
+	}
+
+	if _, err := db.Import(bundle, models.ImportConflictFail); err == nil {
+		t.Fatalf("Import() expected to fail on conflicting permission")
+	}
+
+	identities, err := db.IdentityList()
+	if err != nil {
+		t.Fatalf("IdentityList() failed: %s", err)
+	}
+
+	if len(identities) != 0 {
+		t.Errorf("IdentityList() returned %+v, expected failed import to be rolled back", identities)
+	}
+}
+
+func TestImportBundleVersions(t *testing.T) {
+	const (
+		fileName = "/tmp/test_dir_i2v/portability/file.db"
+	)
+
+	db := loadTestDatabase(t, fileName)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("Close failed: %s", err)
+		}
+
+		if err := os.RemoveAll("/tmp/test_dir_i2v"); err != nil {
+			t.Errorf("failed to clean after test: %s", err)
+		}
+	}()
+
+	// version 1 bundle has no items added in later versions
+	old := &Bundle{
+		Version:     1,
+		Permissions: []models.Permission{{ID: "permission", TransactionID: "transaction"}},
+	}
+	if _, err := db.Import(old, models.ImportConflictFail); err != nil {
+		t.Fatalf("Import() of version 1 bundle failed: %s", err)
+	}
+
+	permissions, err := db.PermissionList()
+	if err != nil {
+		t.Fatalf("PermissionList() failed: %s", err)
+	}
+	if len(permissions) != 1 || permissions[0].ID != "permission" {
+		t.Errorf("PermissionList() returned %+v after import of version 1 bundle", permissions)
+	}
+
+	for _, version := range []int{0, BundleVersion + 1} {
+		if _, err := db.Import(&Bundle{Version: version}, models.ImportConflictFail); err == nil {
+			t.Errorf("Import() of version %d bundle expected to fail", version)
+		}
+	}
+}
+
+// bucketKeys returns keys and nested buckets of every bucket in database, metadata is not part of wallet
+func bucketKeys(t *testing.T, db *Database) map[string][]string {
+	keys := make(map[string][]string)
+	var walk func(path string, bucket *bolt.Bucket) error
+	walk = func(path string, bucket *bolt.Bucket) error {
+		keys[path] = []string{}
+		return bucket.ForEach(func(k, v []byte) error {
+			keys[path] = append(keys[path], string(k))
+			if v == nil {
+				return walk(path+"/"+string(k), bucket.Bucket(k))
+			}
+			return nil
+		})
+	}
+
+	err := db.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+			if string(name) == bucketMetadata {
+				return nil
+			}
+			return walk(string(name), bucket)
+		})
+	})
+	if err != nil {
+		t.Fatalf("failed to list keys: %s", err)
+	}
+	return keys
+}
+
+func TestExportImportAllBuckets(t *testing.T) {
+	const (
+		sourceFile      = "/tmp/test_dir_i2i/portability/source.db"
+		destinationFile = "/tmp/test_dir_i2i/portability/destination.db"
+	)
+
+	source := loadTestDatabase(t, sourceFile)
+	destination := loadDestinationDatabase(t, destinationFile, source)
+	defer func() {
+		if err := source.Close(); err != nil {
+			t.Errorf("Close failed: %s", err)
+		}
+
+		if err := destination.Close(); err != nil {
+			t.Errorf("Close failed: %s", err)
+		}
+
+		if err := os.RemoveAll("/tmp/test_dir_i2i"); err != nil {
+			t.Errorf("failed to clean after test: %s", err)
+		}
+	}()
+
+	name := "Tom"
+	if _, err := source.PersonalDetailsUpdate(models.PersonalDetailsInput{Name: &name}); err != nil {
+		t.Fatalf("PersonalDetailsUpdate() failed: %s", err)
+	}
+
+	identity, err := source.IdentityAdd(models.IdentityInput{DisplayName: "private"})
+	if err != nil {
+		t.Fatalf("IdentityAdd() failed: %s", err)
+	}
+
+	contact, err := source.ContactAdd(models.ContactInput{Identity: identity.ID, DisplayName: "guardian"})
+	if err != nil {
+		t.Fatalf("ContactAdd() failed: %s", err)
+	}
+
+	if _, err := source.AddressAdd(models.AddressInput{Identity: identity.ID, DisplayName: "home"}); err != nil {
+		t.Fatalf("AddressAdd() failed: %s", err)
+	}
+
+	if _, err := source.PaymentCardAdd(models.PaymentCardInput{Identity: identity.ID, DisplayName: "card"}); err != nil {
+		t.Fatalf("PaymentCardAdd() failed: %s", err)
+	}
+
+	if _, err := source.PassportAdd(models.PassportInput{Identity: identity.ID, DisplayName: "passport"}); err != nil {
+		t.Fatalf("PassportAdd() failed: %s", err)
+	}
+
+	if _, err := source.IdentityDocumentAdd(models.IdentityDocumentInput{Identity: identity.ID, DisplayName: "id card"}); err != nil {
+		t.Fatalf("IdentityDocumentAdd() failed: %s", err)
+	}
+
+	if _, err := source.PermissionAdd(models.Permission{TransactionID: "transaction"}); err != nil {
+		t.Fatalf("PermissionAdd() failed: %s", err)
+	}
+
+	requester := models.Key32{Key: cryptography.RandomKey32()}
+	if _, err := source.RequesterListSet(models.RequesterListInput{PublicKey: requester, List: models.RequesterListTypeAllow}); err != nil {
+		t.Fatalf("RequesterListSet() failed: %s", err)
+	}
+
+	if _, err := source.RequesterPolicySet(models.RequesterPolicyAllowlistOnly); err != nil {
+		t.Fatalf("RequesterPolicySet() failed: %s", err)
+	}
+
+	if err := source.ApprovalPolicySet(models.ApprovalPolicy{Sensitivity: models.SensitivityHigh, Required: 1, OwnerApproves: true}); err != nil {
+		t.Fatalf("ApprovalPolicySet() failed: %s", err)
+	}
+
+	if _, err := source.LegalTemplateAdd(models.LegalTemplateInput{ID: "lease", PermissionType: "lease agreement"}); err != nil {
+		t.Fatalf("LegalTemplateAdd() failed: %s", err)
+	}
+
+	if err := source.DataSubjectRequestPut(&models.DataSubjectRequestRecord{ID: "request", Type: models.DataSubjectRequestTypeAccess}); err != nil {
+		t.Fatalf("DataSubjectRequestPut() failed: %s", err)
+	}
+
+	if err := source.DelegationPut(&models.Delegation{ID: "delegation", Delegate: contact}); err != nil {
+		t.Fatalf("DelegationPut() failed: %s", err)
+	}
+
+	if err := source.DevicePut(&models.Device{ID: "device", DisplayName: "phone"}); err != nil {
+		t.Fatalf("DevicePut() failed: %s", err)
+	}
+
+	if _, err := source.SelectionDefaultSet(models.SelectionDefaultInput{RequesterPublicKey: requester}); err != nil {
+		t.Fatalf("SelectionDefaultSet() failed: %s", err)
+	}
+
+	bundle, err := source.Export()
+	if err != nil {
+		t.Fatalf("Export() failed: %s", err)
+	}
+
+	if _, err := destination.Import(bundle, models.ImportConflictFail); err != nil {
+		t.Fatalf("Import() failed: %s", err)
+	}
+
+	exported := bucketKeys(t, source)
+	imported := bucketKeys(t, destination)
+	for path, keys := range exported {
+		// new bucket has to be filled above, otherwise missing export would go unnoticed
+		if len(keys) == 0 {
+			t.Errorf("bucket %s is empty, test has to fill every bucket", path)
+		}
+
+		for _, key := range keys {
+			found := false
+			for _, other := range imported[path] {
+				found = found || other == key
+			}
+			if !found {
+				t.Errorf("key %s of bucket %s is not exported or imported", key, path)
+			}
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package database
+
+import (
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+func (d *Database) requesterListInputToEntry(input *models.RequesterListInput, entry *models.RequesterListEntry) error {
+	if !input.List.IsValid() {
+		return ErrInvalidValue("list", input.List.String())
+	}
+
+	entry.PublicKey = input.PublicKey
+	entry.List = input.List
+	entry.Created = time.Now().Format(time.RFC3339)
+
+	if input.DisplayName != nil {
+		entry.DisplayName = *input.DisplayName
+	}
+
+	if input.List != models.RequesterListTypeMute {
+		return nil
+	}
+
+	if input.MutedUntil == nil {
+		return ErrInvalidValue("muted_until", "")
+	}
+
+	if _, err := time.Parse(time.RFC3339, *input.MutedUntil); err != nil {
+		return ErrInvalidValue("muted_until", *input.MutedUntil)
+	}
+	entry.MutedUntil = input.MutedUntil
+	return nil
+}
+
+// RequesterListSet puts requester on allow, block or mute list.
+// Requester can be only on one list, previous entry is replaced.
+func (d *Database) RequesterListSet(input models.RequesterListInput) (entry models.RequesterListEntry, err error) {
+	if err := d.requesterListInputToEntry(&input, &entry); err != nil {
+		return entry, err
+	}
+
+	err = d.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(bucketRequesterLists))
+		if err != nil {
+			return err
+		}
+		return d.put(bucket, []byte(entry.PublicKey.Key.String()), &entry)
+	})
+	return entry, err
+}
+
+// RequesterListDel removes requester from lists
+func (d *Database) RequesterListDel(key cryptography.Key32) (removed cryptography.Key32, err error) {
+	err = d.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(bucketRequesterLists))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.Delete([]byte(key.String()))
+	})
+	return key, err
+}
+
+// RequesterListGet returns list entry of requester, nil is returned if requester is not listed
+func (d *Database) RequesterListGet(key cryptography.Key32) (entry *models.RequesterListEntry, err error) {
+	err = d.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(bucketRequesterLists))
+		if bucket == nil {
+			return nil
+		}
+
+		raw := bucket.Get([]byte(key.String()))
+		if raw == nil {
+			return nil
+		}
+
+		entry = &models.RequesterListEntry{}
+		return d.decode(raw, entry)
+	})
+	return entry, err
+}
+
+func (d *Database) collectRequesterLists(list *[]models.RequesterListEntry, bucket *bolt.Bucket) error {
+	return bucket.ForEach(func(k, v []byte) error {
+		var entry models.RequesterListEntry
+		if err := d.decode(v, &entry); err != nil {
+			return err
+		}
+		*list = append(*list, entry)
+		return nil
+	})
+}
+
+// RequesterList lists requesters on all lists
+func (d *Database) RequesterList() (list []models.RequesterListEntry, err error) {
+	err = d.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(bucketRequesterLists))
+		if bucket == nil {
+			return nil
+		}
+		return d.collectRequesterLists(&list, bucket)
+	})
+	return list, err
+}
+
+// RequesterPolicySet sets policy applied to requesters which are not listed
+func (d *Database) RequesterPolicySet(policy models.RequesterPolicy) (models.RequesterPolicy, error) {
+	if !policy.IsValid() {
+		return policy, ErrInvalidValue("policy", policy.String())
+	}
+
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(bucketSettings))
+		if err != nil {
+			return err
+		}
+		return d.put(bucket, []byte(requesterPolicyKey), &policy)
+	})
+	return policy, err
+}
+
+// RequesterPolicy returns policy applied to requesters which are not listed.
+// By default requests from all requesters are accepted.
+func (d *Database) RequesterPolicy() (policy models.RequesterPolicy, err error) {
+	policy = models.RequesterPolicyAcceptAll
+	err = d.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(bucketSettings))
+		if bucket == nil {
+			return nil
+		}
+
+		raw := bucket.Get([]byte(requesterPolicyKey))
+		if raw == nil {
+			return nil
+		}
+		return d.decode(raw, &policy)
+	})
+	return policy, err
+}
+
+// IsContact returns true if key belongs to contact of any identity
+func (d *Database) IsContact(key cryptography.Key32) (bool, error) {
+	contact, err := d.ContactByKey(key)
+	return contact != nil, err
+}
+
+// ContactByKey returns contact of any identity with main public key, nil is returned if there is none
+func (d *Database) ContactByKey(key cryptography.Key32) (found *models.Contact, err error) {
+	err = d.db.View(func(tx *bolt.Tx) error {
+		identitiesBucket := tx.Bucket([]byte(bucketIdentities))
+		if identitiesBucket == nil {
+			return ErrBucketNotFound(bucketIdentities)
+		}
+
+		return identitiesBucket.ForEach(func(k, v []byte) error {
+			identityBucket := identitiesBucket.Bucket(k)
+			if identityBucket == nil || found != nil {
+				return nil
+			}
+
+			contactBucket := identityBucket.Bucket([]byte(bucketContacts))
+			if contactBucket == nil {
+				return nil
+			}
+
+			var contacts []models.Contact
+			if err := d.collectContacts(&contacts, contactBucket); err != nil {
+				return err
+			}
+
+			for i := range contacts {
+				if contacts[i].PublicKey.Key.Equal(key) {
+					found = &contacts[i]
+					return nil
+				}
+			}
+			return nil
+		})
+	})
+	return found, err
+}
@@ -0,0 +1,204 @@
+package database
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+func TestRequesterListSet(t *testing.T) {
+	const (
+		fileName = "/tmp/test_dir_i2i/requesters/file.db"
+	)
+
+	wallet, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+
+	db, err := LoadDatabase(fileName, wallet)
+	if err != nil {
+		t.Fatalf("LoadDatabase(%q) failed: %s", fileName, err)
+	}
+
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("Close failed: %s", err)
+		}
+
+		if err := os.RemoveAll("/tmp/test_dir_i2i"); err != nil {
+			t.Errorf("failed to clean after test: %s", err)
+		}
+	}()
+
+	key := models.Key32{Key: cryptography.RandomKey32()}
+	if _, err := db.RequesterListSet(models.RequesterListInput{PublicKey: key, List: models.RequesterListTypeBlock}); err != nil {
+		t.Fatalf("RequesterListSet() failed: %s", err)
+	}
+
+	entry, err := db.RequesterListGet(key.Key)
+	if err != nil {
+		t.Fatalf("RequesterListGet() failed: %s", err)
+	}
+
+	if entry == nil || entry.List != models.RequesterListTypeBlock {
+		t.Fatalf("RequesterListGet() returned %+v, expected blocked entry", entry)
+	}
+
+	mutedUntil := time.Now().Add(time.Hour).Format(time.RFC3339)
+	if _, err := db.RequesterListSet(models.RequesterListInput{PublicKey: key, List: models.RequesterListTypeMute, MutedUntil: &mutedUntil}); err != nil {
+		t.Fatalf("RequesterListSet() failed: %s", err)
+	}
+
+	list, err := db.RequesterList()
+	if err != nil {
+		t.Fatalf("RequesterList() failed: %s", err)
+	}
+
+	if len(list) != 1 || list[0].List != models.RequesterListTypeMute {
+		t.Fatalf("RequesterList() returned %+v, expected single muted entry", list)
+	}
+
+	if _, err := db.RequesterListDel(key.Key); err != nil {
+		t.Fatalf("RequesterListDel() failed: %s", err)
+	}
+
+	entry, err = db.RequesterListGet(key.Key)
+	if err != nil {
+		t.Fatalf("RequesterListGet() failed: %s", err)
+	}
+
+	if entry != nil {
+		t.Errorf("RequesterListGet() returned entry after RequesterListDel")
+	}
+}
+
+func TestRequesterListSetMuteWithoutPeriod(t *testing.T) {
+	const (
+		fileName = "/tmp/test_dir_i2i/requesters/file.db"
+	)
+
+	wallet, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+
+	db, err := LoadDatabase(fileName, wallet)
+	if err != nil {
+		t.Fatalf("LoadDatabase(%q) failed: %s", fileName, err)
+	}
+
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("Close failed: %s", err)
+		}
+
+		if err := os.RemoveAll("/tmp/test_dir_i2i"); err != nil {
+			t.Errorf("failed to clean after test: %s", err)
+		}
+	}()
+
+	key := models.Key32{Key: cryptography.RandomKey32()}
+	if _, err := db.RequesterListSet(models.RequesterListInput{PublicKey: key, List: models.RequesterListTypeMute}); err == nil {
+		t.Errorf("RequesterListSet() expected to fail without muted_until")
+	}
+}
+
+func TestRequesterPolicy(t *testing.T) {
+	const (
+		fileName = "/tmp/test_dir_i2i/requesters/file.db"
+	)
+
+	wallet, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+
+	db, err := LoadDatabase(fileName, wallet)
+	if err != nil {
+		t.Fatalf("LoadDatabase(%q) failed: %s", fileName, err)
+	}
+
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("Close failed: %s", err)
+		}
+
+		if err := os.RemoveAll("/tmp/test_dir_i2i"); err != nil {
+			t.Errorf("failed to clean after test: %s", err)
+		}
+	}()
+
+	policy, err := db.RequesterPolicy()
+	if err != nil {
+		t.Fatalf("RequesterPolicy() failed: %s", err)
+	}
+
+	if policy != models.RequesterPolicyAcceptAll {
+		t.Errorf("RequesterPolicy() default is %q", policy)
+	}
+
+	if _, err := db.RequesterPolicySet(models.RequesterPolicyAllowlistOnly); err != nil {
+		t.Fatalf("RequesterPolicySet() failed: %s", err)
+	}
+
+	policy, err = db.RequesterPolicy()
+	if err != nil {
+		t.Fatalf("RequesterPolicy() failed: %s", err)
+	}
+
+	if policy != models.RequesterPolicyAllowlistOnly {
+		t.Errorf("RequesterPolicy() returned %q after RequesterPolicySet", policy)
+	}
+}
+
+func TestIsContact(t *testing.T) {
+	const (
+		fileName = "/tmp/test_dir_i2i/requesters/file.db"
+	)
+
+	wallet, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+
+	db, err := LoadDatabase(fileName, wallet)
+	if err != nil {
+		t.Fatalf("LoadDatabase(%q) failed: %s", fileName, err)
+	}
+
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("Close failed: %s", err)
+		}
+
+		if err := os.RemoveAll("/tmp/test_dir_i2i"); err != nil {
+			t.Errorf("failed to clean after test: %s", err)
+		}
+	}()
+
+	identity, err := db.IdentityAdd(models.IdentityInput{DisplayName: "private"})
+	if err != nil {
+		t.Fatalf("IdentityAdd() failed: %s", err)
+	}
+
+	key := models.Key32{Key: cryptography.RandomKey32()}
+	if _, err := db.ContactAdd(models.ContactInput{Identity: identity.ID, PublicKey: key, DisplayName: "Tom"}); err != nil {
+		t.Fatalf("ContactAdd() failed: %s", err)
+	}
+
+	if found, err := db.IsContact(key.Key); err != nil || !found {
+		t.Errorf("IsContact() returned %v, %v for added contact", found, err)
+	}
+
+	if found, err := db.IsContact(cryptography.RandomKey32()); err != nil || found {
+		t.Errorf("IsContact() returned %v, %v for unknown key", found, err)
+	}
+
+	if contact, err := db.ContactByKey(key.Key); err != nil || contact == nil || contact.DisplayName != "Tom" {
+		t.Errorf("ContactByKey() returned %+v, %v for added contact", contact, err)
+	}
+}
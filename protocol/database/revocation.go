@@ -0,0 +1,65 @@
+package database
+
+import (
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+// PermissionRevoke marks permission as revoked and returns it
+func (d *Database) PermissionRevoke(id string) (revoked models.Permission, err error) {
+	err = d.db.Update(func(tx *bolt.Tx) error {
+		permissionBucket := tx.Bucket([]byte(bucketPermissionsGranted))
+		if permissionBucket == nil {
+			return ErrBucketNotFound(bucketPermissionsGranted)
+		}
+
+		if err := d.get(permissionBucket, []byte(id), &revoked); err != nil {
+			return err
+		}
+
+		if revoked.RevokedAt != "" {
+			return nil
+		}
+
+		revoked.RevokedAt = time.Now().Format(time.RFC3339)
+		revoked.RevokationID = d.newID()
+		return d.put(permissionBucket, []byte(id), &revoked)
+	})
+	return revoked, err
+}
+
+// PermissionErased records deletion attestation on all permissions granted in transaction
+func (d *Database) PermissionErased(transactionID, erasedAt, attestation string) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		permissionBucket := tx.Bucket([]byte(bucketPermissionsGranted))
+		if permissionBucket == nil {
+			return ErrBucketNotFound(bucketPermissionsGranted)
+		}
+
+		var list []models.Permission
+		if err := d.collectPermissions(&list, permissionBucket); err != nil {
+			return err
+		}
+
+		found := false
+		for _, permission := range list {
+			if permission.TransactionID != transactionID {
+				continue
+			}
+
+			found = true
+			permission.ErasedAt = erasedAt
+			permission.DeletionAttestation = attestation
+			if err := d.put(permissionBucket, []byte(permission.ID), &permission); err != nil {
+				return err
+			}
+		}
+
+		if !found {
+			return ErrKeyNotFound([]byte(transactionID))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,78 @@
+package database
+
+import (
+	"os"
+	"testing"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+func TestPermissionRevokeErased(t *testing.T) {
+	const (
+		fileName = "/tmp/test_dir_i2i/revocation/file.db"
+	)
+
+	wallet, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+
+	db, err := LoadDatabase(fileName, wallet)
+	if err != nil {
+		t.Fatalf("LoadDatabase(%q) failed: %s", fileName, err)
+	}
+
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("Close failed: %s", err)
+		}
+
+		if err := os.RemoveAll("/tmp/test_dir_i2i"); err != nil {
+			t.Errorf("failed to clean after test: %s", err)
+		}
+	}()
+
+	permission, err := db.PermissionAdd(models.Permission{
+		TransactionID:  "transaction",
+		RetentionUntil: "2019-05-15T12:00:00Z",
+		Purpose:        "contract",
+	})
+	if err != nil {
+		t.Fatalf("PermissionAdd() failed: %s", err)
+	}
+
+	if permission.RetentionUntil != "2019-05-15T12:00:00Z" || permission.Purpose != "contract" {
+		t.Errorf("PermissionAdd() returned %+v", permission)
+	}
+
+	revoked, err := db.PermissionRevoke(permission.ID)
+	if err != nil {
+		t.Fatalf("PermissionRevoke() failed: %s", err)
+	}
+
+	if revoked.RevokedAt == "" || revoked.RevokationID == "" {
+		t.Errorf("PermissionRevoke() returned %+v", revoked)
+	}
+
+	if _, err := db.PermissionRevoke("unknown"); err == nil {
+		t.Errorf("PermissionRevoke() of unknown permission succeeded")
+	}
+
+	if err := db.PermissionErased("transaction", "2019-04-15T12:00:00Z", "erased"); err != nil {
+		t.Fatalf("PermissionErased() failed: %s", err)
+	}
+
+	if err := db.PermissionErased("unknown", "2019-04-15T12:00:00Z", "erased"); err == nil {
+		t.Errorf("PermissionErased() of unknown transaction succeeded")
+	}
+
+	list, err := db.PermissionList()
+	if err != nil {
+		t.Fatalf("PermissionList() failed: %s", err)
+	}
+
+	if len(list) != 1 || list[0].ErasedAt != "2019-04-15T12:00:00Z" || list[0].DeletionAttestation != "erased" || list[0].RevokedAt != revoked.RevokedAt {
+		t.Errorf("PermissionList() returned %+v", list)
+	}
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+// SelectionDefaultSet sets items shared with requester when the owner does not choose them, previous default is replaced
+func (d *Database) SelectionDefaultSet(input models.SelectionDefaultInput) (selection models.SelectionDefault, err error) {
+	selection.RequesterPublicKey = input.RequesterPublicKey
+	selection.Updated = time.Now().Format(time.RFC3339)
+	selection.Selection = make([]models.ItemSelection, len(input.Selection))
+	for i := range input.Selection {
+		selection.Selection[i] = models.ItemSelection(input.Selection[i])
+	}
+
+	err = d.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(bucketSelectionDefaults))
+		if err != nil {
+			return err
+		}
+		return d.put(bucket, []byte(selection.RequesterPublicKey.Key.String()), &selection)
+	})
+	return selection, err
+}
+
+// SelectionDefaultDel removes default selection of requester
+func (d *Database) SelectionDefaultDel(key cryptography.Key32) (removed cryptography.Key32, err error) {
+	err = d.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(bucketSelectionDefaults))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.Delete([]byte(key.String()))
+	})
+	return key, err
+}
+
+// SelectionDefault returns default selection of requester, nil is returned if requester has none
+func (d *Database) SelectionDefault(key cryptography.Key32) (selection *models.SelectionDefault, err error) {
+	err = d.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(bucketSelectionDefaults))
+		if bucket == nil {
+			return nil
+		}
+
+		raw := bucket.Get([]byte(key.String()))
+		if raw == nil {
+			return nil
+		}
+
+		selection = &models.SelectionDefault{}
+		return d.decode(raw, selection)
+	})
+	return selection, err
+}
+
+// SelectionDefaultList lists default selections of all requesters
+func (d *Database) SelectionDefaultList() (list []models.SelectionDefault, err error) {
+	err = d.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(bucketSelectionDefaults))
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			var selection models.SelectionDefault
+			if err := d.decode(v, &selection); err != nil {
+				return err
+			}
+			list = append(list, selection)
+			return nil
+		})
+	})
+	return list, err
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"os"
+	"testing"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+func TestSelectionDefaults(t *testing.T) {
+	const (
+		fileName = "/tmp/test_dir_i2i/selections/file.db"
+	)
+
+	wallet, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+
+	db, err := LoadDatabase(fileName, wallet)
+	if err != nil {
+		t.Fatalf("LoadDatabase(%q) failed: %s", fileName, err)
+	}
+
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("Close failed: %s", err)
+		}
+
+		if err := os.RemoveAll("/tmp/test_dir_i2i"); err != nil {
+			t.Errorf("failed to clean after test: %s", err)
+		}
+	}()
+
+	requester := cryptography.RandomKey32()
+	if selection, err := db.SelectionDefault(requester); err != nil || selection != nil {
+		t.Errorf("SelectionDefault() of requester without default returned %+v, %v", selection, err)
+	}
+
+	input := models.SelectionDefaultInput{
+		RequesterPublicKey: models.Key32{Key: requester},
+		Selection:          []models.ItemSelectionInput{{Item: "passport", ID: "1"}},
+	}
+	if _, err := db.SelectionDefaultSet(input); err != nil {
+		t.Fatalf("SelectionDefaultSet() failed: %s", err)
+	}
+
+	selection, err := db.SelectionDefault(requester)
+	if err != nil || selection == nil || len(selection.Selection) != 1 || selection.Selection[0].ID != "1" {
+		t.Fatalf("SelectionDefault() returned %+v, %v", selection, err)
+	}
+
+	if list, err := db.SelectionDefaultList(); err != nil || len(list) != 1 {
+		t.Errorf("SelectionDefaultList() returned %+v, %v", list, err)
+	}
+
+	if _, err := db.SelectionDefaultDel(requester); err != nil {
+		t.Fatalf("SelectionDefaultDel() failed: %s", err)
+	}
+	if selection, err := db.SelectionDefault(requester); err != nil || selection != nil {
+		t.Errorf("SelectionDefault() after delete returned %+v, %v", selection, err)
+	}
+}
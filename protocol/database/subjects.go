@@ -0,0 +1,38 @@
+package database
+
+import (
+	"github.com/boltdb/bolt"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+// DataSubjectRequestPut stores data subject request sent to requester,
+// request with the same ID is replaced
+func (d *Database) DataSubjectRequestPut(record *models.DataSubjectRequestRecord) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(bucketDataSubjects))
+		if err != nil {
+			return err
+		}
+		return d.put(bucket, []byte(record.ID), record)
+	})
+}
+
+// DataSubjectRequestList lists data subject requests sent to requesters
+func (d *Database) DataSubjectRequestList() (list []models.DataSubjectRequestRecord, err error) {
+	err = d.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(bucketDataSubjects))
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			var record models.DataSubjectRequestRecord
+			if err := d.decode(v, &record); err != nil {
+				return err
+			}
+			list = append(list, record)
+			return nil
+		})
+	})
+	return list, err
+}
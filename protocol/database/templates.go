@@ -0,0 +1,116 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+// LegalTemplateKey returns key under which template version is stored
+func LegalTemplateKey(id string, version int) string {
+	return fmt.Sprintf("%s@%d", id, version)
+}
+
+func legalTemplateInputToTemplate(input *models.LegalTemplateInput, template *models.LegalTemplate) {
+	template.ID = input.ID
+	template.PermissionType = input.PermissionType
+	template.LawApplying = input.LawApplying
+	template.Created = time.Now().Format(time.RFC3339)
+	template.LegalReliationships = models.LegalReliationships{
+		MyRights:       input.LegalReliationships.MyRights,
+		TheirDuties:    input.LegalReliationships.TheirDuties,
+		MyPowers:       input.LegalReliationships.MyPowers,
+		TheirLiability: input.LegalReliationships.TheirLiability,
+	}
+
+	template.Obligations = nil
+	for _, obligation := range input.Obligations {
+		template.Obligations = append(template.Obligations, models.ObligationTemplate{
+			Kind:         obligation.Kind,
+			Description:  obligation.Description,
+			DeadlineDays: obligation.DeadlineDays,
+			RemindDays:   obligation.RemindDays,
+		})
+	}
+}
+
+// LegalTemplateAdd adds new version of legal template.
+// Version is one higher than the latest stored version of template with the same ID.
+func (d *Database) LegalTemplateAdd(input models.LegalTemplateInput) (added models.LegalTemplate, err error) {
+	if input.ID == "" {
+		return added, ErrInvalidValue("id", input.ID)
+	}
+
+	for _, obligation := range input.Obligations {
+		if !obligation.Kind.IsValid() {
+			return added, ErrInvalidValue("kind", obligation.Kind.String())
+		}
+		if obligation.DeadlineDays < 0 {
+			return added, ErrInvalidValue("deadline_days", strconv.Itoa(obligation.DeadlineDays))
+		}
+		if obligation.RemindDays < 0 {
+			return added, ErrInvalidValue("remind_days", strconv.Itoa(obligation.RemindDays))
+		}
+	}
+
+	err = d.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(bucketLegalTemplates))
+		if err != nil {
+			return err
+		}
+
+		var list []models.LegalTemplate
+		if err := d.collectLegalTemplates(&list, bucket); err != nil {
+			return err
+		}
+
+		legalTemplateInputToTemplate(&input, &added)
+		for i := range list {
+			if list[i].ID == added.ID && list[i].Version > added.Version {
+				added.Version = list[i].Version
+			}
+		}
+		added.Version++
+
+		return d.put(bucket, []byte(LegalTemplateKey(added.ID, added.Version)), &added)
+	})
+	return added, err
+}
+
+func (d *Database) collectLegalTemplates(list *[]models.LegalTemplate, bucket *bolt.Bucket) error {
+	return bucket.ForEach(func(k, v []byte) error {
+		var template models.LegalTemplate
+		if err := d.decode(v, &template); err != nil {
+			return err
+		}
+		*list = append(*list, template)
+		return nil
+	})
+}
+
+// LegalTemplateList lists all versions of stored legal templates
+func (d *Database) LegalTemplateList() (list []models.LegalTemplate, err error) {
+	err = d.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(bucketLegalTemplates))
+		if bucket == nil {
+			return nil
+		}
+		return d.collectLegalTemplates(&list, bucket)
+	})
+	return list, err
+}
+
+// LegalTemplateDel removes single version of legal template
+func (d *Database) LegalTemplateDel(id string, version int) (removedID string, err error) {
+	err = d.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(bucketLegalTemplates))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.Delete([]byte(LegalTemplateKey(id, version)))
+	})
+	return id, err
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"os"
+	"testing"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+func TestLegalTemplateAdd(t *testing.T) {
+	const (
+		fileName = "/tmp/test_dir_i2i/templates/file.db"
+	)
+
+	wallet, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+
+	db, err := LoadDatabase(fileName, wallet)
+	if err != nil {
+		t.Fatalf("LoadDatabase(%q) failed: %s", fileName, err)
+	}
+
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("Close failed: %s", err)
+		}
+
+		if err := os.RemoveAll("/tmp/test_dir_i2i"); err != nil {
+			t.Errorf("failed to clean after test: %s", err)
+		}
+	}()
+
+	input := models.LegalTemplateInput{
+		ID:             "lease",
+		PermissionType: "lease agreement",
+		LawApplying:    "Netherlands",
+		LegalReliationships: models.LegalReliationshipsInput{
+			MyRights: []string{"live in the apartment"},
+		},
+	}
+
+	first, err := db.LegalTemplateAdd(input)
+	if err != nil {
+		t.Fatalf("LegalTemplateAdd() failed: %s", err)
+	}
+
+	second, err := db.LegalTemplateAdd(input)
+	if err != nil {
+		t.Fatalf("LegalTemplateAdd() failed: %s", err)
+	}
+
+	if first.Version != 1 || second.Version != 2 {
+		t.Fatalf("LegalTemplateAdd() returned versions %d and %d, expected 1 and 2", first.Version, second.Version)
+	}
+
+	if _, err := db.LegalTemplateDel("lease", 1); err != nil {
+		t.Fatalf("LegalTemplateDel() failed: %s", err)
+	}
+
+	list, err := db.LegalTemplateList()
+	if err != nil {
+		t.Fatalf("LegalTemplateList() failed: %s", err)
+	}
+
+	if len(list) != 1 || list[0].Version != 2 || len(list[0].LegalReliationships.MyRights) != 1 {
+		t.Errorf("LegalTemplateList() returned %+v, expected only second version", list)
+	}
+
+	if _, err := db.LegalTemplateAdd(models.LegalTemplateInput{}); err == nil {
+		t.Errorf("LegalTemplateAdd() expected to fail without id")
+	}
+}
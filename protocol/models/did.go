@@ -0,0 +1,38 @@
+package models
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+)
+
+// DID is did:key identifier of X25519 or Ed25519 public key
+type DID struct {
+	Key  cryptography.Key32
+	Type cryptography.KeyType
+}
+
+func (d DID) String() string {
+	return cryptography.EncodeDIDKey(d.Key, d.Type)
+}
+
+func (d DID) MarshalGQL(w io.Writer) {
+	data := strconv.Quote(d.String())
+	_, _ = w.Write([]byte(data))
+}
+
+func (d *DID) UnmarshalGQL(v interface{}) error {
+	switch v := v.(type) {
+	case string:
+		key, keyType, err := cryptography.DecodeDIDKey(v)
+		if err != nil {
+			return err
+		}
+		d.Key, d.Type = key, keyType
+		return nil
+	default:
+		return fmt.Errorf("%T is invalid", v)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"strconv"
+	"strings"
 
 	"github.com/odysseyhack/planet-society/protocol/cryptography"
 )
@@ -17,16 +18,44 @@ func (k Key32) MarshalGQL(w io.Writer) {
 	_, _ = w.Write([]byte(data))
 }
 
-func (k *Key32) UnmarshalGQL(v interface{}) error {
-	switch v := v.(type) {
-	case string:
-		key, err := cryptography.Key32FromString(v)
-		if err != nil {
-			return err
-		}
-		k.Key = key
-		return nil
-	default:
-		return fmt.Errorf("%T is invalid", v)
+// UnmarshalGQL accepts hex encoded key or did:key identifier of X25519 key. Ed25519
+// did:key is rejected, signature key would be used as main key otherwise.
+func (k *Key32) UnmarshalGQL(v interface{}) (err error) {
+	k.Key, err = unmarshalKey(v, cryptography.KeyTypeX25519)
+	return err
+}
+
+// SignatureKey32 is Ed25519 signature key, it converts to Key32 stored in models
+type SignatureKey32 Key32
+
+func (k SignatureKey32) MarshalGQL(w io.Writer) {
+	Key32(k).MarshalGQL(w)
+}
+
+// UnmarshalGQL accepts hex encoded key or did:key identifier of Ed25519 key. X25519
+// did:key is rejected, main key would be used as signature key otherwise.
+func (k *SignatureKey32) UnmarshalGQL(v interface{}) (err error) {
+	k.Key, err = unmarshalKey(v, cryptography.KeyTypeEd25519)
+	return err
+}
+
+// unmarshalKey decodes hex encoded key or did:key identifier of key with keyType
+func unmarshalKey(v interface{}, keyType cryptography.KeyType) (cryptography.Key32, error) {
+	raw, ok := v.(string)
+	if !ok {
+		return cryptography.Key32{}, fmt.Errorf("%T is invalid", v)
+	}
+
+	if !strings.HasPrefix(raw, cryptography.DIDKeyPrefix) {
+		return cryptography.Key32FromString(raw)
+	}
+
+	key, decoded, err := cryptography.DecodeDIDKey(raw)
+	if err != nil {
+		return key, err
+	}
+	if decoded != keyType {
+		return cryptography.Key32{}, fmt.Errorf("did:key of %s is not %s key", decoded, keyType)
 	}
+	return key, nil
 }
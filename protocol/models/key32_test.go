@@ -0,0 +1,49 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+)
+
+func TestKey32UnmarshalGQL(t *testing.T) {
+	keychain, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+
+	for _, v := range []string{keychain.MainPublicKey.String(), cryptography.EncodeDIDKey(keychain.MainPublicKey, cryptography.KeyTypeX25519)} {
+		var key Key32
+		if err := key.UnmarshalGQL(v); err != nil || !key.Key.Equal(keychain.MainPublicKey) {
+			t.Errorf("UnmarshalGQL(%q) returned %s, %v", v, key.Key, err)
+		}
+	}
+
+	var key Key32
+	if err := key.UnmarshalGQL(cryptography.EncodeDIDKey(keychain.SignaturePublicKey, cryptography.KeyTypeEd25519)); err == nil {
+		t.Errorf("UnmarshalGQL() of Ed25519 did:key succeeded")
+	}
+}
+
+func TestSignatureKey32UnmarshalGQL(t *testing.T) {
+	keychain, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+
+	for _, v := range []string{keychain.SignaturePublicKey.String(), cryptography.EncodeDIDKey(keychain.SignaturePublicKey, cryptography.KeyTypeEd25519)} {
+		var key SignatureKey32
+		if err := key.UnmarshalGQL(v); err != nil || !key.Key.Equal(keychain.SignaturePublicKey) {
+			t.Errorf("UnmarshalGQL(%q) returned %s, %v", v, key.Key, err)
+		}
+	}
+
+	var key SignatureKey32
+	if err := key.UnmarshalGQL(cryptography.EncodeDIDKey(keychain.MainPublicKey, cryptography.KeyTypeX25519)); err == nil {
+		t.Errorf("UnmarshalGQL() of X25519 did:key succeeded")
+	}
+
+	if err := key.UnmarshalGQL(42); err == nil {
+		t.Errorf("UnmarshalGQL() of number succeeded")
+	}
+}
@@ -0,0 +1,171 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// AttestationStore records deletion attestations on granted permissions
+type AttestationStore interface {
+	PermissionList() ([]models.Permission, error)
+	PermissionErased(transactionID, erasedAt, attestation string) error
+}
+
+// SetAttestationStore enables deletion attestations sent by requesters, it has to be called before Loop
+func (p *Protocol) SetAttestationStore(store AttestationStore) {
+	p.attestations = store
+}
+
+// DeletionStatement returns statement of requester that data of owner was erased
+func DeletionStatement(requester, owner cryptography.Key32, transactions []string, reason models.DeletionReason, erased time.Time) string {
+	return fmt.Sprintf("requester %s erased data of owner %s received in transactions [%s] at %s, reason: %s",
+		requester.String(), owner.String(), strings.Join(transactions, ", "), erased.Format(time.RFC3339), reason)
+}
+
+// signedAttestationData returns data covered by attestation signature
+func signedAttestationData(attestation *models.DeletionAttestation) ([]byte, error) {
+	unsigned := *attestation
+	unsigned.Signature = ""
+	return json.Marshal(&unsigned)
+}
+
+// NewDeletionAttestation creates deletion attestation signed by requester keychain
+func NewDeletionAttestation(keychain *cryptography.Keychain, owner cryptography.Key32, transactions []string, reason models.DeletionReason, erased time.Time) (*models.DeletionAttestation, error) {
+	attestation := &models.DeletionAttestation{
+		RequesterPublicKey: models.Key32{Key: keychain.MainPublicKey},
+		OwnerPublicKey:     models.Key32{Key: owner},
+		Transactions:       transactions,
+		Reason:             reason,
+		Erased:             erased.Format(time.RFC3339),
+		Statement:          DeletionStatement(keychain.MainPublicKey, owner, transactions, reason, erased),
+	}
+
+	data, err := signedAttestationData(attestation)
+	if err != nil {
+		return nil, err
+	}
+
+	if attestation.Signature, err = SignDetached(data, keychain); err != nil {
+		return nil, err
+	}
+	return attestation, nil
+}
+
+// VerifyDeletionAttestation verifies attestation signature made with requester signature key
+func VerifyDeletionAttestation(attestation *models.DeletionAttestation, key cryptography.Key32) error {
+	data, err := signedAttestationData(attestation)
+	if err != nil {
+		return err
+	}
+
+	if err := VerifyDetached(data, attestation.Signature, key); err != nil {
+		return fmt.Errorf("%s: %s", ErrAttestationSignature, err)
+	}
+	return nil
+}
+
+func (p *Protocol) handleDeletionAttestation(c Conn, msg *Message) {
+	var attestation models.DeletionAttestation
+	if err := gob.NewDecoder(bytes.NewBuffer(msg.Body.Payload)).Decode(&attestation); err != nil {
+		log.Warningln("deletion attestation: invalid payload:", err)
+		sendDeletionReply(c, msg, &models.DeletionAttestationReply{Error: errorString(ErrUnknownAttestation)})
+		return
+	}
+
+	accepted, err := p.acceptAttestation(msg, &attestation)
+	if err != nil {
+		log.Warningf("deletion attestation from %s rejected: %s", msg.Header.Source.String(), err)
+		sendDeletionReply(c, msg, &models.DeletionAttestationReply{Error: errorString(err)})
+		return
+	}
+
+	log.Infof("deletion attestation from %s accepted for %d transactions", msg.Header.Source.String(), len(accepted))
+	sendDeletionReply(c, msg, &models.DeletionAttestationReply{Accepted: accepted})
+}
+
+// acceptAttestation verifies attestation against permissions granted to requester and records it.
+// Every listed transaction has to be granted to the requester and signature key which signed it.
+func (p *Protocol) acceptAttestation(msg *Message, attestation *models.DeletionAttestation) ([]string, error) {
+	if p.attestations == nil {
+		return nil, ErrAttestationNotHandled
+	}
+
+	if len(attestation.Transactions) == 0 {
+		return nil, ErrEmptyAttestation
+	}
+
+	requester := attestation.RequesterPublicKey.Key
+	if !requester.Equal(msg.Header.Source) {
+		return nil, fmt.Errorf("%s: requester key does not match message source", ErrUnknownAttestation)
+	}
+
+	permissions, err := p.attestations.PermissionList()
+	if err != nil {
+		return nil, err
+	}
+
+	granted := make(map[string]*models.Permission)
+	for i := range permissions {
+		if permissions[i].RequesterPublicKey.Key.Equal(requester) {
+			granted[permissions[i].TransactionID] = &permissions[i]
+		}
+	}
+
+	var (
+		accepted []string
+		signer   *cryptography.Key32
+	)
+	for _, transaction := range attestation.Transactions {
+		permission, ok := granted[transaction]
+		if !ok {
+			return nil, fmt.Errorf("%s: transaction %s", ErrUnknownAttestation, transaction)
+		}
+
+		if signer == nil {
+			signer = &permission.RequesterSignatureKey.Key
+			if err := VerifyDeletionAttestation(attestation, *signer); err != nil {
+				return nil, err
+			}
+		}
+
+		if !permission.RequesterSignatureKey.Key.Equal(*signer) {
+			return nil, fmt.Errorf("%s: transaction %s granted to other signature key", ErrUnknownAttestation, transaction)
+		}
+		accepted = append(accepted, transaction)
+	}
+
+	for _, transaction := range accepted {
+		if err := p.attestations.PermissionErased(transaction, attestation.Erased, attestation.Statement); err != nil {
+			return nil, err
+		}
+	}
+	return accepted, nil
+}
+
+func sendDeletionReply(c Conn, msg *Message, reply *models.DeletionAttestationReply) {
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(reply); err != nil {
+		log.Warningln("deletion attestation: failed to encode reply:", err)
+		return
+	}
+
+	if err := c.Write(&Message{
+		Header: Header{Source: msg.Header.Destination, Destination: msg.Header.Source, Topic: TopicDeletionReply, Version: msg.Header.Version},
+		Body:   Body{Payload: buffer.Bytes()},
+	}); err != nil {
+		log.Warningln("deletion attestation: failed to send reply:", err)
+	}
+}
+
+func errorString(err error) *string {
+	message := err.Error()
+	return &message
+}
@@ -0,0 +1,128 @@
+package protocol
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+type testAttestationStore struct {
+	permissions []models.Permission
+	erased      map[string]string
+}
+
+func (s *testAttestationStore) PermissionList() ([]models.Permission, error) {
+	return s.permissions, nil
+}
+
+func (s *testAttestationStore) PermissionErased(transactionID, erasedAt, attestation string) error {
+	s.erased[transactionID] = attestation
+	return nil
+}
+
+func TestAcceptAttestation(t *testing.T) {
+	owner, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+
+	requester, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+
+	store := &testAttestationStore{
+		permissions: []models.Permission{{
+			TransactionID:         "transaction",
+			RequesterPublicKey:    models.Key32{Key: requester.MainPublicKey},
+			RequesterSignatureKey: models.Key32{Key: requester.SignaturePublicKey},
+		}},
+		erased: make(map[string]string),
+	}
+
+	proto := NewProtocol(nil)
+	msg := &Message{Header: Header{Source: requester.MainPublicKey, Destination: owner.MainPublicKey}}
+
+	attestation, err := NewDeletionAttestation(requester, owner.MainPublicKey, []string{"transaction"}, models.DeletionReasonRetentionExpired, time.Now())
+	if err != nil {
+		t.Fatalf("NewDeletionAttestation() failed: %s", err)
+	}
+
+	if _, err := proto.acceptAttestation(msg, attestation); err != ErrAttestationNotHandled {
+		t.Errorf("acceptAttestation() without store returned %v", err)
+	}
+	proto.SetAttestationStore(store)
+
+	accepted, err := proto.acceptAttestation(msg, attestation)
+	if err != nil {
+		t.Fatalf("acceptAttestation() failed: %s", err)
+	}
+
+	if len(accepted) != 1 || store.erased["transaction"] != attestation.Statement {
+		t.Errorf("acceptAttestation() returned %v, recorded %v", accepted, store.erased)
+	}
+
+	forged := *attestation
+	forged.Reason = models.DeletionReasonRevoked
+	if _, err := proto.acceptAttestation(msg, &forged); err == nil || !strings.HasPrefix(err.Error(), ErrAttestationSignature.Error()) {
+		t.Errorf("acceptAttestation() of forged attestation returned %v", err)
+	}
+
+	unknown, err := NewDeletionAttestation(requester, owner.MainPublicKey, []string{"unknown"}, models.DeletionReasonRetentionExpired, time.Now())
+	if err != nil {
+		t.Fatalf("NewDeletionAttestation() failed: %s", err)
+	}
+
+	if _, err := proto.acceptAttestation(msg, unknown); err == nil || !strings.HasPrefix(err.Error(), ErrUnknownAttestation.Error()) {
+		t.Errorf("acceptAttestation() of unknown transaction returned %v", err)
+	}
+}
+
+func TestAcceptAttestationTransactions(t *testing.T) {
+	owner := testKeychain(t)
+	requester := testKeychain(t)
+	other := testKeychain(t)
+
+	store := &testAttestationStore{
+		permissions: []models.Permission{{
+			TransactionID:         "transaction",
+			RequesterPublicKey:    models.Key32{Key: requester.MainPublicKey},
+			RequesterSignatureKey: models.Key32{Key: requester.SignaturePublicKey},
+		}, {
+			TransactionID:         "other",
+			RequesterPublicKey:    models.Key32{Key: requester.MainPublicKey},
+			RequesterSignatureKey: models.Key32{Key: other.SignaturePublicKey},
+		}},
+		erased: make(map[string]string),
+	}
+
+	proto := NewProtocol(nil)
+	proto.SetAttestationStore(store)
+	msg := &Message{Header: Header{Source: requester.MainPublicKey, Destination: owner.MainPublicKey}}
+
+	empty, err := NewDeletionAttestation(requester, owner.MainPublicKey, nil, models.DeletionReasonRetentionExpired, time.Now())
+	if err != nil {
+		t.Fatalf("NewDeletionAttestation() failed: %s", err)
+	}
+
+	if _, err := proto.acceptAttestation(msg, empty); err != ErrEmptyAttestation {
+		t.Errorf("acceptAttestation() of empty attestation returned %v", err)
+	}
+
+	// transaction granted to other signature key can't be erased by this requester
+	mixed, err := NewDeletionAttestation(requester, owner.MainPublicKey, []string{"transaction", "other"}, models.DeletionReasonRetentionExpired, time.Now())
+	if err != nil {
+		t.Fatalf("NewDeletionAttestation() failed: %s", err)
+	}
+
+	if _, err := proto.acceptAttestation(msg, mixed); err == nil || !strings.HasPrefix(err.Error(), ErrUnknownAttestation.Error()) {
+		t.Errorf("acceptAttestation() of transaction of other signer returned %v", err)
+	}
+
+	if len(store.erased) != 0 {
+		t.Errorf("rejected attestation recorded %v", store.erased)
+	}
+}
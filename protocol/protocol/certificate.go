@@ -0,0 +1,249 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+const (
+	// maxCertificateChain is maximal number of certificates in chain, including requester certificate
+	maxCertificateChain = 4
+)
+
+// Certificate binds requester name and registration number to its keys.
+// Keys are hex encoded, Issuer is signature key of certificate issuer.
+type Certificate struct {
+	Subject            string `json:"subject"`
+	RegistrationNumber string `json:"registration_number"`
+	MainPublicKey      string `json:"main_public_key"`
+	SignaturePublicKey string `json:"signature_public_key"`
+	Issuer             string `json:"issuer"`
+	CanIssue           bool   `json:"can_issue"`
+	NotBefore          string `json:"not_before"`
+	NotAfter           string `json:"not_after"`
+}
+
+// SignedCertificate is certificate with detached issuer signature
+type SignedCertificate struct {
+	Certificate Certificate `json:"certificate"`
+	Signature   string      `json:"signature"`
+}
+
+// TrustAnchor is issuer trusted by the responder
+type TrustAnchor struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+// TrustAnchors is a list of trust anchors configured on the responder
+type TrustAnchors struct {
+	Anchors []TrustAnchor `json:"anchors"`
+}
+
+// IssueCertificate signs certificate with issuer keychain, Issuer field is filled by the function
+func IssueCertificate(certificate Certificate, issuer *cryptography.Keychain) (*SignedCertificate, error) {
+	certificate.Issuer = issuer.SignaturePublicKey.String()
+	data, err := json.Marshal(&certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := SignDetached(data, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SignedCertificate{
+		Certificate: certificate,
+		Signature:   signature,
+	}, nil
+}
+
+// EncodeCertificateChain encodes chain to form sent inside pre transaction request
+func EncodeCertificateChain(chain []*SignedCertificate) ([]string, error) {
+	var encoded []string
+	for i := range chain {
+		data, err := json.Marshal(chain[i])
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, string(data))
+	}
+	return encoded, nil
+}
+
+// DecodeCertificateChain decodes chain sent inside pre transaction request
+func DecodeCertificateChain(encoded []string) ([]*SignedCertificate, error) {
+	var chain []*SignedCertificate
+	for i := range encoded {
+		var certificate SignedCertificate
+		if err := json.Unmarshal([]byte(encoded[i]), &certificate); err != nil {
+			return nil, fmt.Errorf("%s: certificate %d: %s", ErrInvalidCertificate, i, err)
+		}
+		chain = append(chain, &certificate)
+	}
+	return chain, nil
+}
+
+// LoadTrustAnchors reads trust anchors from JSON file
+func LoadTrustAnchors(path string) (*TrustAnchors, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var anchors TrustAnchors
+	if err := json.Unmarshal(data, &anchors); err != nil {
+		return nil, fmt.Errorf("trust anchors %q: %s", path, err)
+	}
+	return &anchors, nil
+}
+
+func (t *TrustAnchors) find(key string) *TrustAnchor {
+	for i := range t.Anchors {
+		if t.Anchors[i].Key == key {
+			return &t.Anchors[i]
+		}
+	}
+	return nil
+}
+
+// verifySignature checks certificate signature made with issuer key
+func (c *SignedCertificate) verifySignature(issuerKey string) error {
+	key, err := cryptography.Key32FromString(issuerKey)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(&c.Certificate)
+	if err != nil {
+		return err
+	}
+
+	if err := VerifyDetached(data, c.Signature, key); err != nil {
+		return fmt.Errorf("certificate of %q: %s", c.Certificate.Subject, err)
+	}
+	return nil
+}
+
+func (c *SignedCertificate) checkValidity(now time.Time) error {
+	notBefore, err := time.Parse(time.RFC3339, c.Certificate.NotBefore)
+	if err != nil {
+		return err
+	}
+
+	notAfter, err := time.Parse(time.RFC3339, c.Certificate.NotAfter)
+	if err != nil {
+		return err
+	}
+
+	if now.Before(notBefore) || now.After(notAfter) {
+		return fmt.Errorf("certificate of %q valid from %s to %s", c.Certificate.Subject, c.Certificate.NotBefore, c.Certificate.NotAfter)
+	}
+	return nil
+}
+
+// VerifyCertificateChain verifies chain starting with requester certificate,
+// followed by optional intermediate issuers, up to one of trust anchors.
+// Trust anchor which issued the chain is returned.
+func VerifyCertificateChain(chain []*SignedCertificate, anchors *TrustAnchors, request *models.PreTransactionRequest, now time.Time) (*TrustAnchor, error) {
+	if len(chain) == 0 || len(chain) > maxCertificateChain {
+		return nil, fmt.Errorf("%s: chain length %d", ErrInvalidCertificate, len(chain))
+	}
+
+	leaf := &chain[0].Certificate
+	if leaf.MainPublicKey != request.MainPublicKey.Key.String() || leaf.SignaturePublicKey != request.SignaturePublicKey.Key.String() {
+		return nil, fmt.Errorf("%s: certificate keys do not match requester keys", ErrInvalidCertificate)
+	}
+
+	for i := range chain {
+		if err := chain[i].checkValidity(now); err != nil {
+			return nil, fmt.Errorf("%s: %s", ErrInvalidCertificate, err)
+		}
+
+		if anchor := anchors.find(chain[i].Certificate.Issuer); anchor != nil {
+			if err := chain[i].verifySignature(anchor.Key); err != nil {
+				return nil, fmt.Errorf("%s: %s", ErrInvalidCertificate, err)
+			}
+			return anchor, nil
+		}
+
+		if i+1 == len(chain) {
+			break
+		}
+
+		issuer := &chain[i+1].Certificate
+		if !issuer.CanIssue || issuer.SignaturePublicKey != chain[i].Certificate.Issuer {
+			return nil, fmt.Errorf("%s: %q is not issuer of %q", ErrInvalidCertificate, issuer.Subject, chain[i].Certificate.Subject)
+		}
+
+		if err := chain[i].verifySignature(issuer.SignaturePublicKey); err != nil {
+			return nil, fmt.Errorf("%s: %s", ErrInvalidCertificate, err)
+		}
+	}
+	return nil, ErrUntrustedCertificate
+}
+
+// CertificateValidator verifies requester certificates against configured trust anchors
+type CertificateValidator struct {
+	anchors  *TrustAnchors
+	required bool
+}
+
+// NewCertificateValidator creates validator using given trust anchors.
+// If required is set requesters without certificate are rejected.
+func NewCertificateValidator(anchors *TrustAnchors, required bool) *CertificateValidator {
+	return &CertificateValidator{anchors: anchors, required: required}
+}
+
+// NewCertificateValidatorFromParams creates CertificateValidator using parameters:
+// "anchors" path to trust anchors file and optional "required" which defaults to true.
+func NewCertificateValidatorFromParams(params map[string]string) (PreTransactionValidator, error) {
+	anchors, err := LoadTrustAnchors(params["anchors"])
+	if err != nil {
+		return nil, err
+	}
+
+	required := true
+	if raw, ok := params["required"]; ok {
+		if required, err = strconv.ParseBool(raw); err != nil {
+			return nil, fmt.Errorf("required: %s", err)
+		}
+	}
+	return NewCertificateValidator(anchors, required), nil
+}
+
+func (c *CertificateValidator) Name() string {
+	return "certificate"
+}
+
+func (c *CertificateValidator) Validate(request *models.PreTransactionRequest) (*Verification, error) {
+	if len(request.Certificates) == 0 {
+		if c.required {
+			return nil, ErrMissingCertificate
+		}
+		return nil, nil
+	}
+
+	chain, err := DecodeCertificateChain(request.Certificates)
+	if err != nil {
+		return nil, err
+	}
+
+	anchor, err := VerifyCertificateChain(chain, c.anchors, request, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	leaf := &chain[0].Certificate
+	return &Verification{
+		Statement: fmt.Sprintf("%s: %s (%s)", anchor.Name, leaf.Subject, leaf.RegistrationNumber),
+		Name:      leaf.Subject,
+	}, nil
+}
@@ -0,0 +1,149 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+func testKeychain(t *testing.T) *cryptography.Keychain {
+	keychain, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain failed: %s", err)
+	}
+	return keychain
+}
+
+func testCertificate(subject string, keychain *cryptography.Keychain, canIssue bool) Certificate {
+	return Certificate{
+		Subject:            subject,
+		RegistrationNumber: "27291981",
+		MainPublicKey:      keychain.MainPublicKey.String(),
+		SignaturePublicKey: keychain.SignaturePublicKey.String(),
+		CanIssue:           canIssue,
+		NotBefore:          time.Now().Add(-time.Hour).Format(time.RFC3339),
+		NotAfter:           time.Now().Add(time.Hour).Format(time.RFC3339),
+	}
+}
+
+func testRequest(keychain *cryptography.Keychain, certificates []string) *models.PreTransactionRequest {
+	return &models.PreTransactionRequest{
+		TransactionID:      models.Key32{Key: cryptography.RandomKey32()},
+		MainPublicKey:      models.Key32{Key: keychain.MainPublicKey},
+		SignaturePublicKey: models.Key32{Key: keychain.SignaturePublicKey},
+		Requester:          "John Smith",
+		Certificates:       certificates,
+	}
+}
+
+func issue(t *testing.T, certificate Certificate, issuer *cryptography.Keychain) *SignedCertificate {
+	signed, err := IssueCertificate(certificate, issuer)
+	if err != nil {
+		t.Fatalf("IssueCertificate failed: %s", err)
+	}
+	return signed
+}
+
+func encode(t *testing.T, chain ...*SignedCertificate) []string {
+	encoded, err := EncodeCertificateChain(chain)
+	if err != nil {
+		t.Fatalf("EncodeCertificateChain failed: %s", err)
+	}
+	return encoded
+}
+
+func TestCertificateValidatorDirect(t *testing.T) {
+	anchor := testKeychain(t)
+	requester := testKeychain(t)
+	anchors := &TrustAnchors{Anchors: []TrustAnchor{{Name: "kvk", Key: anchor.SignaturePublicKey.String()}}}
+
+	leaf := issue(t, testCertificate("T-mobile", requester, false), anchor)
+	validator := NewCertificateValidator(anchors, true)
+
+	verification, err := validator.Validate(testRequest(requester, encode(t, leaf)))
+	if err != nil {
+		t.Fatalf("Validate failed: %s", err)
+	}
+
+	if verification.Name != "T-mobile" || verification.Statement != "kvk: T-mobile (27291981)" {
+		t.Errorf("Validate returned %+v", verification)
+	}
+}
+
+func TestCertificateValidatorIntermediate(t *testing.T) {
+	anchor := testKeychain(t)
+	intermediate := testKeychain(t)
+	requester := testKeychain(t)
+	anchors := &TrustAnchors{Anchors: []TrustAnchor{{Name: "kvk", Key: anchor.SignaturePublicKey.String()}}}
+
+	issuer := issue(t, testCertificate("Chamber of Commerce Amsterdam", intermediate, true), anchor)
+	leaf := issue(t, testCertificate("T-mobile", requester, false), intermediate)
+	validator := NewCertificateValidator(anchors, true)
+
+	verification, err := validator.Validate(testRequest(requester, encode(t, leaf, issuer)))
+	if err != nil {
+		t.Fatalf("Validate failed: %s", err)
+	}
+
+	if verification.Name != "T-mobile" {
+		t.Errorf("Validate confirmed name %q", verification.Name)
+	}
+
+	notIssuer := issue(t, testCertificate("Chamber of Commerce Amsterdam", intermediate, false), anchor)
+	if _, err := validator.Validate(testRequest(requester, encode(t, leaf, notIssuer))); err == nil {
+		t.Errorf("Validate expected to fail for intermediate without CanIssue")
+	}
+}
+
+func TestCertificateValidatorRejects(t *testing.T) {
+	anchor := testKeychain(t)
+	stranger := testKeychain(t)
+	requester := testKeychain(t)
+	anchors := &TrustAnchors{Anchors: []TrustAnchor{{Name: "kvk", Key: anchor.SignaturePublicKey.String()}}}
+	validator := NewCertificateValidator(anchors, true)
+
+	untrusted := issue(t, testCertificate("T-mobile", requester, false), stranger)
+	if _, err := validator.Validate(testRequest(requester, encode(t, untrusted))); err != ErrUntrustedCertificate {
+		t.Errorf("Validate returned %v, expected %q", err, ErrUntrustedCertificate)
+	}
+
+	otherKeys := issue(t, testCertificate("T-mobile", stranger, false), anchor)
+	if _, err := validator.Validate(testRequest(requester, encode(t, otherKeys))); err == nil {
+		t.Errorf("Validate expected to fail for certificate of other keys")
+	}
+
+	expiredCertificate := testCertificate("T-mobile", requester, false)
+	expiredCertificate.NotAfter = time.Now().Add(-time.Minute).Format(time.RFC3339)
+	expired := issue(t, expiredCertificate, anchor)
+	if _, err := validator.Validate(testRequest(requester, encode(t, expired))); err == nil {
+		t.Errorf("Validate expected to fail for expired certificate")
+	}
+
+	tampered := issue(t, testCertificate("T-mobile", requester, false), anchor)
+	tampered.Certificate.Subject = "Bank of Netherlands"
+	if _, err := validator.Validate(testRequest(requester, encode(t, tampered))); err == nil {
+		t.Errorf("Validate expected to fail for tampered certificate")
+	}
+
+	if _, err := validator.Validate(testRequest(requester, nil)); err != ErrMissingCertificate {
+		t.Errorf("Validate returned %v, expected %q", err, ErrMissingCertificate)
+	}
+
+	if verification, err := NewCertificateValidator(anchors, false).Validate(testRequest(requester, nil)); err != nil || verification != nil {
+		t.Errorf("Validate returned %v, %v for optional certificate", verification, err)
+	}
+}
+
+func TestRequesterDisplayName(t *testing.T) {
+	request := testRequest(testKeychain(t), nil)
+
+	if name := requesterDisplayName("T-mobile", request); name != "T-mobile" {
+		t.Errorf("requesterDisplayName returned %q for verified name", name)
+	}
+
+	if name := requesterDisplayName("", request); name == request.Requester {
+		t.Errorf("requesterDisplayName returned claimed name %q", name)
+	}
+}
@@ -0,0 +1,270 @@
+package protocol
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+// DataCategory is GDPR category of personal data
+type DataCategory string
+
+const (
+	CategoryIdentifier DataCategory = "identifier"
+	CategoryLocation   DataCategory = "location data"
+	CategoryFinancial  DataCategory = "financial data"
+	CategoryNationalID DataCategory = "national identification number"
+	CategorySpecial    DataCategory = "special category data"
+)
+
+// categoryWeight is contribution of category to request risk
+var categoryWeight = map[DataCategory]int{
+	CategoryIdentifier: 1,
+	CategoryLocation:   2,
+	CategoryFinancial:  3,
+	CategoryNationalID: 4,
+	CategorySpecial:    5,
+}
+
+// categorySensitivity maps category to sensitivity used by delegations and approval policies
+var categorySensitivity = map[DataCategory]models.Sensitivity{
+	CategoryIdentifier: models.SensitivityMedium,
+	CategoryLocation:   models.SensitivityMedium,
+	CategoryFinancial:  models.SensitivityHigh,
+	CategoryNationalID: models.SensitivityHigh,
+	CategorySpecial:    models.SensitivityHigh,
+}
+
+// categoryNotes explains why category matters to the owner
+var categoryNotes = map[DataCategory]string{
+	CategoryIdentifier: "identifies you directly",
+	CategoryLocation:   "reveals where you live or stay",
+	CategoryFinancial:  "gives access to your money, leaks enable payment fraud",
+	CategoryNationalID: "its processing is restricted by GDPR Art. 87 and national law",
+	CategorySpecial:    "its processing is prohibited by GDPR Art. 9 unless explicit consent or exception applies",
+}
+
+// riskCombinations raise risk when categories are shared together
+var riskCombinations = []struct {
+	categories []DataCategory
+	weight     int
+	note       string
+}{
+	{categories: []DataCategory{CategoryIdentifier, CategoryNationalID}, weight: 2, note: "name together with national identification number enables identity theft"},
+	{categories: []DataCategory{CategoryIdentifier, CategoryFinancial}, weight: 2, note: "name together with financial data enables payment fraud"},
+}
+
+// maxRisk is raw risk of request containing all categories and combinations
+var maxRisk = func() (max int) {
+	for _, weight := range categoryWeight {
+		max += weight
+	}
+	for _, combination := range riskCombinations {
+		max += combination.weight
+	}
+	return max
+}()
+
+const (
+	riskMedium = 25
+	riskHigh   = 60
+)
+
+// queryTypes maps query fields to schema types they return
+var queryTypes = map[string]string{
+	"personalDetails":  "PersonalDetails",
+	"address":          "Address",
+	"paymentCard":      "PaymentCard",
+	"passport":         "Passport",
+	"identityDocument": "IdentityDocument",
+	"bankingDetails":   "BankDetails",
+}
+
+// fieldCategories classifies fields of schema types, fields which are not listed
+// do not contain personal data
+var fieldCategories = map[string]map[string]DataCategory{
+	"PersonalDetails": {
+		"public_key":    CategoryIdentifier,
+		"signature_key": CategoryIdentifier,
+		"name":          CategoryIdentifier,
+		"surname":       CategoryIdentifier,
+		"birth_date":    CategoryIdentifier,
+		"email":         CategoryIdentifier,
+		"country":       CategoryLocation,
+		"BSN":           CategoryNationalID,
+	},
+	"Address": {
+		"country": CategoryLocation,
+		"city":    CategoryLocation,
+		"street":  CategoryLocation,
+	},
+	"PaymentCard": {
+		"name":          CategoryIdentifier,
+		"surname":       CategoryIdentifier,
+		"currency":      CategoryFinancial,
+		"number":        CategoryFinancial,
+		"expiration":    CategoryFinancial,
+		"security_code": CategoryFinancial,
+	},
+	"Passport": {
+		"name":       CategoryIdentifier,
+		"surname":    CategoryIdentifier,
+		"country":    CategoryIdentifier,
+		"expiration": CategoryIdentifier,
+		"number":     CategoryNationalID,
+	},
+	"IdentityDocument": {
+		"name":       CategoryIdentifier,
+		"surname":    CategoryIdentifier,
+		"country":    CategoryIdentifier,
+		"expiration": CategoryIdentifier,
+		"number":     CategoryNationalID,
+	},
+	"BankDetails": {
+		"bank":       CategoryFinancial,
+		"IBAN":       CategoryFinancial,
+		"nameOnCard": CategoryFinancial,
+	},
+}
+
+// specialKeywords recognise special category data in fields which are not classified
+var specialKeywords = []string{"health", "medical", "genetic", "biometric", "ethnic", "race", "religio", "political", "union", "sexual"}
+
+// ClassifiedField is queried field containing personal data
+type ClassifiedField struct {
+	Item     string
+	Field    string
+	Category DataCategory
+}
+
+// Classification is result of request classification
+type Classification struct {
+	Fields []ClassifiedField
+	// Categories are ordered from the most sensitive
+	Categories []DataCategory
+	// Score is request risk from 0 to 100
+	Score       int
+	Sensitivity models.Sensitivity
+	notes       []string
+}
+
+// fieldCategory returns category of field of schema type
+func fieldCategory(typeName, field string) (DataCategory, bool) {
+	if fields, ok := fieldCategories[typeName]; ok {
+		if category, ok := fields[field]; ok {
+			return category, true
+		}
+	}
+
+	lower := strings.ToLower(field)
+	for _, keyword := range specialKeywords {
+		if strings.Contains(lower, keyword) {
+			return CategorySpecial, true
+		}
+	}
+
+	if _, known := fieldCategories[typeName]; !known && field != "id" {
+		// fields of unknown types are treated as personal data
+		return CategoryIdentifier, true
+	}
+	return "", false
+}
+
+// typeFields returns classified fields of schema type, used when item does not list fields
+func typeFields(typeName string) (fields []string) {
+	for field := range fieldCategories[typeName] {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// Classify maps requested items to GDPR categories and computes request risk
+func Classify(items []models.ItemField) *Classification {
+	c := &Classification{Sensitivity: models.SensitivityLow}
+	found := make(map[DataCategory]bool)
+
+	for i := range items {
+		typeName, ok := queryTypes[items[i].Item]
+		if !ok {
+			typeName = items[i].Item
+		}
+
+		fields := items[i].Fields
+		if len(fields) == 0 {
+			fields = typeFields(typeName)
+		}
+		if len(fields) == 0 {
+			// nothing is known about the item, whole item is treated as personal data
+			fields = []string{"*"}
+		}
+
+		for _, field := range fields {
+			category, ok := fieldCategory(typeName, field)
+			if !ok {
+				continue
+			}
+
+			c.Fields = append(c.Fields, ClassifiedField{Item: items[i].Item, Field: field, Category: category})
+			if !found[category] {
+				found[category] = true
+				c.Categories = append(c.Categories, category)
+			}
+		}
+	}
+
+	sort.Slice(c.Categories, func(i, j int) bool {
+		return categoryWeight[c.Categories[i]] > categoryWeight[c.Categories[j]]
+	})
+
+	risk := 0
+	for _, category := range c.Categories {
+		risk += categoryWeight[category]
+		if sensitivity := categorySensitivity[category]; !SensitivityAtMost(sensitivity, c.Sensitivity) {
+			c.Sensitivity = sensitivity
+		}
+	}
+
+	for _, combination := range riskCombinations {
+		if found[combination.categories[0]] && found[combination.categories[1]] {
+			risk += combination.weight
+			c.notes = append(c.notes, combination.note)
+		}
+	}
+
+	c.Score = risk * 100 / maxRisk
+	return c
+}
+
+// Level returns human readable risk level
+func (c *Classification) Level() string {
+	switch {
+	case c.Score >= riskHigh:
+		return "high"
+	case c.Score >= riskMedium:
+		return "medium"
+	default:
+		return "low"
+	}
+}
+
+// Analysis returns analysis lines shown to the owner in consent notification
+func (c *Classification) Analysis() []string {
+	if len(c.Fields) == 0 {
+		return []string{"request does not contain personal data, risk score 0/100"}
+	}
+
+	lines := []string{fmt.Sprintf("risk score %d/100 (%s), all requested personal data is protected by GDPR", c.Score, c.Level())}
+	for _, category := range c.Categories {
+		var fields []string
+		for i := range c.Fields {
+			if c.Fields[i].Category == category {
+				fields = append(fields, c.Fields[i].Item+"."+c.Fields[i].Field)
+			}
+		}
+		lines = append(lines, fmt.Sprintf("%s (%s) %s", category, strings.Join(fields, ", "), categoryNotes[category]))
+	}
+	return append(lines, c.notes...)
+}
@@ -0,0 +1,117 @@
+package protocol
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		items       []models.ItemField
+		categories  []DataCategory
+		sensitivity models.Sensitivity
+		level       string
+	}{
+		{
+			items:       []models.ItemField{{Item: "personalDetails", Fields: []string{"id"}}},
+			sensitivity: models.SensitivityLow,
+			level:       "low",
+		},
+		{
+			items:       []models.ItemField{{Item: "personalDetails", Fields: []string{"name", "email"}}},
+			categories:  []DataCategory{CategoryIdentifier},
+			sensitivity: models.SensitivityMedium,
+			level:       "low",
+		},
+		{
+			items:       []models.ItemField{{Item: "address", Fields: []string{"city", "street"}}},
+			categories:  []DataCategory{CategoryLocation},
+			sensitivity: models.SensitivityMedium,
+			level:       "low",
+		},
+		{
+			items: []models.ItemField{
+				{Item: "personalDetails", Fields: []string{"name", "surname", "birth_date", "email", "BSN"}},
+				{Item: "passport", Fields: []string{"number", "expiration", "country"}},
+				{Item: "bankingDetails", Fields: []string{"IBAN", "bank", "nameOnCard"}},
+			},
+			categories:  []DataCategory{CategoryNationalID, CategoryFinancial, CategoryIdentifier},
+			sensitivity: models.SensitivityHigh,
+			level:       "high",
+		},
+		{
+			items:       []models.ItemField{{Item: "medicalRecord", Fields: []string{"healthCondition"}}},
+			categories:  []DataCategory{CategorySpecial},
+			sensitivity: models.SensitivityHigh,
+			level:       "medium",
+		},
+		{
+			items:       []models.ItemField{{Item: "unknown"}},
+			categories:  []DataCategory{CategoryIdentifier},
+			sensitivity: models.SensitivityMedium,
+			level:       "low",
+		},
+	}
+
+	for i, test := range tests {
+		c := Classify(test.items)
+		if len(c.Categories) != len(test.categories) {
+			t.Errorf("Classify() test %d returned categories %v, expected %v", i, c.Categories, test.categories)
+			continue
+		}
+
+		for j := range c.Categories {
+			if c.Categories[j] != test.categories[j] {
+				t.Errorf("Classify() test %d returned categories %v, expected %v", i, c.Categories, test.categories)
+			}
+		}
+
+		if c.Sensitivity != test.sensitivity || c.Level() != test.level {
+			t.Errorf("Classify() test %d returned sensitivity %s, level %s (score %d), expected %s, %s",
+				i, c.Sensitivity, c.Level(), c.Score, test.sensitivity, test.level)
+		}
+	}
+}
+
+func TestClassificationAnalysis(t *testing.T) {
+	c := Classify([]models.ItemField{
+		{Item: "personalDetails", Fields: []string{"name", "BSN"}},
+		{Item: "address", Fields: []string{"city"}},
+	})
+
+	analysis := c.Analysis()
+	expected := []string{
+		"risk score",
+		"national identification number (personalDetails.BSN)",
+		"location data (address.city)",
+		"identifier (personalDetails.name)",
+		"name together with national identification number",
+	}
+
+	if len(analysis) != len(expected) {
+		t.Fatalf("Analysis() returned %q", analysis)
+	}
+
+	for i := range expected {
+		if !strings.HasPrefix(analysis[i], expected[i]) {
+			t.Errorf("Analysis() line %d is %q, expected prefix %q", i, analysis[i], expected[i])
+		}
+	}
+}
+
+func TestGenerateNotificationRequestAnalysis(t *testing.T) {
+	days, purpose := 30, "contract"
+	request := &models.TransactionRequest{RetentionDays: &days, Purpose: &purpose}
+	data := []CollectionData{{Structure: "bankingDetails", Fields: []string{"IBAN"}}}
+
+	notification := generateNotificationRequest(request, data, &Entry{})
+	if notification.RiskScore == 0 || len(notification.Analysis) != 4 {
+		t.Fatalf("generateNotificationRequest() returned score %d, analysis %q", notification.RiskScore, notification.Analysis)
+	}
+
+	if notification.Analysis[2] != "data will be processed for: contract" || notification.Analysis[3] != "requester erases data after 30 days" {
+		t.Errorf("generateNotificationRequest() returned analysis %q", notification.Analysis)
+	}
+}
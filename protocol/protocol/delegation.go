@@ -0,0 +1,442 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// delegatedConsentTimeout is how long the owner waits for decision of delegate
+const delegatedConsentTimeout = time.Minute * 2
+
+// DelegationStore stores delegations granted by the owner
+type DelegationStore interface {
+	DelegationList() ([]models.Delegation, error)
+}
+
+// ContactStore finds contacts of the owner by their main public key
+type ContactStore interface {
+	ContactByKey(key cryptography.Key32) (*models.Contact, error)
+}
+
+// SetContactStore sets contacts allowed to delegate consent to this node, without it delegated
+// consent requests are refused. It has to be called before Loop
+func (p *Protocol) SetContactStore(contacts ContactStore) {
+	p.contacts = contacts
+}
+
+// signedDelegationData returns data covered by delegation signature
+func signedDelegationData(delegation *models.Delegation) ([]byte, error) {
+	unsigned := *delegation
+	unsigned.Signature = ""
+	return json.Marshal(&unsigned)
+}
+
+// signedConsentRequestData returns data covered by consent request signature
+func signedConsentRequestData(request *models.DelegatedConsentRequest) ([]byte, error) {
+	unsigned := *request
+	unsigned.Signature = ""
+	return json.Marshal(&unsigned)
+}
+
+// signedConsentDecisionData returns data covered by consent decision signature
+func signedConsentDecisionData(decision *models.DelegatedConsentDecision) ([]byte, error) {
+	unsigned := *decision
+	unsigned.Signature = ""
+	return json.Marshal(&unsigned)
+}
+
+// NewDelegation creates delegation signed by the owner, delegate is reached at endpoint
+func NewDelegation(keychain *cryptography.Keychain, delegate models.Contact, endpoint string, scope models.DelegationScope, now, expiration time.Time) (*models.Delegation, error) {
+	if !scope.MaxSensitivity.IsValid() {
+		return nil, fmt.Errorf("%s: sensitivity %q", ErrInvalidDelegation, scope.MaxSensitivity)
+	}
+
+	if !expiration.After(now) {
+		return nil, fmt.Errorf("%s: %s", ErrDelegationExpired, expiration.Format(time.RFC3339))
+	}
+
+	id := cryptography.RandomKey32()
+	delegation := &models.Delegation{
+		ID:                id.String(),
+		OwnerPublicKey:    models.Key32{Key: keychain.MainPublicKey},
+		OwnerSignatureKey: models.Key32{Key: keychain.SignaturePublicKey},
+		Delegate:          delegate,
+		Endpoint:          endpoint,
+		Scope:             scope,
+		Created:           now.Format(time.RFC3339),
+		Expiration:        expiration.Format(time.RFC3339),
+	}
+
+	data, err := signedDelegationData(delegation)
+	if err != nil {
+		return nil, err
+	}
+
+	if delegation.Signature, err = SignDetached(data, keychain); err != nil {
+		return nil, err
+	}
+	return delegation, nil
+}
+
+// VerifyDelegation verifies owner signature and expiration of delegation
+func VerifyDelegation(delegation *models.Delegation, now time.Time) error {
+	data, err := signedDelegationData(delegation)
+	if err != nil {
+		return err
+	}
+
+	if err := VerifyDetached(data, delegation.Signature, delegation.OwnerSignatureKey.Key); err != nil {
+		return fmt.Errorf("%s: %s", ErrDelegationSignature, err)
+	}
+
+	expiration, err := time.Parse(time.RFC3339, delegation.Expiration)
+	if err != nil {
+		return fmt.Errorf("%s: expiration %q", ErrInvalidDelegation, delegation.Expiration)
+	}
+
+	if !now.Before(expiration) {
+		return fmt.Errorf("%s: %s", ErrDelegationExpired, delegation.Expiration)
+	}
+	return nil
+}
+
+// VerifyOwnDelegation verifies delegation granted by keychain owner. Delegations of other
+// owners can be imported with wallet bundle, they are never used to ask delegates.
+func VerifyOwnDelegation(delegation *models.Delegation, keychain *cryptography.Keychain, now time.Time) error {
+	if !delegation.OwnerSignatureKey.Key.Equal(keychain.SignaturePublicKey) {
+		return fmt.Errorf("%s: granted by other owner", ErrInvalidDelegation)
+	}
+	return VerifyDelegation(delegation, now)
+}
+
+// DelegationCovers returns true if all items of request are in scope of delegation
+func DelegationCovers(delegation *models.Delegation, request *models.PermissionNotificationRequest) bool {
+	if !SensitivityAtMost(RequestSensitivity(request), delegation.Scope.MaxSensitivity) {
+		return false
+	}
+
+	if len(delegation.Scope.Items) == 0 {
+		return true
+	}
+
+	for i := range request.Item {
+		if !contains(delegation.Scope.Items, request.Item[i].Item) {
+			return false
+		}
+	}
+	return true
+}
+
+// NewConsentRequest creates request asking delegate for decision, signed by the owner
+func NewConsentRequest(keychain *cryptography.Keychain, delegation *models.Delegation, notification *models.PermissionNotificationRequest, now time.Time) (*models.DelegatedConsentRequest, error) {
+	request := &models.DelegatedConsentRequest{
+		RequestID:    models.Key32{Key: cryptography.RandomKey32()},
+		Delegation:   *delegation,
+		Notification: *notification,
+		Created:      now.Format(time.RFC3339),
+	}
+
+	data, err := signedConsentRequestData(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.Signature, err = SignDetached(data, keychain); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// VerifyConsentRequest verifies delegation and owner signature of consent request
+func VerifyConsentRequest(request *models.DelegatedConsentRequest, now time.Time) error {
+	if err := VerifyDelegation(&request.Delegation, now); err != nil {
+		return err
+	}
+
+	data, err := signedConsentRequestData(request)
+	if err != nil {
+		return err
+	}
+
+	if err := VerifyDetached(data, request.Signature, request.Delegation.OwnerSignatureKey.Key); err != nil {
+		return fmt.Errorf("%s: %s", ErrDelegationSignature, err)
+	}
+
+	if !DelegationCovers(&request.Delegation, &request.Notification) {
+		return fmt.Errorf("%s: request is out of delegation scope", ErrInvalidConsentMsg)
+	}
+	return nil
+}
+
+// SignConsentDecision signs decision with delegate keychain
+func SignConsentDecision(decision *models.DelegatedConsentDecision, keychain *cryptography.Keychain) (err error) {
+	data, err := signedConsentDecisionData(decision)
+	if err != nil {
+		return err
+	}
+
+	decision.Signature, err = SignDetached(data, keychain)
+	return err
+}
+
+// VerifyConsentDecision verifies decision signature made with delegate signature key
+func VerifyConsentDecision(decision *models.DelegatedConsentDecision, key cryptography.Key32) error {
+	data, err := signedConsentDecisionData(decision)
+	if err != nil {
+		return err
+	}
+
+	if err := VerifyDetached(data, decision.Signature, key); err != nil {
+		return fmt.Errorf("%s: %s", ErrDelegationSignature, err)
+	}
+	return nil
+}
+
+// DelegatedAuthorization routes requests covered by delegation to the delegate,
+// other requests and requests delegate failed to decide are authorized by the owner
+type DelegatedAuthorization struct {
+	store    DelegationStore
+	keychain *cryptography.Keychain
+	dial     Dialer
+	owner    AuthorizationPlugin
+	timeout  time.Duration
+}
+
+// NewDelegatedAuthorization creates authorization plugin falling back to owner plugin
+func NewDelegatedAuthorization(store DelegationStore, keychain *cryptography.Keychain, dial Dialer, owner AuthorizationPlugin) *DelegatedAuthorization {
+	return &DelegatedAuthorization{
+		store:    store,
+		keychain: keychain,
+		dial:     dial,
+		owner:    owner,
+		timeout:  delegatedConsentTimeout,
+	}
+}
+
+func (d *DelegatedAuthorization) Authorize(input *models.PermissionNotificationRequest) (*models.PermissionNotificationResponse, error) {
+	delegation, err := d.delegation(input, time.Now())
+	if err != nil {
+		log.Warningln("delegation: listing delegations failed:", err)
+	}
+
+	if delegation != nil {
+		decision, err := requestConsent(d.keychain, d.dial, delegation, input, d.timeout)
+		if err == nil {
+			log.Infof("delegation: transaction %s decided by delegate %s, accepted: %t", input.TransactionID, delegation.Delegate.DisplayName, decision.Accepted)
+			return &models.PermissionNotificationResponse{
+				TransactionID: input.TransactionID,
+				Accepted:      decision.Accepted,
+				Identities:    delegation.Scope.Identities,
+			}, nil
+		}
+		log.Warningf("delegation: delegate %s did not decide transaction %s: %s", delegation.Delegate.DisplayName, input.TransactionID, err)
+	}
+
+	if d.owner == nil {
+		return nil, ErrNoDelegate
+	}
+	return d.owner.Authorize(input)
+}
+
+// delegation returns valid delegation covering request, nil is returned if there is none
+func (d *DelegatedAuthorization) delegation(input *models.PermissionNotificationRequest, now time.Time) (*models.Delegation, error) {
+	list, err := d.store.DelegationList()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range list {
+		if err := VerifyOwnDelegation(&list[i], d.keychain, now); err != nil {
+			continue
+		}
+
+		if DelegationCovers(&list[i], input) {
+			return &list[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// requestConsent sends request to delegate endpoint and returns verified decision
+func requestConsent(keychain *cryptography.Keychain, dial Dialer, delegation *models.Delegation, input *models.PermissionNotificationRequest, timeout time.Duration) (*models.DelegatedConsentDecision, error) {
+	request, err := NewConsentRequest(keychain, delegation, input, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := dial(delegation.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(request); err != nil {
+		return nil, err
+	}
+
+	if err := conn.Write(&Message{
+		Header: Header{Source: keychain.MainPublicKey, Destination: delegation.Delegate.PublicKey.Key, Topic: TopicConsentRequest, Version: Version1},
+		Body:   Body{Payload: buffer.Bytes()},
+	}); err != nil {
+		return nil, err
+	}
+
+	msg, err := ReadTimeout(conn, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if msg.Header.Topic != TopicConsentReply {
+		return nil, fmt.Errorf("%s: unexpected topic", ErrInvalidConsentMsg)
+	}
+
+	var decision models.DelegatedConsentDecision
+	if err := gob.NewDecoder(bytes.NewBuffer(msg.Body.Payload)).Decode(&decision); err != nil {
+		return nil, fmt.Errorf("%s: %s", ErrInvalidConsentMsg, err)
+	}
+
+	if decision.Error != nil {
+		return nil, fmt.Errorf("%s: %s", ErrInvalidConsentMsg, *decision.Error)
+	}
+
+	if !decision.RequestID.Key.Equal(request.RequestID.Key) || decision.TransactionID != input.TransactionID || decision.DelegationID != delegation.ID {
+		return nil, fmt.Errorf("%s: decision does not match request", ErrInvalidConsentMsg)
+	}
+
+	if err := VerifyConsentDecision(&decision, delegation.Delegate.SignatureKey.Key); err != nil {
+		return nil, err
+	}
+	return &decision, nil
+}
+
+func (p *Protocol) handleConsentRequest(c Conn, msg *Message) {
+	var request models.DelegatedConsentRequest
+	if err := gob.NewDecoder(bytes.NewBuffer(msg.Body.Payload)).Decode(&request); err != nil {
+		log.Warningln("delegated consent: invalid payload:", err)
+		sendConsentDecision(c, msg, &models.DelegatedConsentDecision{Error: errorString(ErrInvalidConsentMsg)})
+		return
+	}
+
+	decision := &models.DelegatedConsentDecision{
+		RequestID:     request.RequestID,
+		TransactionID: request.Notification.TransactionID,
+		DelegationID:  request.Delegation.ID,
+	}
+
+	if err := p.decideConsent(msg, &request, decision); err != nil {
+		log.Warningf("delegated consent from %s rejected: %s", msg.Header.Source.String(), err)
+		decision.Error = errorString(err)
+	}
+
+	decision.Decided = time.Now().Format(time.RFC3339)
+	if p.keychain != nil {
+		if err := SignConsentDecision(decision, p.keychain); err != nil {
+			log.Warningln("delegated consent: signing decision failed:", err)
+			return
+		}
+	}
+	sendConsentDecision(c, msg, decision)
+}
+
+// decideConsent verifies request delegated to this node and asks local authorization plugin for decision
+func (p *Protocol) decideConsent(msg *Message, request *models.DelegatedConsentRequest, decision *models.DelegatedConsentDecision) error {
+	if p.keychain == nil || p.authorization == nil {
+		return ErrConsentNotHandled
+	}
+
+	if err := VerifyConsentRequest(request, time.Now()); err != nil {
+		return err
+	}
+
+	owner := request.Delegation.OwnerPublicKey.Key
+	if !owner.Equal(msg.Header.Source) {
+		return fmt.Errorf("%s: owner key does not match message source", ErrInvalidConsentMsg)
+	}
+
+	if !request.Delegation.Delegate.PublicKey.Key.Equal(p.keychain.MainPublicKey) {
+		return ErrNotDelegate
+	}
+
+	contact, err := p.delegatingContact(&request.Delegation)
+	if err != nil {
+		return err
+	}
+
+	if err := checkRequester(p.requesterLists, owner, time.Now()); err != nil {
+		return err
+	}
+
+	if err := p.limiter.AuthorizationStart(owner); err != nil {
+		return err
+	}
+	defer p.limiter.AuthorizationDone(owner)
+
+	notification, err := delegatedNotification(&request.Notification, contact)
+	if err != nil {
+		return err
+	}
+
+	reply, err := p.authorization.Authorize(notification)
+	if err != nil {
+		return err
+	}
+
+	decision.Accepted = reply.Accepted
+	return nil
+}
+
+// delegatingContact returns contact of the owner who signed delegation. Delegation carries
+// keys chosen by the sender, so they have to match contact stored by the owner of this node.
+func (p *Protocol) delegatingContact(delegation *models.Delegation) (*models.Contact, error) {
+	if p.contacts == nil {
+		return nil, ErrConsentNotHandled
+	}
+
+	contact, err := p.contacts.ContactByKey(delegation.OwnerPublicKey.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	if contact == nil || !contact.SignatureKey.Key.Equal(delegation.OwnerSignatureKey.Key) {
+		return nil, ErrUnknownOwner
+	}
+	return contact, nil
+}
+
+// delegatedNotification returns notification shown for request delegated by contact. Requester
+// name and verification were not checked by this node, so they are never shown as received.
+func delegatedNotification(received *models.PermissionNotificationRequest, contact *models.Contact) (*models.PermissionNotificationRequest, error) {
+	requester, err := cryptography.Key32FromString(received.RequesterPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%s: requester key: %s", ErrInvalidConsentMsg, err)
+	}
+
+	notification := *received
+	notification.RequesterName = unverifiedRequesterName(requester)
+	notification.Verification = nil
+	notification.Analysis = append(append([]string(nil), received.Analysis...), fmt.Sprintf("decision delegated by contact %s", contact.DisplayName))
+	return &notification, nil
+}
+
+func sendConsentDecision(c Conn, msg *Message, decision *models.DelegatedConsentDecision) {
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(decision); err != nil {
+		log.Warningln("delegated consent: failed to encode decision:", err)
+		return
+	}
+
+	if err := c.Write(&Message{
+		Header: Header{Source: msg.Header.Destination, Destination: msg.Header.Source, Topic: TopicConsentReply, Version: msg.Header.Version},
+		Body:   Body{Payload: buffer.Bytes()},
+	}); err != nil {
+		log.Warningln("delegated consent: failed to send decision:", err)
+	}
+}
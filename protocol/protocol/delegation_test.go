@@ -0,0 +1,315 @@
+package protocol
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+// pipeConn is one side of in-memory connection
+type pipeConn struct {
+	in   chan *Message
+	out  chan *Message
+	once *sync.Once
+	done chan struct{}
+}
+
+func pipe() (*pipeConn, *pipeConn) {
+	a, b := make(chan *Message, 1), make(chan *Message, 1)
+	once, done := &sync.Once{}, make(chan struct{})
+	return &pipeConn{in: a, out: b, once: once, done: done}, &pipeConn{in: b, out: a, once: once, done: done}
+}
+
+func (p *pipeConn) Read() (*Message, error) {
+	select {
+	case msg := <-p.in:
+		return msg, nil
+	case <-p.done:
+		return nil, fmt.Errorf("closed")
+	}
+}
+
+func (p *pipeConn) Write(msg *Message) error {
+	p.out <- msg
+	return nil
+}
+
+func (p *pipeConn) Close() error {
+	p.once.Do(func() { close(p.done) })
+	return nil
+}
+
+func (p *pipeConn) RemoteAddr() string {
+	return "pipe"
+}
+
+type testAuthorization struct {
+	accept   bool
+	requests []*models.PermissionNotificationRequest
+}
+
+func (a *testAuthorization) Authorize(input *models.PermissionNotificationRequest) (*models.PermissionNotificationResponse, error) {
+	a.requests = append(a.requests, input)
+	return &models.PermissionNotificationResponse{TransactionID: input.TransactionID, Accepted: a.accept}, nil
+}
+
+type testDelegationStore struct {
+	delegations []models.Delegation
+}
+
+func (s *testDelegationStore) DelegationList() ([]models.Delegation, error) {
+	return s.delegations, nil
+}
+
+// testContacts are contacts of delegate node keyed by main public key
+type testContacts map[cryptography.Key32]*models.Contact
+
+func (c testContacts) ContactByKey(key cryptography.Key32) (*models.Contact, error) {
+	return c[key], nil
+}
+
+// ownerContact returns contact of owner stored by delegate
+func ownerContact(owner *cryptography.Keychain) testContacts {
+	return testContacts{owner.MainPublicKey: &models.Contact{
+		PublicKey:    models.Key32{Key: owner.MainPublicKey},
+		SignatureKey: models.Key32{Key: owner.SignaturePublicKey},
+		DisplayName:  "owner",
+	}}
+}
+
+// testNotification creates request for items, "item.field" requests single field of item
+func testNotification(items ...string) *models.PermissionNotificationRequest {
+	requester := cryptography.RandomKey32()
+	request := &models.PermissionNotificationRequest{
+		TransactionID:      "transaction",
+		RequesterPublicKey: requester.String(),
+		RequesterName:      "requester",
+	}
+	for _, item := range items {
+		parts := strings.SplitN(item, ".", 2)
+		field := models.ItemField{Item: parts[0]}
+		if len(parts) == 2 {
+			field.Fields = []string{parts[1]}
+		}
+		request.Item = append(request.Item, field)
+	}
+	return request
+}
+
+func TestDelegationCovers(t *testing.T) {
+	owner := testKeychain(t)
+	scope := models.DelegationScope{Items: []string{"personalDetails", "address"}, MaxSensitivity: models.SensitivityMedium}
+	delegation, err := NewDelegation(owner, models.Contact{}, "ws://delegate/", scope, time.Now(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("NewDelegation() failed: %s", err)
+	}
+
+	if err := VerifyDelegation(delegation, time.Now()); err != nil {
+		t.Errorf("VerifyDelegation() failed: %s", err)
+	}
+
+	if err := VerifyDelegation(delegation, time.Now().Add(time.Hour*2)); err == nil || !strings.HasPrefix(err.Error(), ErrDelegationExpired.Error()) {
+		t.Errorf("VerifyDelegation() of expired delegation returned %v", err)
+	}
+
+	forged := *delegation
+	forged.Scope.MaxSensitivity = models.SensitivityHigh
+	if err := VerifyDelegation(&forged, time.Now()); err == nil || !strings.HasPrefix(err.Error(), ErrDelegationSignature.Error()) {
+		t.Errorf("VerifyDelegation() of forged delegation returned %v", err)
+	}
+
+	tests := []struct {
+		items  []string
+		covers bool
+	}{
+		{items: []string{"personalDetails.name"}, covers: true},
+		{items: []string{"personalDetails.name", "address"}, covers: true},
+		{items: []string{"personalDetails.BSN"}, covers: false},
+		{items: []string{"personalDetails.name", "passport"}, covers: false},
+		{items: []string{"unknown"}, covers: false},
+	}
+
+	for _, test := range tests {
+		if covers := DelegationCovers(delegation, testNotification(test.items...)); covers != test.covers {
+			t.Errorf("DelegationCovers(%v) = %t, expected %t", test.items, covers, test.covers)
+		}
+	}
+}
+
+func TestDelegatedAuthorization(t *testing.T) {
+	owner := testKeychain(t)
+	delegateKeychain := testKeychain(t)
+	contact := models.Contact{
+		ID:           "contact",
+		PublicKey:    models.Key32{Key: delegateKeychain.MainPublicKey},
+		SignatureKey: models.Key32{Key: delegateKeychain.SignaturePublicKey},
+		DisplayName:  "guardian",
+	}
+
+	scope := models.DelegationScope{Identities: []string{"dependent"}, MaxSensitivity: models.SensitivityMedium}
+	delegation, err := NewDelegation(owner, contact, "ws://delegate/", scope, time.Now(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("NewDelegation() failed: %s", err)
+	}
+
+	delegateAuthorization := &testAuthorization{accept: true}
+	delegate := NewProtocol(delegateAuthorization)
+	delegate.SetKeychain(delegateKeychain)
+	delegate.SetContactStore(ownerContact(owner))
+	go delegate.Loop()
+	defer delegate.Stop()
+
+	dial := func(endpoint string) (Conn, error) {
+		local, remote := pipe()
+		delegate.Connections <- remote
+		return local, nil
+	}
+
+	ownerAuthorization := &testAuthorization{accept: false}
+	authorization := NewDelegatedAuthorization(&testDelegationStore{delegations: []models.Delegation{*delegation}}, owner, dial, ownerAuthorization)
+
+	reply, err := authorization.Authorize(testNotification("personalDetails.name"))
+	if err != nil {
+		t.Fatalf("Authorize() failed: %s", err)
+	}
+
+	if !reply.Accepted || len(reply.Identities) != 1 || reply.Identities[0] != "dependent" {
+		t.Errorf("Authorize() returned %+v, expected delegate decision", reply)
+	}
+
+	if len(delegateAuthorization.requests) != 1 || len(ownerAuthorization.requests) != 0 {
+		t.Fatalf("delegate was asked %d times, owner %d times", len(delegateAuthorization.requests), len(ownerAuthorization.requests))
+	}
+
+	if name := delegateAuthorization.requests[0].RequesterName; !strings.HasPrefix(name, "unverified requester") {
+		t.Errorf("delegate was shown requester name %q", name)
+	}
+
+	reply, err = authorization.Authorize(testNotification("passport"))
+	if err != nil {
+		t.Fatalf("Authorize() failed: %s", err)
+	}
+
+	if reply.Accepted || len(ownerAuthorization.requests) != 1 {
+		t.Errorf("Authorize() out of scope returned %+v, expected owner decision", reply)
+	}
+}
+
+func TestDelegatedAuthorizationNotDelegate(t *testing.T) {
+	owner := testKeychain(t)
+	delegateKeychain := testKeychain(t)
+	contact := models.Contact{
+		PublicKey:    models.Key32{Key: cryptography.RandomKey32()},
+		SignatureKey: models.Key32{Key: delegateKeychain.SignaturePublicKey},
+	}
+
+	delegation, err := NewDelegation(owner, contact, "ws://delegate/", models.DelegationScope{MaxSensitivity: models.SensitivityHigh}, time.Now(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("NewDelegation() failed: %s", err)
+	}
+
+	delegateAuthorization := &testAuthorization{accept: true}
+	delegate := NewProtocol(delegateAuthorization)
+	delegate.SetKeychain(delegateKeychain)
+	delegate.SetContactStore(ownerContact(owner))
+	go delegate.Loop()
+	defer delegate.Stop()
+
+	dial := func(endpoint string) (Conn, error) {
+		local, remote := pipe()
+		delegate.Connections <- remote
+		return local, nil
+	}
+
+	ownerAuthorization := &testAuthorization{accept: false}
+	authorization := NewDelegatedAuthorization(&testDelegationStore{delegations: []models.Delegation{*delegation}}, owner, dial, ownerAuthorization)
+
+	reply, err := authorization.Authorize(testNotification("passport"))
+	if err != nil {
+		t.Fatalf("Authorize() failed: %s", err)
+	}
+
+	if reply.Accepted || len(delegateAuthorization.requests) != 0 || len(ownerAuthorization.requests) != 1 {
+		t.Errorf("Authorize() returned %+v, expected owner decision", reply)
+	}
+}
+
+func TestDelegatedAuthorizationUntrustedOwner(t *testing.T) {
+	owner := testKeychain(t)
+	delegateKeychain := testKeychain(t)
+	contact := models.Contact{
+		PublicKey:    models.Key32{Key: delegateKeychain.MainPublicKey},
+		SignatureKey: models.Key32{Key: delegateKeychain.SignaturePublicKey},
+	}
+
+	delegation, err := NewDelegation(owner, contact, "ws://delegate/", models.DelegationScope{MaxSensitivity: models.SensitivityHigh}, time.Now(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("NewDelegation() failed: %s", err)
+	}
+
+	wrongKey := ownerContact(owner)
+	wrongKey[owner.MainPublicKey].SignatureKey = models.Key32{Key: cryptography.RandomKey32()}
+
+	for name, contacts := range map[string]testContacts{"unknown owner": {}, "wrong signature key": wrongKey} {
+		delegateAuthorization := &testAuthorization{accept: true}
+		delegate := NewProtocol(delegateAuthorization)
+		delegate.SetKeychain(delegateKeychain)
+		delegate.SetContactStore(contacts)
+		go delegate.Loop()
+
+		dial := func(endpoint string) (Conn, error) {
+			local, remote := pipe()
+			delegate.Connections <- remote
+			return local, nil
+		}
+
+		ownerAuthorization := &testAuthorization{accept: false}
+		authorization := NewDelegatedAuthorization(&testDelegationStore{delegations: []models.Delegation{*delegation}}, owner, dial, ownerAuthorization)
+
+		reply, err := authorization.Authorize(testNotification("passport"))
+		if err != nil {
+			t.Fatalf("%s: Authorize() failed: %s", name, err)
+		}
+
+		if reply.Accepted || len(delegateAuthorization.requests) != 0 || len(ownerAuthorization.requests) != 1 {
+			t.Errorf("%s: Authorize() returned %+v, expected owner decision", name, reply)
+		}
+		delegate.Stop()
+	}
+}
+
+func TestDelegatedAuthorizationOtherOwner(t *testing.T) {
+	owner := testKeychain(t)
+	other := testKeychain(t)
+	delegateKeychain := testKeychain(t)
+	contact := models.Contact{
+		PublicKey:    models.Key32{Key: delegateKeychain.MainPublicKey},
+		SignatureKey: models.Key32{Key: delegateKeychain.SignaturePublicKey},
+	}
+
+	delegation, err := NewDelegation(other, contact, "ws://delegate/", models.DelegationScope{MaxSensitivity: models.SensitivityHigh}, time.Now(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("NewDelegation() failed: %s", err)
+	}
+
+	if err := VerifyOwnDelegation(delegation, owner, time.Now()); err == nil || !strings.HasPrefix(err.Error(), ErrInvalidDelegation.Error()) {
+		t.Errorf("VerifyOwnDelegation() of delegation of other owner returned %v", err)
+	}
+
+	dial := func(endpoint string) (Conn, error) {
+		t.Errorf("delegate of other owner was dialed")
+		return nil, fmt.Errorf("unexpected dial")
+	}
+
+	ownerAuthorization := &testAuthorization{accept: false}
+	authorization := NewDelegatedAuthorization(&testDelegationStore{delegations: []models.Delegation{*delegation}}, owner, dial, ownerAuthorization)
+
+	if reply, err := authorization.Authorize(testNotification("passport")); err != nil || reply.Accepted || len(ownerAuthorization.requests) != 1 {
+		t.Errorf("Authorize() returned %+v, %v, expected owner decision", reply, err)
+	}
+}
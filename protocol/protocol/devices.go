@@ -0,0 +1,192 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+// PairingTimeout is time device has to accept pairing offer
+const PairingTimeout = time.Minute * 10
+
+// DeviceStore keeps devices paired with the owner
+type DeviceStore interface {
+	DevicePut(device *models.Device) error
+	Device(id string) (models.Device, error)
+	DeviceList() ([]models.Device, error)
+}
+
+// Pairing issues one-time pairing offers and pairs devices accepting them
+type Pairing struct {
+	sync.Mutex
+	store    DeviceStore
+	keychain *cryptography.Keychain
+	relay    string
+	endpoint string
+	offers   map[string]time.Time
+}
+
+// SignedDecision is consent response signed by paired device
+type SignedDecision struct {
+	Response models.PermissionNotificationResponse `json:"response"`
+	// Device is ID of device which signed the decision
+	Device    string `json:"device"`
+	Signature string `json:"signature"`
+}
+
+// NewPairing creates pairing of devices using notification server at relay,
+// devices accept offers at GraphQL endpoint of the node
+func NewPairing(store DeviceStore, keychain *cryptography.Keychain, relay, endpoint string) *Pairing {
+	return &Pairing{
+		store:    store,
+		keychain: keychain,
+		relay:    relay,
+		endpoint: endpoint,
+		offers:   make(map[string]time.Time),
+	}
+}
+
+// Offer creates one-time pairing offer valid for PairingTimeout, devices accept it at endpoint of the node
+func (p *Pairing) Offer(now time.Time) (*models.DevicePairing, error) {
+	if p.endpoint == "" {
+		return nil, ErrNoPairingEndpoint
+	}
+
+	code := cryptography.RandomKey32()
+	offer := &models.DevicePairing{
+		Code:                  code.String(),
+		Relay:                 p.relay,
+		Endpoint:              p.endpoint,
+		ResponderPublicKey:    models.Key32{Key: p.keychain.MainPublicKey},
+		ResponderSignatureKey: models.Key32{Key: p.keychain.SignaturePublicKey},
+		Expires:               now.Add(PairingTimeout).Format(time.RFC3339),
+	}
+
+	payload, err := json.Marshal(offer)
+	if err != nil {
+		return nil, err
+	}
+	offer.Payload = string(payload)
+
+	p.Lock()
+	defer p.Unlock()
+	for code, expires := range p.offers {
+		if now.After(expires) {
+			delete(p.offers, code)
+		}
+	}
+	p.offers[offer.Code] = now.Add(PairingTimeout)
+	return offer, nil
+}
+
+// Pair pairs device which accepted offer, offer code can be used only once
+func (p *Pairing) Pair(input *models.DevicePairInput, now time.Time) (*models.Device, error) {
+	p.Lock()
+	expires, ok := p.offers[input.Code]
+	delete(p.offers, input.Code)
+	p.Unlock()
+
+	if !ok || now.After(expires) {
+		return nil, ErrInvalidPairingCode
+	}
+
+	data, err := signedPairingData(input)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := VerifyDetached(data, input.Signature, input.SignatureKey.Key); err != nil {
+		return nil, fmt.Errorf("%s: %s", ErrPairingSignature, err)
+	}
+
+	device := &models.Device{
+		ID:           input.PublicKey.Key.String(),
+		DisplayName:  input.DisplayName,
+		PublicKey:    input.PublicKey,
+		SignatureKey: models.Key32(input.SignatureKey),
+		Paired:       now.Format(time.RFC3339),
+	}
+	return device, p.store.DevicePut(device)
+}
+
+// SignPairing signs pairing input with device keychain
+func SignPairing(input *models.DevicePairInput, keychain *cryptography.Keychain) (err error) {
+	data, err := signedPairingData(input)
+	if err != nil {
+		return err
+	}
+
+	input.Signature, err = SignDetached(data, keychain)
+	return err
+}
+
+func signedPairingData(input *models.DevicePairInput) ([]byte, error) {
+	unsigned := *input
+	unsigned.Signature = ""
+	return json.Marshal(&unsigned)
+}
+
+// ActiveDevices returns paired devices which were not revoked
+func ActiveDevices(store DeviceStore) (active []models.Device, err error) {
+	devices, err := store.DeviceList()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, device := range devices {
+		if device.RevokedAt == nil {
+			active = append(active, device)
+		}
+	}
+	return active, nil
+}
+
+// SignDecision signs consent response with keychain of paired device
+func SignDecision(response *models.PermissionNotificationResponse, keychain *cryptography.Keychain) (*SignedDecision, error) {
+	decision := &SignedDecision{
+		Response: *response,
+		Device:   keychain.MainPublicKey.String(),
+	}
+
+	data, err := signedDecisionData(decision)
+	if err != nil {
+		return nil, err
+	}
+
+	if decision.Signature, err = SignDetached(data, keychain); err != nil {
+		return nil, err
+	}
+	return decision, nil
+}
+
+// VerifyDecision checks that decision was signed by device paired and not revoked
+func VerifyDecision(decision *SignedDecision, store DeviceStore) (*models.PermissionNotificationResponse, error) {
+	device, err := store.Device(decision.Device)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", ErrUnknownDevice, decision.Device)
+	}
+
+	if device.RevokedAt != nil {
+		return nil, fmt.Errorf("%s: %s", ErrDeviceRevoked, decision.Device)
+	}
+
+	data, err := signedDecisionData(decision)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := VerifyDetached(data, decision.Signature, device.SignatureKey.Key); err != nil {
+		return nil, fmt.Errorf("%s: %s", ErrDecisionSignature, err)
+	}
+	return &decision.Response, nil
+}
+
+func signedDecisionData(decision *SignedDecision) ([]byte, error) {
+	unsigned := *decision
+	unsigned.Signature = ""
+	return json.Marshal(&unsigned)
+}
@@ -0,0 +1,133 @@
+package protocol
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/database"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+func TestPairingWithoutEndpoint(t *testing.T) {
+	pairing := NewPairing(nil, testKeychain(t), "http://relay", "")
+	if _, err := pairing.Offer(time.Now()); err != ErrNoPairingEndpoint {
+		t.Errorf("Offer() without endpoint returned %v", err)
+	}
+}
+
+func TestPairing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Fatalf("failed to create temporary dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	responder, device, other := testKeychain(t), testKeychain(t), testKeychain(t)
+	db, err := database.LoadDatabase(filepath.Join(dir, "db"), responder)
+	if err != nil {
+		t.Fatalf("LoadDatabase failed: %s", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	pairing := NewPairing(db, responder, "http://relay", "http://node/query")
+	offer, err := pairing.Offer(now)
+	if err != nil {
+		t.Fatalf("Offer() failed: %s", err)
+	}
+
+	var payload models.DevicePairing
+	if err := json.Unmarshal([]byte(offer.Payload), &payload); err != nil {
+		t.Fatalf("pairing payload is invalid: %s", err)
+	}
+	if payload.Code != offer.Code || payload.Relay != "http://relay" || !payload.ResponderSignatureKey.Key.Equal(responder.SignaturePublicKey) {
+		t.Errorf("pairing payload is %+v", payload)
+	}
+
+	input := &models.DevicePairInput{
+		Code:         offer.Code,
+		DisplayName:  "phone",
+		PublicKey:    models.Key32{Key: device.MainPublicKey},
+		SignatureKey: models.SignatureKey32{Key: device.SignaturePublicKey},
+	}
+	if err := SignPairing(input, other); err != nil {
+		t.Fatalf("SignPairing() failed: %s", err)
+	}
+	if _, err := pairing.Pair(input, now); err == nil || !strings.HasPrefix(err.Error(), ErrPairingSignature.Error()) {
+		t.Errorf("Pair() signed by other key returned %v", err)
+	}
+
+	// code is consumed by failed attempt as well
+	if err := SignPairing(input, device); err != nil {
+		t.Fatalf("SignPairing() failed: %s", err)
+	}
+	if _, err := pairing.Pair(input, now); err != ErrInvalidPairingCode {
+		t.Errorf("Pair() with used code returned %v", err)
+	}
+
+	if offer, err = pairing.Offer(now); err != nil {
+		t.Fatalf("Offer() failed: %s", err)
+	}
+	input.Code = offer.Code
+	if err := SignPairing(input, device); err != nil {
+		t.Fatalf("SignPairing() failed: %s", err)
+	}
+	if _, err := pairing.Pair(input, now.Add(PairingTimeout+time.Second)); err != ErrInvalidPairingCode {
+		t.Errorf("Pair() with expired code returned %v", err)
+	}
+
+	if offer, err = pairing.Offer(now); err != nil {
+		t.Fatalf("Offer() failed: %s", err)
+	}
+	input.Code = offer.Code
+	if err := SignPairing(input, device); err != nil {
+		t.Fatalf("SignPairing() failed: %s", err)
+	}
+	paired, err := pairing.Pair(input, now)
+	if err != nil {
+		t.Fatalf("Pair() failed: %s", err)
+	}
+
+	response := &models.PermissionNotificationResponse{TransactionID: "transaction", Accepted: true}
+	decision, err := SignDecision(response, device)
+	if err != nil {
+		t.Fatalf("SignDecision() failed: %s", err)
+	}
+
+	if decision.Device != paired.ID {
+		t.Errorf("decision signed by %s, expected %s", decision.Device, paired.ID)
+	}
+
+	if verified, err := VerifyDecision(decision, db); err != nil || !verified.Accepted {
+		t.Errorf("VerifyDecision() returned %+v, %v", verified, err)
+	}
+
+	forged, err := SignDecision(response, other)
+	if err != nil {
+		t.Fatalf("SignDecision() failed: %s", err)
+	}
+	if _, err := VerifyDecision(forged, db); err == nil || !strings.HasPrefix(err.Error(), ErrUnknownDevice.Error()) {
+		t.Errorf("VerifyDecision() of unpaired device returned %v", err)
+	}
+
+	forged.Device = decision.Device
+	if _, err := VerifyDecision(forged, db); err == nil || !strings.HasPrefix(err.Error(), ErrDecisionSignature.Error()) {
+		t.Errorf("VerifyDecision() of forged decision returned %v", err)
+	}
+
+	if _, err := db.DeviceRevoke(paired.ID, now.Format(time.RFC3339)); err != nil {
+		t.Fatalf("DeviceRevoke() failed: %s", err)
+	}
+	if _, err := VerifyDecision(decision, db); err == nil || !strings.HasPrefix(err.Error(), ErrDeviceRevoked.Error()) {
+		t.Errorf("VerifyDecision() of revoked device returned %v", err)
+	}
+
+	if active, err := ActiveDevices(db); err != nil || len(active) != 0 {
+		t.Errorf("ActiveDevices() returned %v, %v", active, err)
+	}
+}
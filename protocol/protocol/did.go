@@ -0,0 +1,49 @@
+package protocol
+
+import (
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+// didContexts are JSON-LD contexts of resolved DID documents
+var didContexts = []string{
+	"https://www.w3.org/ns/did/v1",
+	"https://w3id.org/security/suites/ed25519-2020/v1",
+	"https://w3id.org/security/suites/x25519-2020/v1",
+}
+
+// WalletDID returns did:key identifiers of keychain keys
+func WalletDID(keychain *cryptography.Keychain) models.WalletDID {
+	return models.WalletDID{
+		Main:      models.DID{Key: keychain.MainPublicKey, Type: cryptography.KeyTypeX25519},
+		Signature: models.DID{Key: keychain.SignaturePublicKey, Type: cryptography.KeyTypeEd25519},
+	}
+}
+
+// ResolveDID resolves did:key identifier to DID document. Ed25519 key is listed for
+// authentication and assertion, X25519 key for key agreement. Keychain keys are
+// generated independently, so key agreement key is not derived from Ed25519 key.
+func ResolveDID(did models.DID) models.DIDDocument {
+	id := did.String()
+	methodID := id + "#" + cryptography.MultibaseKey(did.Key, did.Type)
+
+	document := models.DIDDocument{
+		Context: didContexts,
+		ID:      did,
+		VerificationMethod: []models.VerificationMethod{{
+			ID:                 methodID,
+			Type:               did.Type.String(),
+			Controller:         did,
+			PublicKeyMultibase: cryptography.MultibaseKey(did.Key, did.Type),
+		}},
+	}
+
+	switch did.Type {
+	case cryptography.KeyTypeEd25519:
+		document.Authentication = []string{methodID}
+		document.AssertionMethod = []string{methodID}
+	case cryptography.KeyTypeX25519:
+		document.KeyAgreement = []string{methodID}
+	}
+	return document
+}
@@ -0,0 +1,51 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+func TestResolveDID(t *testing.T) {
+	wallet := WalletDID(testKeychain(t))
+
+	document := ResolveDID(wallet.Signature)
+	if document.ID != wallet.Signature || len(document.VerificationMethod) != 1 {
+		t.Fatalf("ResolveDID() returned %+v", document)
+	}
+
+	method := document.VerificationMethod[0]
+	if method.Type != "Ed25519VerificationKey2020" || len(document.Authentication) != 1 ||
+		document.Authentication[0] != method.ID || document.KeyAgreement != nil {
+		t.Errorf("signature key resolved to %+v", document)
+	}
+
+	document = ResolveDID(wallet.Main)
+	if len(document.KeyAgreement) != 1 || document.Authentication != nil {
+		t.Errorf("main key resolved to %+v", document)
+	}
+}
+
+func TestKey32AcceptsDID(t *testing.T) {
+	keychain := testKeychain(t)
+
+	var fromDID, fromHex models.Key32
+	if err := fromDID.UnmarshalGQL(keychain.MainDID()); err != nil {
+		t.Fatalf("UnmarshalGQL() of DID failed: %s", err)
+	}
+	if err := fromHex.UnmarshalGQL(keychain.MainPublicKey.String()); err != nil {
+		t.Fatalf("UnmarshalGQL() of hex failed: %s", err)
+	}
+	if !fromDID.Key.Equal(fromHex.Key) {
+		t.Errorf("DID decoded to %x, expected %x", fromDID.Key, fromHex.Key)
+	}
+
+	var did models.DID
+	if err := did.UnmarshalGQL(keychain.MainPublicKey.String()); err == nil {
+		t.Errorf("DID accepted hex key")
+	}
+	if err := did.UnmarshalGQL(keychain.SignatureDID()); err != nil || did.Type != cryptography.KeyTypeEd25519 {
+		t.Errorf("UnmarshalGQL() returned %+v, %v", did, err)
+	}
+}
@@ -0,0 +1,103 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	log "github.com/sirupsen/logrus"
+)
+
+// WellKnownPath is path on which node serves its discovery document
+const WellKnownPath = "/.well-known/planet"
+
+// EndpointProtocol names websocket endpoint requesters connect to in discovery document
+const EndpointProtocol = "protocol"
+
+// Discovery is document describing the node, it is signed by node signature key
+type Discovery struct {
+	// PublicKey is hex encoded main public key of the node
+	PublicKey string `json:"public_key"`
+	// SignatureKey is hex encoded signature public key of the node
+	SignatureKey string            `json:"signature_key"`
+	Versions     []int             `json:"versions"`
+	Endpoints    map[string]string `json:"endpoints"`
+	Created      string            `json:"created"`
+	Signature    string            `json:"signature"`
+}
+
+// NewDiscovery creates discovery document of keychain owner signed with its signature key
+func NewDiscovery(keychain *cryptography.Keychain, versions []int, endpoints map[string]string, now time.Time) (*Discovery, error) {
+	discovery := &Discovery{
+		PublicKey:    keychain.MainPublicKey.String(),
+		SignatureKey: keychain.SignaturePublicKey.String(),
+		Versions:     versions,
+		Endpoints:    endpoints,
+		Created:      now.Format(time.RFC3339),
+	}
+
+	data, err := signedDiscoveryData(discovery)
+	if err != nil {
+		return nil, err
+	}
+
+	if discovery.Signature, err = SignDetached(data, keychain); err != nil {
+		return nil, err
+	}
+	return discovery, nil
+}
+
+// VerifyDiscovery checks that document is signed by signature key it contains,
+// it returns main public key and signature key of the node
+func VerifyDiscovery(discovery *Discovery) (publicKey, signatureKey cryptography.Key32, err error) {
+	if publicKey, err = cryptography.Key32FromString(discovery.PublicKey); err != nil {
+		return publicKey, signatureKey, fmt.Errorf("%s: public key: %s", ErrInvalidDiscovery, err)
+	}
+
+	if signatureKey, err = cryptography.Key32FromString(discovery.SignatureKey); err != nil {
+		return publicKey, signatureKey, fmt.Errorf("%s: signature key: %s", ErrInvalidDiscovery, err)
+	}
+
+	data, err := signedDiscoveryData(discovery)
+	if err != nil {
+		return publicKey, signatureKey, err
+	}
+
+	if err := VerifyDetached(data, discovery.Signature, signatureKey); err != nil {
+		return publicKey, signatureKey, fmt.Errorf("%s: %s", ErrDiscoverySignature, err)
+	}
+	return publicKey, signatureKey, nil
+}
+
+func signedDiscoveryData(discovery *Discovery) ([]byte, error) {
+	unsigned := *discovery
+	unsigned.Signature = ""
+	return json.Marshal(&unsigned)
+}
+
+// DiscoveryHandler serves discovery document signed once when handler is created
+func DiscoveryHandler(keychain *cryptography.Keychain, versions []int, endpoints map[string]string) (http.Handler, error) {
+	discovery, err := NewDiscovery(keychain, versions, endpoints, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(discovery)
+	if err != nil {
+		return nil, err
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(data); err != nil {
+			log.Warningln("discovery: failed to write document:", err)
+		}
+	}), nil
+}
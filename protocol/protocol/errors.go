@@ -3,3 +3,124 @@ package protocol
 import "errors"
 
 var ErrIDAlreadyUsed = errors.New("id already used")
+
+var (
+	ErrNoCommonVersion    = errors.New("no common protocol version")
+	ErrNoCommonEncoding   = errors.New("no common encoding")
+	ErrNoCommonEncryption = errors.New("no common encryption mode")
+	ErrTopicNotSupported  = errors.New("topic not supported")
+	ErrVersionMismatch    = errors.New("protocol version mismatch")
+	ErrEncryptionMismatch = errors.New("encryption mode mismatch")
+)
+
+var (
+	ErrBanned                = errors.New("requester temporarily banned")
+	ErrMessageTooLarge       = errors.New("message too large")
+	ErrTooManyConnections    = errors.New("too many connections")
+	ErrRateLimited           = errors.New("rate limit exceeded")
+	ErrTooManyPending        = errors.New("too many pending transactions")
+	ErrTooManyAuthorizations = errors.New("too many concurrent authorizations")
+)
+
+var (
+	ErrRequesterBlocked    = errors.New("requester blocked by owner")
+	ErrRequesterMuted      = errors.New("requester muted by owner")
+	ErrRequesterNotAllowed = errors.New("requester not on owner allowlist")
+)
+
+var (
+	ErrValidationFailed     = errors.New("pre transaction validation failed")
+	ErrUnknownValidator     = errors.New("unknown validator type")
+	ErrUnknownOrganisation  = errors.New("organisation not found in registry")
+	ErrRegistrySignature    = errors.New("registry signature verification failed")
+	ErrInvalidRequesterData = errors.New("invalid requester data")
+)
+
+var (
+	ErrInvalidCertificate   = errors.New("invalid requester certificate")
+	ErrUntrustedCertificate = errors.New("requester certificate not issued by trust anchor")
+	ErrMissingCertificate   = errors.New("requester certificate missing")
+)
+
+var (
+	ErrUnknownTemplate  = errors.New("unknown legal template")
+	ErrTemplateMismatch = errors.New("legal template does not match transaction")
+)
+
+var (
+	ErrNoPermissionGranted   = errors.New("no permission granted to requester")
+	ErrNoRequesterEndpoint   = errors.New("requester did not provide endpoint")
+	ErrDataSubjectSignature  = errors.New("data subject message signature verification failed")
+	ErrDataSubjectTimeout    = errors.New("requester did not reply to data subject request")
+	ErrUnknownDataSubject    = errors.New("requester holds no data of owner")
+	ErrInvalidDataSubjectMsg = errors.New("invalid data subject message")
+	ErrOwnerSignatureKey     = errors.New("owner signature key does not match key of received data")
+	ErrInvalidEndpoint       = errors.New("endpoint is not websocket URL")
+)
+
+var (
+	ErrAttestationSignature  = errors.New("deletion attestation signature verification failed")
+	ErrUnknownAttestation    = errors.New("deletion attestation does not match granted permissions")
+	ErrAttestationNotHandled = errors.New("deletion attestations are not accepted")
+	ErrEmptyAttestation      = errors.New("deletion attestation lists no transactions")
+	ErrInvalidRetention      = errors.New("invalid retention period")
+)
+
+var (
+	ErrInvalidDelegation   = errors.New("invalid delegation")
+	ErrDelegationSignature = errors.New("delegation signature verification failed")
+	ErrDelegationExpired   = errors.New("delegation expired")
+	ErrNotDelegate         = errors.New("delegation does not name this node as delegate")
+	ErrNoDelegate          = errors.New("no delegate and no owner authorization")
+	ErrConsentNotHandled   = errors.New("delegated consent requests are not accepted")
+	ErrInvalidConsentMsg   = errors.New("invalid delegated consent message")
+	ErrNoIdentityAllowed   = errors.New("no identity allowed in transaction")
+	ErrUnknownOwner        = errors.New("delegating owner is not contact with matching signature key")
+)
+
+var (
+	ErrInvalidApprovalPolicy = errors.New("invalid approval policy")
+	ErrQuorumTimeout         = errors.New("approval quorum not reached before timeout")
+)
+
+var (
+	ErrInvalidPairingCode = errors.New("invalid or expired pairing code")
+	ErrNoPairingEndpoint  = errors.New("public endpoint devices use to accept pairing not configured")
+	ErrPairingSignature   = errors.New("pairing signature verification failed")
+	ErrUnknownDevice      = errors.New("device not paired")
+	ErrDeviceRevoked      = errors.New("device revoked")
+	ErrDecisionSignature  = errors.New("consent decision signature verification failed")
+)
+
+var (
+	ErrNoPendingTransaction = errors.New("no pending transaction")
+	ErrDuplicatePending     = errors.New("transaction already pending")
+	ErrPendingTimeout       = errors.New("owner did not decide pending transaction before timeout")
+	ErrInvalidFieldSubset   = errors.New("approved fields are not subset of requested")
+	ErrNoFieldApproved      = errors.New("no field approved")
+)
+
+var (
+	ErrInvalidDiscovery   = errors.New("invalid discovery document")
+	ErrDiscoverySignature = errors.New("discovery document signature verification failed")
+)
+
+var (
+	ErrInvalidSelection = errors.New("invalid item selection")
+)
+
+var (
+	ErrPossessionProof      = errors.New("requester did not prove possession of its keys")
+	ErrSourceMismatch       = errors.New("message source does not match requester key")
+	ErrTransactionSignature = errors.New("transaction request signature verification failed")
+	ErrContentEncryption    = errors.New("transaction content decryption failed")
+	ErrNoKeychain           = errors.New("responder keychain not configured")
+)
+
+var (
+	ErrNoReminderSubscriber = errors.New("no owner app subscribed to obligation reminders")
+)
+
+var (
+	ErrOwnerOnly = errors.New("owner token required")
+)
@@ -0,0 +1,119 @@
+package protocol
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/odysseyhack/planet-society/protocol/models"
+	"github.com/vektah/gqlparser/ast"
+	"github.com/vektah/gqlparser/parser"
+)
+
+// restrictQuery removes items and fields not approved by the owner from transaction query
+func restrictQuery(query string, approved []models.ItemField) (string, error) {
+	doc, gqlErr := parser.ParseQuery(&ast.Source{Input: query})
+	if gqlErr != nil {
+		return "", gqlErr
+	}
+
+	var builder strings.Builder
+	builder.WriteString("query {")
+	written := false
+	for _, operation := range doc.Operations {
+		for _, selection := range operation.SelectionSet {
+			item, ok := selection.(*ast.Field)
+			if !ok {
+				continue
+			}
+
+			fields := approvedFields(approved, item.Name)
+			if len(fields) == 0 {
+				continue
+			}
+
+			var selected ast.SelectionSet
+			for _, selection := range item.SelectionSet {
+				if field, ok := selection.(*ast.Field); ok && contains(fields, field.Name) {
+					selected = append(selected, field)
+				}
+			}
+
+			if len(selected) == 0 {
+				continue
+			}
+
+			builder.WriteString(" ")
+			writeField(&builder, item, selected)
+			written = true
+		}
+	}
+	builder.WriteString(" }")
+
+	if !written {
+		return "", ErrNoFieldApproved
+	}
+	return builder.String(), nil
+}
+
+func approvedFields(approved []models.ItemField, item string) []string {
+	for i := range approved {
+		if approved[i].Item == item {
+			return approved[i].Fields
+		}
+	}
+	return nil
+}
+
+func writeField(builder *strings.Builder, field *ast.Field, selection ast.SelectionSet) {
+	if field.Alias != "" && field.Alias != field.Name {
+		builder.WriteString(field.Alias + ": ")
+	}
+	builder.WriteString(field.Name)
+
+	if len(field.Arguments) > 0 {
+		arguments := make([]string, len(field.Arguments))
+		for i, argument := range field.Arguments {
+			arguments[i] = fmt.Sprintf("%s: %s", argument.Name, argument.Value.String())
+		}
+		builder.WriteString("(" + strings.Join(arguments, ", ") + ")")
+	}
+
+	if len(selection) == 0 {
+		return
+	}
+
+	builder.WriteString(" {")
+	for _, selection := range selection {
+		if field, ok := selection.(*ast.Field); ok {
+			builder.WriteString(" ")
+			writeField(builder, field, field.SelectionSet)
+		}
+	}
+	builder.WriteString(" }")
+}
+
+// intersectFields returns fields approved by both a and b, nil approves all fields
+func intersectFields(a, b []models.ItemField) []models.ItemField {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+
+	common := []models.ItemField{}
+	for i := range a {
+		fields := approvedFields(b, a[i].Item)
+		var shared []string
+		for _, field := range a[i].Fields {
+			if contains(fields, field) {
+				shared = append(shared, field)
+			}
+		}
+
+		if len(shared) > 0 {
+			common = append(common, models.ItemField{Item: a[i].Item, Fields: shared})
+		}
+	}
+	return common
+}
@@ -0,0 +1,278 @@
+package protocol
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+)
+
+// Limits defines resources which single requester can use
+type Limits struct {
+	// MaxMessageSize is maximal size of message payload in bytes
+	MaxMessageSize int
+	// ConnectionsPerIP is maximal number of open connections from single address
+	ConnectionsPerIP int
+	// ConnectionsPerKey is maximal number of open connections from single public key proven in pre transaction
+	ConnectionsPerKey int
+	// PreTransactionsPerMinute is maximal number of pre transactions from single public key
+	PreTransactionsPerMinute int
+	// PendingTransactions is maximal number of transactions waiting in queue for single public key
+	PendingTransactions int
+	// ConcurrentAuthorizations is maximal number of authorization prompts shown at once for single public key
+	ConcurrentAuthorizations int
+	// MessagesPerMinute is maximal number of transaction, deletion attestation and consent messages on single connection
+	MessagesPerMinute int
+	// BanDuration is time for which requester is refused after violating limits
+	BanDuration time.Duration
+	// PendingTransactionTTL is time after which pending transaction is removed from queue
+	PendingTransactionTTL time.Duration
+}
+
+// messageOverhead is upper bound of encoded message size without payload
+const messageOverhead = 1024
+
+// DefaultLimits returns limits used by default by the protocol
+func DefaultLimits() Limits {
+	return Limits{
+		MaxMessageSize:           64 * 1024,
+		ConnectionsPerIP:         8,
+		ConnectionsPerKey:        2,
+		PreTransactionsPerMinute: 10,
+		PendingTransactions:      4,
+		ConcurrentAuthorizations: 2,
+		MessagesPerMinute:        30,
+		BanDuration:              time.Minute * 10,
+		PendingTransactionTTL:    time.Minute * 5,
+	}
+}
+
+// FrameSize returns maximal size of encoded message which transport should accept
+func (l Limits) FrameSize() int64 {
+	return int64(l.MaxMessageSize + messageOverhead)
+}
+
+// Limiter tracks resources used by requesters and enforces Limits
+type Limiter struct {
+	sync.Mutex
+	limits          Limits
+	ipConnections   map[string]int
+	keyConnections  map[cryptography.Key32]int
+	preTransactions map[cryptography.Key32][]time.Time
+	authorizations  map[cryptography.Key32]int
+	bans            map[string]time.Time
+}
+
+// NewLimiter creates limiter enforcing given limits
+func NewLimiter(limits Limits) *Limiter {
+	return &Limiter{
+		limits:          limits,
+		ipConnections:   make(map[string]int),
+		keyConnections:  make(map[cryptography.Key32]int),
+		preTransactions: make(map[cryptography.Key32][]time.Time),
+		authorizations:  make(map[cryptography.Key32]int),
+		bans:            make(map[string]time.Time),
+	}
+}
+
+// Limits returns limits enforced by limiter
+func (l *Limiter) Limits() Limits {
+	return l.limits
+}
+
+func ipBanKey(ip string) string {
+	return "ip:" + ip
+}
+
+func keyBanKey(key cryptography.Key32) string {
+	return "key:" + key.String()
+}
+
+// hostFromAddr strips port from remote address
+func hostFromAddr(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+func (l *Limiter) banned(name string) error {
+	until, ok := l.bans[name]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(until) {
+		delete(l.bans, name)
+		return nil
+	}
+	return fmt.Errorf("%s until %s", ErrBanned, until.Format(time.RFC3339))
+}
+
+// Ban refuses requester with given address and key for BanDuration
+func (l *Limiter) Ban(ip string, key cryptography.Key32) {
+	l.Lock()
+	defer l.Unlock()
+
+	until := time.Now().Add(l.limits.BanDuration)
+	if ip != "" {
+		l.bans[ipBanKey(ip)] = until
+	}
+	l.bans[keyBanKey(key)] = until
+}
+
+// BanAddress refuses requester with given address for BanDuration, it is used
+// when requester did not prove its key yet, so the key can't be banned
+func (l *Limiter) BanAddress(ip string) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.bans[ipBanKey(ip)] = time.Now().Add(l.limits.BanDuration)
+}
+
+// Connect registers new connection from ip
+func (l *Limiter) Connect(ip string) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if err := l.banned(ipBanKey(ip)); err != nil {
+		return err
+	}
+
+	if l.ipConnections[ip] >= l.limits.ConnectionsPerIP {
+		return fmt.Errorf("%s: limit %d per address", ErrTooManyConnections, l.limits.ConnectionsPerIP)
+	}
+	l.ipConnections[ip]++
+	return nil
+}
+
+// Disconnect releases connection registered with Connect
+func (l *Limiter) Disconnect(ip string) {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.ipConnections[ip]--; l.ipConnections[ip] <= 0 {
+		delete(l.ipConnections, ip)
+	}
+}
+
+// ConnectKey registers new connection from public key
+func (l *Limiter) ConnectKey(key cryptography.Key32) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if err := l.banned(keyBanKey(key)); err != nil {
+		return err
+	}
+
+	if l.keyConnections[key] >= l.limits.ConnectionsPerKey {
+		return fmt.Errorf("%s: limit %d per key", ErrTooManyConnections, l.limits.ConnectionsPerKey)
+	}
+	l.keyConnections[key]++
+	return nil
+}
+
+// DisconnectKey releases connection registered with ConnectKey
+func (l *Limiter) DisconnectKey(key cryptography.Key32) {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.keyConnections[key]--; l.keyConnections[key] <= 0 {
+		delete(l.keyConnections, key)
+	}
+}
+
+// MessageSize checks if payload size is within limits
+func (l *Limiter) MessageSize(size int) error {
+	if size > l.limits.MaxMessageSize {
+		return fmt.Errorf("%s: %d bytes, limit %d", ErrMessageTooLarge, size, l.limits.MaxMessageSize)
+	}
+	return nil
+}
+
+// PreTransaction registers new pre transaction from key and checks rate limit
+func (l *Limiter) PreTransaction(key cryptography.Key32) error {
+	l.Lock()
+	defer l.Unlock()
+
+	recent := recentEvents(l.preTransactions[key], time.Now().Add(-time.Minute))
+	if len(recent) >= l.limits.PreTransactionsPerMinute {
+		l.preTransactions[key] = recent
+		return fmt.Errorf("%s: limit %d pre transactions per minute", ErrRateLimited, l.limits.PreTransactionsPerMinute)
+	}
+	l.preTransactions[key] = append(recent, time.Now())
+	return nil
+}
+
+// Message checks rate limit of messages received on connection with recent history and returns updated history
+func (l *Limiter) Message(history []time.Time) ([]time.Time, error) {
+	recent := recentEvents(history, time.Now().Add(-time.Minute))
+	if len(recent) >= l.limits.MessagesPerMinute {
+		return recent, fmt.Errorf("%s: limit %d messages per minute", ErrRateLimited, l.limits.MessagesPerMinute)
+	}
+	return append(recent, time.Now()), nil
+}
+
+// Pending checks if requester with given number of pending transactions can add new one
+func (l *Limiter) Pending(pending int) error {
+	if pending >= l.limits.PendingTransactions {
+		return fmt.Errorf("%s: limit %d", ErrTooManyPending, l.limits.PendingTransactions)
+	}
+	return nil
+}
+
+// AuthorizationStart registers new authorization prompt for key
+func (l *Limiter) AuthorizationStart(key cryptography.Key32) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.authorizations[key] >= l.limits.ConcurrentAuthorizations {
+		return fmt.Errorf("%s: limit %d", ErrTooManyAuthorizations, l.limits.ConcurrentAuthorizations)
+	}
+	l.authorizations[key]++
+	return nil
+}
+
+// AuthorizationDone releases prompt registered with AuthorizationStart
+func (l *Limiter) AuthorizationDone(key cryptography.Key32) {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.authorizations[key]--; l.authorizations[key] <= 0 {
+		delete(l.authorizations, key)
+	}
+}
+
+// Prune removes expired bans and rate limiting history
+func (l *Limiter) Prune() {
+	l.Lock()
+	defer l.Unlock()
+
+	now := time.Now()
+	for name, until := range l.bans {
+		if now.After(until) {
+			delete(l.bans, name)
+		}
+	}
+
+	for key, events := range l.preTransactions {
+		recent := recentEvents(events, now.Add(-time.Minute))
+		if len(recent) == 0 {
+			delete(l.preTransactions, key)
+			continue
+		}
+		l.preTransactions[key] = recent
+	}
+}
+
+func recentEvents(events []time.Time, since time.Time) []time.Time {
+	var recent []time.Time
+	for i := range events {
+		if events[i].After(since) {
+			recent = append(recent, events[i])
+		}
+	}
+	return recent
+}
@@ -0,0 +1,233 @@
+package protocol
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+)
+
+func testLimits() Limits {
+	limits := DefaultLimits()
+	limits.ConnectionsPerIP = 1
+	limits.ConnectionsPerKey = 1
+	limits.PreTransactionsPerMinute = 2
+	limits.ConcurrentAuthorizations = 1
+	return limits
+}
+
+func TestLimiterConnections(t *testing.T) {
+	limiter := NewLimiter(testLimits())
+	key := cryptography.RandomKey32()
+
+	if err := limiter.Connect("127.0.0.1"); err != nil {
+		t.Fatalf("Connect failed: %s", err)
+	}
+
+	if err := limiter.Connect("127.0.0.1"); err == nil {
+		t.Errorf("Connect expected to fail above limit")
+	}
+
+	limiter.Disconnect("127.0.0.1")
+	if err := limiter.Connect("127.0.0.1"); err != nil {
+		t.Errorf("Connect failed after Disconnect: %s", err)
+	}
+
+	if err := limiter.ConnectKey(key); err != nil {
+		t.Fatalf("ConnectKey failed: %s", err)
+	}
+
+	if err := limiter.ConnectKey(key); err == nil {
+		t.Errorf("ConnectKey expected to fail above limit")
+	}
+}
+
+func TestLimiterPreTransactionRate(t *testing.T) {
+	limiter := NewLimiter(testLimits())
+	key := cryptography.RandomKey32()
+
+	for i := 0; i < 2; i++ {
+		if err := limiter.PreTransaction(key); err != nil {
+			t.Fatalf("PreTransaction failed: %s", err)
+		}
+	}
+
+	err := limiter.PreTransaction(key)
+	if err == nil || !strings.HasPrefix(err.Error(), ErrRateLimited.Error()) {
+		t.Errorf("PreTransaction returned %v, expected %q", err, ErrRateLimited)
+	}
+}
+
+func TestLimiterAuthorizations(t *testing.T) {
+	limiter := NewLimiter(testLimits())
+	key := cryptography.RandomKey32()
+
+	if err := limiter.AuthorizationStart(key); err != nil {
+		t.Fatalf("AuthorizationStart failed: %s", err)
+	}
+
+	if err := limiter.AuthorizationStart(key); err == nil {
+		t.Errorf("AuthorizationStart expected to fail above limit")
+	}
+
+	limiter.AuthorizationDone(key)
+	if err := limiter.AuthorizationStart(key); err != nil {
+		t.Errorf("AuthorizationStart failed after AuthorizationDone: %s", err)
+	}
+}
+
+func TestLimiterMessageRate(t *testing.T) {
+	limits := testLimits()
+	limits.MessagesPerMinute = 2
+	limiter := NewLimiter(limits)
+
+	var history []time.Time
+	var err error
+	for i := 0; i < 2; i++ {
+		if history, err = limiter.Message(history); err != nil {
+			t.Fatalf("Message failed: %s", err)
+		}
+	}
+
+	if _, err = limiter.Message(history); err == nil || !strings.HasPrefix(err.Error(), ErrRateLimited.Error()) {
+		t.Errorf("Message returned %v, expected %q", err, ErrRateLimited)
+	}
+
+	if _, err = limiter.Message([]time.Time{time.Now().Add(-time.Hour), time.Now().Add(-time.Hour)}); err != nil {
+		t.Errorf("Message failed with old history: %s", err)
+	}
+}
+
+func TestLimiterMessageSize(t *testing.T) {
+	limiter := NewLimiter(testLimits())
+
+	if err := limiter.MessageSize(testLimits().MaxMessageSize); err != nil {
+		t.Errorf("MessageSize failed: %s", err)
+	}
+
+	if err := limiter.MessageSize(testLimits().MaxMessageSize + 1); err == nil {
+		t.Errorf("MessageSize expected to fail above limit")
+	}
+}
+
+func TestLimiterBan(t *testing.T) {
+	limits := testLimits()
+	limits.BanDuration = time.Millisecond * 50
+	limiter := NewLimiter(limits)
+	key := cryptography.RandomKey32()
+
+	limiter.Ban("10.0.0.1", key)
+
+	if err := limiter.Connect("10.0.0.1"); err == nil || !strings.HasPrefix(err.Error(), ErrBanned.Error()) {
+		t.Errorf("Connect returned %v, expected %q", err, ErrBanned)
+	}
+
+	if err := limiter.ConnectKey(key); err == nil || !strings.HasPrefix(err.Error(), ErrBanned.Error()) {
+		t.Errorf("ConnectKey returned %v, expected %q", err, ErrBanned)
+	}
+
+	time.Sleep(limits.BanDuration)
+	if err := limiter.Connect("10.0.0.1"); err != nil {
+		t.Errorf("Connect failed after ban expired: %s", err)
+	}
+}
+
+func TestHostFromAddr(t *testing.T) {
+	if host := hostFromAddr("192.168.1.1:15000"); host != "192.168.1.1" {
+		t.Errorf("hostFromAddr returned %q", host)
+	}
+
+	if host := hostFromAddr("unknown"); host != "unknown" {
+		t.Errorf("hostFromAddr returned %q", host)
+	}
+}
+
+func TestProtocolLimitsProvenKey(t *testing.T) {
+	responder := testKeychain(t)
+	requester := testKeychain(t)
+	attacker := testKeychain(t)
+
+	limits := testLimits()
+	limits.ConnectionsPerIP = 4
+	limits.PendingTransactions = 1
+	proto := NewProtocol(nil)
+	proto.SetKeychain(responder)
+	proto.SetLimits(limits)
+
+	// attacker keeps connection open with key of requester it can't prove
+	local, remote := pipe()
+	closed := make(chan struct{})
+	go func() {
+		proto.handleConn(remote)
+		close(closed)
+	}()
+
+	spoofed := provenRequest(t, requester, attacker, responder.MainPublicKey, nil)
+	if err := local.Write(preTransactionMessage(t, spoofed, requester.MainPublicKey)); err != nil {
+		t.Fatalf("Write() failed: %s", err)
+	}
+
+	if reply := readPreTransactionReply(t, local); reply.Error == nil || !strings.HasPrefix(*reply.Error, ErrPossessionProof.Error()) {
+		t.Errorf("spoofed pre transaction returned %+v", reply)
+	}
+
+	// connection of requester is counted only for proven key, so spoofed connection does not use its slot
+	first := provenRequest(t, requester, requester, responder.MainPublicKey, nil)
+	if reply := preTransact(t, proto, first, requester.MainPublicKey); !reply.Success {
+		t.Fatalf("pre transaction of requester returned %+v", reply)
+	}
+
+	// other key on the same connection is refused without banning the key
+	own := provenRequest(t, attacker, attacker, responder.MainPublicKey, nil)
+	if err := local.Write(preTransactionMessage(t, own, attacker.MainPublicKey)); err != nil {
+		t.Fatalf("Write() failed: %s", err)
+	}
+
+	if reply := readPreTransactionReply(t, local); reply.Error == nil || *reply.Error != ErrSourceMismatch.Error() {
+		t.Errorf("pre transaction with other key returned %+v", reply)
+	}
+	<-closed
+
+	if err := proto.limiter.ConnectKey(requester.MainPublicKey); err != nil {
+		t.Errorf("ConnectKey() of spoofed key returned %s", err)
+	}
+	proto.limiter.DisconnectKey(requester.MainPublicKey)
+
+	// pending transactions are counted for the same proven key
+	second := provenRequest(t, requester, requester, responder.MainPublicKey, nil)
+	if reply := preTransact(t, proto, second, requester.MainPublicKey); reply.Error == nil || !strings.HasPrefix(*reply.Error, ErrTooManyPending.Error()) {
+		t.Errorf("pre transaction above pending limit returned %+v", reply)
+	}
+}
+
+func TestProtocolLimitsMessages(t *testing.T) {
+	limits := testLimits()
+	limits.MessagesPerMinute = 2
+	proto := NewProtocol(nil)
+	proto.SetKeychain(testKeychain(t))
+	proto.SetLimits(limits)
+
+	local, remote := pipe()
+	defer local.Close()
+	source := cryptography.RandomKey32()
+	s := &session{source: &source}
+	msg := &Message{Header: Header{Topic: TopicDeletionAttestation, Source: source}}
+
+	for i := 0; i < 2; i++ {
+		if err := proto.handleMessage(remote, msg, s); err != nil {
+			t.Fatalf("handleMessage() failed: %s", err)
+		}
+		if _, err := local.Read(); err != nil {
+			t.Fatalf("Read() failed: %s", err)
+		}
+	}
+
+	if err := proto.handleMessage(remote, msg, s); err == nil || !strings.HasPrefix(err.Error(), ErrRateLimited.Error()) {
+		t.Errorf("handleMessage() above message limit returned %v", err)
+	}
+
+	if err := proto.limiter.Connect(hostFromAddr(remote.RemoteAddr())); err == nil || !strings.HasPrefix(err.Error(), ErrBanned.Error()) {
+		t.Errorf("Connect() after exceeding message limit returned %v", err)
+	}
+}
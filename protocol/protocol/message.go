@@ -13,6 +13,9 @@ type Header struct {
 	Source      cryptography.Key32
 	Destination cryptography.Key32
 	Topic       cryptography.Key32
+	// Version is protocol version agreed during pre transaction,
+	// it is zero for messages sent before negotiation.
+	Version int
 }
 
 // Body contains payload which is handled by service
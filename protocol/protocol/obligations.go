@@ -0,0 +1,238 @@
+package protocol
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/models"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	day = time.Hour * 24
+
+	// obligationCheckInterval is how often watcher looks for obligations to remind about
+	obligationCheckInterval = time.Hour
+)
+
+// ObligationStore gives access to obligations of granted permissions
+type ObligationStore interface {
+	ObligationList() ([]models.Obligation, error)
+	ObligationReminded(permissionID, id string) error
+}
+
+// ObligationNotifier delivers reminders about obligations to the owner
+type ObligationNotifier interface {
+	Remind(obligation *models.Obligation) error
+}
+
+// NewObligations derives obligations with deadlines from template. Deadlines are counted
+// from permission creation, obligations without deadline days end with permission expiration.
+func NewObligations(template *models.LegalTemplate, created, expiration time.Time) []models.Obligation {
+	var obligations []models.Obligation
+	for _, obligation := range template.Obligations {
+		deadline := expiration
+		if obligation.DeadlineDays > 0 {
+			deadline = created.Add(day * time.Duration(obligation.DeadlineDays))
+		}
+
+		remindAt := deadline.Add(-day * time.Duration(obligation.RemindDays))
+		if remindAt.Before(created) {
+			remindAt = created
+		}
+
+		obligations = append(obligations, models.Obligation{
+			Kind:        obligation.Kind,
+			Description: obligation.Description,
+			Deadline:    deadline.Format(time.RFC3339),
+			RemindAt:    remindAt.Format(time.RFC3339),
+			Status:      models.ObligationStatusPending,
+		})
+	}
+	return obligations
+}
+
+// ObligationStatusAt returns status of obligation at given time
+func ObligationStatusAt(obligation *models.Obligation, now time.Time) (models.ObligationStatus, error) {
+	deadline, err := time.Parse(time.RFC3339, obligation.Deadline)
+	if err != nil {
+		return "", fmt.Errorf("obligation %s: invalid deadline: %s", obligation.ID, err)
+	}
+
+	remindAt, err := time.Parse(time.RFC3339, obligation.RemindAt)
+	if err != nil {
+		return "", fmt.Errorf("obligation %s: invalid reminder time: %s", obligation.ID, err)
+	}
+
+	switch {
+	case !now.Before(deadline):
+		return models.ObligationStatusOverdue, nil
+	case !now.Before(remindAt):
+		return models.ObligationStatusUpcoming, nil
+	default:
+		return models.ObligationStatusPending, nil
+	}
+}
+
+// FilterObligations sets current status of obligations and returns those with given status,
+// nil status returns all obligations
+func FilterObligations(list []models.Obligation, status *models.ObligationStatus, now time.Time) ([]models.Obligation, error) {
+	var filtered []models.Obligation
+	for i := range list {
+		current, err := ObligationStatusAt(&list[i], now)
+		if err != nil {
+			return nil, err
+		}
+
+		list[i].Status = current
+		if status == nil || *status == current {
+			filtered = append(filtered, list[i])
+		}
+	}
+	return filtered, nil
+}
+
+// ObligationWatcher reminds the owner about obligations with deadlines approaching
+type ObligationWatcher struct {
+	store    ObligationStore
+	notifier ObligationNotifier
+	quit     chan struct{}
+}
+
+// NewObligationWatcher creates watcher reminding through notifier
+func NewObligationWatcher(store ObligationStore, notifier ObligationNotifier) *ObligationWatcher {
+	return &ObligationWatcher{
+		store:    store,
+		notifier: notifier,
+		quit:     make(chan struct{}),
+	}
+}
+
+// Check sends reminders for upcoming and overdue obligations which were not reminded yet.
+// Overdue obligations are reminded too, as deadline may pass before reminder is delivered
+// or reminder time may equal the deadline. Every obligation is reminded once, failed
+// reminders are retried on next check.
+func (w *ObligationWatcher) Check(now time.Time) error {
+	list, err := w.store.ObligationList()
+	if err != nil {
+		return err
+	}
+
+	list, err = FilterObligations(list, nil, now)
+	if err != nil {
+		return err
+	}
+
+	for i := range list {
+		if list[i].Reminded || list[i].Status == models.ObligationStatusPending {
+			continue
+		}
+
+		if err := w.notifier.Remind(&list[i]); err != nil {
+			log.Warningf("obligations: reminder for %s failed: %s", list[i].ID, err)
+			continue
+		}
+
+		if err := w.store.ObligationReminded(list[i].PermissionID, list[i].ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Loop checks obligations periodically until Stop is called. Notifier providing
+// Subscribed channel makes watcher check right away when the owner connects.
+func (w *ObligationWatcher) Loop() {
+	ticker := time.NewTicker(obligationCheckInterval)
+	defer ticker.Stop()
+
+	var subscribed <-chan struct{}
+	if notifier, ok := w.notifier.(interface{ Subscribed() <-chan struct{} }); ok {
+		subscribed = notifier.Subscribed()
+	}
+
+	for {
+		if err := w.Check(time.Now()); err != nil {
+			log.Warningln("obligations: check failed:", err)
+		}
+
+		select {
+		case <-w.quit:
+			return
+		case <-ticker.C:
+		case <-subscribed:
+		}
+	}
+}
+
+// Stop stops obligation watcher loop
+func (w *ObligationWatcher) Stop() {
+	w.quit <- struct{}{}
+}
+
+// ObligationReminders delivers reminders to owner apps subscribed through GraphQL API.
+// Reminder fails while no app is subscribed, so watcher retries it until the owner connects.
+type ObligationReminders struct {
+	sync.Mutex
+	subscribers map[chan models.Obligation]struct{}
+	subscribed  chan struct{}
+}
+
+// NewObligationReminders creates reminders without subscribers
+func NewObligationReminders() *ObligationReminders {
+	return &ObligationReminders{
+		subscribers: make(map[chan models.Obligation]struct{}),
+		subscribed:  make(chan struct{}, 1),
+	}
+}
+
+// Remind sends obligation to subscribed apps, it fails if no app received it
+func (r *ObligationReminders) Remind(obligation *models.Obligation) error {
+	r.Lock()
+	defer r.Unlock()
+
+	delivered := false
+	for subscriber := range r.subscribers {
+		select {
+		case subscriber <- *obligation:
+			delivered = true
+		default:
+			log.Warningln("obligations: subscriber too slow, dropping reminder:", obligation.ID)
+		}
+	}
+
+	if !delivered {
+		return ErrNoReminderSubscriber
+	}
+	return nil
+}
+
+// Subscribe returns channel receiving reminders from now on, channel is closed when ctx is done
+func (r *ObligationReminders) Subscribe(ctx context.Context) <-chan models.Obligation {
+	subscriber := make(chan models.Obligation, subscriberBuffer)
+
+	r.Lock()
+	r.subscribers[subscriber] = struct{}{}
+	r.Unlock()
+
+	select {
+	case r.subscribed <- struct{}{}:
+	default:
+	}
+
+	go func() {
+		<-ctx.Done()
+		r.Lock()
+		delete(r.subscribers, subscriber)
+		close(subscriber)
+		r.Unlock()
+	}()
+	return subscriber
+}
+
+// Subscribed signals that app subscribed, reminders waiting for the owner can be sent
+func (r *ObligationReminders) Subscribed() <-chan struct{} {
+	return r.subscribed
+}
@@ -0,0 +1,200 @@
+package protocol
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+type testObligationStore struct {
+	obligations []models.Obligation
+	reminded    map[string]bool
+}
+
+func (s *testObligationStore) ObligationList() ([]models.Obligation, error) {
+	list := make([]models.Obligation, len(s.obligations))
+	copy(list, s.obligations)
+	for i := range list {
+		list[i].Reminded = s.reminded[list[i].ID]
+	}
+	return list, nil
+}
+
+func (s *testObligationStore) ObligationReminded(permissionID, id string) error {
+	s.reminded[id] = true
+	return nil
+}
+
+type testNotifier struct {
+	reminders []string
+}
+
+func (n *testNotifier) Remind(obligation *models.Obligation) error {
+	n.reminders = append(n.reminders, obligation.ID)
+	return nil
+}
+
+func TestNewObligations(t *testing.T) {
+	created := time.Date(2019, 4, 1, 12, 0, 0, 0, time.UTC)
+	expiration := created.Add(day * 365)
+	obligations := NewObligations(&defaultLegalTemplates()[0], created, expiration)
+	if len(obligations) != 2 {
+		t.Fatalf("NewObligations() returned %d obligations, expected 2", len(obligations))
+	}
+
+	if obligations[0].Deadline != created.Add(day*14).Format(time.RFC3339) || obligations[0].RemindAt != created.Add(day*11).Format(time.RFC3339) {
+		t.Errorf("NewObligations() returned %+v for cancellation window", obligations[0])
+	}
+
+	if obligations[1].Deadline != expiration.Format(time.RFC3339) {
+		t.Errorf("NewObligations() returned deadline %s, expected permission expiration", obligations[1].Deadline)
+	}
+
+	statuses := []struct {
+		now    time.Time
+		status models.ObligationStatus
+	}{
+		{now: created, status: models.ObligationStatusPending},
+		{now: created.Add(day * 12), status: models.ObligationStatusUpcoming},
+		{now: created.Add(day * 14), status: models.ObligationStatusOverdue},
+	}
+
+	for _, test := range statuses {
+		status, err := ObligationStatusAt(&obligations[0], test.now)
+		if err != nil {
+			t.Fatalf("ObligationStatusAt() failed: %s", err)
+		}
+		if status != test.status {
+			t.Errorf("ObligationStatusAt(%s) returned %s, expected %s", test.now, status, test.status)
+		}
+	}
+}
+
+func TestObligationWatcherCheck(t *testing.T) {
+	created := time.Date(2019, 4, 1, 12, 0, 0, 0, time.UTC)
+	obligations := NewObligations(&defaultLegalTemplates()[0], created, created.Add(day*365))
+	for i := range obligations {
+		obligations[i].ID = string(rune('a' + i))
+	}
+
+	store := &testObligationStore{obligations: obligations, reminded: make(map[string]bool)}
+	notifier := &testNotifier{}
+	watcher := NewObligationWatcher(store, notifier)
+
+	now := created.Add(day * 12)
+	if err := watcher.Check(now); err != nil {
+		t.Fatalf("Check() failed: %s", err)
+	}
+	if err := watcher.Check(now); err != nil {
+		t.Fatalf("Check() failed: %s", err)
+	}
+
+	if len(notifier.reminders) != 1 || notifier.reminders[0] != "a" {
+		t.Errorf("Check() sent reminders %v, expected single reminder for cancellation window", notifier.reminders)
+	}
+
+	overdue := models.ObligationStatusOverdue
+	list, err := FilterObligations(obligations, &overdue, created.Add(day*20))
+	if err != nil {
+		t.Fatalf("FilterObligations() failed: %s", err)
+	}
+	if len(list) != 1 || list[0].ID != "a" {
+		t.Errorf("FilterObligations() returned %+v, expected overdue cancellation window", list)
+	}
+}
+
+func TestObligationReminders(t *testing.T) {
+	created := time.Date(2019, 4, 1, 12, 0, 0, 0, time.UTC)
+	obligations := NewObligations(&defaultLegalTemplates()[0], created, created.Add(day*365))
+	for i := range obligations {
+		obligations[i].ID = string(rune('a' + i))
+	}
+
+	store := &testObligationStore{obligations: obligations, reminded: make(map[string]bool)}
+	reminders := NewObligationReminders()
+	watcher := NewObligationWatcher(store, reminders)
+
+	// reminder stays due until the owner app subscribes
+	now := created.Add(day * 12)
+	if err := watcher.Check(now); err != nil {
+		t.Fatalf("Check() failed: %s", err)
+	}
+	if store.reminded["a"] {
+		t.Errorf("obligation reminded without subscribed app")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	subscription := reminders.Subscribe(ctx)
+	select {
+	case <-reminders.Subscribed():
+	default:
+		t.Errorf("Subscribe() did not signal subscribed app")
+	}
+
+	if err := watcher.Check(now); err != nil {
+		t.Fatalf("Check() failed: %s", err)
+	}
+	if reminder := <-subscription; reminder.ID != "a" || !store.reminded["a"] {
+		t.Errorf("subscription received %+v, reminded %v", reminder, store.reminded)
+	}
+
+	cancel()
+	if _, ok := <-subscription; ok {
+		t.Errorf("subscription not closed after cancel")
+	}
+
+	if err := reminders.Remind(&obligations[0]); err != ErrNoReminderSubscriber {
+		t.Errorf("Remind() without subscribers returned %v", err)
+	}
+}
+
+func TestObligationWatcherCheckWithoutRemindDays(t *testing.T) {
+	created := time.Date(2019, 4, 1, 12, 0, 0, 0, time.UTC)
+	template := &models.LegalTemplate{
+		Obligations: []models.ObligationTemplate{{Kind: models.ObligationKindPower, Description: "cancel", DeadlineDays: 14}},
+	}
+	obligations := NewObligations(template, created, created.Add(day*365))
+	obligations[0].ID = "a"
+
+	store := &testObligationStore{obligations: obligations, reminded: make(map[string]bool)}
+	notifier := &testNotifier{}
+	watcher := NewObligationWatcher(store, notifier)
+
+	// reminder time equals the deadline, so obligation is overdue once reminder is due
+	if err := watcher.Check(created.Add(day * 14)); err != nil {
+		t.Fatalf("Check() failed: %s", err)
+	}
+	if len(notifier.reminders) != 1 || notifier.reminders[0] != "a" || !store.reminded["a"] {
+		t.Errorf("Check() sent reminders %v, expected reminder at the deadline", notifier.reminders)
+	}
+}
+
+func TestObligationRemindersAfterDeadline(t *testing.T) {
+	created := time.Date(2019, 4, 1, 12, 0, 0, 0, time.UTC)
+	obligations := NewObligations(&defaultLegalTemplates()[0], created, created.Add(day*365))
+	for i := range obligations {
+		obligations[i].ID = string(rune('a' + i))
+	}
+
+	store := &testObligationStore{obligations: obligations, reminded: make(map[string]bool)}
+	reminders := NewObligationReminders()
+	watcher := NewObligationWatcher(store, reminders)
+
+	if err := watcher.Check(created.Add(day * 12)); err != nil {
+		t.Fatalf("Check() failed: %s", err)
+	}
+
+	// app subscribes only after the deadline passed
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	subscription := reminders.Subscribe(ctx)
+
+	if err := watcher.Check(created.Add(day * 20)); err != nil {
+		t.Fatalf("Check() failed: %s", err)
+	}
+	if reminder := <-subscription; reminder.ID != "a" || reminder.Status != models.ObligationStatusOverdue || !store.reminded["a"] {
+		t.Errorf("subscription received %+v, reminded %v", reminder, store.reminded)
+	}
+}
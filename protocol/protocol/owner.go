@@ -0,0 +1,79 @@
+package protocol
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+)
+
+// OwnerTokenHeader carries token of the owner as "Bearer <token>"
+const OwnerTokenHeader = "Authorization"
+
+// publicFields are root fields of GraphQL API served without owner token,
+// devices accept pairing offers authenticated by one-time code
+var publicFields = map[string]bool{
+	"devicePair": true,
+}
+
+// LoadOwnerToken reads token authenticating the owner to GraphQL API, token is generated on the first run
+func LoadOwnerToken(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		key := cryptography.RandomKey32()
+		token := key.String()
+		return token, ioutil.WriteFile(path, []byte(token), 0600)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("owner token %s is empty", path)
+	}
+	return token, nil
+}
+
+// OwnerMiddleware marks context of requests carrying owner token, see IsOwner
+func OwnerMiddleware(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ownerToken(r.Header.Get(OwnerTokenHeader), token) {
+				r = r.WithContext(context.WithValue(r.Context(), "Owner", true))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ownerToken(header, token string) bool {
+	const prefix = "Bearer "
+	if !strings.HasPrefix(header, prefix) || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(header, prefix)), []byte(token)) == 1
+}
+
+// IsOwner reports if request was authenticated with owner token
+func IsOwner(ctx context.Context) bool {
+	owner, _ := ctx.Value("Owner").(bool)
+	return owner
+}
+
+// OwnerFields refuses root queries and mutations other than public fields to requests
+// without owner token. Subscriptions are not resolved through field middleware and
+// check IsOwner themselves.
+func OwnerFields(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+	field := graphql.GetResolverContext(ctx)
+	if field == nil || (field.Object != "Query" && field.Object != "Mutation") || publicFields[field.Field.Name] || IsOwner(ctx) {
+		return next(ctx)
+	}
+	return nil, fmt.Errorf("%s: %s", ErrOwnerOnly, field.Field.Name)
+}
@@ -0,0 +1,127 @@
+package protocol
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/ast"
+)
+
+// fieldContext returns context of resolver of field on object
+func fieldContext(ctx context.Context, object, field string) context.Context {
+	return graphql.WithResolverContext(ctx, &graphql.ResolverContext{
+		Object: object,
+		Field:  graphql.CollectedField{Field: &ast.Field{Name: field}},
+	})
+}
+
+func TestLoadOwnerToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Fatalf("failed to create temporary dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "owner.token")
+	token, err := LoadOwnerToken(path)
+	if err != nil || token == "" {
+		t.Fatalf("LoadOwnerToken() returned %q, %v", token, err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() failed: %s", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("owner token is stored with mode %s", info.Mode())
+	}
+
+	if loaded, err := LoadOwnerToken(path); err != nil || loaded != token {
+		t.Errorf("LoadOwnerToken() returned %q, %v, expected stored token", loaded, err)
+	}
+}
+
+func TestOwnerMiddleware(t *testing.T) {
+	var owner bool
+	handler := OwnerMiddleware("secret")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		owner = IsOwner(r.Context())
+	}))
+
+	headers := map[string]bool{
+		"":              false,
+		"secret":        false,
+		"Bearer other":  false,
+		"Bearer secret": true,
+	}
+
+	for header, expected := range headers {
+		request := httptest.NewRequest(http.MethodPost, "/query", nil)
+		if header != "" {
+			request.Header.Set(OwnerTokenHeader, header)
+		}
+
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+		if owner != expected {
+			t.Errorf("request with %q authenticated owner %v", header, owner)
+		}
+	}
+}
+
+func TestOwnerFields(t *testing.T) {
+	resolved := func(ctx context.Context) (interface{}, error) {
+		return true, nil
+	}
+	owner := context.WithValue(context.Background(), "Owner", true)
+
+	tests := []struct {
+		ctx     context.Context
+		object  string
+		field   string
+		allowed bool
+	}{
+		{ctx: context.Background(), object: "Mutation", field: "transactionApprove", allowed: false},
+		{ctx: context.Background(), object: "Mutation", field: "devicePairingStart", allowed: false},
+		{ctx: context.Background(), object: "Query", field: "pendingTransactions", allowed: false},
+		{ctx: context.Background(), object: "Mutation", field: "devicePair", allowed: true},
+		{ctx: context.Background(), object: "Device", field: "id", allowed: true},
+		{ctx: owner, object: "Mutation", field: "transactionApprove", allowed: true},
+		{ctx: owner, object: "Query", field: "pendingTransactions", allowed: true},
+	}
+
+	for _, test := range tests {
+		_, err := OwnerFields(fieldContext(test.ctx, test.object, test.field), resolved)
+		if test.allowed && err != nil {
+			t.Errorf("%s.%s refused: %s", test.object, test.field, err)
+		}
+		if !test.allowed && (err == nil || !strings.HasPrefix(err.Error(), ErrOwnerOnly.Error())) {
+			t.Errorf("%s.%s returned %v, expected %q", test.object, test.field, err, ErrOwnerOnly)
+		}
+	}
+}
+
+func TestOwnerSubscriptions(t *testing.T) {
+	resolver := &subscriptionResolver{&Resolver{pending: NewPendingQueue(time.Minute), reminders: NewObligationReminders()}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, err := resolver.PendingTransactions(ctx); err == nil || !strings.HasPrefix(err.Error(), ErrOwnerOnly.Error()) {
+		t.Errorf("PendingTransactions() without owner token returned %v", err)
+	}
+
+	if _, err := resolver.ObligationReminders(ctx); err == nil || !strings.HasPrefix(err.Error(), ErrOwnerOnly.Error()) {
+		t.Errorf("ObligationReminders() without owner token returned %v", err)
+	}
+
+	owner := context.WithValue(ctx, "Owner", true)
+	if _, err := resolver.PendingTransactions(owner); err != nil {
+		t.Errorf("PendingTransactions() of owner failed: %s", err)
+	}
+}
@@ -0,0 +1,204 @@
+package protocol
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// subscriberBuffer is number of pending transactions queued for slow subscriber
+const subscriberBuffer = 16
+
+// pendingTransaction is transaction waiting in PendingQueue
+type pendingTransaction struct {
+	transaction models.PendingTransaction
+	received    time.Time
+	reply       chan models.PermissionNotificationResponse
+}
+
+// PendingQueue is authorization plugin keeping transactions pending until the owner
+// approves or denies them through GraphQL API of the node
+type PendingQueue struct {
+	sync.Mutex
+	timeout     time.Duration
+	pending     map[string]*pendingTransaction
+	subscribers map[chan models.PendingTransaction]struct{}
+}
+
+// NewPendingQueue creates queue, transactions not decided before timeout are rejected
+func NewPendingQueue(timeout time.Duration) *PendingQueue {
+	return &PendingQueue{
+		timeout:     timeout,
+		pending:     make(map[string]*pendingTransaction),
+		subscribers: make(map[chan models.PendingTransaction]struct{}),
+	}
+}
+
+// Authorize queues transaction and waits for the owner decision
+func (q *PendingQueue) Authorize(input *models.PermissionNotificationRequest) (*models.PermissionNotificationResponse, error) {
+	now := time.Now()
+	entry := &pendingTransaction{
+		transaction: models.PendingTransaction{
+			TransactionID: input.TransactionID,
+			Notification:  *input,
+			Received:      now.Format(time.RFC3339),
+			Expires:       now.Add(q.timeout).Format(time.RFC3339),
+		},
+		received: now,
+		reply:    make(chan models.PermissionNotificationResponse, 1),
+	}
+
+	q.Lock()
+	if _, ok := q.pending[input.TransactionID]; ok {
+		q.Unlock()
+		return nil, fmt.Errorf("%s: %s", ErrDuplicatePending, input.TransactionID)
+	}
+	q.pending[input.TransactionID] = entry
+	q.publish(entry.transaction)
+	q.Unlock()
+
+	defer q.remove(input.TransactionID)
+
+	select {
+	case response := <-entry.reply:
+		return &response, nil
+	case <-time.After(q.timeout):
+		return nil, fmt.Errorf("%s: %s", ErrPendingTimeout, input.TransactionID)
+	}
+}
+
+// List returns pending transactions ordered from the oldest
+func (q *PendingQueue) List() []models.PendingTransaction {
+	q.Lock()
+	entries := make([]*pendingTransaction, 0, len(q.pending))
+	for _, entry := range q.pending {
+		entries = append(entries, entry)
+	}
+	q.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].received.Before(entries[j].received)
+	})
+
+	list := make([]models.PendingTransaction, len(entries))
+	for i := range entries {
+		list[i] = entries[i].transaction
+	}
+	return list
+}
+
+// Approve accepts pending transaction, fields restrict requested items and their
+// fields shared with requester, nil fields approve everything requested.
+// Selection chooses shared items, nil selection uses default selection of requester.
+func (q *PendingQueue) Approve(transactionID string, fields []models.ItemField, identities []string, selection []models.ItemSelection) (*models.PermissionNotificationResponse, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	entry, ok := q.pending[transactionID]
+	if !ok {
+		return nil, fmt.Errorf("%s: %s", ErrNoPendingTransaction, transactionID)
+	}
+
+	if fields != nil {
+		if err := checkFieldSubset(entry.transaction.Notification.Item, fields); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := CheckSelection(selection); err != nil {
+		return nil, err
+	}
+
+	response := models.PermissionNotificationResponse{
+		TransactionID: transactionID,
+		Accepted:      true,
+		Identities:    identities,
+		Fields:        fields,
+		Selection:     selection,
+	}
+	return q.decide(entry, response), nil
+}
+
+// Deny rejects pending transaction
+func (q *PendingQueue) Deny(transactionID string) (*models.PermissionNotificationResponse, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	entry, ok := q.pending[transactionID]
+	if !ok {
+		return nil, fmt.Errorf("%s: %s", ErrNoPendingTransaction, transactionID)
+	}
+	return q.decide(entry, models.PermissionNotificationResponse{TransactionID: transactionID}), nil
+}
+
+// Subscribe returns channel receiving transactions queued from now on,
+// channel is closed when ctx is done
+func (q *PendingQueue) Subscribe(ctx context.Context) <-chan models.PendingTransaction {
+	subscriber := make(chan models.PendingTransaction, subscriberBuffer)
+
+	q.Lock()
+	q.subscribers[subscriber] = struct{}{}
+	q.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		q.Lock()
+		delete(q.subscribers, subscriber)
+		close(subscriber)
+		q.Unlock()
+	}()
+	return subscriber
+}
+
+// decide passes decision to waiting Authorize call, caller holds the lock
+func (q *PendingQueue) decide(entry *pendingTransaction, response models.PermissionNotificationResponse) *models.PermissionNotificationResponse {
+	delete(q.pending, response.TransactionID)
+	entry.reply <- response
+	return &response
+}
+
+func (q *PendingQueue) remove(transactionID string) {
+	q.Lock()
+	defer q.Unlock()
+	delete(q.pending, transactionID)
+}
+
+// publish sends transaction to subscribers, caller holds the lock
+func (q *PendingQueue) publish(transaction models.PendingTransaction) {
+	for subscriber := range q.subscribers {
+		select {
+		case subscriber <- transaction:
+		default:
+			log.Warningln("pending queue: subscriber too slow, dropping transaction:", transaction.TransactionID)
+		}
+	}
+}
+
+// checkFieldSubset checks that approved fields are subset of requested items and fields
+func checkFieldSubset(requested, approved []models.ItemField) error {
+	for _, item := range approved {
+		index := -1
+		for i := range requested {
+			if requested[i].Item == item.Item {
+				index = i
+				break
+			}
+		}
+
+		if index < 0 {
+			return fmt.Errorf("%s: item %s not requested", ErrInvalidFieldSubset, item.Item)
+		}
+
+		for _, field := range item.Fields {
+			if !contains(requested[index].Fields, field) {
+				return fmt.Errorf("%s: field %s.%s not requested", ErrInvalidFieldSubset, item.Item, field)
+			}
+		}
+	}
+	return nil
+}
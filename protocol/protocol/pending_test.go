@@ -0,0 +1,136 @@
+package protocol
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+func pendingNotification(id string) *models.PermissionNotificationRequest {
+	return &models.PermissionNotificationRequest{
+		TransactionID: id,
+		Item: []models.ItemField{
+			{Item: "personalDetails", Fields: []string{"name", "surname", "BSN"}},
+			{Item: "passport", Fields: []string{"number"}},
+		},
+	}
+}
+
+// waitPending waits until transaction is queued
+func waitPending(t *testing.T, queue *PendingQueue, id string) {
+	for i := 0; i < 100; i++ {
+		for _, pending := range queue.List() {
+			if pending.TransactionID == id {
+				return
+			}
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Fatalf("transaction %s not pending", id)
+}
+
+func TestPendingQueue(t *testing.T) {
+	queue := NewPendingQueue(time.Second * 5)
+	ctx, cancel := context.WithCancel(context.Background())
+	subscription := queue.Subscribe(ctx)
+
+	responses := make(chan *models.PermissionNotificationResponse, 2)
+	for _, id := range []string{"first", "second"} {
+		go func(id string) {
+			response, err := queue.Authorize(pendingNotification(id))
+			if err != nil {
+				t.Errorf("Authorize(%s) failed: %s", id, err)
+			}
+			responses <- response
+		}(id)
+		waitPending(t, queue, id)
+	}
+
+	if pending := queue.List(); len(pending) != 2 || pending[0].TransactionID != "first" {
+		t.Errorf("List() returned %+v", pending)
+	}
+
+	if published := <-subscription; published.TransactionID != "first" || len(published.Notification.Item) != 2 {
+		t.Errorf("subscription received %+v", published)
+	}
+
+	if _, err := queue.Approve("first", []models.ItemField{{Item: "personalDetails", Fields: []string{"email"}}}, nil, nil); err == nil ||
+		!strings.HasPrefix(err.Error(), ErrInvalidFieldSubset.Error()) {
+		t.Errorf("Approve() of not requested field returned %v", err)
+	}
+
+	subset := []models.ItemField{{Item: "personalDetails", Fields: []string{"name"}}}
+	if _, err := queue.Approve("first", subset, nil, nil); err != nil {
+		t.Fatalf("Approve() failed: %s", err)
+	}
+	if response := <-responses; !response.Accepted || len(response.Fields) != 1 || response.Fields[0].Fields[0] != "name" {
+		t.Errorf("approved transaction returned %+v", response)
+	}
+
+	if _, err := queue.Deny("second"); err != nil {
+		t.Fatalf("Deny() failed: %s", err)
+	}
+	if response := <-responses; response.Accepted {
+		t.Errorf("denied transaction returned %+v", response)
+	}
+
+	if _, err := queue.Deny("second"); err == nil || !strings.HasPrefix(err.Error(), ErrNoPendingTransaction.Error()) {
+		t.Errorf("Deny() of decided transaction returned %v", err)
+	}
+
+	cancel()
+	for range subscription {
+	}
+}
+
+func TestPendingQueueTimeout(t *testing.T) {
+	queue := NewPendingQueue(time.Millisecond * 50)
+	if _, err := queue.Authorize(pendingNotification("late")); err == nil || !strings.HasPrefix(err.Error(), ErrPendingTimeout.Error()) {
+		t.Errorf("Authorize() without decision returned %v", err)
+	}
+
+	if pending := queue.List(); len(pending) != 0 {
+		t.Errorf("List() after timeout returned %+v", pending)
+	}
+}
+
+func TestRestrictQuery(t *testing.T) {
+	query := `query { personalDetails { name surname BSN } passport(id: "1") { number } }`
+
+	restricted, err := restrictQuery(query, []models.ItemField{{Item: "personalDetails", Fields: []string{"name", "BSN"}}})
+	if err != nil {
+		t.Fatalf("restrictQuery() failed: %s", err)
+	}
+	if restricted != "query { personalDetails { name BSN } }" {
+		t.Errorf("restrictQuery() returned %q", restricted)
+	}
+
+	restricted, err = restrictQuery(query, []models.ItemField{{Item: "passport", Fields: []string{"number"}}})
+	if err != nil {
+		t.Fatalf("restrictQuery() failed: %s", err)
+	}
+	if restricted != `query { passport(id: "1") { number } }` {
+		t.Errorf("restrictQuery() returned %q", restricted)
+	}
+
+	if _, err := restrictQuery(query, []models.ItemField{}); err != ErrNoFieldApproved {
+		t.Errorf("restrictQuery() without fields returned %v", err)
+	}
+}
+
+func TestIntersectFields(t *testing.T) {
+	a := []models.ItemField{{Item: "personalDetails", Fields: []string{"name", "surname"}}, {Item: "passport", Fields: []string{"number"}}}
+	b := []models.ItemField{{Item: "personalDetails", Fields: []string{"surname", "BSN"}}}
+
+	if common := intersectFields(nil, a); len(common) != 2 {
+		t.Errorf("intersectFields() with all fields returned %+v", common)
+	}
+
+	common := intersectFields(a, b)
+	if len(common) != 1 || common[0].Item != "personalDetails" || len(common[0].Fields) != 1 || common[0].Fields[0] != "surname" {
+		t.Errorf("intersectFields() returned %+v", common)
+	}
+}
@@ -1,9 +1,10 @@
 package protocol
 
 import (
-	"bytes"
 	"encoding/json"
-	"net/http"
+	"fmt"
+	"io/ioutil"
+	"sync"
 
 	"github.com/odysseyhack/planet-society/protocol/models"
 )
@@ -16,31 +17,119 @@ type Plugins struct {
 	preTransactionValidator []PreTransactionValidator
 }
 
+// Verification is a result of successful validation
+type Verification struct {
+	// Statement is human readable verification result shown to the owner
+	Statement string
+	// Name is requester name confirmed by validator, empty if validator does not verify names
+	Name string
+}
+
+// PreTransactionValidator verifies requester before transaction is queued.
+// Validate returns verification result or nil if there is nothing to report,
+// returned error rejects pre transaction. Validators run only after requester
+// proved possession of keys claimed in the request, see VerifyPossession.
 type PreTransactionValidator interface {
-	Validate(request *models.PreTransactionRequest) bool
+	Name() string
+	Validate(request *models.PreTransactionRequest) (*Verification, error)
 }
 
-func (p *Plugins) ValidatePreTransaction(request *models.PreTransactionRequest) bool {
-	for i := range p.preTransactionValidator {
-		if !p.preTransactionValidator[i].Validate(request) {
-			return false
-		}
-	}
-	return true
+// ValidatorFactory creates validator from configuration parameters
+type ValidatorFactory func(params map[string]string) (PreTransactionValidator, error)
+
+// ValidatorConfig configures single validator
+type ValidatorConfig struct {
+	Type   string            `json:"type"`
+	Params map[string]string `json:"params"`
 }
 
-type BlockChainExample struct {
+// PluginsConfig configures plugins used by the protocol
+type PluginsConfig struct {
+	Validators []ValidatorConfig `json:"validators"`
 }
 
-func (b *BlockChainExample) Validate(request *models.PreTransactionRequest) bool {
-	data, err := json.Marshal(request)
-	if err != nil {
-		return false
+var (
+	factoriesLock      sync.RWMutex
+	validatorFactories = map[string]ValidatorFactory{
+		"sanity":      NewSanityValidatorFromParams,
+		"registry":    NewRegistryValidatorFromParams,
+		"certificate": NewCertificateValidatorFromParams,
 	}
-	client := http.Client{}
-	resp, err := client.Post("http://block-chain-verification.com:3033", "json", bytes.NewReader(data))
+)
+
+// RegisterValidatorFactory makes validator type available in configuration
+func RegisterValidatorFactory(name string, factory ValidatorFactory) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+	validatorFactories[name] = factory
+}
+
+// LoadPluginsConfig reads plugins configuration from JSON file
+func LoadPluginsConfig(path string) (*PluginsConfig, error) {
+	data, err := ioutil.ReadFile(path)
 	if err != nil {
-		return false
+		return nil, err
+	}
+
+	var config PluginsConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("plugins config %q: %s", path, err)
+	}
+	return &config, nil
+}
+
+// RegisterPreTransactionValidator adds validator run on every pre transaction
+func (p *Plugins) RegisterPreTransactionValidator(validator PreTransactionValidator) {
+	p.preTransactionValidator = append(p.preTransactionValidator, validator)
+}
+
+// Configure creates and registers validators defined in configuration
+func (p *Plugins) Configure(config *PluginsConfig) error {
+	factoriesLock.RLock()
+	defer factoriesLock.RUnlock()
+
+	for _, validatorConfig := range config.Validators {
+		factory, ok := validatorFactories[validatorConfig.Type]
+		if !ok {
+			return fmt.Errorf("%s: %q", ErrUnknownValidator, validatorConfig.Type)
+		}
+
+		validator, err := factory(validatorConfig.Params)
+		if err != nil {
+			return fmt.Errorf("validator %q: %s", validatorConfig.Type, err)
+		}
+		p.RegisterPreTransactionValidator(validator)
+	}
+	return nil
+}
+
+// ValidatePreTransaction runs all validators and returns their verification statements
+// and requester name confirmed by validators. Error is returned if any of validators
+// rejects request or validators confirmed different names.
+func (p *Plugins) ValidatePreTransaction(request *models.PreTransactionRequest) (statements []string, verifiedName string, err error) {
+	for i := range p.preTransactionValidator {
+		verification, err := p.preTransactionValidator[i].Validate(request)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %s: %s", ErrValidationFailed, p.preTransactionValidator[i].Name(), err)
+		}
+
+		if verification == nil {
+			continue
+		}
+
+		if verification.Statement != "" {
+			statements = append(statements, verification.Statement)
+		}
+
+		if verification.Name == "" {
+			continue
+		}
+
+		if verifiedName != "" && verifiedName != verification.Name {
+			return nil, "", fmt.Errorf("%s: %s: confirmed name %q, other validator confirmed %q",
+				ErrValidationFailed, p.preTransactionValidator[i].Name(), verification.Name, verifiedName)
+		}
+		verifiedName = verification.Name
 	}
-	return resp.StatusCode == http.StatusOK
+	return statements, verifiedName, nil
 }
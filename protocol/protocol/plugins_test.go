@@ -0,0 +1,105 @@
+package protocol
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+type testValidator struct {
+	result string
+	name   string
+	err    error
+}
+
+func (v *testValidator) Name() string {
+	return "test"
+}
+
+func (v *testValidator) Validate(request *models.PreTransactionRequest) (*Verification, error) {
+	if v.err != nil {
+		return nil, v.err
+	}
+	return &Verification{Statement: v.result, Name: v.name}, nil
+}
+
+func TestValidatePreTransaction(t *testing.T) {
+	var plugins Plugins
+	plugins.RegisterPreTransactionValidator(&testValidator{result: "verified by test"})
+	plugins.RegisterPreTransactionValidator(&testValidator{})
+
+	verification, name, err := plugins.ValidatePreTransaction(&models.PreTransactionRequest{})
+	if err != nil {
+		t.Fatalf("ValidatePreTransaction failed: %s", err)
+	}
+
+	if len(verification) != 1 || verification[0] != "verified by test" {
+		t.Errorf("ValidatePreTransaction returned %v", verification)
+	}
+
+	if name != "" {
+		t.Errorf("ValidatePreTransaction confirmed name %q, no validator verifies names", name)
+	}
+}
+
+func TestValidatePreTransactionVerifiedName(t *testing.T) {
+	var plugins Plugins
+	plugins.RegisterPreTransactionValidator(&testValidator{result: "registry", name: "T-mobile"})
+	plugins.RegisterPreTransactionValidator(&testValidator{result: "certificate", name: "T-mobile"})
+
+	_, name, err := plugins.ValidatePreTransaction(&models.PreTransactionRequest{})
+	if err != nil {
+		t.Fatalf("ValidatePreTransaction failed: %s", err)
+	}
+
+	if name != "T-mobile" {
+		t.Errorf("ValidatePreTransaction confirmed name %q, expected %q", name, "T-mobile")
+	}
+
+	plugins.RegisterPreTransactionValidator(&testValidator{result: "other", name: "John Smith"})
+	if _, _, err := plugins.ValidatePreTransaction(&models.PreTransactionRequest{}); err == nil {
+		t.Errorf("ValidatePreTransaction expected to fail for conflicting names")
+	}
+}
+
+func TestValidatePreTransactionRejected(t *testing.T) {
+	var plugins Plugins
+	plugins.RegisterPreTransactionValidator(&testValidator{result: "verified by test"})
+	plugins.RegisterPreTransactionValidator(&testValidator{err: fmt.Errorf("rejected")})
+
+	_, _, err := plugins.ValidatePreTransaction(&models.PreTransactionRequest{})
+	if err == nil || !strings.HasPrefix(err.Error(), ErrValidationFailed.Error()) {
+		t.Errorf("ValidatePreTransaction returned %v, expected %q", err, ErrValidationFailed)
+	}
+}
+
+func TestPluginsConfigure(t *testing.T) {
+	RegisterValidatorFactory("test", func(params map[string]string) (PreTransactionValidator, error) {
+		return &testValidator{result: params["result"]}, nil
+	})
+
+	var plugins Plugins
+	config := &PluginsConfig{Validators: []ValidatorConfig{
+		{Type: "sanity"},
+		{Type: "test", Params: map[string]string{"result": "configured"}},
+	}}
+
+	if err := plugins.Configure(config); err != nil {
+		t.Fatalf("Configure failed: %s", err)
+	}
+
+	if len(plugins.preTransactionValidator) != 2 {
+		t.Errorf("Configure registered %d validators, expected 2", len(plugins.preTransactionValidator))
+	}
+}
+
+func TestPluginsConfigureUnknown(t *testing.T) {
+	var plugins Plugins
+	config := &PluginsConfig{Validators: []ValidatorConfig{{Type: "does-not-exist"}}}
+
+	if err := plugins.Configure(config); err == nil {
+		t.Errorf("Configure expected to fail for unknown validator")
+	}
+}
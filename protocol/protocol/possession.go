@@ -0,0 +1,122 @@
+package protocol
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+// possessionData is data covered by proof of possession of requester keys
+type possessionData struct {
+	Request            models.PreTransactionRequest `json:"request"`
+	ResponderPublicKey string                       `json:"responder_public_key"`
+}
+
+// signedPossessionData returns data covered by proof, proof itself is blanked
+func signedPossessionData(request *models.PreTransactionRequest, responder cryptography.Key32) ([]byte, error) {
+	data := possessionData{Request: *request, ResponderPublicKey: responder.String()}
+	data.Request.Proof = ""
+	return json.Marshal(&data)
+}
+
+// ProvePossession fills proof of pre transaction request sent to responder.
+// The request is signed with requester signature key and the signature is boxed
+// from requester main key to the responder, so the proof shows possession of both
+// keys and can't be replayed to other responder or with changed request.
+func ProvePossession(request *models.PreTransactionRequest, keychain *cryptography.Keychain, responder cryptography.Key32) error {
+	data, err := signedPossessionData(request, responder)
+	if err != nil {
+		return err
+	}
+
+	signature, err := SignDetached(data, keychain)
+	if err != nil {
+		return err
+	}
+
+	proof, err := cryptography.BoxEncrypt([]byte(signature), &responder, &keychain.MainPrivateKey)
+	if err != nil {
+		return err
+	}
+	request.Proof = hex.EncodeToString(proof)
+	return nil
+}
+
+// VerifyPossession verifies proof of pre transaction request received by responder with keychain
+func VerifyPossession(request *models.PreTransactionRequest, keychain *cryptography.Keychain) error {
+	proof, err := hex.DecodeString(request.Proof)
+	if err != nil || len(proof) < 24 {
+		return fmt.Errorf("%s: malformed proof", ErrPossessionProof)
+	}
+
+	signature, err := cryptography.BoxDecrypt(proof, &keychain.MainPrivateKey, &request.MainPublicKey.Key)
+	if err != nil {
+		return fmt.Errorf("%s: %s", ErrPossessionProof, err)
+	}
+
+	data, err := signedPossessionData(request, keychain.MainPublicKey)
+	if err != nil {
+		return err
+	}
+
+	if err := VerifyDetached(data, string(signature), request.SignaturePublicKey.Key); err != nil {
+		return fmt.Errorf("%s: %s", ErrPossessionProof, err)
+	}
+	return nil
+}
+
+// signedTransactionRequestData returns data covered by transaction request signature
+func signedTransactionRequestData(request *models.TransactionRequest) ([]byte, error) {
+	unsigned := *request
+	unsigned.Signature = ""
+	return json.Marshal(&unsigned)
+}
+
+// SignTransactionRequest signs transaction request with requester keychain
+func SignTransactionRequest(request *models.TransactionRequest, keychain *cryptography.Keychain) (err error) {
+	data, err := signedTransactionRequestData(request)
+	if err != nil {
+		return err
+	}
+	request.Signature, err = SignDetached(data, keychain)
+	return err
+}
+
+// VerifyTransactionRequest verifies transaction request signature made with requester signature key
+func VerifyTransactionRequest(request *models.TransactionRequest, key cryptography.Key32) error {
+	data, err := signedTransactionRequestData(request)
+	if err != nil {
+		return err
+	}
+
+	if err := VerifyDetached(data, request.Signature, key); err != nil {
+		return fmt.Errorf("%s: %s", ErrTransactionSignature, err)
+	}
+	return nil
+}
+
+// EncryptContent encrypts transaction content to requester main key, result is hex encoded
+func EncryptContent(content string, requester cryptography.Key32, keychain *cryptography.Keychain) (string, error) {
+	encrypted, err := cryptography.BoxEncrypt([]byte(content), &requester, &keychain.MainPrivateKey)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(encrypted), nil
+}
+
+// DecryptContent decrypts transaction content encrypted by responder with EncryptContent
+func DecryptContent(content string, responder cryptography.Key32, keychain *cryptography.Keychain) (string, error) {
+	encrypted, err := hex.DecodeString(content)
+	if err != nil || len(encrypted) < 24 {
+		return "", fmt.Errorf("%s: malformed content", ErrContentEncryption)
+	}
+
+	decrypted, err := cryptography.BoxDecrypt(encrypted, &keychain.MainPrivateKey, &responder)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", ErrContentEncryption, err)
+	}
+	return string(decrypted), nil
+}
@@ -0,0 +1,225 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/gob"
+	"strings"
+	"testing"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+// provenRequest returns pre transaction request of requester with proof made by signer
+func provenRequest(t *testing.T, requester, signer *cryptography.Keychain, responder cryptography.Key32, certificates []string) *models.PreTransactionRequest {
+	request := testRequest(requester, certificates)
+	request.Capabilities = DefaultCapabilities()
+	if err := ProvePossession(request, signer, responder); err != nil {
+		t.Fatalf("ProvePossession() failed: %s", err)
+	}
+	return request
+}
+
+// preTransactionMessage returns message with pre transaction request sent from source
+func preTransactionMessage(t *testing.T, request *models.PreTransactionRequest, source cryptography.Key32) *Message {
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(request); err != nil {
+		t.Fatalf("Encode() failed: %s", err)
+	}
+
+	return &Message{
+		Header: Header{Topic: TopicPreTransactionRequest, Source: source},
+		Body:   Body{Payload: buffer.Bytes()},
+	}
+}
+
+// preTransact sends pre transaction request from source to the protocol and returns the reply
+func preTransact(t *testing.T, proto *Protocol, request *models.PreTransactionRequest, source cryptography.Key32) *models.PreTransactionReply {
+	local, remote := pipe()
+	defer local.Close()
+	s := &session{source: &source}
+	defer proto.release(s)
+	if err := proto.handleMessage(remote, preTransactionMessage(t, request, source), s); err != nil {
+		t.Fatalf("handleMessage() failed: %s", err)
+	}
+	return readPreTransactionReply(t, local)
+}
+
+// readPreTransactionReply reads pre transaction reply from connection
+func readPreTransactionReply(t *testing.T, c Conn) *models.PreTransactionReply {
+	msg, err := c.Read()
+	if err != nil {
+		t.Fatalf("Read() failed: %s", err)
+	}
+
+	var reply models.PreTransactionReply
+	if err := gob.NewDecoder(bytes.NewBuffer(msg.Body.Payload)).Decode(&reply); err != nil {
+		t.Fatalf("Decode() failed: %s", err)
+	}
+	return &reply
+}
+
+func TestVerifyPossession(t *testing.T) {
+	responder := testKeychain(t)
+	requester := testKeychain(t)
+
+	request := provenRequest(t, requester, requester, responder.MainPublicKey, nil)
+	if err := VerifyPossession(request, responder); err != nil {
+		t.Fatalf("VerifyPossession() failed: %s", err)
+	}
+
+	endpoint := "ws://attacker/"
+	changed := *request
+	changed.Endpoint = &endpoint
+	if err := VerifyPossession(&changed, responder); err == nil || !strings.HasPrefix(err.Error(), ErrPossessionProof.Error()) {
+		t.Errorf("VerifyPossession() of changed request returned %v", err)
+	}
+
+	other := testKeychain(t)
+	if err := VerifyPossession(request, other); err == nil || !strings.HasPrefix(err.Error(), ErrPossessionProof.Error()) {
+		t.Errorf("VerifyPossession() by other responder returned %v", err)
+	}
+
+	unproven := testRequest(requester, nil)
+	if err := VerifyPossession(unproven, responder); err == nil || !strings.HasPrefix(err.Error(), ErrPossessionProof.Error()) {
+		t.Errorf("VerifyPossession() without proof returned %v", err)
+	}
+}
+
+func TestPreTransactionReplayedCertificate(t *testing.T) {
+	anchor := testKeychain(t)
+	responder := testKeychain(t)
+	certified := testKeychain(t)
+	attacker := testKeychain(t)
+	anchors := &TrustAnchors{Anchors: []TrustAnchor{{Name: "kvk", Key: anchor.SignaturePublicKey.String()}}}
+	chain := encode(t, issue(t, testCertificate("T-mobile", certified, false), anchor))
+
+	proto := NewProtocol(nil)
+	proto.RegisterPreTransactionValidator(NewCertificateValidator(anchors, true))
+	proto.SetKeychain(responder)
+
+	// attacker replays public certificate chain with keys of certified requester
+	replayed := provenRequest(t, certified, attacker, responder.MainPublicKey, chain)
+	reply := preTransact(t, proto, replayed, certified.MainPublicKey)
+	if reply.Success || reply.Error == nil || !strings.HasPrefix(*reply.Error, ErrPossessionProof.Error()) {
+		t.Errorf("replayed certificate chain returned %+v", reply)
+	}
+
+	if _, ok := proto.TransactionQueue.Get(replayed.TransactionID.Key); ok {
+		t.Errorf("transaction with replayed certificate chain added to queue")
+	}
+
+	// proof made for other responder is not accepted either
+	other := provenRequest(t, certified, certified, attacker.MainPublicKey, chain)
+	if reply := preTransact(t, proto, other, certified.MainPublicKey); reply.Success {
+		t.Errorf("proof made for other responder returned %+v", reply)
+	}
+
+	valid := provenRequest(t, certified, certified, responder.MainPublicKey, chain)
+	if reply := preTransact(t, proto, valid, attacker.MainPublicKey); reply.Success || reply.Error == nil || *reply.Error != ErrSourceMismatch.Error() {
+		t.Errorf("request sent from other source returned %+v", reply)
+	}
+
+	reply = preTransact(t, proto, valid, certified.MainPublicKey)
+	if !reply.Success {
+		t.Fatalf("proven request returned %+v", reply)
+	}
+
+	entry, ok := proto.TransactionQueue.Get(valid.TransactionID.Key)
+	if !ok || !entry.RequesterVerified || entry.RequesterName != "T-mobile" {
+		t.Errorf("queue contains %+v", entry)
+	}
+}
+
+func TestVerifyTransactionRequest(t *testing.T) {
+	requester := testKeychain(t)
+	attacker := testKeychain(t)
+
+	request := &models.TransactionRequest{
+		TransactionID: models.Key32{Key: cryptography.RandomKey32()},
+		Query:         "{ personalDetails { name } }",
+	}
+
+	if err := SignTransactionRequest(request, requester); err != nil {
+		t.Fatalf("SignTransactionRequest() failed: %s", err)
+	}
+
+	if err := VerifyTransactionRequest(request, requester.SignaturePublicKey); err != nil {
+		t.Errorf("VerifyTransactionRequest() failed: %s", err)
+	}
+
+	changed := *request
+	changed.Query = "{ passport { number } }"
+	if err := VerifyTransactionRequest(&changed, requester.SignaturePublicKey); err == nil || !strings.HasPrefix(err.Error(), ErrTransactionSignature.Error()) {
+		t.Errorf("VerifyTransactionRequest() of changed request returned %v", err)
+	}
+
+	forged := *request
+	if err := SignTransactionRequest(&forged, attacker); err != nil {
+		t.Fatalf("SignTransactionRequest() failed: %s", err)
+	}
+
+	if err := VerifyTransactionRequest(&forged, requester.SignaturePublicKey); err == nil || !strings.HasPrefix(err.Error(), ErrTransactionSignature.Error()) {
+		t.Errorf("VerifyTransactionRequest() of forged request returned %v", err)
+	}
+}
+
+func TestEncryptContent(t *testing.T) {
+	responder := testKeychain(t)
+	requester := testKeychain(t)
+
+	encrypted, err := EncryptContent("John Smith", requester.MainPublicKey, responder)
+	if err != nil {
+		t.Fatalf("EncryptContent() failed: %s", err)
+	}
+
+	if content, err := DecryptContent(encrypted, responder.MainPublicKey, requester); err != nil || content != "John Smith" {
+		t.Errorf("DecryptContent() returned %q, %v", content, err)
+	}
+
+	if _, err := DecryptContent(encrypted, responder.MainPublicKey, testKeychain(t)); err == nil {
+		t.Errorf("DecryptContent() by other requester succeeded")
+	}
+}
+
+func TestPreTransactionVersion1(t *testing.T) {
+	responder := testKeychain(t)
+	requester := testKeychain(t)
+
+	proto := NewProtocol(nil)
+	proto.SetKeychain(responder)
+
+	// peer built before Version2 sends no proof, it learns it has to upgrade
+	request := testRequest(requester, nil)
+	request.Capabilities = DefaultCapabilities()
+	request.Capabilities.Versions = []int{Version1}
+	request.Capabilities.Encryption = []string{EncryptionNone}
+
+	reply := preTransact(t, proto, request, requester.MainPublicKey)
+	if reply.Success || reply.Error == nil || !strings.HasPrefix(*reply.Error, ErrNoCommonVersion.Error()) {
+		t.Errorf("pre transaction of version 1 peer returned %+v", reply)
+	}
+}
+
+func TestSealContent(t *testing.T) {
+	responder := testKeychain(t)
+	requester := testKeychain(t)
+
+	proto := NewProtocol(nil)
+	proto.SetKeychain(responder)
+
+	entry := &Entry{RequesterPublicKey: requester.MainPublicKey, Agreement: &Agreement{Version: Version2, Encryption: EncryptionNone}}
+	if content, err := proto.sealContent("John Smith", entry); err != nil || content != "John Smith" {
+		t.Errorf("sealContent() without agreed encryption returned %q, %v", content, err)
+	}
+
+	entry.Agreement.Encryption = EncryptionBox
+	sealed, err := proto.sealContent("John Smith", entry)
+	if err != nil {
+		t.Fatalf("sealContent() failed: %s", err)
+	}
+
+	if content, err := DecryptContent(sealed, responder.MainPublicKey, requester); err != nil || content != "John Smith" {
+		t.Errorf("DecryptContent() of sealed content returned %q, %v", content, err)
+	}
+}
@@ -7,8 +7,11 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
 	"github.com/odysseyhack/planet-society/protocol/models"
 	log "github.com/sirupsen/logrus"
 	"github.com/vektah/gqlparser/ast"
@@ -17,6 +20,9 @@ import (
 
 const (
 	connectionChannelSize = 16
+	pruneInterval         = time.Minute
+	// DefaultQueryEndpoint is GraphQL endpoint of the node queried for transaction data
+	DefaultQueryEndpoint = "http://127.0.0.1:8088/query"
 )
 
 type Protocol struct {
@@ -25,27 +31,83 @@ type Protocol struct {
 	authorization    AuthorizationPlugin
 	TransactionQueue *Queue
 	plugins          Plugins
+	capabilities     models.Capabilities
+	limiter          *Limiter
+	requesterLists   RequesterLists
+	templates        *LegalTemplates
+	attestations     AttestationStore
+	keychain         *cryptography.Keychain
+	queryEndpoint    string
+	queryToken       string
+	contacts         ContactStore
 }
 
 func NewProtocol(authorization AuthorizationPlugin) *Protocol {
 	return &Protocol{
 		authorization:    authorization,
+		capabilities:     DefaultCapabilities(),
 		quit:             make(chan struct{}),
 		Connections:      make(chan Conn, connectionChannelSize),
 		TransactionQueue: NewQueue(),
+		limiter:          NewLimiter(DefaultLimits()),
+		templates:        NewLegalTemplates(nil),
+		queryEndpoint:    DefaultQueryEndpoint,
 	}
 }
 
+// SetQueryEndpoint sets GraphQL endpoint of the node queried for transaction data, it has to be called before Loop
+func (p *Protocol) SetQueryEndpoint(endpoint string) {
+	p.queryEndpoint = endpoint
+}
+
+// SetQueryToken sets owner token sent with queries for transaction data, it has to be called before Loop
+func (p *Protocol) SetQueryToken(token string) {
+	p.queryToken = token
+}
+
+// SetKeychain sets keychain of the node. Requesters prove possession of their keys to it,
+// transaction content is encrypted and decisions about requests delegated by other
+// owners are signed with it. Without keychain pre transactions and delegated consent
+// requests are refused. It has to be called before Loop
+func (p *Protocol) SetKeychain(keychain *cryptography.Keychain) {
+	p.keychain = keychain
+}
+
+// SetLegalTemplates sets registry used to resolve legal templates, it has to be called before Loop
+func (p *Protocol) SetLegalTemplates(templates *LegalTemplates) {
+	p.templates = templates
+}
+
+// RegisterPreTransactionValidator adds validator run on every pre transaction, it has to be called before Loop
+func (p *Protocol) RegisterPreTransactionValidator(validator PreTransactionValidator) {
+	p.plugins.RegisterPreTransactionValidator(validator)
+}
+
+// ConfigurePlugins creates plugins defined in configuration, it has to be called before Loop
+func (p *Protocol) ConfigurePlugins(config *PluginsConfig) error {
+	return p.plugins.Configure(config)
+}
+
+// SetLimits changes limits enforced on requesters, it has to be called before Loop
+func (p *Protocol) SetLimits(limits Limits) {
+	p.limiter = NewLimiter(limits)
+}
+
 func (p *Protocol) Stop() {
 	p.quit <- struct{}{}
 }
 
 func (p *Protocol) Loop() {
 	log.Debugln("protocol: starting event loop")
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
 	for {
 		select {
 		case <-p.quit:
 			return
+		case <-ticker.C:
+			p.prune()
 		case conn := <-p.Connections:
 			log.Debugln("protocol: handling new connection")
 			go p.handleConn(conn)
@@ -53,6 +115,14 @@ func (p *Protocol) Loop() {
 	}
 }
 
+func (p *Protocol) prune() {
+	ttl := p.limiter.Limits().PendingTransactionTTL
+	if removed := p.TransactionQueue.Prune(time.Now().Add(-ttl)); removed > 0 {
+		log.Infoln("protocol: removed expired transactions from TransactionQueue:", removed)
+	}
+	p.limiter.Prune()
+}
+
 func (p *Protocol) handleConn(c Conn) {
 	log.Debugln("protocol handling new connection")
 	defer func() {
@@ -61,24 +131,146 @@ func (p *Protocol) handleConn(c Conn) {
 		}
 	}()
 
+	ip := hostFromAddr(c.RemoteAddr())
+	if err := p.limiter.Connect(ip); err != nil {
+		log.Warningf("protocol: refusing connection from %s: %s", ip, err)
+		if msg, readErr := c.Read(); readErr == nil {
+			p.reject(c, msg, err)
+		}
+		return
+	}
+	defer p.limiter.Disconnect(ip)
+
+	s := &session{}
+	defer p.release(s)
 	for {
 		msg, err := c.Read()
 		if err != nil {
 			break
 		}
-		p.handleMessage(c, msg)
+
+		if s.source == nil {
+			source := msg.Header.Source
+			s.source = &source
+		}
+
+		// connection is used by key of the first message only
+		if !msg.Header.Source.Equal(*s.source) {
+			log.Warningf("protocol: connection of %s used by %s", s.source.String(), msg.Header.Source.String())
+			p.reject(c, msg, ErrSourceMismatch)
+			break
+		}
+
+		if err := p.limiter.MessageSize(len(msg.Body.Payload)); err != nil {
+			p.addressViolation(c, msg, err)
+			break
+		}
+
+		if err := p.handleMessage(c, msg, s); err != nil {
+			break
+		}
+	}
+}
+
+// session is state of single connection
+type session struct {
+	// source is key of the first message, other keys can't use the connection
+	source *cryptography.Key32
+	// counted is set once source proved possession of the key and connection is counted for it
+	counted bool
+	// messages are times of recent messages handled by messageHandlers
+	messages []time.Time
+}
+
+// count counts connection for requester key proven in pre transaction
+func (p *Protocol) count(s *session) error {
+	if s.counted {
+		return nil
+	}
+
+	if err := p.limiter.ConnectKey(*s.source); err != nil {
+		return err
 	}
+	s.counted = true
+	return nil
+}
+
+// release releases connection counted for requester key
+func (p *Protocol) release(s *session) {
+	if s.counted {
+		p.limiter.DisconnectKey(*s.source)
+	}
+}
+
+// violation bans requester which exceeded limits and replies with error,
+// source of the message has to be proven requester key
+func (p *Protocol) violation(c Conn, msg *Message, err error) {
+	ip := hostFromAddr(c.RemoteAddr())
+	log.Warningf("protocol: requester %s from %s violated limits: %s", msg.Header.Source.String(), ip, err)
+	p.limiter.Ban(ip, msg.Header.Source)
+	p.reject(c, msg, err)
+}
+
+// addressViolation bans address of requester which exceeded limits before proving its key
+func (p *Protocol) addressViolation(c Conn, msg *Message, err error) {
+	ip := hostFromAddr(c.RemoteAddr())
+	log.Warningf("protocol: requester from %s violated limits: %s", ip, err)
+	p.limiter.BanAddress(ip)
+	p.reject(c, msg, err)
 }
 
-func (p *Protocol) handleMessage(c Conn, msg *Message) {
+// reject replies to message with error on matching reply topic
+func (p *Protocol) reject(c Conn, msg *Message, err error) {
+	errMsg := err.Error()
 	switch msg.Header.Topic {
 	case TopicPreTransactionRequest:
-		p.handlePreTransactionRequest(c, msg)
+		sendPreTransactionReply(c, msg, &models.PreTransactionReply{Error: &errMsg, Capabilities: p.capabilities})
 	case TopicTransactionRequest:
-		p.handleTransactionRequest(c, msg)
+		sendTransactionReply(c, msg, &models.TransactionReply{Error: &errMsg})
+	case TopicDeletionAttestation:
+		sendDeletionReply(c, msg, &models.DeletionAttestationReply{Error: &errMsg})
+	case TopicConsentRequest:
+		sendConsentDecision(c, msg, &models.DelegatedConsentDecision{Error: &errMsg})
 	}
 }
 
+// messageHandlers handle request topics received by Protocol, pre transaction request
+// is handled by handleMessage as it counts requester session
+var messageHandlers = map[cryptography.Key32]func(p *Protocol, c Conn, msg *Message){
+	TopicTransactionRequest:  (*Protocol).handleTransactionRequest,
+	TopicDeletionAttestation: (*Protocol).handleDeletionAttestation,
+	TopicConsentRequest:      (*Protocol).handleConsentRequest,
+}
+
+// handleMessage handles message received on connection, returned error closes the connection
+func (p *Protocol) handleMessage(c Conn, msg *Message, s *session) error {
+	if handler, ok := messageHandlers[msg.Header.Topic]; ok {
+		var err error
+		if s.messages, err = p.limiter.Message(s.messages); err != nil {
+			p.addressViolation(c, msg, err)
+			return err
+		}
+		handler(p, c, msg)
+		return nil
+	}
+
+	if msg.Header.Topic != TopicPreTransactionRequest {
+		return nil
+	}
+
+	request, agreement, ok := p.provenPreTransaction(c, msg)
+	if !ok {
+		return nil
+	}
+
+	if err := p.count(s); err != nil {
+		p.violation(c, msg, err)
+		return err
+	}
+	p.handlePreTransactionRequest(c, msg, request, agreement)
+	return nil
+}
+
 func (p *Protocol) handleTransactionRequest(c Conn, msg *Message) {
 	var transactionRequest models.TransactionRequest
 	if err := gob.NewDecoder(bytes.NewBuffer(msg.Body.Payload)).Decode(&transactionRequest); err != nil {
@@ -96,6 +288,42 @@ func (p *Protocol) handleTransactionRequest(c Conn, msg *Message) {
 		return
 	}
 
+	if !msg.Header.Source.Equal(entry.RequesterPublicKey) {
+		log.Warningf("transaction request sent from other key than pre transaction id=%q", transactionRequest.TransactionID.Key.String())
+		errMsg := ErrSourceMismatch.Error()
+		sendTransactionReply(c, msg, &models.TransactionReply{Error: &errMsg})
+		return
+	}
+
+	if err := VerifyTransactionRequest(&transactionRequest, entry.RequesterSignatureKey); err != nil {
+		log.Warningf("transaction request not signed by requester id=%q, err=%q", transactionRequest.TransactionID.Key.String(), err)
+		errMsg := err.Error()
+		sendTransactionReply(c, msg, &models.TransactionReply{Error: &errMsg})
+		return
+	}
+
+	if msg.Header.Version != entry.AgreedVersion() {
+		log.Warningf("transaction uses version %d, agreed %d id: %s", msg.Header.Version, entry.AgreedVersion(), transactionRequest.TransactionID.Key.String())
+		errMsg := fmt.Sprintf("%s: got %d, agreed %d", ErrVersionMismatch, msg.Header.Version, entry.AgreedVersion())
+		sendTransactionReply(c, msg, &models.TransactionReply{Error: &errMsg})
+		return
+	}
+
+	template, err := p.templates.Resolve(stringValue(transactionRequest.LegalTemplateID), transactionRequest.Type, transactionRequest.LawApplying)
+	if err != nil {
+		log.Warningf("transaction failed to resolve legal template id=%q, err=%q", transactionRequest.TransactionID.Key.String(), err)
+		errMsg := err.Error()
+		sendTransactionReply(c, msg, &models.TransactionReply{Error: &errMsg})
+		return
+	}
+
+	if transactionRequest.RetentionDays != nil && *transactionRequest.RetentionDays <= 0 {
+		log.Warningf("transaction has invalid retention id=%q, days=%d", transactionRequest.TransactionID.Key.String(), *transactionRequest.RetentionDays)
+		errMsg := fmt.Sprintf("%s: %d days", ErrInvalidRetention, *transactionRequest.RetentionDays)
+		sendTransactionReply(c, msg, &models.TransactionReply{Error: &errMsg})
+		return
+	}
+
 	data, err := parseQuery(transactionRequest.Query)
 	if err != nil {
 		log.Warningln("transaction failed to parse query id:", transactionRequest.TransactionID)
@@ -106,8 +334,15 @@ func (p *Protocol) handleTransactionRequest(c Conn, msg *Message) {
 
 	authData := generateNotificationRequest(&transactionRequest, data, entry)
 
+	if err := p.limiter.AuthorizationStart(entry.RequesterPublicKey); err != nil {
+		p.violation(c, msg, err)
+		return
+	}
+
 	log.Infoln("calling authorization plugin for id:", transactionRequest.TransactionID.Key.String())
 	authReply, err := p.authorization.Authorize(authData)
+	p.limiter.AuthorizationDone(entry.RequesterPublicKey)
+	p.TransactionQueue.Remove(entry.TransactionID)
 	if err != nil {
 		log.Warningf("transaction failed to authorize id=%q , err=%q", transactionRequest.TransactionID.Key.String(), err)
 		errMsg := "not authorized"
@@ -122,16 +357,52 @@ func (p *Protocol) handleTransactionRequest(c Conn, msg *Message) {
 		return
 	}
 
-	content, err := post(transactionRequest.Query, &transactionRequest, entry)
+	if err := CheckSelection(authReply.Selection); err != nil {
+		log.Warningf("transaction authorized with invalid selection id=%q, err=%q", transactionRequest.TransactionID.Key.String(), err)
+		errMsg := "not authorized"
+		sendTransactionReply(c, msg, &models.TransactionReply{Error: &errMsg})
+		return
+	}
+
+	query := transactionRequest.Query
+	if authReply.Fields != nil {
+		if query, err = restrictQuery(query, authReply.Fields); err != nil {
+			log.Warningf("transaction failed to restrict query to approved fields id=%q, err=%q", transactionRequest.TransactionID.Key.String(), err)
+			errMsg := "not authorized"
+			sendTransactionReply(c, msg, &models.TransactionReply{Error: &errMsg})
+			return
+		}
+	}
+
+	content, err := post(p.queryEndpoint, p.queryToken, query, &transactionRequest, entry, template, authReply)
 	if err != nil {
 		log.Warningf("transaction failed to post transaction id=%q, err=%q", transactionRequest.TransactionID.Key.String(), err)
 		errMsg := "transaction commitment failed"
 		sendTransactionReply(c, msg, &models.TransactionReply{Error: &errMsg})
 		return
 	}
+
+	if content, err = p.sealContent(content, entry); err != nil {
+		log.Warningf("transaction failed to encrypt content id=%q, err=%q", transactionRequest.TransactionID.Key.String(), err)
+		errMsg := "transaction commitment failed"
+		sendTransactionReply(c, msg, &models.TransactionReply{Error: &errMsg})
+		return
+	}
 	sendTransactionReply(c, msg, &models.TransactionReply{Content: &content})
 }
 
+// sealContent encrypts transaction content if encryption was agreed with requester
+func (p *Protocol) sealContent(content string, entry *Entry) (string, error) {
+	switch entry.AgreedEncryption() {
+	case EncryptionBox:
+		return EncryptContent(content, entry.RequesterPublicKey, p.keychain)
+	case EncryptionNone:
+		return content, nil
+	default:
+		return "", fmt.Errorf("%s: %q", ErrNoCommonEncryption, entry.AgreedEncryption())
+	}
+}
+
 func generateNotificationRequest(request *models.TransactionRequest, c []CollectionData, e *Entry) *models.PermissionNotificationRequest {
 	ret := &models.PermissionNotificationRequest{
 		RequesterName:      e.RequesterName,
@@ -140,51 +411,171 @@ func generateNotificationRequest(request *models.TransactionRequest, c []Collect
 		Title:              request.Title,
 		RequesterPublicKey: e.RequesterPublicKey.String(),
 		TransactionID:      e.TransactionID.String(),
-		Analysis:           []string{"personal data is GDPR protected data", "banking details is sensitive data"},
-		Verification:       []string{"digid.nl", "planet-blockchain", "kvk"},
+		Verification:       e.Verification,
 	}
 
 	for i := range c {
 		ret.Item = append(ret.Item, models.ItemField{Item: c[i].Structure, Fields: c[i].Fields})
 	}
 
+	classification := Classify(ret.Item)
+	ret.RiskScore = classification.Score
+	ret.Analysis = append(classification.Analysis(), requestAnalysis(request)...)
 	return ret
 }
 
-func (p *Protocol) handlePreTransactionRequest(c Conn, msg *Message) {
+// requestAnalysis returns analysis of storage terms stated by requester
+func requestAnalysis(request *models.TransactionRequest) (lines []string) {
+	if stringValue(request.Purpose) == "" {
+		lines = append(lines, "requester did not state purpose of processing")
+	} else {
+		lines = append(lines, fmt.Sprintf("data will be processed for: %s", *request.Purpose))
+	}
+
+	if request.RetentionDays == nil {
+		lines = append(lines, "requester keeps data until you revoke permission")
+	} else {
+		lines = append(lines, fmt.Sprintf("requester erases data after %d days", *request.RetentionDays))
+	}
+	return lines
+}
+
+// provenPreTransaction decodes pre transaction request, negotiates capabilities and verifies that
+// source of the message proved possession of requester keys, error is sent to requester if request
+// is not proven. Capabilities are negotiated first, so peers without Version2 learn they have to upgrade.
+func (p *Protocol) provenPreTransaction(c Conn, msg *Message) (*models.PreTransactionRequest, *Agreement, bool) {
 	var preTransactionRequest models.PreTransactionRequest
 	if err := gob.NewDecoder(bytes.NewBuffer(msg.Body.Payload)).Decode(&preTransactionRequest); err != nil {
-		sendPreTransactionReply(c, msg, false)
+		p.sendPreTransactionError(c, msg, &preTransactionRequest, "decoding payload failed")
 		log.Warningln("pre transaction request: invalid payload:", err)
+		return nil, nil, false
+	}
+
+	agreement, err := Negotiate(&p.capabilities, &preTransactionRequest.Capabilities)
+	if err != nil {
+		p.sendPreTransactionError(c, msg, &preTransactionRequest, err.Error())
+		log.Warningln("protocol: capability negotiation failed:", err)
+		return nil, nil, false
+	}
+
+	if err := p.verifyPossession(msg, &preTransactionRequest); err != nil {
+		p.sendPreTransactionError(c, msg, &preTransactionRequest, err.Error())
+		log.Warningln("protocol: refusing pre transaction:", err)
+		return nil, nil, false
+	}
+	return &preTransactionRequest, agreement, true
+}
+
+// handlePreTransactionRequest handles request proven with provenPreTransaction
+func (p *Protocol) handlePreTransactionRequest(c Conn, msg *Message, preTransactionRequest *models.PreTransactionRequest, agreement *Agreement) {
+	// source is proven requester main key, all limits are counted for it
+	requester := msg.Header.Source
+	if err := p.limiter.PreTransaction(requester); err != nil {
+		p.violation(c, msg, err)
+		return
+	}
+
+	// pending transactions are counted again atomically when the transaction is added
+	if err := p.limiter.Pending(p.TransactionQueue.CountByRequester(requester)); err != nil {
+		p.violation(c, msg, err)
+		return
+	}
+
+	if preTransactionRequest.Endpoint != nil {
+		if err := CheckEndpoint(*preTransactionRequest.Endpoint); err != nil {
+			p.sendPreTransactionError(c, msg, preTransactionRequest, err.Error())
+			log.Warningln("protocol: refusing requester endpoint:", err)
+			return
+		}
+	}
+
+	if err := checkRequester(p.requesterLists, requester, time.Now()); err != nil {
+		p.sendPreTransactionError(c, msg, preTransactionRequest, err.Error())
+		log.Warningf("protocol: refusing requester %s: %s", requester.String(), err)
 		return
 	}
 
 	log.Infoln("protocol: validating pre transaction request with plugins")
-	if !p.plugins.ValidatePreTransaction(&preTransactionRequest) {
-		log.Warningln("protocol: request didn't pass validation")
+	verification, verifiedName, err := p.plugins.ValidatePreTransaction(preTransactionRequest)
+	if err != nil {
+		p.sendPreTransactionError(c, msg, preTransactionRequest, err.Error())
+		log.Warningln("protocol: request didn't pass validation:", err)
+		return
 	}
 
 	entry := &Entry{
-		TransactionID:      preTransactionRequest.TransactionID.Key,
-		RequesterName:      preTransactionRequest.Requester,
-		RequesterPublicKey: preTransactionRequest.MainPublicKey.Key,
+		TransactionID:         preTransactionRequest.TransactionID.Key,
+		RequesterName:         requesterDisplayName(verifiedName, preTransactionRequest),
+		RequesterVerified:     verifiedName != "",
+		RequesterPublicKey:    requester,
+		RequesterSignatureKey: preTransactionRequest.SignaturePublicKey.Key,
+		RequesterEndpoint:     stringValue(preTransactionRequest.Endpoint),
+		Agreement:             agreement,
+		Verification:          verification,
 	}
 
-	if err := p.TransactionQueue.Add(entry); err != nil {
-		sendPreTransactionReply(c, msg, false)
+	if err := p.TransactionQueue.AddChecked(entry, p.limiter.Pending); err != nil {
+		if strings.HasPrefix(err.Error(), ErrTooManyPending.Error()) {
+			p.violation(c, msg, err)
+			return
+		}
+		p.sendPreTransactionError(c, msg, preTransactionRequest, err.Error())
 		log.Warningln("protocol: adding to TransactionQueue failed:", err)
+		return
 	}
-	log.Infoln("protocol: added new transaction to TransactionQueue")
-	sendPreTransactionReply(c, msg, true)
+	log.Infof("protocol: added new transaction to TransactionQueue, version=%d", agreement.Version)
+	sendPreTransactionReply(c, msg, &models.PreTransactionReply{
+		TransactionID: preTransactionRequest.TransactionID,
+		Success:       true,
+		Version:       agreement.Version,
+		Encryption:    &agreement.Encryption,
+		Capabilities:  p.capabilities,
+	})
 }
 
-func sendPreTransactionReply(c Conn, msg *Message, ok bool) {
-	var buffer bytes.Buffer
+// verifyPossession checks that requester holds keys claimed in pre transaction request
+// and sends messages from its main key. Everything decided by requester key,
+// i.e. limits, requester lists and validators, relies on this check.
+func (p *Protocol) verifyPossession(msg *Message, request *models.PreTransactionRequest) error {
+	if p.keychain == nil {
+		return ErrNoKeychain
+	}
 
-	reply := &models.PreTransactionReply{
-		Success: ok,
+	if err := VerifyPossession(request, p.keychain); err != nil {
+		return err
 	}
 
+	if !msg.Header.Source.Equal(request.MainPublicKey.Key) {
+		return ErrSourceMismatch
+	}
+	return nil
+}
+
+// requesterDisplayName returns name shown to the owner, names claimed by
+// requester are never shown unless confirmed by validator.
+func requesterDisplayName(verifiedName string, request *models.PreTransactionRequest) string {
+	if verifiedName != "" {
+		return verifiedName
+	}
+	return unverifiedRequesterName(request.MainPublicKey.Key)
+}
+
+// unverifiedRequesterName returns name shown for requester which name was not verified
+func unverifiedRequesterName(key cryptography.Key32) string {
+	return fmt.Sprintf("unverified requester %s", key.String()[:16])
+}
+
+func (p *Protocol) sendPreTransactionError(c Conn, msg *Message, request *models.PreTransactionRequest, errMsg string) {
+	sendPreTransactionReply(c, msg, &models.PreTransactionReply{
+		TransactionID: request.TransactionID,
+		Error:         &errMsg,
+		Capabilities:  p.capabilities,
+	})
+}
+
+func sendPreTransactionReply(c Conn, msg *Message, reply *models.PreTransactionReply) {
+	var buffer bytes.Buffer
+
 	if err := gob.NewEncoder(&buffer).Encode(reply); err != nil {
 		return
 	}
@@ -194,6 +585,7 @@ func sendPreTransactionReply(c Conn, msg *Message, ok bool) {
 			Topic:       TopicPreTransactionReply,
 			Destination: msg.Header.Source,
 			Source:      msg.Header.Destination,
+			Version:     reply.Version,
 		},
 		Body: Body{
 			Payload: buffer.Bytes(),
@@ -208,7 +600,7 @@ func sendTransactionReply(c Conn, msg *Message, reply *models.TransactionReply)
 	}
 	_ = c.Write(&Message{
 		Header: Header{Topic: TopicTransactionReply,
-			Destination: msg.Header.Source, Source: msg.Header.Destination,
+			Destination: msg.Header.Source, Source: msg.Header.Destination, Version: msg.Header.Version,
 		}, Body: Body{Payload: buffer.Bytes()},
 	})
 }
@@ -252,7 +644,14 @@ type Request struct {
 	Query string `json:"query"`
 }
 
-func fillHeader(request *http.Request, transactionRequest *models.TransactionRequest, entry *Entry) {
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func fillHeader(request *http.Request, transactionRequest *models.TransactionRequest, entry *Entry, template *models.LegalTemplate, authReply *models.PermissionNotificationResponse) {
 	request.Header.Add("permission-type", transactionRequest.Type)
 	request.Header.Add("title", transactionRequest.Title)
 	request.Header.Add("description", transactionRequest.Description)
@@ -260,10 +659,30 @@ func fillHeader(request *http.Request, transactionRequest *models.TransactionReq
 	request.Header.Add("signature", transactionRequest.Signature)
 	request.Header.Add("requester", entry.RequesterPublicKey.String())
 	request.Header.Add("requester-name", entry.RequesterName)
+	request.Header.Add("requester-signature-key", entry.RequesterSignatureKey.String())
+	if entry.RequesterEndpoint != "" {
+		request.Header.Add("requester-endpoint", entry.RequesterEndpoint)
+	}
+	request.Header.Add("law-applying", transactionRequest.LawApplying)
+	if template != nil {
+		request.Header.Add("legal-template", TemplateReference(template))
+	}
+	if transactionRequest.RetentionDays != nil {
+		request.Header.Add("retention-days", strconv.Itoa(*transactionRequest.RetentionDays))
+	}
+	if transactionRequest.Purpose != nil {
+		request.Header.Add("purpose", *transactionRequest.Purpose)
+	}
+	if len(authReply.Identities) > 0 {
+		request.Header.Add("identities", strings.Join(authReply.Identities, ","))
+	}
+	if len(authReply.Selection) > 0 {
+		request.Header.Add("selection", SelectionHeader(authReply.Selection))
+	}
 	request.Header.Set("Content-Type", "application/json")
 }
 
-func post(query string, transactionRequest *models.TransactionRequest, entry *Entry) (string, error) {
+func post(endpoint, token, query string, transactionRequest *models.TransactionRequest, entry *Entry, template *models.LegalTemplate, authReply *models.PermissionNotificationResponse) (string, error) {
 	r := Request{
 		Query: query,
 	}
@@ -274,11 +693,14 @@ func post(query string, transactionRequest *models.TransactionRequest, entry *En
 	}
 
 	client := http.Client{}
-	request, err := http.NewRequest(http.MethodPost, "http://127.0.0.1:8088/query", bytes.NewBuffer(requestBody))
+	request, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewBuffer(requestBody))
 	if err != nil {
 		return "", err
 	}
-	fillHeader(request, transactionRequest, entry)
+	fillHeader(request, transactionRequest, entry, template, authReply)
+	if token != "" {
+		request.Header.Set(OwnerTokenHeader, "Bearer "+token)
+	}
 
 	rawResponse, err := client.Do(request)
 	if err != nil {
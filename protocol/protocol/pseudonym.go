@@ -0,0 +1,73 @@
+package protocol
+
+import (
+	"strings"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+// pseudonymLabel separates key of pseudonymous ids from other keys derived from keychain
+const pseudonymLabel = "planet-society pseudonymous node id"
+
+// PermissionStore lists permissions granted to requesters
+type PermissionStore interface {
+	PermissionList() ([]models.Permission, error)
+}
+
+// Pseudonyms derives pairwise pseudonymous ids of items shared with requesters.
+// Every requester receives different id of the same item, so requesters can not
+// correlate the owner by comparing ids. Ids are derived with keyed hash, real id
+// is found again among nodes of permissions granted to requester.
+type Pseudonyms struct {
+	keychain *cryptography.Keychain
+	store    PermissionStore
+}
+
+// NewPseudonyms creates pseudonyms with key derived from keychain
+func NewPseudonyms(keychain *cryptography.Keychain, store PermissionStore) *Pseudonyms {
+	return &Pseudonyms{
+		keychain: keychain,
+		store:    store,
+	}
+}
+
+// ID returns pseudonymous id of item shared with requester
+func (p *Pseudonyms) ID(requester cryptography.Key32, id string) string {
+	key := cryptography.KeyedHash32(p.keychain.MainPrivateKey, []byte(pseudonymLabel))
+	pseudonym := cryptography.KeyedHash32(key, append(requester[:], id...))
+	return pseudonym.String()
+}
+
+// nodes returns real ids of requester permission nodes by their pseudonymous ids
+func (p *Pseudonyms) nodes(requester cryptography.Key32) (map[string]string, error) {
+	permissions, err := p.store.PermissionList()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[string]string)
+	for i := range permissions {
+		if !permissions[i].RequesterPublicKey.Key.Equal(requester) {
+			continue
+		}
+		for _, node := range permissions[i].PermissionNodes {
+			nodes[p.ID(requester, node.NodeID)] = node.NodeID
+		}
+	}
+	return nodes, nil
+}
+
+// Reveal replaces pseudonymous ids in content received from requester with real ids
+func (p *Pseudonyms) Reveal(requester cryptography.Key32, content string) (string, error) {
+	nodes, err := p.nodes(requester)
+	if err != nil {
+		return "", err
+	}
+
+	pairs := make([]string, 0, 2*len(nodes))
+	for pseudonym, id := range nodes {
+		pairs = append(pairs, pseudonym, id)
+	}
+	return strings.NewReplacer(pairs...).Replace(content), nil
+}
@@ -0,0 +1,63 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+type testPermissions []models.Permission
+
+func (t testPermissions) PermissionList() ([]models.Permission, error) {
+	return t, nil
+}
+
+func TestPseudonyms(t *testing.T) {
+	requesterA, requesterB := cryptography.RandomKey32(), cryptography.RandomKey32()
+	permissions := testPermissions{{
+		RequesterPublicKey: models.Key32{Key: requesterA},
+		PermissionNodes:    []models.PermissionNodes{{NodeID: "passport-1"}},
+	}}
+	pseudonyms := NewPseudonyms(testKeychain(t), permissions)
+
+	idA := pseudonyms.ID(requesterA, "passport-1")
+	if idA == "passport-1" || idA != pseudonyms.ID(requesterA, "passport-1") {
+		t.Errorf("ID() returned %s", idA)
+	}
+
+	if idA == pseudonyms.ID(requesterB, "passport-1") {
+		t.Errorf("requesters received the same pseudonymous id")
+	}
+
+	if other := NewPseudonyms(testKeychain(t), permissions); idA == other.ID(requesterA, "passport-1") {
+		t.Errorf("different keychains derived the same pseudonymous id")
+	}
+
+	content, err := pseudonyms.Reveal(requesterA, `{"passport":{"id":"`+idA+`","number":"X1"}}`)
+	if err != nil {
+		t.Fatalf("Reveal() failed: %s", err)
+	}
+	if content != `{"passport":{"id":"passport-1","number":"X1"}}` {
+		t.Errorf("Reveal() returned %s", content)
+	}
+
+	// item not shared with requester stays pseudonymous
+	idB := pseudonyms.ID(requesterB, "passport-1")
+	if content, err := pseudonyms.Reveal(requesterB, idB); err != nil || content != idB {
+		t.Errorf("Reveal() of item not shared with requester returned %s, %v", content, err)
+	}
+}
+
+func TestPermittedNodesBankingDetails(t *testing.T) {
+	requester := cryptography.RandomKey32()
+	transaction := &Transaction{BankDetails: models.BankDetails{ID: "bank-1"}}
+	permission := &models.Permission{RequesterPublicKey: models.Key32{Key: requester}}
+	fillPermittedNodes([]string{"bankingDetails"}, permission, transaction)
+
+	pseudonyms := NewPseudonyms(testKeychain(t), testPermissions{*permission})
+	id := pseudonyms.ID(requester, "bank-1")
+	if content, err := pseudonyms.Reveal(requester, id); err != nil || content != "bank-1" {
+		t.Errorf("Reveal() of banking details returned %s, %v", content, err)
+	}
+}
@@ -2,6 +2,7 @@ package protocol
 
 import (
 	"sync"
+	"time"
 
 	"github.com/odysseyhack/planet-society/protocol/cryptography"
 )
@@ -9,8 +10,31 @@ import (
 type Entry struct {
 	TransactionID      cryptography.Key32
 	RequesterName      string
+	RequesterVerified  bool
 	Authorization      map[string]string
 	RequesterPublicKey cryptography.Key32
+	// RequesterSignatureKey and RequesterEndpoint are used to send data subject requests
+	RequesterSignatureKey cryptography.Key32
+	RequesterEndpoint     string
+	Agreement             *Agreement
+	Verification          []string
+	Created               time.Time
+}
+
+// AgreedVersion returns protocol version agreed during pre transaction
+func (e *Entry) AgreedVersion() int {
+	if e.Agreement == nil {
+		return 0
+	}
+	return e.Agreement.Version
+}
+
+// AgreedEncryption returns encryption of transaction content agreed during pre transaction
+func (e *Entry) AgreedEncryption() string {
+	if e.Agreement == nil {
+		return EncryptionNone
+	}
+	return e.Agreement.Encryption
 }
 
 type Queue struct {
@@ -25,17 +49,74 @@ func NewQueue() *Queue {
 }
 
 func (q *Queue) Add(e *Entry) error {
+	return q.AddChecked(e, nil)
+}
+
+// AddChecked adds entry if check accepts number of transactions pending for its requester.
+// Counting and adding is done under single lock, so concurrent requests can't exceed the limit.
+func (q *Queue) AddChecked(e *Entry, check func(pending int) error) error {
 	q.Lock()
 	defer q.Unlock()
 
+	if check != nil {
+		if err := check(q.countByRequester(e.RequesterPublicKey)); err != nil {
+			return err
+		}
+	}
+
 	if _, ok := q.entries[e.TransactionID]; ok {
 		return ErrIDAlreadyUsed
 	}
+	if e.Created.IsZero() {
+		e.Created = time.Now()
+	}
 	q.entries[e.TransactionID] = e
 	return nil
 }
 
 func (q *Queue) Get(TransactionID cryptography.Key32) (*Entry, bool) {
+	q.RLock()
+	defer q.RUnlock()
+
 	entry, ok := q.entries[TransactionID]
 	return entry, ok
 }
+
+// Remove removes transaction from the queue
+func (q *Queue) Remove(TransactionID cryptography.Key32) {
+	q.Lock()
+	defer q.Unlock()
+
+	delete(q.entries, TransactionID)
+}
+
+// CountByRequester returns number of pending transactions of given requester
+func (q *Queue) CountByRequester(requester cryptography.Key32) int {
+	q.RLock()
+	defer q.RUnlock()
+	return q.countByRequester(requester)
+}
+
+// countByRequester counts pending transactions of requester, caller holds the lock
+func (q *Queue) countByRequester(requester cryptography.Key32) (count int) {
+	for _, entry := range q.entries {
+		if entry.RequesterPublicKey.Equal(requester) {
+			count++
+		}
+	}
+	return count
+}
+
+// Prune removes transactions created before given time and returns number of removed entries
+func (q *Queue) Prune(before time.Time) (removed int) {
+	q.Lock()
+	defer q.Unlock()
+
+	for id, entry := range q.entries {
+		if entry.Created.Before(before) {
+			delete(q.entries, id)
+			removed++
+		}
+	}
+	return removed
+}
@@ -1,7 +1,11 @@
 package protocol
 
 import (
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/odysseyhack/planet-society/protocol/cryptography"
 )
@@ -22,3 +26,80 @@ func TestNewQueueAdd(t *testing.T) {
 		t.Errorf("queue.Add failed %s", err)
 	}
 }
+
+func TestQueueRemove(t *testing.T) {
+	queue := NewQueue()
+	entry := &Entry{
+		TransactionID: cryptography.RandomKey32(),
+	}
+
+	if err := queue.Add(entry); err != nil {
+		t.Fatalf("queue.Add failed %s", err)
+	}
+
+	queue.Remove(entry.TransactionID)
+	if _, ok := queue.Get(entry.TransactionID); ok {
+		t.Errorf("entry still in queue after Remove")
+	}
+}
+
+func TestQueuePrune(t *testing.T) {
+	queue := NewQueue()
+	requester := cryptography.RandomKey32()
+	old := &Entry{
+		TransactionID:      cryptography.RandomKey32(),
+		RequesterPublicKey: requester,
+		Created:            time.Now().Add(-time.Hour),
+	}
+	fresh := &Entry{
+		TransactionID:      cryptography.RandomKey32(),
+		RequesterPublicKey: requester,
+	}
+
+	for _, entry := range []*Entry{old, fresh} {
+		if err := queue.Add(entry); err != nil {
+			t.Fatalf("queue.Add failed %s", err)
+		}
+	}
+
+	if count := queue.CountByRequester(requester); count != 2 {
+		t.Errorf("CountByRequester returned %d, expected 2", count)
+	}
+
+	if removed := queue.Prune(time.Now().Add(-time.Minute)); removed != 1 {
+		t.Errorf("Prune removed %d entries, expected 1", removed)
+	}
+
+	if _, ok := queue.Get(fresh.TransactionID); !ok {
+		t.Errorf("fresh entry removed by Prune")
+	}
+}
+
+func TestQueueAddCheckedConcurrent(t *testing.T) {
+	queue := NewQueue()
+	limiter := NewLimiter(testLimits())
+	requester := cryptography.RandomKey32()
+
+	var wg sync.WaitGroup
+	var added int32
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			entry := &Entry{
+				TransactionID:      cryptography.RandomKey32(),
+				RequesterPublicKey: requester,
+			}
+			if err := queue.AddChecked(entry, limiter.Pending); err == nil {
+				atomic.AddInt32(&added, 1)
+			} else if !strings.HasPrefix(err.Error(), ErrTooManyPending.Error()) {
+				t.Errorf("AddChecked returned %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if limit := testLimits().PendingTransactions; int(added) != limit || queue.CountByRequester(requester) != limit {
+		t.Errorf("AddChecked added %d entries, expected %d", added, limit)
+	}
+}
@@ -0,0 +1,79 @@
+package protocol
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+// RequesterLists gives access to requesters allowed, blocked or muted by the owner
+type RequesterLists interface {
+	RequesterListGet(key cryptography.Key32) (*models.RequesterListEntry, error)
+	RequesterPolicy() (models.RequesterPolicy, error)
+	IsContact(key cryptography.Key32) (bool, error)
+}
+
+// SetRequesterLists sets lists checked before pre transaction is accepted, it has to be called before Loop
+func (p *Protocol) SetRequesterLists(lists RequesterLists) {
+	p.requesterLists = lists
+}
+
+// checkRequester returns error if requester is not allowed to send requests to the owner.
+// Key has to be proven by requester with VerifyPossession, otherwise any requester
+// could claim key of allowed contact.
+func checkRequester(lists RequesterLists, key cryptography.Key32, now time.Time) error {
+	if lists == nil {
+		return nil
+	}
+
+	entry, err := lists.RequesterListGet(key)
+	if err != nil {
+		return err
+	}
+
+	if entry != nil {
+		switch entry.List {
+		case models.RequesterListTypeAllow:
+			return nil
+		case models.RequesterListTypeBlock:
+			return ErrRequesterBlocked
+		case models.RequesterListTypeMute:
+			if muted(entry, now) {
+				return fmt.Errorf("%s until %s", ErrRequesterMuted, *entry.MutedUntil)
+			}
+		}
+	}
+
+	policy, err := lists.RequesterPolicy()
+	if err != nil {
+		return err
+	}
+
+	if policy != models.RequesterPolicyAllowlistOnly {
+		return nil
+	}
+
+	contact, err := lists.IsContact(key)
+	if err != nil {
+		return err
+	}
+
+	if !contact {
+		return ErrRequesterNotAllowed
+	}
+	return nil
+}
+
+func muted(entry *models.RequesterListEntry, now time.Time) bool {
+	if entry.MutedUntil == nil {
+		return false
+	}
+
+	until, err := time.Parse(time.RFC3339, *entry.MutedUntil)
+	if err != nil {
+		return false
+	}
+	return now.Before(until)
+}
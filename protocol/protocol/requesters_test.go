@@ -0,0 +1,112 @@
+package protocol
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+type testRequesterLists struct {
+	entries  map[cryptography.Key32]*models.RequesterListEntry
+	contacts map[cryptography.Key32]bool
+	policy   models.RequesterPolicy
+}
+
+func (l *testRequesterLists) RequesterListGet(key cryptography.Key32) (*models.RequesterListEntry, error) {
+	return l.entries[key], nil
+}
+
+func (l *testRequesterLists) RequesterPolicy() (models.RequesterPolicy, error) {
+	return l.policy, nil
+}
+
+func (l *testRequesterLists) IsContact(key cryptography.Key32) (bool, error) {
+	return l.contacts[key], nil
+}
+
+func TestCheckRequester(t *testing.T) {
+	var (
+		blocked  = cryptography.RandomKey32()
+		muted    = cryptography.RandomKey32()
+		expired  = cryptography.RandomKey32()
+		allowed  = cryptography.RandomKey32()
+		contact  = cryptography.RandomKey32()
+		stranger = cryptography.RandomKey32()
+		now      = time.Now()
+		future   = now.Add(time.Hour).Format(time.RFC3339)
+		past     = now.Add(-time.Hour).Format(time.RFC3339)
+	)
+
+	lists := &testRequesterLists{
+		entries: map[cryptography.Key32]*models.RequesterListEntry{
+			blocked: {List: models.RequesterListTypeBlock},
+			muted:   {List: models.RequesterListTypeMute, MutedUntil: &future},
+			expired: {List: models.RequesterListTypeMute, MutedUntil: &past},
+			allowed: {List: models.RequesterListTypeAllow},
+		},
+		contacts: map[cryptography.Key32]bool{contact: true},
+		policy:   models.RequesterPolicyAcceptAll,
+	}
+
+	tests := []struct {
+		name    string
+		key     cryptography.Key32
+		policy  models.RequesterPolicy
+		refused bool
+	}{
+		{name: "blocked", key: blocked, policy: models.RequesterPolicyAcceptAll, refused: true},
+		{name: "muted", key: muted, policy: models.RequesterPolicyAcceptAll, refused: true},
+		{name: "mute expired", key: expired, policy: models.RequesterPolicyAcceptAll},
+		{name: "stranger", key: stranger, policy: models.RequesterPolicyAcceptAll},
+		{name: "stranger allowlist", key: stranger, policy: models.RequesterPolicyAllowlistOnly, refused: true},
+		{name: "allowed allowlist", key: allowed, policy: models.RequesterPolicyAllowlistOnly},
+		{name: "contact allowlist", key: contact, policy: models.RequesterPolicyAllowlistOnly},
+	}
+
+	for _, test := range tests {
+		lists.policy = test.policy
+		err := checkRequester(lists, test.key, now)
+		if test.refused && err == nil {
+			t.Errorf("%s: checkRequester expected to refuse requester", test.name)
+		}
+		if !test.refused && err != nil {
+			t.Errorf("%s: checkRequester failed: %s", test.name, err)
+		}
+	}
+}
+
+func TestPreTransactionAllowlistBypass(t *testing.T) {
+	responder := testKeychain(t)
+	blocked := testKeychain(t)
+	contact := testKeychain(t)
+
+	proto := NewProtocol(nil)
+	proto.SetKeychain(responder)
+	proto.SetRequesterLists(&testRequesterLists{
+		entries:  map[cryptography.Key32]*models.RequesterListEntry{blocked.MainPublicKey: {List: models.RequesterListTypeBlock}},
+		contacts: map[cryptography.Key32]bool{contact.MainPublicKey: true},
+		policy:   models.RequesterPolicyAllowlistOnly,
+	})
+
+	// blocked requester claims key of allowed contact
+	bypass := provenRequest(t, contact, blocked, responder.MainPublicKey, nil)
+	for _, source := range []cryptography.Key32{contact.MainPublicKey, blocked.MainPublicKey} {
+		reply := preTransact(t, proto, bypass, source)
+		if reply.Success || reply.Error == nil || !strings.HasPrefix(*reply.Error, ErrPossessionProof.Error()) {
+			t.Errorf("request with key of contact sent from %s returned %+v", source.String(), reply)
+		}
+	}
+
+	own := provenRequest(t, blocked, blocked, responder.MainPublicKey, nil)
+	if reply := preTransact(t, proto, own, blocked.MainPublicKey); reply.Success || reply.Error == nil || *reply.Error != ErrRequesterBlocked.Error() {
+		t.Errorf("blocked requester returned %+v", reply)
+	}
+
+	allowed := provenRequest(t, contact, contact, responder.MainPublicKey, nil)
+	if reply := preTransact(t, proto, allowed, contact.MainPublicKey); !reply.Success {
+		t.Errorf("contact returned %+v", reply)
+	}
+}
@@ -3,7 +3,6 @@ package protocol
 import (
 	"context"
 	"fmt"
-	"math/rand"
 	"sync"
 	"time"
 
@@ -13,15 +12,31 @@ import (
 	"github.com/odysseyhack/planet-society/protocol/cryptography"
 	"github.com/odysseyhack/planet-society/protocol/database"
 	"github.com/odysseyhack/planet-society/protocol/models"
+	log "github.com/sirupsen/logrus"
 )
 
 type Resolver struct {
-	db *database.Database
-}
-
-func NewResolver(db *database.Database) *Resolver {
+	db        *database.Database
+	keychain  *cryptography.Keychain
+	templates *LegalTemplates
+	subjects  *DataSubjects
+	pairing   *Pairing
+	pending   *PendingQueue
+	reminders *ObligationReminders
+	// pseudonyms hide real ids of items shared with requesters
+	pseudonyms *Pseudonyms
+}
+
+func NewResolver(db *database.Database, keychain *cryptography.Keychain, templates *LegalTemplates, subjects *DataSubjects, pairing *Pairing, pending *PendingQueue, reminders *ObligationReminders) *Resolver {
 	return &Resolver{
-		db: db,
+		db:         db,
+		keychain:   keychain,
+		templates:  templates,
+		subjects:   subjects,
+		pairing:    pairing,
+		pending:    pending,
+		reminders:  reminders,
+		pseudonyms: NewPseudonyms(keychain, db),
 	}
 }
 
@@ -31,6 +46,9 @@ func (r *Resolver) Mutation() MutationResolver {
 func (r *Resolver) Query() QueryResolver {
 	return &queryResolver{r}
 }
+func (r *Resolver) Subscription() SubscriptionResolver {
+	return &subscriptionResolver{r}
+}
 
 type mutationResolver struct{ *Resolver }
 
@@ -85,21 +103,199 @@ func (r *mutationResolver) IdentityDocumentDel(ctx context.Context, id string) (
 	return r.db.IdentityDocumentDel(id)
 }
 
+func (r *mutationResolver) RequesterListSet(ctx context.Context, entry models.RequesterListInput) (*models.RequesterListEntry, error) {
+	added, err := r.db.RequesterListSet(entry)
+	return &added, err
+}
+
+func (r *mutationResolver) RequesterListDel(ctx context.Context, publicKey models.Key32) (models.Key32, error) {
+	removed, err := r.db.RequesterListDel(publicKey.Key)
+	return models.Key32{Key: removed}, err
+}
+
+func (r *mutationResolver) RequesterPolicySet(ctx context.Context, policy models.RequesterPolicy) (models.RequesterPolicy, error) {
+	return r.db.RequesterPolicySet(policy)
+}
+
+func (r *mutationResolver) LegalTemplateAdd(ctx context.Context, template models.LegalTemplateInput) (*models.LegalTemplate, error) {
+	added, err := r.db.LegalTemplateAdd(template)
+	return &added, err
+}
+
+func (r *mutationResolver) LegalTemplateDel(ctx context.Context, id string, version int) (string, error) {
+	return r.db.LegalTemplateDel(id, version)
+}
+
+func (r *mutationResolver) WalletExport(ctx context.Context, passphrase string) (string, error) {
+	bundle, err := r.db.Export()
+	if err != nil {
+		return "", err
+	}
+
+	encrypted, err := database.EncryptBundle(bundle, passphrase)
+	if err != nil {
+		return "", err
+	}
+	return string(encrypted), nil
+}
+
+func (r *mutationResolver) WalletImport(ctx context.Context, bundle string, passphrase string, conflict *models.ImportConflict) (*models.ImportResult, error) {
+	decrypted, err := database.DecryptBundle([]byte(bundle), passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := models.ImportConflictFail
+	if conflict != nil {
+		mode = *conflict
+	}
+
+	result, err := r.db.Import(decrypted, mode)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (r *mutationResolver) DataSubjectRequestSend(ctx context.Context, requesterPublicKey models.Key32, typeArg models.DataSubjectRequestType) (*models.DataSubjectRequestRecord, error) {
+	return r.subjects.Send(requesterPublicKey.Key, typeArg)
+}
+
+func (r *mutationResolver) PermissionRevoke(ctx context.Context, id string) (*models.Permission, error) {
+	permission, err := r.db.PermissionRevoke(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := r.subjects.Revoke(&permission); err != nil {
+		log.Warningf("permission %s revoked, requester was not informed: %s", id, err)
+	}
+	return &permission, nil
+}
+
+func (r *mutationResolver) DelegationGrant(ctx context.Context, contact string, endpoint string, scope models.DelegationScopeInput, expiration string) (*models.Delegation, error) {
+	expires, err := time.Parse(time.RFC3339, expiration)
+	if err != nil {
+		return nil, fmt.Errorf("%s: expiration %q", ErrInvalidDelegation, expiration)
+	}
+
+	delegate, err := r.db.Contact(contact)
+	if err != nil {
+		return nil, err
+	}
+
+	delegation, err := NewDelegation(r.keychain, delegate, endpoint, models.DelegationScope(scope), time.Now(), expires)
+	if err != nil {
+		return nil, err
+	}
+	return delegation, r.db.DelegationPut(delegation)
+}
+
+func (r *mutationResolver) DelegationRevoke(ctx context.Context, id string) (string, error) {
+	return r.db.DelegationDel(id)
+}
+
+func (r *mutationResolver) ApprovalPolicySet(ctx context.Context, policy models.ApprovalPolicyInput) (*models.ApprovalPolicy, error) {
+	delegations, err := r.db.DelegationList()
+	if err != nil {
+		return nil, err
+	}
+
+	approval := models.ApprovalPolicy(policy)
+	if err := ValidateApprovalPolicy(&approval, delegations); err != nil {
+		return nil, err
+	}
+	return &approval, r.db.ApprovalPolicySet(approval)
+}
+
+func (r *mutationResolver) ApprovalPolicyDel(ctx context.Context) (bool, error) {
+	if err := r.db.ApprovalPolicyDel(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *mutationResolver) DevicePairingStart(ctx context.Context) (*models.DevicePairing, error) {
+	return r.pairing.Offer(time.Now())
+}
+
+func (r *mutationResolver) DevicePair(ctx context.Context, input models.DevicePairInput) (*models.Device, error) {
+	return r.pairing.Pair(&input, time.Now())
+}
+
+func (r *mutationResolver) DeviceRevoke(ctx context.Context, id string) (*models.Device, error) {
+	device, err := r.db.DeviceRevoke(id, time.Now().Format(time.RFC3339))
+	return &device, err
+}
+
+func (r *mutationResolver) TransactionApprove(ctx context.Context, transactionID string, fields []models.ItemFieldInput, identities []string, selection []models.ItemSelectionInput) (*models.PermissionNotificationResponse, error) {
+	var approved []models.ItemField
+	if fields != nil {
+		approved = make([]models.ItemField, len(fields))
+		for i := range fields {
+			approved[i] = models.ItemField(fields[i])
+		}
+	}
+
+	var chosen []models.ItemSelection
+	if selection != nil {
+		chosen = make([]models.ItemSelection, len(selection))
+		for i := range selection {
+			chosen[i] = models.ItemSelection(selection[i])
+		}
+	}
+	return r.pending.Approve(transactionID, approved, identities, chosen)
+}
+
+func (r *mutationResolver) TransactionDeny(ctx context.Context, transactionID string) (*models.PermissionNotificationResponse, error) {
+	return r.pending.Deny(transactionID)
+}
+
+func (r *mutationResolver) SelectionDefaultSet(ctx context.Context, input models.SelectionDefaultInput) (models.SelectionDefault, error) {
+	selection := make([]models.ItemSelection, len(input.Selection))
+	for i := range input.Selection {
+		selection[i] = models.ItemSelection(input.Selection[i])
+	}
+	if err := CheckSelection(selection); err != nil {
+		return models.SelectionDefault{}, err
+	}
+	return r.db.SelectionDefaultSet(input)
+}
+
+func (r *mutationResolver) SelectionDefaultDel(ctx context.Context, requesterPublicKey models.Key32) (models.Key32, error) {
+	key, err := r.db.SelectionDefaultDel(requesterPublicKey.Key)
+	return models.Key32{Key: key}, err
+}
+
 type queryResolver struct{ *Resolver }
 
+// pseudonymousID returns id of item shared with requester of transaction, requester
+// receives pairwise pseudonymous id. Real id is returned if there is no requester.
+func (r *queryResolver) pseudonymousID(ctx context.Context, id string) string {
+	requester, ok := ctx.Value("Requester").(cryptography.Key32)
+	if !ok {
+		return id
+	}
+	return r.pseudonyms.ID(requester, id)
+}
+
 func (r *queryResolver) PersonalDetails(ctx context.Context) (*models.PersonalDetails, error) {
 	t, err := transact(ctx, r.db)
 	if err != nil {
 		return nil, err
 	}
-	return &t.PersonalDetails, nil
+	details := t.PersonalDetails
+	details.ID = r.pseudonymousID(ctx, details.ID)
+	return &details, nil
 }
 func (r *queryResolver) Address(ctx context.Context) (*models.Address, error) {
 	t, err := transact(ctx, r.db)
 	if err != nil {
 		return nil, err
 	}
-	return &t.Address, nil
+	address := t.Address
+	address.ID = r.pseudonymousID(ctx, address.ID)
+	return &address, nil
 }
 
 func (r *queryResolver) PaymentCard(ctx context.Context) (*models.PaymentCard, error) {
@@ -107,21 +303,27 @@ func (r *queryResolver) PaymentCard(ctx context.Context) (*models.PaymentCard, e
 	if err != nil {
 		return nil, err
 	}
-	return &t.PaymentCard, nil
+	card := t.PaymentCard
+	card.ID = r.pseudonymousID(ctx, card.ID)
+	return &card, nil
 }
 func (r *queryResolver) Passport(ctx context.Context) (*models.Passport, error) {
 	t, err := transact(ctx, r.db)
 	if err != nil {
 		return nil, err
 	}
-	return &t.Passport, nil
+	passport := t.Passport
+	passport.ID = r.pseudonymousID(ctx, passport.ID)
+	return &passport, nil
 }
 func (r *queryResolver) IdentityDocument(ctx context.Context) (*models.IdentityDocument, error) {
 	t, err := transact(ctx, r.db)
 	if err != nil {
 		return nil, err
 	}
-	return &t.IdentityDocument, nil
+	document := t.IdentityDocument
+	document.ID = r.pseudonymousID(ctx, document.ID)
+	return &document, nil
 }
 
 func (r *queryResolver) BankingDetails(ctx context.Context) (*models.BankDetails, error) {
@@ -129,7 +331,9 @@ func (r *queryResolver) BankingDetails(ctx context.Context) (*models.BankDetails
 	if err != nil {
 		return nil, err
 	}
-	return &t.BankDetails, nil
+	details := t.BankDetails
+	details.ID = r.pseudonymousID(ctx, details.ID)
+	return &details, nil
 }
 
 func (r *queryResolver) Identity(ctx context.Context) ([]models.Identity, error) {
@@ -146,7 +350,7 @@ func (r *queryResolver) PermissionListByPublicKey(ctx context.Context, publicKey
 			ret = append(ret, list[i])
 		}
 	}
-	return list, err
+	return ret, nil
 }
 
 func (r *queryResolver) PermissionListByResource(ctx context.Context, id string) (ret []models.Permission, err error) {
@@ -170,6 +374,9 @@ func (r *queryResolver) PermissionList(ctx context.Context) ([]models.Permission
 	return a, err
 }
 
+func (r *queryResolver) AddressList(ctx context.Context, identity string) ([]models.Address, error) {
+	return r.db.AddressList(identity)
+}
 func (r *queryResolver) PaymentCardList(ctx context.Context, identity string) ([]models.PaymentCard, error) {
 	return r.db.PaymentCardList(identity)
 }
@@ -180,6 +387,88 @@ func (r *queryResolver) IdentityDocumentList(ctx context.Context, identity strin
 	return r.db.IdentityDocumentList(identity)
 }
 
+func (r *queryResolver) RequesterList(ctx context.Context, list *models.RequesterListType) (ret []models.RequesterListEntry, err error) {
+	entries, err := r.db.RequesterList()
+	if err != nil || list == nil {
+		return entries, err
+	}
+
+	for i := range entries {
+		if entries[i].List == *list {
+			ret = append(ret, entries[i])
+		}
+	}
+	return ret, nil
+}
+
+func (r *queryResolver) RequesterPolicy(ctx context.Context) (models.RequesterPolicy, error) {
+	return r.db.RequesterPolicy()
+}
+
+func (r *queryResolver) LegalTemplateList(ctx context.Context) ([]models.LegalTemplate, error) {
+	return r.templates.List()
+}
+
+func (r *queryResolver) LegalTemplate(ctx context.Context, id string) (*models.LegalTemplate, error) {
+	return r.templates.Get(id)
+}
+
+func (r *queryResolver) ObligationList(ctx context.Context, status *models.ObligationStatus) ([]models.Obligation, error) {
+	list, err := r.db.ObligationList()
+	if err != nil {
+		return nil, err
+	}
+	return FilterObligations(list, status, time.Now())
+}
+
+func (r *queryResolver) DataSubjectRequestList(ctx context.Context) ([]models.DataSubjectRequestRecord, error) {
+	return r.subjects.List(time.Now())
+}
+
+func (r *queryResolver) DelegationList(ctx context.Context) ([]models.Delegation, error) {
+	return r.db.DelegationList()
+}
+
+func (r *queryResolver) DeviceList(ctx context.Context) ([]models.Device, error) {
+	return r.db.DeviceList()
+}
+
+func (r *queryResolver) PendingTransactions(ctx context.Context) ([]models.PendingTransaction, error) {
+	return r.pending.List(), nil
+}
+
+func (r *queryResolver) ApprovalPolicy(ctx context.Context) (*models.ApprovalPolicy, error) {
+	return r.db.ApprovalPolicy()
+}
+
+func (r *queryResolver) SelectionDefaultList(ctx context.Context) ([]models.SelectionDefault, error) {
+	return r.db.SelectionDefaultList()
+}
+
+func (r *queryResolver) WalletDID(ctx context.Context) (models.WalletDID, error) {
+	return WalletDID(r.keychain), nil
+}
+
+func (r *queryResolver) DidResolve(ctx context.Context, did models.DID) (models.DIDDocument, error) {
+	return ResolveDID(did), nil
+}
+
+type subscriptionResolver struct{ *Resolver }
+
+func (r *subscriptionResolver) PendingTransactions(ctx context.Context) (<-chan models.PendingTransaction, error) {
+	if !IsOwner(ctx) {
+		return nil, fmt.Errorf("%s: pendingTransactions", ErrOwnerOnly)
+	}
+	return r.pending.Subscribe(ctx), nil
+}
+
+func (r *subscriptionResolver) ObligationReminders(ctx context.Context) (<-chan models.Obligation, error) {
+	if !IsOwner(ctx) {
+		return nil, fmt.Errorf("%s: obligationReminders", ErrOwnerOnly)
+	}
+	return r.reminders.Subscribe(ctx), nil
+}
+
 // dummy
 type Transaction struct {
 	Address          models.Address
@@ -218,14 +507,20 @@ func transact(ctx context.Context, db *database.Database) (*Transaction, error)
 		return t, nil
 	}
 
-	transaction, err := fillTransaction(db)
+	tr := randomTransaction(ctx)
+	selection, err := transactionSelection(ctx, db, tr)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, _ := ctx.Value("Identities").([]string)
+	transaction, err := fillTransaction(db, allowed, selection)
 	if err != nil {
 		return nil, err
 	}
 
 	cache[transactionID] = transaction
-	tr := randomTransaction(ctx)
-	fillPermittedNodes(ctx, tr, transaction)
+	fillPermittedNodes(graphql.CollectAllFields(ctx), tr, transaction)
 
 	if _, err := db.PermissionAdd(*tr); err != nil {
 		return nil, err
@@ -233,8 +528,22 @@ func transact(ctx context.Context, db *database.Database) (*Transaction, error)
 	return transaction, nil
 }
 
-func fillPermittedNodes(ctx context.Context, tr *models.Permission, transaction *Transaction) {
-	fields := graphql.CollectAllFields(ctx)
+// transactionSelection returns selection chosen by the owner in consent or default selection of requester
+func transactionSelection(ctx context.Context, db *database.Database, tr *models.Permission) ([]models.ItemSelection, error) {
+	if selection, ok := ctx.Value("Selection").([]models.ItemSelection); ok {
+		return selection, nil
+	}
+
+	defaults, err := db.SelectionDefault(tr.RequesterPublicKey.Key)
+	if err != nil || defaults == nil {
+		return nil, err
+	}
+	return defaults.Selection, nil
+}
+
+// fillPermittedNodes records items of queried fields in permission, pseudonymous ids
+// of the items are revealed only if they are recorded
+func fillPermittedNodes(fields []string, tr *models.Permission, transaction *Transaction) {
 	for _, field := range fields {
 		switch field {
 		case "personalDetails":
@@ -247,32 +556,44 @@ func fillPermittedNodes(ctx context.Context, tr *models.Permission, transaction
 			tr.PermissionNodes = append(tr.PermissionNodes, models.PermissionNodes{NodeID: transaction.Passport.ID})
 		case "identityDocument":
 			tr.PermissionNodes = append(tr.PermissionNodes, models.PermissionNodes{NodeID: transaction.IdentityDocument.ID})
+		case "bankingDetails":
+			tr.PermissionNodes = append(tr.PermissionNodes, models.PermissionNodes{NodeID: transaction.BankDetails.ID})
 		}
 	}
 }
 
-func fillTransaction(db *database.Database) (transaction *Transaction, err error) {
+// fillTransaction fills data shared in transaction with identity and items chosen in selection,
+// allowed restricts identities data is taken from. Identity not chosen is the first allowed one
+// owning all chosen items and item not chosen is the first stored item of its type, so the same
+// selection always shares the same data.
+func fillTransaction(db *database.Database, allowed []string, selection []models.ItemSelection) (transaction *Transaction, err error) {
 	transaction = &Transaction{}
-	randS := rand.New(rand.NewSource(time.Now().UnixNano()))
-
 	if transaction.PersonalDetails, err = db.PersonalDetails(); err != nil {
 		return nil, err
 	}
 
-	identities, err := db.IdentityList()
+	identities, err := allowedIdentities(db, allowed)
 	if err != nil {
 		return nil, err
 	}
-	identityID := identities[randS.Uint32()%uint32(len(identities))].ID
 
-	as, err := db.AddressList(identityID)
-	if err != nil {
-		return nil, err
+	if identityID, ok := chosen(selection, SelectIdentity); ok {
+		if !contains(identities, identityID) {
+			return nil, fmt.Errorf("%s: identity %s not allowed", ErrInvalidSelection, identityID)
+		}
+		identities = []string{identityID}
 	}
-	number4 := randS.Uint32() % uint32(len(as))
-	transaction.Address = as[number4]
 
-	if err := fillTransactionWithDocuments(db, transaction); err != nil {
+	for _, identityID := range identities {
+		err = fillTransactionWithDocuments(db, transaction, identityID, selection)
+		if err != ErrInvalidSelection {
+			break
+		}
+	}
+	if err == ErrInvalidSelection {
+		return nil, fmt.Errorf("%s: chosen items do not belong to allowed identity", ErrInvalidSelection)
+	}
+	if err != nil {
 		return nil, err
 	}
 	transaction.BankDetails = models.BankDetails{ID: "bd4ea82ee442e3d54adcd8c5cf4b2032935cd1166f35e518006b670e77cfea17", Bank: "Bank of Netherlands", Iban: "D3ADB33F", NameOnCard: "John Smith"}
@@ -280,33 +601,68 @@ func fillTransaction(db *database.Database) (transaction *Transaction, err error
 	return transaction, nil
 }
 
-func fillTransactionWithDocuments(db *database.Database, transaction *Transaction) error {
-	randS := rand.New(rand.NewSource(time.Now().UnixNano()))
-
-	identities, err := db.IdentityList()
+// fillTransactionWithDocuments fills items of identity chosen in selection,
+// ErrInvalidSelection is returned if identity does not own chosen item
+func fillTransactionWithDocuments(db *database.Database, transaction *Transaction, identityID string, selection []models.ItemSelection) error {
+	as, err := db.AddressList(identityID)
 	if err != nil {
 		return err
 	}
-	identityID := identities[randS.Uint32()%uint32(len(identities))].ID
+	ids := make([]string, len(as))
+	for i := range as {
+		ids[i] = as[i].ID
+	}
+	index, err := selectItem(selection, SelectAddress, ids)
+	if err != nil {
+		return err
+	}
+	if index >= 0 {
+		transaction.Address = as[index]
+	}
 
-	ids, err := db.IdentityDocumentList(identityID)
+	ds, err := db.IdentityDocumentList(identityID)
 	if err != nil {
 		return err
 	}
-	number1 := randS.Uint32() % uint32(len(ids))
-	transaction.IdentityDocument = ids[number1]
+	ids = make([]string, len(ds))
+	for i := range ds {
+		ids[i] = ds[i].ID
+	}
+	if index, err = selectItem(selection, SelectIdentityDocument, ids); err != nil {
+		return err
+	}
+	if index >= 0 {
+		transaction.IdentityDocument = ds[index]
+	}
 
 	ps, err := db.PassportList(identityID)
 	if err != nil {
 		return err
 	}
-	number2 := randS.Uint32() % uint32(len(ps))
-	transaction.Passport = ps[number2]
+	ids = make([]string, len(ps))
+	for i := range ps {
+		ids[i] = ps[i].ID
+	}
+	if index, err = selectItem(selection, SelectPassport, ids); err != nil {
+		return err
+	}
+	if index >= 0 {
+		transaction.Passport = ps[index]
+	}
+
 	pc, err := db.PaymentCardList(identityID)
 	if err != nil {
 		return err
 	}
-	number3 := randS.Uint32() % uint32(len(pc))
-	transaction.PaymentCard = pc[number3]
+	ids = make([]string, len(pc))
+	for i := range pc {
+		ids[i] = pc[i].ID
+	}
+	if index, err = selectItem(selection, SelectPaymentCard, ids); err != nil {
+		return err
+	}
+	if index >= 0 {
+		transaction.PaymentCard = pc[index]
+	}
 	return nil
 }
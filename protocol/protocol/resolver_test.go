@@ -4,10 +4,12 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/odysseyhack/planet-society/protocol/cryptography"
 	"github.com/odysseyhack/planet-society/protocol/database"
+	"github.com/odysseyhack/planet-society/protocol/models"
 	"github.com/phob0s-pl/generator"
 )
 
@@ -35,12 +37,68 @@ func TestFillTransaction(t *testing.T) {
 		t.Fatalf("Generate failed: %s", err)
 	}
 
-	transaction, err := fillTransaction(db)
+	transaction, err := fillTransaction(db, nil, nil)
 	if err != nil {
-		t.Errorf("fillTransaction failed %s", err)
+		t.Fatalf("fillTransaction failed %s", err)
 	}
 
 	if transaction == nil {
-		t.Errorf("fillTransaction returned nil transaction")
+		t.Fatalf("fillTransaction returned nil transaction")
+	}
+
+	again, err := fillTransaction(db, nil, nil)
+	if err != nil {
+		t.Fatalf("fillTransaction failed %s", err)
+	}
+	if again.Address.ID != transaction.Address.ID || again.Passport.ID != transaction.Passport.ID ||
+		again.PaymentCard.ID != transaction.PaymentCard.ID || again.IdentityDocument.ID != transaction.IdentityDocument.ID {
+		t.Errorf("fillTransaction is not deterministic: %+v and %+v", transaction, again)
+	}
+
+	identities, err := db.IdentityList()
+	if err != nil || len(identities) == 0 {
+		t.Fatalf("IdentityList() returned %d identities, %v", len(identities), err)
+	}
+	identity := identities[len(identities)-1].ID
+
+	passports, err := db.PassportList(identity)
+	if err != nil || len(passports) == 0 {
+		t.Fatalf("PassportList() returned %d passports, %v", len(passports), err)
+	}
+	passport := passports[len(passports)-1].ID
+
+	// identity owning chosen passport is used
+	selection := []models.ItemSelection{{Item: SelectPassport, ID: passport}}
+	if transaction, err = fillTransaction(db, nil, selection); err != nil {
+		t.Fatalf("fillTransaction with selection failed %s", err)
+	}
+	if transaction.Passport.ID != passport {
+		t.Errorf("fillTransaction shared passport %s, chosen %s", transaction.Passport.ID, passport)
+	}
+
+	if _, err := fillTransaction(db, []string{"other"}, selection); err != ErrNoIdentityAllowed {
+		t.Errorf("fillTransaction without allowed identity returned %v", err)
+	}
+
+	selection = append(selection, models.ItemSelection{Item: SelectAddress, ID: "missing"})
+	if _, err := fillTransaction(db, nil, selection); err == nil || !strings.HasPrefix(err.Error(), ErrInvalidSelection.Error()) {
+		t.Errorf("fillTransaction with missing item returned %v", err)
+	}
+}
+
+func TestSelectionHeader(t *testing.T) {
+	selection := []models.ItemSelection{{Item: SelectIdentity, ID: "a1"}, {Item: SelectPassport, ID: "b2"}}
+	parsed, err := ParseSelectionHeader(SelectionHeader(selection))
+	if err != nil {
+		t.Fatalf("ParseSelectionHeader() failed: %s", err)
+	}
+	if len(parsed) != 2 || parsed[0] != selection[0] || parsed[1] != selection[1] {
+		t.Errorf("ParseSelectionHeader() returned %+v", parsed)
+	}
+
+	for _, invalid := range []string{"passport", "car=1", "passport=1,passport=2", "address="} {
+		if _, err := ParseSelectionHeader(invalid); err == nil {
+			t.Errorf("ParseSelectionHeader(%q) succeeded", invalid)
+		}
 	}
 }
@@ -0,0 +1,110 @@
+package protocol
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/odysseyhack/planet-society/protocol/database"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+// Items the owner can choose in selection
+const (
+	SelectIdentity         = "identity"
+	SelectAddress          = "address"
+	SelectPassport         = "passport"
+	SelectPaymentCard      = "paymentCard"
+	SelectIdentityDocument = "identityDocument"
+)
+
+var selectableItems = []string{SelectIdentity, SelectAddress, SelectPassport, SelectPaymentCard, SelectIdentityDocument}
+
+// CheckSelection checks that selection chooses known items, each of them at most once
+func CheckSelection(selection []models.ItemSelection) error {
+	seen := make(map[string]bool)
+	for i := range selection {
+		if !contains(selectableItems, selection[i].Item) {
+			return fmt.Errorf("%s: unknown item %q", ErrInvalidSelection, selection[i].Item)
+		}
+		if seen[selection[i].Item] {
+			return fmt.Errorf("%s: item %q chosen twice", ErrInvalidSelection, selection[i].Item)
+		}
+		if selection[i].ID == "" {
+			return fmt.Errorf("%s: empty id of %q", ErrInvalidSelection, selection[i].Item)
+		}
+		seen[selection[i].Item] = true
+	}
+	return nil
+}
+
+// SelectionHeader encodes selection as comma separated item=id pairs
+func SelectionHeader(selection []models.ItemSelection) string {
+	pairs := make([]string, len(selection))
+	for i := range selection {
+		pairs[i] = selection[i].Item + "=" + selection[i].ID
+	}
+	return strings.Join(pairs, ",")
+}
+
+// ParseSelectionHeader decodes selection encoded with SelectionHeader
+func ParseSelectionHeader(header string) ([]models.ItemSelection, error) {
+	var selection []models.ItemSelection
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%s: %q", ErrInvalidSelection, pair)
+		}
+		selection = append(selection, models.ItemSelection{Item: parts[0], ID: parts[1]})
+	}
+	return selection, CheckSelection(selection)
+}
+
+// chosen returns id of item chosen in selection
+func chosen(selection []models.ItemSelection, item string) (string, bool) {
+	for i := range selection {
+		if selection[i].Item == item {
+			return selection[i].ID, true
+		}
+	}
+	return "", false
+}
+
+// selectItem returns index of item chosen in selection among ids of stored items, first item is
+// used if none is chosen and -1 if there are no items. Missing chosen item is ErrInvalidSelection.
+func selectItem(selection []models.ItemSelection, item string, ids []string) (int, error) {
+	id, ok := chosen(selection, item)
+	if !ok {
+		if len(ids) == 0 {
+			return -1, nil
+		}
+		return 0, nil
+	}
+
+	for i := range ids {
+		if ids[i] == id {
+			return i, nil
+		}
+	}
+	return -1, ErrInvalidSelection
+}
+
+// allowedIdentities returns identities data can be taken from in stored order,
+// empty allowed means all identities
+func allowedIdentities(db *database.Database, allowed []string) ([]string, error) {
+	identities, err := db.IdentityList()
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for i := range identities {
+		if len(allowed) == 0 || contains(allowed, identities[i].ID) {
+			ids = append(ids, identities[i].ID)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil, ErrNoIdentityAllowed
+	}
+	return ids, nil
+}
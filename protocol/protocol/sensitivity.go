@@ -0,0 +1,20 @@
+package protocol
+
+import "github.com/odysseyhack/planet-society/protocol/models"
+
+// sensitivityRank orders sensitivity levels
+var sensitivityRank = map[models.Sensitivity]int{
+	models.SensitivityLow:    0,
+	models.SensitivityMedium: 1,
+	models.SensitivityHigh:   2,
+}
+
+// RequestSensitivity returns sensitivity of the most sensitive data category in request
+func RequestSensitivity(request *models.PermissionNotificationRequest) models.Sensitivity {
+	return Classify(request.Item).Sensitivity
+}
+
+// SensitivityAtMost returns true if sensitivity is not above max
+func SensitivityAtMost(sensitivity, max models.Sensitivity) bool {
+	return sensitivityRank[sensitivity] <= sensitivityRank[max]
+}
@@ -0,0 +1,34 @@
+package protocol
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"golang.org/x/crypto/nacl/sign"
+)
+
+// SignDetached signs data with keychain signature key and returns hex encoded signature without data
+func SignDetached(data []byte, keychain *cryptography.Keychain) (string, error) {
+	signed, err := cryptography.NewSigner(keychain.SignaturePrivateKey, keychain.SignaturePublicKey).Sign(data)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(signed[:sign.Overhead]), nil
+}
+
+// VerifyDetached verifies hex encoded signature made by SignDetached
+func VerifyDetached(data []byte, signature string, key cryptography.Key32) error {
+	raw, err := hex.DecodeString(signature)
+	if err != nil {
+		return err
+	}
+
+	if len(raw) != sign.Overhead {
+		return fmt.Errorf("verify: invalid signature length %d", len(raw))
+	}
+
+	signed := append(raw, data...)
+	_, err = cryptography.NewSigner(cryptography.Key64{}, key).Verify(signed)
+	return err
+}
@@ -0,0 +1,382 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DataSubjectDeadline is time requester has to answer data subject request
+	DataSubjectDeadline = day * 30
+
+	// dataSubjectReplyTimeout is how long responder waits for reply on open connection
+	dataSubjectReplyTimeout = time.Minute
+)
+
+// Dialer opens connection to endpoint of the other side
+type Dialer func(endpoint string) (Conn, error)
+
+// CheckEndpoint checks that endpoint given by the other side is websocket URL,
+// it is dialed later and must not point to other services, e.g. over http or file
+func CheckEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("%s: %s", ErrInvalidEndpoint, err)
+	}
+
+	if (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+		return fmt.Errorf("%s: %q", ErrInvalidEndpoint, endpoint)
+	}
+	return nil
+}
+
+// DataSubjectStore stores data subject requests sent by the owner
+type DataSubjectStore interface {
+	PermissionList() ([]models.Permission, error)
+	PermissionErased(transactionID, erasedAt, attestation string) error
+	DataSubjectRequestPut(record *models.DataSubjectRequestRecord) error
+	DataSubjectRequestList() ([]models.DataSubjectRequestRecord, error)
+}
+
+// DataSubjects sends access and erasure requests to requesters which
+// were granted permissions and tracks their status
+type DataSubjects struct {
+	store      DataSubjectStore
+	keychain   *cryptography.Keychain
+	dial       Dialer
+	pseudonyms *Pseudonyms
+}
+
+// NewDataSubjects creates data subject requests service
+func NewDataSubjects(store DataSubjectStore, keychain *cryptography.Keychain, dial Dialer) *DataSubjects {
+	return &DataSubjects{
+		store:      store,
+		keychain:   keychain,
+		dial:       dial,
+		pseudonyms: NewPseudonyms(keychain, store),
+	}
+}
+
+// dataSubjectTopics returns request and reply topic for request type
+func dataSubjectTopics(requestType models.DataSubjectRequestType) (request, reply cryptography.Key32) {
+	switch requestType {
+	case models.DataSubjectRequestTypeErasure:
+		return TopicErasureRequest, TopicErasureReply
+	case models.DataSubjectRequestTypeRevocation:
+		return TopicRevocationRequest, TopicRevocationReply
+	default:
+		return TopicAccessRequest, TopicAccessReply
+	}
+}
+
+// signedRequestData returns data covered by request signature
+func signedRequestData(request *models.DataSubjectRequest) ([]byte, error) {
+	unsigned := *request
+	unsigned.Signature = ""
+	return json.Marshal(&unsigned)
+}
+
+// signedReplyData returns data covered by reply signature
+func signedReplyData(reply *models.DataSubjectReply) ([]byte, error) {
+	unsigned := *reply
+	unsigned.Signature = ""
+	return json.Marshal(&unsigned)
+}
+
+// NewDataSubjectRequest creates data subject request signed by the owner
+func NewDataSubjectRequest(keychain *cryptography.Keychain, requestType models.DataSubjectRequestType, transactions []string, now time.Time) (*models.DataSubjectRequest, error) {
+	request := &models.DataSubjectRequest{
+		RequestID:         models.Key32{Key: cryptography.RandomKey32()},
+		Type:              requestType,
+		OwnerPublicKey:    models.Key32{Key: keychain.MainPublicKey},
+		OwnerSignatureKey: models.Key32{Key: keychain.SignaturePublicKey},
+		Transactions:      transactions,
+		Created:           now.Format(time.RFC3339),
+		Deadline:          now.Add(DataSubjectDeadline).Format(time.RFC3339),
+	}
+
+	data, err := signedRequestData(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.Signature, err = SignDetached(data, keychain); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// VerifyDataSubjectRequest verifies owner signature of data subject request. Signature key is
+// carried in the request, requester has to compare it with key bound to data it received.
+func VerifyDataSubjectRequest(request *models.DataSubjectRequest) error {
+	if !request.Type.IsValid() {
+		return fmt.Errorf("%s: type %q", ErrInvalidDataSubjectMsg, request.Type)
+	}
+
+	data, err := signedRequestData(request)
+	if err != nil {
+		return err
+	}
+
+	if err := VerifyDetached(data, request.Signature, request.OwnerSignatureKey.Key); err != nil {
+		return fmt.Errorf("%s: %s", ErrDataSubjectSignature, err)
+	}
+	return nil
+}
+
+// SignDataSubjectReply signs reply with requester keychain
+func SignDataSubjectReply(reply *models.DataSubjectReply, keychain *cryptography.Keychain) (err error) {
+	data, err := signedReplyData(reply)
+	if err != nil {
+		return err
+	}
+
+	reply.Signature, err = SignDetached(data, keychain)
+	return err
+}
+
+// VerifyDataSubjectReply verifies reply signature made with requester signature key
+func VerifyDataSubjectReply(reply *models.DataSubjectReply, key cryptography.Key32) error {
+	data, err := signedReplyData(reply)
+	if err != nil {
+		return err
+	}
+
+	if err := VerifyDetached(data, reply.Signature, key); err != nil {
+		return fmt.Errorf("%s: %s", ErrDataSubjectSignature, err)
+	}
+	return nil
+}
+
+// Send sends data subject request about all permissions granted to requester.
+// The request is delivered in background, its status is tracked in the store.
+func (d *DataSubjects) Send(requester cryptography.Key32, requestType models.DataSubjectRequestType) (*models.DataSubjectRequestRecord, error) {
+	if !requestType.IsValid() {
+		return nil, fmt.Errorf("%s: type %q", ErrInvalidDataSubjectMsg, requestType)
+	}
+
+	permissions, err := d.store.PermissionList()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		transactions []string
+		latest       *models.Permission
+	)
+	for i := range permissions {
+		if !permissions[i].RequesterPublicKey.Key.Equal(requester) {
+			continue
+		}
+
+		transactions = append(transactions, permissions[i].TransactionID)
+		if permissions[i].RequesterEndpoint != "" && (latest == nil || permissions[i].Created > latest.Created) {
+			latest = &permissions[i]
+		}
+	}
+
+	if len(transactions) == 0 {
+		return nil, fmt.Errorf("%s: %s", ErrNoPermissionGranted, requester.String())
+	}
+
+	if latest == nil {
+		return nil, fmt.Errorf("%s: %s", ErrNoRequesterEndpoint, requester.String())
+	}
+	return d.send(latest, requestType, transactions)
+}
+
+// Revoke informs requester that permission was revoked, requester has to erase data
+// received in the transaction. The request is delivered in background.
+func (d *DataSubjects) Revoke(permission *models.Permission) (*models.DataSubjectRequestRecord, error) {
+	if permission.RequesterEndpoint == "" {
+		return nil, fmt.Errorf("%s: %s", ErrNoRequesterEndpoint, permission.RequesterPublicKey.Key.String())
+	}
+	return d.send(permission, models.DataSubjectRequestTypeRevocation, []string{permission.TransactionID})
+}
+
+// send sends request to endpoint of requester which was granted permission
+func (d *DataSubjects) send(permission *models.Permission, requestType models.DataSubjectRequestType, transactions []string) (*models.DataSubjectRequestRecord, error) {
+	if err := CheckEndpoint(permission.RequesterEndpoint); err != nil {
+		return nil, err
+	}
+
+	requester := permission.RequesterPublicKey.Key
+	request, err := NewDataSubjectRequest(d.keychain, requestType, transactions, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	record := &models.DataSubjectRequestRecord{
+		ID:                 request.RequestID.Key.String(),
+		Type:               requestType,
+		RequesterPublicKey: models.Key32{Key: requester},
+		Transactions:       transactions,
+		Status:             models.DataSubjectRequestStatusPending,
+		Created:            request.Created,
+		Deadline:           request.Deadline,
+	}
+
+	if err := d.store.DataSubjectRequestPut(record); err != nil {
+		return nil, err
+	}
+
+	go d.deliver(permission.RequesterEndpoint, permission.RequesterSignatureKey.Key, request, *record)
+	return record, nil
+}
+
+// deliver sends request to requester endpoint and stores the reply
+func (d *DataSubjects) deliver(endpoint string, signatureKey cryptography.Key32, request *models.DataSubjectRequest, record models.DataSubjectRequestRecord) {
+	reply, err := d.exchange(endpoint, signatureKey, request, record.RequesterPublicKey.Key)
+	if err != nil {
+		log.Warningf("data subjects: request %s failed: %s", record.ID, err)
+		message := err.Error()
+		record.Status = models.DataSubjectRequestStatusFailed
+		record.Error = &message
+	} else {
+		answered := time.Now().Format(time.RFC3339)
+		record.Status = models.DataSubjectRequestStatusAnswered
+		record.Answered = &answered
+		record.Content = d.reveal(record.RequesterPublicKey.Key, reply.Content)
+		record.Erased = reply.Erased
+		record.Attestation = reply.Attestation
+		record.Error = reply.Error
+		if reply.Error != nil {
+			record.Status = models.DataSubjectRequestStatusFailed
+		}
+		d.erased(&record)
+	}
+
+	if err := d.store.DataSubjectRequestPut(&record); err != nil {
+		log.Warningf("data subjects: storing request %s failed: %s", record.ID, err)
+	}
+}
+
+// reveal replaces pseudonymous ids in content returned by requester with real ids of the owner items
+func (d *DataSubjects) reveal(requester cryptography.Key32, content *string) *string {
+	if content == nil {
+		return nil
+	}
+
+	revealed, err := d.pseudonyms.Reveal(requester, *content)
+	if err != nil {
+		log.Warningf("data subjects: revealing ids of %s failed: %s", requester.String(), err)
+		return content
+	}
+	return &revealed
+}
+
+// erased records attestation of erasure or revocation on erased permissions
+func (d *DataSubjects) erased(record *models.DataSubjectRequestRecord) {
+	if record.Type == models.DataSubjectRequestTypeAccess || record.Attestation == nil {
+		return
+	}
+
+	for _, transaction := range record.Erased {
+		if err := d.store.PermissionErased(transaction, *record.Answered, *record.Attestation); err != nil {
+			log.Warningf("data subjects: marking %s erased failed: %s", transaction, err)
+		}
+	}
+}
+
+func (d *DataSubjects) exchange(endpoint string, signatureKey cryptography.Key32, request *models.DataSubjectRequest, requester cryptography.Key32) (*models.DataSubjectReply, error) {
+	conn, err := d.dial(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	requestTopic, replyTopic := dataSubjectTopics(request.Type)
+
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(request); err != nil {
+		return nil, err
+	}
+
+	if err := conn.Write(&Message{
+		Header: Header{Source: d.keychain.MainPublicKey, Destination: requester, Topic: requestTopic, Version: Version1},
+		Body:   Body{Payload: buffer.Bytes()},
+	}); err != nil {
+		return nil, err
+	}
+
+	msg, err := ReadTimeout(conn, dataSubjectReplyTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if msg.Header.Topic != replyTopic {
+		return nil, fmt.Errorf("%s: unexpected topic", ErrInvalidDataSubjectMsg)
+	}
+
+	var reply models.DataSubjectReply
+	if err := gob.NewDecoder(bytes.NewBuffer(msg.Body.Payload)).Decode(&reply); err != nil {
+		return nil, fmt.Errorf("%s: %s", ErrInvalidDataSubjectMsg, err)
+	}
+
+	if !reply.RequestID.Key.Equal(request.RequestID.Key) || reply.Type != request.Type {
+		return nil, fmt.Errorf("%s: reply does not match request", ErrInvalidDataSubjectMsg)
+	}
+
+	if err := VerifyDataSubjectReply(&reply, signatureKey); err != nil {
+		return nil, err
+	}
+
+	if reply.Content != nil {
+		content, err := DecryptContent(*reply.Content, requester, d.keychain)
+		if err != nil {
+			return nil, err
+		}
+		reply.Content = &content
+	}
+	return &reply, nil
+}
+
+// ReadTimeout reads single message from connection, connection is closed on timeout
+func ReadTimeout(conn Conn, timeout time.Duration) (*Message, error) {
+	type result struct {
+		msg *Message
+		err error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		msg, err := conn.Read()
+		done <- result{msg: msg, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.msg, r.err
+	case <-time.After(timeout):
+		_ = conn.Close()
+		return nil, ErrDataSubjectTimeout
+	}
+}
+
+// List returns sent data subject requests, pending requests past deadline are overdue
+func (d *DataSubjects) List(now time.Time) ([]models.DataSubjectRequestRecord, error) {
+	list, err := d.store.DataSubjectRequestList()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range list {
+		if list[i].Status != models.DataSubjectRequestStatusPending {
+			continue
+		}
+
+		deadline, err := time.Parse(time.RFC3339, list[i].Deadline)
+		if err == nil && !now.Before(deadline) {
+			list[i].Status = models.DataSubjectRequestStatusOverdue
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,166 @@
+package protocol
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+type testDataSubjectStore struct {
+	permissions []models.Permission
+	records     map[string]models.DataSubjectRequestRecord
+}
+
+func (s *testDataSubjectStore) PermissionList() ([]models.Permission, error) {
+	return s.permissions, nil
+}
+
+func (s *testDataSubjectStore) PermissionErased(transactionID, erasedAt, attestation string) error {
+	return nil
+}
+
+func (s *testDataSubjectStore) DataSubjectRequestPut(record *models.DataSubjectRequestRecord) error {
+	s.records[record.ID] = *record
+	return nil
+}
+
+func (s *testDataSubjectStore) DataSubjectRequestList() (list []models.DataSubjectRequestRecord, err error) {
+	for _, record := range s.records {
+		list = append(list, record)
+	}
+	return list, nil
+}
+
+func TestDataSubjectRequestSignature(t *testing.T) {
+	owner, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+
+	request, err := NewDataSubjectRequest(owner, models.DataSubjectRequestTypeErasure, []string{"transaction"}, time.Now())
+	if err != nil {
+		t.Fatalf("NewDataSubjectRequest() failed: %s", err)
+	}
+
+	if err := VerifyDataSubjectRequest(request); err != nil {
+		t.Fatalf("VerifyDataSubjectRequest() failed: %s", err)
+	}
+
+	request.Transactions = append(request.Transactions, "other")
+	if err := VerifyDataSubjectRequest(request); err == nil || !strings.HasPrefix(err.Error(), ErrDataSubjectSignature.Error()) {
+		t.Errorf("VerifyDataSubjectRequest() returned %v for tampered request", err)
+	}
+
+	reply := &models.DataSubjectReply{RequestID: request.RequestID, Type: request.Type, Erased: []string{"transaction"}}
+	if err := SignDataSubjectReply(reply, owner); err != nil {
+		t.Fatalf("SignDataSubjectReply() failed: %s", err)
+	}
+
+	if err := VerifyDataSubjectReply(reply, owner.SignaturePublicKey); err != nil {
+		t.Errorf("VerifyDataSubjectReply() failed: %s", err)
+	}
+
+	if err := VerifyDataSubjectReply(reply, cryptography.RandomKey32()); err == nil {
+		t.Errorf("VerifyDataSubjectReply() expected to fail with other key")
+	}
+}
+
+func TestDataSubjectsSendWithoutEndpoint(t *testing.T) {
+	owner, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+
+	requester := cryptography.RandomKey32()
+	store := &testDataSubjectStore{
+		permissions: []models.Permission{{TransactionID: "transaction", RequesterPublicKey: models.Key32{Key: requester}}},
+		records:     make(map[string]models.DataSubjectRequestRecord),
+	}
+	subjects := NewDataSubjects(store, owner, nil)
+
+	if _, err := subjects.Send(requester, models.DataSubjectRequestTypeAccess); err == nil || !strings.HasPrefix(err.Error(), ErrNoRequesterEndpoint.Error()) {
+		t.Errorf("Send() returned %v, expected %s", err, ErrNoRequesterEndpoint)
+	}
+
+	if _, err := subjects.Send(cryptography.RandomKey32(), models.DataSubjectRequestTypeAccess); err == nil || !strings.HasPrefix(err.Error(), ErrNoPermissionGranted.Error()) {
+		t.Errorf("Send() returned %v, expected %s", err, ErrNoPermissionGranted)
+	}
+}
+
+func TestDataSubjectsListOverdue(t *testing.T) {
+	now := time.Now()
+	store := &testDataSubjectStore{
+		records: map[string]models.DataSubjectRequestRecord{
+			"late":     {ID: "late", Status: models.DataSubjectRequestStatusPending, Deadline: now.Add(-time.Hour).Format(time.RFC3339)},
+			"waiting":  {ID: "waiting", Status: models.DataSubjectRequestStatusPending, Deadline: now.Add(time.Hour).Format(time.RFC3339)},
+			"answered": {ID: "answered", Status: models.DataSubjectRequestStatusAnswered, Deadline: now.Add(-time.Hour).Format(time.RFC3339)},
+		},
+	}
+
+	list, err := NewDataSubjects(store, nil, nil).List(now)
+	if err != nil {
+		t.Fatalf("List() failed: %s", err)
+	}
+
+	expected := map[string]models.DataSubjectRequestStatus{
+		"late":     models.DataSubjectRequestStatusOverdue,
+		"waiting":  models.DataSubjectRequestStatusPending,
+		"answered": models.DataSubjectRequestStatusAnswered,
+	}
+	for _, record := range list {
+		if record.Status != expected[record.ID] {
+			t.Errorf("List() returned status %s for %s, expected %s", record.Status, record.ID, expected[record.ID])
+		}
+	}
+}
+
+func TestCheckEndpoint(t *testing.T) {
+	for endpoint, valid := range map[string]bool{
+		"ws://127.0.0.1:15001/":             true,
+		"wss://requester.example.com/":      true,
+		"http://127.0.0.1:8088/query":       false,
+		"file:///etc/passwd":                false,
+		"ws:///":                            false,
+		"gopher://127.0.0.1:6379/_FLUSHALL": false,
+		"":                                  false,
+	} {
+		if err := CheckEndpoint(endpoint); (err == nil) != valid {
+			t.Errorf("CheckEndpoint(%q) returned %v", endpoint, err)
+		}
+	}
+}
+
+func TestRequesterEndpointRestricted(t *testing.T) {
+	responder := testKeychain(t)
+	requester := testKeychain(t)
+
+	proto := NewProtocol(nil)
+	proto.SetKeychain(responder)
+
+	endpoint := "http://127.0.0.1:8088/query"
+	request := testRequest(requester, nil)
+	request.Capabilities = DefaultCapabilities()
+	request.Endpoint = &endpoint
+	if err := ProvePossession(request, requester, responder.MainPublicKey); err != nil {
+		t.Fatalf("ProvePossession() failed: %s", err)
+	}
+
+	if reply := preTransact(t, proto, request, requester.MainPublicKey); reply.Success || reply.Error == nil || !strings.HasPrefix(*reply.Error, ErrInvalidEndpoint.Error()) {
+		t.Errorf("pre transaction with http endpoint returned %+v", reply)
+	}
+
+	store := &testDataSubjectStore{records: make(map[string]models.DataSubjectRequestRecord)}
+	subjects := NewDataSubjects(store, responder, nil)
+	permission := &models.Permission{
+		TransactionID:      "transaction",
+		RequesterPublicKey: models.Key32{Key: requester.MainPublicKey},
+		RequesterEndpoint:  endpoint,
+	}
+
+	if _, err := subjects.Revoke(permission); err == nil || !strings.HasPrefix(err.Error(), ErrInvalidEndpoint.Error()) {
+		t.Errorf("Revoke() returned %v, expected %s", err, ErrInvalidEndpoint)
+	}
+}
@@ -0,0 +1,224 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/odysseyhack/planet-society/protocol/database"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+const (
+	// DefaultLawApplying is jurisdiction used when requester does not specify one
+	DefaultLawApplying = "European Union"
+)
+
+// LegalTemplateStore gives access to legal templates stored by the owner
+type LegalTemplateStore interface {
+	LegalTemplateList() ([]models.LegalTemplate, error)
+}
+
+// LegalTemplates is a registry of legal relationship templates
+// keyed by permission type and law applying. Templates come from
+// built in defaults, template files and the owner's database,
+// stored templates take precedence over files and defaults.
+type LegalTemplates struct {
+	sync.RWMutex
+	files []models.LegalTemplate
+	store LegalTemplateStore
+}
+
+// defaultLegalTemplates returns templates available without configuration
+func defaultLegalTemplates() []models.LegalTemplate {
+	return []models.LegalTemplate{
+		{
+			ID:             "digital-telecommunication-agreement",
+			Version:        1,
+			PermissionType: "digital telecommunication agreement",
+			LawApplying:    DefaultLawApplying,
+			LegalReliationships: models.LegalReliationships{
+				MyRights:       []string{"use telecommunication services until agreement expires"},
+				TheirDuties:    []string{"provide high availability telecommunication service"},
+				MyPowers:       []string{"cancel contract within 14 days from signing"},
+				TheirLiability: []string{"liable for the consequences of the agreement termination"},
+			},
+			Obligations: []models.ObligationTemplate{
+				{
+					Kind:         models.ObligationKindPower,
+					Description:  "cancel contract within 14 days from signing",
+					DeadlineDays: 14,
+					RemindDays:   3,
+				},
+				{
+					Kind:        models.ObligationKindRight,
+					Description: "use telecommunication services until agreement expires",
+					RemindDays:  7,
+				},
+			},
+		},
+	}
+}
+
+// NewLegalTemplates creates registry with default templates, store can be nil
+func NewLegalTemplates(store LegalTemplateStore) *LegalTemplates {
+	return &LegalTemplates{
+		files: defaultLegalTemplates(),
+		store: store,
+	}
+}
+
+// LoadDir loads templates from all JSON files in directory,
+// every file contains a list of templates.
+func (l *LegalTemplates) LoadDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	var loaded []models.LegalTemplate
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		var templates []models.LegalTemplate
+		if err := json.Unmarshal(data, &templates); err != nil {
+			return fmt.Errorf("legal templates %q: %s", file, err)
+		}
+
+		for i := range templates {
+			if templates[i].ID == "" || templates[i].Version <= 0 {
+				return fmt.Errorf("legal templates %q: template %d has no ID or version", file, i)
+			}
+		}
+		loaded = append(loaded, templates...)
+	}
+
+	l.Lock()
+	defer l.Unlock()
+	l.files = append(l.files, loaded...)
+	return nil
+}
+
+// List returns all versions of known templates
+func (l *LegalTemplates) List() ([]models.LegalTemplate, error) {
+	l.RLock()
+	defer l.RUnlock()
+
+	var stored []models.LegalTemplate
+	if l.store != nil {
+		var err error
+		if stored, err = l.store.LegalTemplateList(); err != nil {
+			return nil, err
+		}
+	}
+
+	list := append([]models.LegalTemplate{}, stored...)
+	for i := range l.files {
+		if findTemplate(stored, l.files[i].ID, l.files[i].Version) == nil {
+			list = append(list, l.files[i])
+		}
+	}
+	return list, nil
+}
+
+// ParseTemplateReference parses template reference in form "id" or "id@version",
+// zero version means the latest version.
+func ParseTemplateReference(reference string) (id string, version int, err error) {
+	parts := strings.SplitN(reference, "@", 2)
+	if len(parts) == 1 {
+		return parts[0], 0, nil
+	}
+
+	version, err = strconv.Atoi(parts[1])
+	if err != nil || version <= 0 {
+		return "", 0, fmt.Errorf("%s: invalid version in %q", ErrUnknownTemplate, reference)
+	}
+	return parts[0], version, nil
+}
+
+// TemplateReference returns reference to exact template version
+func TemplateReference(template *models.LegalTemplate) string {
+	return database.LegalTemplateKey(template.ID, template.Version)
+}
+
+// Get returns template referenced by "id" or "id@version"
+func (l *LegalTemplates) Get(reference string) (*models.LegalTemplate, error) {
+	id, version, err := ParseTemplateReference(reference)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := l.List()
+	if err != nil {
+		return nil, err
+	}
+
+	template := findTemplate(list, id, version)
+	if template == nil {
+		return nil, fmt.Errorf("%s: %q", ErrUnknownTemplate, reference)
+	}
+	return template, nil
+}
+
+// Resolve returns template for transaction. If reference is given the referenced
+// template must match permission type and law applying, otherwise the latest template
+// for permission type and law applying is returned. Nil is returned if there is no template.
+func (l *LegalTemplates) Resolve(reference, permissionType, lawApplying string) (*models.LegalTemplate, error) {
+	if lawApplying == "" {
+		lawApplying = DefaultLawApplying
+	}
+
+	if reference != "" {
+		template, err := l.Get(reference)
+		if err != nil {
+			return nil, err
+		}
+
+		if template.PermissionType != permissionType || template.LawApplying != lawApplying {
+			return nil, fmt.Errorf("%s: %q is for %q under %q", ErrTemplateMismatch, reference, template.PermissionType, template.LawApplying)
+		}
+		return template, nil
+	}
+
+	list, err := l.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var latest *models.LegalTemplate
+	for i := range list {
+		if list[i].PermissionType != permissionType || list[i].LawApplying != lawApplying {
+			continue
+		}
+		if latest == nil || list[i].Version > latest.Version {
+			latest = &list[i]
+		}
+	}
+	return latest, nil
+}
+
+// findTemplate finds template with given ID and version, zero version means the latest
+func findTemplate(list []models.LegalTemplate, id string, version int) *models.LegalTemplate {
+	var found *models.LegalTemplate
+	for i := range list {
+		if list[i].ID != id {
+			continue
+		}
+
+		if version != 0 && list[i].Version == version {
+			return &list[i]
+		}
+
+		if version == 0 && (found == nil || list[i].Version > found.Version) {
+			found = &list[i]
+		}
+	}
+	return found
+}
@@ -0,0 +1,112 @@
+package protocol
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+type testTemplateStore struct {
+	templates []models.LegalTemplate
+}
+
+func (s *testTemplateStore) LegalTemplateList() ([]models.LegalTemplate, error) {
+	return s.templates, nil
+}
+
+func TestLegalTemplatesResolve(t *testing.T) {
+	store := &testTemplateStore{
+		templates: []models.LegalTemplate{
+			{ID: "digital-telecommunication-agreement", Version: 2, PermissionType: "digital telecommunication agreement", LawApplying: DefaultLawApplying},
+			{ID: "lease", Version: 1, PermissionType: "lease agreement", LawApplying: "Netherlands"},
+		},
+	}
+	templates := NewLegalTemplates(store)
+
+	template, err := templates.Resolve("", "digital telecommunication agreement", "")
+	if err != nil {
+		t.Fatalf("Resolve() failed: %s", err)
+	}
+	if template == nil || template.Version != 2 {
+		t.Fatalf("Resolve() returned %+v, expected latest stored version", template)
+	}
+
+	template, err = templates.Resolve("digital-telecommunication-agreement@1", "digital telecommunication agreement", DefaultLawApplying)
+	if err != nil {
+		t.Fatalf("Resolve() failed: %s", err)
+	}
+	if template == nil || template.Version != 1 || len(template.LegalReliationships.MyRights) == 0 {
+		t.Fatalf("Resolve() returned %+v, expected default template", template)
+	}
+
+	template, err = templates.Resolve("", "lease agreement", DefaultLawApplying)
+	if err != nil || template != nil {
+		t.Errorf("Resolve() returned %+v, %v for other jurisdiction", template, err)
+	}
+
+	if _, err := templates.Resolve("lease", "digital telecommunication agreement", "Netherlands"); err == nil || !strings.HasPrefix(err.Error(), ErrTemplateMismatch.Error()) {
+		t.Errorf("Resolve() returned %v, expected %s", err, ErrTemplateMismatch)
+	}
+
+	if _, err := templates.Resolve("unknown", "lease agreement", "Netherlands"); err == nil || !strings.HasPrefix(err.Error(), ErrUnknownTemplate.Error()) {
+		t.Errorf("Resolve() returned %v, expected %s", err, ErrUnknownTemplate)
+	}
+}
+
+func TestLegalTemplatesLoadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates")
+	if err != nil {
+		t.Fatalf("TempDir() failed: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := `[{"id": "lease", "version": 1, "permission_type": "lease agreement", "lawApplying": "Netherlands",
+		"legalReliationships": {"myRights": ["live in the apartment"]}}]`
+	if err := ioutil.WriteFile(filepath.Join(dir, "lease.json"), []byte(data), 0600); err != nil {
+		t.Fatalf("WriteFile() failed: %s", err)
+	}
+
+	templates := NewLegalTemplates(nil)
+	if err := templates.LoadDir(dir); err != nil {
+		t.Fatalf("LoadDir() failed: %s", err)
+	}
+
+	template, err := templates.Get("lease")
+	if err != nil {
+		t.Fatalf("Get() failed: %s", err)
+	}
+
+	if TemplateReference(template) != "lease@1" || len(template.LegalReliationships.MyRights) != 1 {
+		t.Errorf("Get() returned %+v", template)
+	}
+}
+
+func TestParseTemplateReference(t *testing.T) {
+	tests := []struct {
+		reference string
+		id        string
+		version   int
+		fail      bool
+	}{
+		{reference: "lease", id: "lease"},
+		{reference: "lease@3", id: "lease", version: 3},
+		{reference: "lease@x", fail: true},
+		{reference: "lease@0", fail: true},
+	}
+
+	for _, test := range tests {
+		id, version, err := ParseTemplateReference(test.reference)
+		if (err != nil) != test.fail {
+			t.Errorf("ParseTemplateReference(%q) error %v, expected failure %v", test.reference, err, test.fail)
+			continue
+		}
+
+		if id != test.id || version != test.version {
+			t.Errorf("ParseTemplateReference(%q) returned %q, %d", test.reference, id, version)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package protocol
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultApprovalTimeout is used when approval policy does not set timeout
+const defaultApprovalTimeout = time.Minute * 2
+
+// ownerApprover names the owner in collected approvals
+const ownerApprover = "owner"
+
+// ApprovalStore stores approval policy and delegations granted to co-approvers
+type ApprovalStore interface {
+	// ApprovalPolicy returns nil if threshold approval is not configured
+	ApprovalPolicy() (*models.ApprovalPolicy, error)
+	DelegationList() ([]models.Delegation, error)
+}
+
+// ValidateApprovalPolicy checks that policy can be satisfied by its approvers. Delegation
+// of every approver has to cover all requests policy applies to, i.e. requests of policy
+// sensitivity and more sensitive ones with any items, delegate rejects other requests.
+func ValidateApprovalPolicy(policy *models.ApprovalPolicy, delegations []models.Delegation) error {
+	if !policy.Sensitivity.IsValid() {
+		return fmt.Errorf("%s: sensitivity %q", ErrInvalidApprovalPolicy, policy.Sensitivity)
+	}
+
+	if policy.TimeoutSeconds < 0 {
+		return fmt.Errorf("%s: timeout %d", ErrInvalidApprovalPolicy, policy.TimeoutSeconds)
+	}
+
+	known := make(map[string]*models.Delegation)
+	for i := range delegations {
+		known[delegations[i].ID] = &delegations[i]
+	}
+
+	seen := make(map[string]bool)
+	for _, approver := range policy.Approvers {
+		delegation, ok := known[approver]
+		if !ok {
+			return fmt.Errorf("%s: unknown delegation %s", ErrInvalidApprovalPolicy, approver)
+		}
+		if seen[approver] {
+			return fmt.Errorf("%s: duplicated delegation %s", ErrInvalidApprovalPolicy, approver)
+		}
+		seen[approver] = true
+
+		for _, sensitivity := range models.AllSensitivity {
+			if SensitivityAtMost(policy.Sensitivity, sensitivity) && !SensitivityAtMost(sensitivity, delegation.Scope.MaxSensitivity) {
+				return fmt.Errorf("%s: delegation %s does not cover %s sensitivity", ErrInvalidApprovalPolicy, approver, sensitivity)
+			}
+		}
+		if len(delegation.Scope.Items) > 0 {
+			return fmt.Errorf("%s: delegation %s covers only items %v", ErrInvalidApprovalPolicy, approver, delegation.Scope.Items)
+		}
+	}
+
+	available := len(policy.Approvers)
+	if policy.OwnerApproves {
+		available++
+	}
+
+	if policy.Required < 1 || policy.Required > available {
+		return fmt.Errorf("%s: %d approvals required, %d approvers", ErrInvalidApprovalPolicy, policy.Required, available)
+	}
+	return nil
+}
+
+// approval is single decision collected during threshold authorization
+type approval struct {
+	approver   string
+	accepted   bool
+	identities []string
+	// fields approved by approver, nil approves all requested fields
+	fields []models.ItemField
+	// selection of shared items, only the owner chooses them
+	selection []models.ItemSelection
+	err       error
+}
+
+// ThresholdAuthorization requires quorum of approvals for requests covered by approval policy,
+// other requests are authorized by next plugin
+type ThresholdAuthorization struct {
+	store    ApprovalStore
+	keychain *cryptography.Keychain
+	dial     Dialer
+	owner    AuthorizationPlugin
+	next     AuthorizationPlugin
+}
+
+// NewThresholdAuthorization creates threshold authorization, owner decides as one of approvers
+func NewThresholdAuthorization(store ApprovalStore, keychain *cryptography.Keychain, dial Dialer, owner, next AuthorizationPlugin) *ThresholdAuthorization {
+	return &ThresholdAuthorization{
+		store:    store,
+		keychain: keychain,
+		dial:     dial,
+		owner:    owner,
+		next:     next,
+	}
+}
+
+func (a *ThresholdAuthorization) Authorize(input *models.PermissionNotificationRequest) (*models.PermissionNotificationResponse, error) {
+	policy, err := a.store.ApprovalPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	if policy == nil || !SensitivityAtMost(policy.Sensitivity, RequestSensitivity(input)) {
+		return a.next.Authorize(input)
+	}
+
+	approvers, err := a.approvers(policy, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return a.collect(policy, approvers, input)
+}
+
+// approvers returns valid delegations of policy approvers, invalid ones are skipped
+func (a *ThresholdAuthorization) approvers(policy *models.ApprovalPolicy, now time.Time) ([]models.Delegation, error) {
+	delegations, err := a.store.DelegationList()
+	if err != nil {
+		return nil, err
+	}
+
+	var approvers []models.Delegation
+	for i := range delegations {
+		if !contains(policy.Approvers, delegations[i].ID) {
+			continue
+		}
+
+		if err := VerifyOwnDelegation(&delegations[i], a.keychain, now); err != nil {
+			log.Warningf("threshold: skipping approver %s: %s", delegations[i].Delegate.DisplayName, err)
+			continue
+		}
+		approvers = append(approvers, delegations[i])
+	}
+	return approvers, nil
+}
+
+// collect asks all approvers in parallel and decides once quorum is met or can not be met anymore
+func (a *ThresholdAuthorization) collect(policy *models.ApprovalPolicy, approvers []models.Delegation, input *models.PermissionNotificationRequest) (*models.PermissionNotificationResponse, error) {
+	timeout := time.Duration(policy.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultApprovalTimeout
+	}
+
+	total := len(approvers)
+	results := make(chan approval, total+1)
+	if policy.OwnerApproves {
+		total++
+		go func() {
+			reply, err := a.owner.Authorize(input)
+			if err != nil {
+				results <- approval{approver: ownerApprover, err: err}
+				return
+			}
+			results <- approval{approver: ownerApprover, accepted: reply.Accepted, identities: reply.Identities, fields: reply.Fields, selection: reply.Selection}
+		}()
+	}
+
+	for i := range approvers {
+		go func(delegation models.Delegation) {
+			decision, err := requestConsent(a.keychain, a.dial, &delegation, input, timeout)
+			results <- approval{
+				approver:   delegation.Delegate.DisplayName,
+				accepted:   err == nil && decision.Accepted,
+				identities: delegation.Scope.Identities,
+				err:        err,
+			}
+		}(approvers[i])
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var accepted []approval
+	for decided := 0; decided < total; decided++ {
+		select {
+		case result := <-results:
+			if result.err != nil {
+				log.Warningf("threshold: approver %s failed to decide transaction %s: %s", result.approver, input.TransactionID, result.err)
+			} else {
+				log.Infof("threshold: approver %s decided transaction %s, accepted: %t", result.approver, input.TransactionID, result.accepted)
+			}
+
+			if result.accepted {
+				accepted = append(accepted, result)
+			}
+
+			if len(accepted) >= policy.Required {
+				identities, ok := approvedIdentities(accepted)
+				if !ok {
+					log.Warningf("threshold: approvers of transaction %s allowed disjoint identities", input.TransactionID)
+				}
+				var fields []models.ItemField
+				var selection []models.ItemSelection
+				for i := range accepted {
+					fields = intersectFields(fields, accepted[i].fields)
+					if accepted[i].approver == ownerApprover {
+						selection = accepted[i].selection
+					}
+				}
+				return &models.PermissionNotificationResponse{
+					TransactionID: input.TransactionID,
+					Accepted:      ok && (fields == nil || len(fields) > 0),
+					Identities:    identities,
+					Fields:        fields,
+					Selection:     selection,
+				}, nil
+			}
+
+			if len(accepted)+total-decided-1 < policy.Required {
+				return &models.PermissionNotificationResponse{TransactionID: input.TransactionID}, nil
+			}
+		case <-timer.C:
+			return nil, fmt.Errorf("%s: %d of %d approvals", ErrQuorumTimeout, len(accepted), policy.Required)
+		}
+	}
+	return &models.PermissionNotificationResponse{TransactionID: input.TransactionID}, nil
+}
+
+// approvedIdentities returns identities allowed by all approvals, approvals without
+// identity restriction allow all identities. False is returned if no identity is allowed by all.
+func approvedIdentities(approvals []approval) (identities []string, ok bool) {
+	restricted := false
+	for i := range approvals {
+		if len(approvals[i].identities) == 0 {
+			continue
+		}
+
+		if !restricted {
+			restricted = true
+			identities = approvals[i].identities
+			continue
+		}
+
+		var common []string
+		for _, identity := range identities {
+			if contains(approvals[i].identities, identity) {
+				common = append(common, identity)
+			}
+		}
+		identities = common
+	}
+	return identities, !restricted || len(identities) > 0
+}
@@ -0,0 +1,195 @@
+package protocol
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+type testApprovalStore struct {
+	policy      *models.ApprovalPolicy
+	delegations []models.Delegation
+}
+
+func (s *testApprovalStore) ApprovalPolicy() (*models.ApprovalPolicy, error) {
+	return s.policy, nil
+}
+
+func (s *testApprovalStore) DelegationList() ([]models.Delegation, error) {
+	return s.delegations, nil
+}
+
+// testApprover is node of co-approver answering delegated consent requests
+type testApprover struct {
+	proto         *Protocol
+	authorization *testAuthorization
+	delegation    models.Delegation
+}
+
+func newTestApprover(t *testing.T, owner *cryptography.Keychain, name string, accept bool, identities []string) *testApprover {
+	keychain := testKeychain(t)
+	contact := models.Contact{
+		ID:           name,
+		PublicKey:    models.Key32{Key: keychain.MainPublicKey},
+		SignatureKey: models.Key32{Key: keychain.SignaturePublicKey},
+		DisplayName:  name,
+	}
+
+	scope := models.DelegationScope{Identities: identities, MaxSensitivity: models.SensitivityHigh}
+	delegation, err := NewDelegation(owner, contact, name, scope, time.Now(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("NewDelegation() failed: %s", err)
+	}
+
+	approver := &testApprover{authorization: &testAuthorization{accept: accept}, delegation: *delegation}
+	approver.proto = NewProtocol(approver.authorization)
+	approver.proto.SetKeychain(keychain)
+	approver.proto.SetContactStore(ownerContact(owner))
+	go approver.proto.Loop()
+	return approver
+}
+
+func testThreshold(owner *cryptography.Keychain, policy *models.ApprovalPolicy, ownerAccepts bool, approvers ...*testApprover) (*ThresholdAuthorization, *testAuthorization) {
+	store := &testApprovalStore{policy: policy}
+	nodes := make(map[string]*Protocol)
+	for _, approver := range approvers {
+		store.delegations = append(store.delegations, approver.delegation)
+		policy.Approvers = append(policy.Approvers, approver.delegation.ID)
+		nodes[approver.delegation.Endpoint] = approver.proto
+	}
+
+	dial := func(endpoint string) (Conn, error) {
+		local, remote := pipe()
+		if node, ok := nodes[endpoint]; ok {
+			node.Connections <- remote
+		}
+		return local, nil
+	}
+
+	next := &testAuthorization{accept: false}
+	return NewThresholdAuthorization(store, owner, dial, &testAuthorization{accept: ownerAccepts}, next), next
+}
+
+func TestThresholdAuthorizationQuorum(t *testing.T) {
+	owner := testKeychain(t)
+	first := newTestApprover(t, owner, "first", false, nil)
+	defer first.proto.Stop()
+	second := newTestApprover(t, owner, "second", true, []string{"household", "dependent"})
+	defer second.proto.Stop()
+
+	policy := &models.ApprovalPolicy{Sensitivity: models.SensitivityHigh, Required: 2, OwnerApproves: true, TimeoutSeconds: 5}
+	authorization, next := testThreshold(owner, policy, true, first, second)
+
+	reply, err := authorization.Authorize(testNotification("passport"))
+	if err != nil {
+		t.Fatalf("Authorize() failed: %s", err)
+	}
+
+	if !reply.Accepted || len(reply.Identities) != 2 {
+		t.Errorf("Authorize() returned %+v, expected accepted by owner and second approver", reply)
+	}
+
+	reply, err = authorization.Authorize(testNotification("personalDetails.email"))
+	if err != nil {
+		t.Fatalf("Authorize() failed: %s", err)
+	}
+
+	if reply.Accepted || len(next.requests) != 1 {
+		t.Errorf("Authorize() below policy sensitivity returned %+v, expected next plugin decision", reply)
+	}
+}
+
+func TestThresholdAuthorizationRejected(t *testing.T) {
+	owner := testKeychain(t)
+	first := newTestApprover(t, owner, "first", false, nil)
+	defer first.proto.Stop()
+	second := newTestApprover(t, owner, "second", true, nil)
+	defer second.proto.Stop()
+
+	policy := &models.ApprovalPolicy{Sensitivity: models.SensitivityMedium, Required: 3, OwnerApproves: true, TimeoutSeconds: 5}
+	authorization, _ := testThreshold(owner, policy, true, first, second)
+
+	reply, err := authorization.Authorize(testNotification("passport"))
+	if err != nil {
+		t.Fatalf("Authorize() failed: %s", err)
+	}
+
+	if reply.Accepted {
+		t.Errorf("Authorize() returned %+v, expected quorum not met", reply)
+	}
+}
+
+func TestThresholdAuthorizationTimeout(t *testing.T) {
+	owner := testKeychain(t)
+	first := newTestApprover(t, owner, "first", true, nil)
+	defer first.proto.Stop()
+	silent := newTestApprover(t, owner, "silent", true, nil)
+	defer silent.proto.Stop()
+
+	policy := &models.ApprovalPolicy{Sensitivity: models.SensitivityHigh, Required: 2, TimeoutSeconds: 1}
+	authorization, _ := testThreshold(owner, policy, false, first)
+
+	// silent approver is in policy, but its node is not reachable by dialer
+	store := authorization.store.(*testApprovalStore)
+	store.delegations = append(store.delegations, silent.delegation)
+	policy.Approvers = append(policy.Approvers, silent.delegation.ID)
+
+	_, err := authorization.Authorize(testNotification("passport"))
+	if err == nil || !strings.HasPrefix(err.Error(), ErrQuorumTimeout.Error()) {
+		t.Errorf("Authorize() returned %v, expected quorum timeout", err)
+	}
+}
+
+func TestValidateApprovalPolicy(t *testing.T) {
+	high := models.DelegationScope{MaxSensitivity: models.SensitivityHigh}
+	delegations := []models.Delegation{
+		{ID: "first", Scope: high},
+		{ID: "second", Scope: high},
+		{ID: "medium", Scope: models.DelegationScope{MaxSensitivity: models.SensitivityMedium}},
+		{ID: "items", Scope: models.DelegationScope{Items: []string{"address"}, MaxSensitivity: models.SensitivityHigh}},
+	}
+	tests := []struct {
+		policy models.ApprovalPolicy
+		valid  bool
+	}{
+		{policy: models.ApprovalPolicy{Sensitivity: models.SensitivityHigh, Required: 2, OwnerApproves: true, Approvers: []string{"first"}}, valid: true},
+		{policy: models.ApprovalPolicy{Sensitivity: models.SensitivityHigh, Required: 3, OwnerApproves: true, Approvers: []string{"first"}}, valid: false},
+		{policy: models.ApprovalPolicy{Sensitivity: models.SensitivityHigh, Required: 0, OwnerApproves: true}, valid: false},
+		{policy: models.ApprovalPolicy{Sensitivity: models.SensitivityHigh, Required: 1, Approvers: []string{"unknown"}}, valid: false},
+		{policy: models.ApprovalPolicy{Sensitivity: models.SensitivityHigh, Required: 2, Approvers: []string{"first", "first"}}, valid: false},
+		{policy: models.ApprovalPolicy{Sensitivity: "EXTREME", Required: 1, OwnerApproves: true}, valid: false},
+		{policy: models.ApprovalPolicy{Sensitivity: models.SensitivityHigh, Required: 1, Approvers: []string{"medium"}}, valid: false},
+		{policy: models.ApprovalPolicy{Sensitivity: models.SensitivityMedium, Required: 1, Approvers: []string{"medium"}}, valid: false},
+		{policy: models.ApprovalPolicy{Sensitivity: models.SensitivityLow, Required: 1, Approvers: []string{"second"}}, valid: true},
+		{policy: models.ApprovalPolicy{Sensitivity: models.SensitivityHigh, Required: 1, Approvers: []string{"items"}}, valid: false},
+	}
+
+	for i, test := range tests {
+		if err := ValidateApprovalPolicy(&test.policy, delegations); (err == nil) != test.valid {
+			t.Errorf("ValidateApprovalPolicy() test %d returned %v, expected valid: %t", i, err, test.valid)
+		}
+	}
+}
+
+func TestThresholdAuthorizationOtherOwner(t *testing.T) {
+	owner := testKeychain(t)
+	first := newTestApprover(t, owner, "first", true, nil)
+	defer first.proto.Stop()
+	foreign := newTestApprover(t, testKeychain(t), "foreign", true, nil)
+	defer foreign.proto.Stop()
+
+	policy := &models.ApprovalPolicy{Sensitivity: models.SensitivityMedium, Required: 2, TimeoutSeconds: 5}
+	authorization, _ := testThreshold(owner, policy, false, first, foreign)
+
+	approvers, err := authorization.approvers(policy, time.Now())
+	if err != nil {
+		t.Fatalf("approvers() failed: %s", err)
+	}
+
+	if len(approvers) != 1 || approvers[0].ID != first.delegation.ID {
+		t.Errorf("approvers() returned %d approvers, expected delegation of the owner only", len(approvers))
+	}
+}
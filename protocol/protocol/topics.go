@@ -1,10 +1,62 @@
 package protocol
 
-import "github.com/odysseyhack/planet-society/protocol/cryptography"
+import (
+	"sort"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+)
 
 var (
 	TopicPreTransactionRequest = cryptography.Key32{'1'}
 	TopicPreTransactionReply   = cryptography.Key32{'2'}
 	TopicTransactionRequest    = cryptography.Key32{'3'}
 	TopicTransactionReply      = cryptography.Key32{'3'}
+	TopicAccessRequest         = cryptography.Key32{'4'}
+	TopicAccessReply           = cryptography.Key32{'5'}
+	TopicErasureRequest        = cryptography.Key32{'6'}
+	TopicErasureReply          = cryptography.Key32{'7'}
+	TopicRevocationRequest     = cryptography.Key32{'8'}
+	TopicRevocationReply       = cryptography.Key32{'9'}
+	TopicDeletionAttestation   = cryptography.Key32{'a'}
+	TopicDeletionReply         = cryptography.Key32{'b'}
+	TopicConsentRequest        = cryptography.Key32{'c'}
+	TopicConsentReply          = cryptography.Key32{'d'}
 )
+
+// topicNames maps topics to names used during capability negotiation
+var topicNames = map[cryptography.Key32]string{
+	TopicPreTransactionRequest: "pre-transaction",
+	TopicTransactionRequest:    "transaction",
+	TopicAccessRequest:         "access",
+	TopicErasureRequest:        "erasure",
+	TopicRevocationRequest:     "revocation",
+	TopicDeletionAttestation:   "deletion-attestation",
+	TopicConsentRequest:        "delegated-consent",
+}
+
+// TopicName returns name of the topic used during capability negotiation
+func TopicName(topic cryptography.Key32) (string, bool) {
+	name, ok := topicNames[topic]
+	return name, ok
+}
+
+// DataSubjectReplyTopics maps data subject request topics handled by requesters to their reply topics
+var DataSubjectReplyTopics = map[cryptography.Key32]cryptography.Key32{
+	TopicAccessRequest:     TopicAccessReply,
+	TopicErasureRequest:    TopicErasureReply,
+	TopicRevocationRequest: TopicRevocationReply,
+}
+
+// handledTopics returns names of request topics with registered handlers, on responder
+// and on requester side, they are advertised during capability negotiation
+func handledTopics() []string {
+	names := []string{topicNames[TopicPreTransactionRequest]}
+	for topic := range messageHandlers {
+		names = append(names, topicNames[topic])
+	}
+	for topic := range DataSubjectReplyTopics {
+		names = append(names, topicNames[topic])
+	}
+	sort.Strings(names)
+	return names
+}
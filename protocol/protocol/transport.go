@@ -4,4 +4,5 @@ type Conn interface {
 	Read() (*Message, error)
 	Write(*Message) error
 	Close() error
+	RemoteAddr() string
 }
@@ -0,0 +1,185 @@
+package protocol
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"unicode"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+const (
+	maxRequesterNameLength = 128
+)
+
+// SanityValidator rejects pre transactions with malformed requester data
+type SanityValidator struct {
+}
+
+// NewSanityValidatorFromParams creates SanityValidator, it takes no parameters
+func NewSanityValidatorFromParams(params map[string]string) (PreTransactionValidator, error) {
+	return &SanityValidator{}, nil
+}
+
+func (s *SanityValidator) Name() string {
+	return "sanity"
+}
+
+func (s *SanityValidator) Validate(request *models.PreTransactionRequest) (*Verification, error) {
+	var empty cryptography.Key32
+
+	if request.Requester == "" || len(request.Requester) > maxRequesterNameLength {
+		return nil, fmt.Errorf("%s: requester name length %d", ErrInvalidRequesterData, len(request.Requester))
+	}
+
+	for _, r := range request.Requester {
+		if !unicode.IsPrint(r) {
+			return nil, fmt.Errorf("%s: requester name contains non printable characters", ErrInvalidRequesterData)
+		}
+	}
+
+	if request.MainPublicKey.Key.Equal(empty) || request.SignaturePublicKey.Key.Equal(empty) {
+		return nil, fmt.Errorf("%s: empty public key", ErrInvalidRequesterData)
+	}
+	return nil, nil
+}
+
+// Organisation is an entry of organisations registry
+type Organisation struct {
+	Name               string `json:"name"`
+	RegistrationNumber string `json:"registration_number"`
+	PublicKey          string `json:"public_key"`
+	SignatureKey       string `json:"signature_key,omitempty"`
+}
+
+// Registry is a list of known organisations issued by registry authority
+type Registry struct {
+	Name          string         `json:"name"`
+	Issued        string         `json:"issued"`
+	Organisations []Organisation `json:"organisations"`
+}
+
+// SignedRegistry is registry signed with registry authority signature key
+type SignedRegistry struct {
+	Signed string `json:"signed"`
+}
+
+// SignRegistry signs registry with given signer
+func SignRegistry(registry *Registry, signer *cryptography.Signer) (*SignedRegistry, error) {
+	data, err := json.Marshal(registry)
+	if err != nil {
+		return nil, err
+	}
+
+	signed, err := signer.Sign(data)
+	if err != nil {
+		return nil, err
+	}
+	return &SignedRegistry{Signed: hex.EncodeToString(signed)}, nil
+}
+
+// OpenRegistry verifies registry signature and returns registry
+func OpenRegistry(signedRegistry *SignedRegistry, authorityKey cryptography.Key32) (*Registry, error) {
+	signed, err := hex.DecodeString(signedRegistry.Signed)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := cryptography.NewSigner(cryptography.Key64{}, authorityKey).Verify(signed)
+	if err != nil {
+		return nil, ErrRegistrySignature
+	}
+
+	var registry Registry
+	if err := json.Unmarshal(data, &registry); err != nil {
+		return nil, err
+	}
+	return &registry, nil
+}
+
+// RegistryValidator verifies requesters against signed local registry of known organisations
+type RegistryValidator struct {
+	registry *Registry
+	required bool
+}
+
+// NewRegistryValidator loads signed registry from file.
+// If required is set requesters not found in registry are rejected.
+func NewRegistryValidator(path string, authorityKey cryptography.Key32, required bool) (*RegistryValidator, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var signedRegistry SignedRegistry
+	if err := json.Unmarshal(data, &signedRegistry); err != nil {
+		return nil, fmt.Errorf("registry %q: %s", path, err)
+	}
+
+	registry, err := OpenRegistry(&signedRegistry, authorityKey)
+	if err != nil {
+		return nil, fmt.Errorf("registry %q: %s", path, err)
+	}
+
+	return &RegistryValidator{registry: registry, required: required}, nil
+}
+
+// NewRegistryValidatorFromParams creates RegistryValidator using parameters:
+// "file" path to signed registry, "key" hex encoded authority signature key
+// and optional "required" which defaults to true.
+func NewRegistryValidatorFromParams(params map[string]string) (PreTransactionValidator, error) {
+	key, err := cryptography.Key32FromString(params["key"])
+	if err != nil {
+		return nil, fmt.Errorf("key: %s", err)
+	}
+
+	required := true
+	if raw, ok := params["required"]; ok {
+		if required, err = strconv.ParseBool(raw); err != nil {
+			return nil, fmt.Errorf("required: %s", err)
+		}
+	}
+	return NewRegistryValidator(params["file"], key, required)
+}
+
+func (r *RegistryValidator) Name() string {
+	return "registry"
+}
+
+// Validate confirms name of organisation registered with requester keys. Keys are
+// trusted only because Protocol verifies their possession before validators run.
+func (r *RegistryValidator) Validate(request *models.PreTransactionRequest) (*Verification, error) {
+	organisation := r.find(request.MainPublicKey.Key)
+	if organisation == nil {
+		if r.required {
+			return nil, ErrUnknownOrganisation
+		}
+		return nil, nil
+	}
+
+	if organisation.SignatureKey != "" && organisation.SignatureKey != request.SignaturePublicKey.Key.String() {
+		return nil, fmt.Errorf("signature key does not match registry entry of %q", organisation.Name)
+	}
+
+	if organisation.Name != request.Requester {
+		return nil, fmt.Errorf("requester name %q does not match registered name %q", request.Requester, organisation.Name)
+	}
+
+	return &Verification{
+		Statement: fmt.Sprintf("%s: %s (%s)", r.registry.Name, organisation.Name, organisation.RegistrationNumber),
+		Name:      organisation.Name,
+	}, nil
+}
+
+func (r *RegistryValidator) find(key cryptography.Key32) *Organisation {
+	for i := range r.registry.Organisations {
+		if r.registry.Organisations[i].PublicKey == key.String() {
+			return &r.registry.Organisations[i]
+		}
+	}
+	return nil
+}
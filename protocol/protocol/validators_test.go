@@ -0,0 +1,187 @@
+package protocol
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+func testPreTransactionRequest(t *testing.T, name string) *models.PreTransactionRequest {
+	keychain, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain failed: %s", err)
+	}
+
+	return &models.PreTransactionRequest{
+		TransactionID:      models.Key32{Key: cryptography.RandomKey32()},
+		MainPublicKey:      models.Key32{Key: keychain.MainPublicKey},
+		SignaturePublicKey: models.Key32{Key: keychain.SignaturePublicKey},
+		Requester:          name,
+	}
+}
+
+func TestSanityValidator(t *testing.T) {
+	validator := &SanityValidator{}
+
+	if _, err := validator.Validate(testPreTransactionRequest(t, "T-mobile")); err != nil {
+		t.Errorf("Validate failed: %s", err)
+	}
+
+	if _, err := validator.Validate(testPreTransactionRequest(t, "")); err == nil {
+		t.Errorf("Validate expected to fail for empty requester name")
+	}
+
+	if _, err := validator.Validate(&models.PreTransactionRequest{Requester: "T-mobile"}); err == nil {
+		t.Errorf("Validate expected to fail for empty keys")
+	}
+}
+
+func writeTestRegistry(t *testing.T, dir string, signer *cryptography.Signer, registry *Registry) string {
+	signed, err := SignRegistry(registry, signer)
+	if err != nil {
+		t.Fatalf("SignRegistry failed: %s", err)
+	}
+
+	data, err := json.Marshal(signed)
+	if err != nil {
+		t.Fatalf("Marshal failed: %s", err)
+	}
+
+	path := filepath.Join(dir, "registry.json")
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("WriteFile failed: %s", err)
+	}
+	return path
+}
+
+func TestRegistryValidator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	if err != nil {
+		t.Fatalf("failed to create temporary dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	authority, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain failed: %s", err)
+	}
+	signer := cryptography.NewSigner(authority.SignaturePrivateKey, authority.SignaturePublicKey)
+
+	known := testPreTransactionRequest(t, "T-mobile")
+	path := writeTestRegistry(t, dir, signer, &Registry{
+		Name: "kvk",
+		Organisations: []Organisation{
+			{Name: "T-mobile", RegistrationNumber: "27291981", PublicKey: known.MainPublicKey.Key.String()},
+		},
+	})
+
+	validator, err := NewRegistryValidator(path, authority.SignaturePublicKey, true)
+	if err != nil {
+		t.Fatalf("NewRegistryValidator failed: %s", err)
+	}
+
+	verification, err := validator.Validate(known)
+	if err != nil {
+		t.Fatalf("Validate failed: %s", err)
+	}
+
+	if verification == nil || verification.Statement != "kvk: T-mobile (27291981)" || verification.Name != "T-mobile" {
+		t.Errorf("Validate returned %+v", verification)
+	}
+
+	if _, err := validator.Validate(testPreTransactionRequest(t, "T-mobile")); err != ErrUnknownOrganisation {
+		t.Errorf("Validate returned %v for unknown organisation, expected %q", err, ErrUnknownOrganisation)
+	}
+
+	known.Requester = "John Smith"
+	if _, err := validator.Validate(known); err == nil {
+		t.Errorf("Validate expected to fail for mismatching requester name")
+	}
+}
+
+func TestRegistryValidatorInvalidSignature(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	if err != nil {
+		t.Fatalf("failed to create temporary dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	authority, err := cryptography.GenerateSigner()
+	if err != nil {
+		t.Fatalf("GenerateSigner failed: %s", err)
+	}
+
+	path := writeTestRegistry(t, dir, authority, &Registry{Name: "kvk"})
+
+	if _, err := NewRegistryValidator(path, cryptography.RandomKey32(), true); err == nil {
+		t.Errorf("NewRegistryValidator expected to fail for registry signed by other key")
+	}
+}
+
+func TestRegistryValidatorSpoofedKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	if err != nil {
+		t.Fatalf("failed to create temporary dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	authority := testKeychain(t)
+	organisation := testKeychain(t)
+	attacker := testKeychain(t)
+	responder := testKeychain(t)
+
+	path := writeTestRegistry(t, dir, cryptography.NewSigner(authority.SignaturePrivateKey, authority.SignaturePublicKey), &Registry{
+		Name: "kvk",
+		Organisations: []Organisation{
+			{Name: "T-mobile", RegistrationNumber: "27291981", PublicKey: organisation.MainPublicKey.String()},
+		},
+	})
+
+	validator, err := NewRegistryValidator(path, authority.SignaturePublicKey, true)
+	if err != nil {
+		t.Fatalf("NewRegistryValidator failed: %s", err)
+	}
+
+	proto := NewProtocol(nil)
+	proto.RegisterPreTransactionValidator(validator)
+	proto.SetKeychain(responder)
+
+	// attacker claims registered main key, with own or registered signature key
+	spoofed := provenRequest(t, organisation, attacker, responder.MainPublicKey, nil)
+	spoofed.Requester = "T-mobile"
+	ownSignatureKey := testRequest(organisation, nil)
+	ownSignatureKey.SignaturePublicKey = models.Key32{Key: attacker.SignaturePublicKey}
+	ownSignatureKey.Requester = "T-mobile"
+	ownSignatureKey.Capabilities = DefaultCapabilities()
+	if err := ProvePossession(ownSignatureKey, attacker, responder.MainPublicKey); err != nil {
+		t.Fatalf("ProvePossession failed: %s", err)
+	}
+
+	for _, request := range []*models.PreTransactionRequest{spoofed, ownSignatureKey} {
+		reply := preTransact(t, proto, request, organisation.MainPublicKey)
+		if reply.Success || reply.Error == nil || !strings.HasPrefix(*reply.Error, ErrPossessionProof.Error()) {
+			t.Errorf("spoofed registry keys returned %+v", reply)
+		}
+	}
+
+	registered := testRequest(organisation, nil)
+	registered.Requester = "T-mobile"
+	registered.Capabilities = DefaultCapabilities()
+	if err := ProvePossession(registered, organisation, responder.MainPublicKey); err != nil {
+		t.Fatalf("ProvePossession failed: %s", err)
+	}
+
+	if reply := preTransact(t, proto, registered, organisation.MainPublicKey); !reply.Success {
+		t.Fatalf("registered organisation returned %+v", reply)
+	}
+
+	if entry, ok := proto.TransactionQueue.Get(registered.TransactionID.Key); !ok || !entry.RequesterVerified || entry.RequesterName != "T-mobile" {
+		t.Errorf("queue contains %+v", entry)
+	}
+}
@@ -0,0 +1,116 @@
+package protocol
+
+import (
+	"fmt"
+
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+// Protocol versions known to this implementation
+const (
+	Version1 = 1
+	// Version2 requires pre transaction request proving possession of requester keys
+	// and transaction request signed by requester, see ProvePossession
+	Version2 = 2
+)
+
+const (
+	// EncryptionNone means payloads are sent as they are
+	EncryptionNone = "none"
+
+	// EncryptionBox means transaction content is boxed to requester main key, see EncryptContent
+	EncryptionBox = "box"
+
+	// EncodingGob means payloads are encoded with encoding/gob
+	EncodingGob = "gob"
+)
+
+// Agreement is a result of capability negotiation between peers
+type Agreement struct {
+	Version    int
+	Encryption string
+	Encoding   string
+	Topics     []string
+}
+
+// SupportsTopic returns true if topic was agreed during negotiation
+func (a *Agreement) SupportsTopic(name string) bool {
+	return contains(a.Topics, name)
+}
+
+// DefaultCapabilities returns capabilities supported by this implementation.
+// Lists are ordered by preference, most preferred first. Version1 is not supported,
+// its requesters do not prove possession of their keys.
+func DefaultCapabilities() models.Capabilities {
+	return models.Capabilities{
+		Versions:   []int{Version2},
+		Topics:     handledTopics(),
+		Encryption: []string{EncryptionBox, EncryptionNone},
+		Encodings:  []string{EncodingGob},
+	}
+}
+
+// Negotiate picks the highest common version and the most preferred
+// local encryption and encoding supported by remote side.
+// Both sides must support pre transaction and transaction topics.
+func Negotiate(local, remote *models.Capabilities) (*Agreement, error) {
+	agreement := &Agreement{}
+	for _, version := range local.Versions {
+		if version > agreement.Version && containsInt(remote.Versions, version) {
+			agreement.Version = version
+		}
+	}
+	if agreement.Version == 0 {
+		return nil, fmt.Errorf("%s: local %v, remote %v", ErrNoCommonVersion, local.Versions, remote.Versions)
+	}
+
+	agreement.Encryption = firstCommon(local.Encryption, remote.Encryption)
+	if agreement.Encryption == "" {
+		return nil, fmt.Errorf("%s: local %v, remote %v", ErrNoCommonEncryption, local.Encryption, remote.Encryption)
+	}
+
+	agreement.Encoding = firstCommon(local.Encodings, remote.Encodings)
+	if agreement.Encoding == "" {
+		return nil, fmt.Errorf("%s: local %v, remote %v", ErrNoCommonEncoding, local.Encodings, remote.Encodings)
+	}
+
+	for _, topic := range local.Topics {
+		if contains(remote.Topics, topic) {
+			agreement.Topics = append(agreement.Topics, topic)
+		}
+	}
+
+	for _, required := range []string{topicNames[TopicPreTransactionRequest], topicNames[TopicTransactionRequest]} {
+		if !agreement.SupportsTopic(required) {
+			return nil, fmt.Errorf("%s: %q", ErrTopicNotSupported, required)
+		}
+	}
+	return agreement, nil
+}
+
+func firstCommon(local, remote []string) string {
+	for _, item := range local {
+		if contains(remote, item) {
+			return item
+		}
+	}
+	return ""
+}
+
+func contains(list []string, item string) bool {
+	for i := range list {
+		if list[i] == item {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(list []int, item int) bool {
+	for i := range list {
+		if list[i] == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package protocol
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+)
+
+func TestNegotiateDefault(t *testing.T) {
+	local := DefaultCapabilities()
+	remote := DefaultCapabilities()
+
+	agreement, err := Negotiate(&local, &remote)
+	if err != nil {
+		t.Fatalf("Negotiate failed: %s", err)
+	}
+
+	if agreement.Version != Version2 {
+		t.Errorf("Negotiate picked version %d, expected %d", agreement.Version, Version2)
+	}
+
+	if agreement.Encoding != EncodingGob || agreement.Encryption != EncryptionBox {
+		t.Errorf("Negotiate picked unexpected features: %+v", agreement)
+	}
+}
+
+func TestNegotiateHighestCommonVersion(t *testing.T) {
+	local := DefaultCapabilities()
+	local.Versions = []int{1, 2, 3}
+	remote := DefaultCapabilities()
+	remote.Versions = []int{4, 2, 1}
+
+	agreement, err := Negotiate(&local, &remote)
+	if err != nil {
+		t.Fatalf("Negotiate failed: %s", err)
+	}
+
+	if agreement.Version != 2 {
+		t.Errorf("Negotiate picked version %d, expected 2", agreement.Version)
+	}
+}
+
+func TestNegotiateMismatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *models.Capabilities)
+		err    error
+	}{
+		{name: "version", modify: func(c *models.Capabilities) { c.Versions = []int{99} }, err: ErrNoCommonVersion},
+		{name: "old peer", modify: func(c *models.Capabilities) { *c = models.Capabilities{} }, err: ErrNoCommonVersion},
+		{name: "version 1 peer", modify: func(c *models.Capabilities) { c.Versions, c.Encryption = []int{Version1}, []string{EncryptionNone} }, err: ErrNoCommonVersion},
+		{name: "encryption", modify: func(c *models.Capabilities) { c.Encryption = []string{"unknown"} }, err: ErrNoCommonEncryption},
+		{name: "encoding", modify: func(c *models.Capabilities) { c.Encodings = []string{"json"} }, err: ErrNoCommonEncoding},
+		{name: "topic", modify: func(c *models.Capabilities) { c.Topics = c.Topics[:1] }, err: ErrTopicNotSupported},
+	}
+
+	for _, test := range tests {
+		local := DefaultCapabilities()
+		remote := DefaultCapabilities()
+		test.modify(&remote)
+
+		_, err := Negotiate(&local, &remote)
+		if err == nil {
+			t.Errorf("%s: Negotiate expected to fail", test.name)
+			continue
+		}
+
+		if !strings.HasPrefix(err.Error(), test.err.Error()) {
+			t.Errorf("%s: Negotiate returned %q, expected %q", test.name, err, test.err)
+		}
+	}
+}
+
+func TestNegotiateEncryptionNone(t *testing.T) {
+	local := DefaultCapabilities()
+	remote := DefaultCapabilities()
+	remote.Encryption = []string{EncryptionNone}
+
+	agreement, err := Negotiate(&local, &remote)
+	if err != nil {
+		t.Fatalf("Negotiate failed: %s", err)
+	}
+
+	if agreement.Encryption != EncryptionNone {
+		t.Errorf("Negotiate picked encryption %q, expected %q", agreement.Encryption, EncryptionNone)
+	}
+}
+
+func TestDefaultCapabilitiesTopics(t *testing.T) {
+	local := DefaultCapabilities()
+	remote := DefaultCapabilities()
+	agreement, err := Negotiate(&local, &remote)
+	if err != nil {
+		t.Fatalf("Negotiate failed: %s", err)
+	}
+
+	handled := []cryptography.Key32{TopicPreTransactionRequest}
+	for topic := range messageHandlers {
+		handled = append(handled, topic)
+	}
+	for topic := range DataSubjectReplyTopics {
+		handled = append(handled, topic)
+	}
+
+	for _, topic := range handled {
+		name, ok := TopicName(topic)
+		if !ok || !agreement.SupportsTopic(name) {
+			t.Errorf("handled topic %q is not advertised: %v", name, local.Topics)
+		}
+	}
+
+	for _, name := range []string{"access", "erasure", "revocation", "deletion-attestation", "delegated-consent"} {
+		if !agreement.SupportsTopic(name) {
+			t.Errorf("topic %q is not advertised: %v", name, local.Topics)
+		}
+	}
+}
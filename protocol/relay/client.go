@@ -0,0 +1,248 @@
+package relay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+)
+
+const (
+	clientRetries = 3
+	clientBackoff = time.Millisecond * 500
+)
+
+// Client talks to notification server, failed requests are retried
+// with growing delay when server is unreachable or fails
+type Client struct {
+	url    string
+	client *http.Client
+	// stream is used by requests which wait for messages
+	stream  *http.Client
+	retries int
+	backoff time.Duration
+}
+
+// NewClient creates client of notification server at url
+func NewClient(url string) *Client {
+	return &Client{
+		url:     url,
+		client:  &http.Client{Timeout: time.Second * 15},
+		stream:  &http.Client{},
+		retries: clientRetries,
+		backoff: clientBackoff,
+	}
+}
+
+// ServerKey returns box key of notification server registrations are proven to
+func (c *Client) ServerKey() (key cryptography.Key32, err error) {
+	var result ServerKey
+	if err := c.call(http.MethodGet, "/server-key", nil, "", nil, &result); err != nil {
+		return key, err
+	}
+	return cryptography.Key32FromString(result.PublicKey)
+}
+
+// Register registers device mailbox and returns device token
+func (c *Client) Register(registration *Registration) (string, error) {
+	data, err := json.Marshal(registration)
+	if err != nil {
+		return "", err
+	}
+
+	var result RegistrationResult
+	if err := c.call(http.MethodPost, "/device-register", nil, "", data, &result); err != nil {
+		return "", err
+	}
+	return result.Token, nil
+}
+
+// Notifications returns notifications waiting in device mailbox
+func (c *Client) Notifications(token string) (messages []Message, err error) {
+	return messages, c.call(http.MethodGet, "/notification-get", nil, token, nil, &messages)
+}
+
+// Reply puts device reply to notification of transaction
+func (c *Client) Reply(token, transactionID string, payload []byte) error {
+	query := url.Values{"transaction": {transactionID}}
+	return c.call(http.MethodPost, "/reply-put", query, token, payload, nil)
+}
+
+// Put puts notification of transaction to device mailbox and returns token of reply
+func (c *Client) Put(device cryptography.Key32, transactionID string, payload []byte) (string, error) {
+	query := url.Values{"device": {device.String()}, "transaction": {transactionID}}
+
+	var result PutResult
+	if err := c.call(http.MethodPost, "/notification-put", query, "", payload, &result); err != nil {
+		return "", err
+	}
+	return result.ReplyToken, nil
+}
+
+// ReplyGet returns device reply to notification of transaction, ErrNoReply is
+// returned when device did not reply yet
+func (c *Client) ReplyGet(device cryptography.Key32, transactionID, replyToken string) ([]byte, error) {
+	query := url.Values{"device": {device.String()}, "transaction": {transactionID}}
+
+	var payload []byte
+	if err := c.call(http.MethodGet, "/reply-get", query, replyToken, nil, &payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// NotificationsSince waits up to wait for notifications put to device mailbox after cursor
+func (c *Client) NotificationsSince(token string, cursor uint64, wait time.Duration) (messages []Message, err error) {
+	query := url.Values{"cursor": {strconv.FormatUint(cursor, 10)}, "wait": {waitSeconds(wait)}}
+	return messages, c.callWith(c.stream, http.MethodGet, "/notification-get", query, token, nil, &messages)
+}
+
+// ReplyWait waits up to wait for device reply to notification of transaction,
+// ErrNoReply is returned when device did not reply before wait passed
+func (c *Client) ReplyWait(device cryptography.Key32, transactionID, replyToken string, wait time.Duration) ([]byte, error) {
+	query := url.Values{"device": {device.String()}, "transaction": {transactionID}, "wait": {waitSeconds(wait)}}
+
+	var payload []byte
+	if err := c.callWith(c.stream, http.MethodGet, "/reply-get", query, replyToken, nil, &payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// StreamNotifications passes notifications put to device mailbox after cursor to handle
+// until stream is closed or handle fails. It returns cursor of last handled notification
+// which resumes stream after reconnect.
+func (c *Client) StreamNotifications(token string, cursor uint64, handle func(message *Message) error) (uint64, error) {
+	query := url.Values{"cursor": {strconv.FormatUint(cursor, 10)}}
+	resp, err := c.do(c.stream, http.MethodGet, "/notification-stream", query, token, nil)
+	if err != nil {
+		return cursor, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := ioutil.ReadAll(resp.Body)
+		return cursor, statusError(resp.StatusCode, data)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+
+		var message Message
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &message); err != nil {
+			return cursor, err
+		}
+
+		if err := handle(&message); err != nil {
+			return cursor, err
+		}
+		cursor = message.Cursor
+	}
+	return cursor, scanner.Err()
+}
+
+// call sends request and decodes JSON response into result, raw payloads
+// are returned when result is *[]byte
+func (c *Client) call(method, path string, query url.Values, token string, body []byte, result interface{}) error {
+	return c.callWith(c.client, method, path, query, token, body, result)
+}
+
+// callWith is call using given HTTP client
+func (c *Client) callWith(client *http.Client, method, path string, query url.Values, token string, body []byte, result interface{}) error {
+	resp, err := c.do(client, method, path, query, token, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if err := statusError(resp.StatusCode, data); err != nil {
+		return err
+	}
+
+	switch result := result.(type) {
+	case nil:
+		return nil
+	case *[]byte:
+		*result = data
+		return nil
+	default:
+		return json.Unmarshal(data, result)
+	}
+}
+
+func (c *Client) do(client *http.Client, method, path string, query url.Values, token string, body []byte) (resp *http.Response, err error) {
+	target := c.url + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		var rq *http.Request
+		if rq, err = http.NewRequest(method, target, bytes.NewReader(body)); err != nil {
+			return nil, err
+		}
+		if token != "" {
+			rq.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err = client.Do(rq)
+		if err == nil && resp.StatusCode < http.StatusInternalServerError {
+			return resp, nil
+		}
+
+		if attempt == c.retries {
+			break
+		}
+		if err == nil {
+			resp.Body.Close()
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// waitSeconds rounds wait up to whole seconds
+func waitSeconds(wait time.Duration) string {
+	return strconv.Itoa(int((wait + time.Second - 1) / time.Second))
+}
+
+// statusError maps failed response to error, server sends text of relay errors in body
+func statusError(status int, body []byte) error {
+	switch status {
+	case http.StatusOK, http.StatusAccepted:
+		return nil
+	case http.StatusNoContent:
+		return ErrNoReply
+	}
+
+	message := strings.TrimSpace(string(body))
+	for _, known := range knownErrors {
+		if strings.HasPrefix(message, known.Error()) {
+			return known
+		}
+	}
+	return fmt.Errorf("notification server returned %d: %s", status, message)
+}
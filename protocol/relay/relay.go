@@ -0,0 +1,152 @@
+// Package relay defines messages exchanged with notification server and clients
+// used by responders and devices. Notification server keeps mailbox per device
+// keyed by device public key, payloads are correlated by transaction ID.
+// Payloads are sealed end to end, server routes them without reading.
+package relay
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/protocol"
+)
+
+// RegistrationWindow is how long registration stays valid after it is created
+const RegistrationWindow = time.Minute * 5
+
+var (
+	ErrInvalidRegistration = errors.New("invalid device registration")
+	ErrRegistrationExpired = errors.New("device registration expired")
+	ErrKeyTaken            = errors.New("mailbox registered with other signature key")
+	ErrUnauthorized        = errors.New("relay request not authorized")
+	ErrNoReply             = errors.New("no reply yet")
+	ErrUnknownDevice       = errors.New("device not registered")
+	ErrUnknownTransaction  = errors.New("no notification for transaction")
+	ErrTransactionPending  = errors.New("notification for transaction is pending")
+)
+
+// knownErrors are errors server reports to clients
+var knownErrors = []error{
+	ErrInvalidRegistration,
+	ErrRegistrationExpired,
+	ErrKeyTaken,
+	ErrUnauthorized,
+	ErrUnknownDevice,
+	ErrUnknownTransaction,
+	ErrTransactionPending,
+}
+
+// Registration proves that device holds box and signature keys of its mailbox
+type Registration struct {
+	// PublicKey is hex encoded box key of device, it addresses the mailbox
+	PublicKey    string `json:"public_key"`
+	SignatureKey string `json:"signature_key"`
+	Created      string `json:"created"`
+	Signature    string `json:"signature"`
+	// Proof is signature boxed from PublicKey to the server, hex encoded
+	Proof string `json:"proof"`
+}
+
+// ServerKey carries box key of notification server, registrations are proven to it
+type ServerKey struct {
+	PublicKey string `json:"public_key"`
+}
+
+// RegistrationResult carries token device uses to access its mailbox
+type RegistrationResult struct {
+	Token string `json:"token"`
+}
+
+// PutResult carries token responder uses to read reply to notification
+type PutResult struct {
+	ReplyToken string `json:"reply_token"`
+}
+
+// Message is notification or reply stored in mailbox
+type Message struct {
+	// Cursor orders notifications of mailbox, requests given cursor
+	// return only notifications put after it
+	Cursor        uint64 `json:"cursor,omitempty"`
+	TransactionID string `json:"transaction_id"`
+	Payload       []byte `json:"payload"`
+	Created       string `json:"created"`
+}
+
+// NewRegistration creates registration of keychain keys signed with keychain,
+// signature is boxed to server key to prove possession of box key
+func NewRegistration(keychain *cryptography.Keychain, server cryptography.Key32, now time.Time) (*Registration, error) {
+	registration := &Registration{
+		PublicKey:    keychain.MainPublicKey.String(),
+		SignatureKey: keychain.SignaturePublicKey.String(),
+		Created:      now.UTC().Format(time.RFC3339),
+	}
+
+	data, err := signedRegistrationData(registration)
+	if err != nil {
+		return nil, err
+	}
+
+	if registration.Signature, err = protocol.SignDetached(data, keychain); err != nil {
+		return nil, err
+	}
+
+	proof, err := cryptography.BoxEncrypt([]byte(registration.Signature), &server, &keychain.MainPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	registration.Proof = hex.EncodeToString(proof)
+	return registration, nil
+}
+
+// VerifyRegistration checks registration signature, proof boxed to server keychain and freshness,
+// it returns mailbox and signature keys
+func VerifyRegistration(registration *Registration, server *cryptography.Keychain, now time.Time) (publicKey, signatureKey cryptography.Key32, err error) {
+	if publicKey, err = cryptography.Key32FromString(registration.PublicKey); err != nil {
+		return publicKey, signatureKey, fmt.Errorf("%s: public key: %s", ErrInvalidRegistration, err)
+	}
+
+	if signatureKey, err = cryptography.Key32FromString(registration.SignatureKey); err != nil {
+		return publicKey, signatureKey, fmt.Errorf("%s: signature key: %s", ErrInvalidRegistration, err)
+	}
+
+	created, err := time.Parse(time.RFC3339, registration.Created)
+	if err != nil {
+		return publicKey, signatureKey, fmt.Errorf("%s: created: %s", ErrInvalidRegistration, err)
+	}
+
+	if now.Sub(created) > RegistrationWindow || created.Sub(now) > RegistrationWindow {
+		return publicKey, signatureKey, fmt.Errorf("%s: created %s", ErrRegistrationExpired, registration.Created)
+	}
+
+	data, err := signedRegistrationData(registration)
+	if err != nil {
+		return publicKey, signatureKey, err
+	}
+
+	if err := protocol.VerifyDetached(data, registration.Signature, signatureKey); err != nil {
+		return publicKey, signatureKey, fmt.Errorf("%s: %s", ErrInvalidRegistration, err)
+	}
+
+	// anyone knows box key of device, only device can box its signature with it
+	proof, err := hex.DecodeString(registration.Proof)
+	if err != nil || len(proof) < 24 {
+		return publicKey, signatureKey, fmt.Errorf("%s: malformed proof", ErrInvalidRegistration)
+	}
+
+	signature, err := cryptography.BoxDecrypt(proof, &server.MainPrivateKey, &publicKey)
+	if err != nil || string(signature) != registration.Signature {
+		return publicKey, signatureKey, fmt.Errorf("%s: box key not proven", ErrInvalidRegistration)
+	}
+	return publicKey, signatureKey, nil
+}
+
+func signedRegistrationData(registration *Registration) ([]byte, error) {
+	unsigned := *registration
+	unsigned.Signature = ""
+	unsigned.Proof = ""
+	return json.Marshal(&unsigned)
+}
@@ -0,0 +1,108 @@
+package relay
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/protocol"
+)
+
+func TestRegistration(t *testing.T) {
+	keychain, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+
+	server, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+
+	now := time.Now()
+	registration, err := NewRegistration(keychain, server.MainPublicKey, now)
+	if err != nil {
+		t.Fatalf("NewRegistration() failed: %s", err)
+	}
+
+	publicKey, signatureKey, err := VerifyRegistration(registration, server, now)
+	if err != nil {
+		t.Fatalf("VerifyRegistration() failed: %s", err)
+	}
+
+	if !publicKey.Equal(keychain.MainPublicKey) || !signatureKey.Equal(keychain.SignaturePublicKey) {
+		t.Errorf("VerifyRegistration() returned %x %x", publicKey, signatureKey)
+	}
+
+	if _, _, err := VerifyRegistration(registration, server, now.Add(RegistrationWindow*2)); err == nil ||
+		!strings.HasPrefix(err.Error(), ErrRegistrationExpired.Error()) {
+		t.Errorf("VerifyRegistration() of old registration returned %v", err)
+	}
+
+	other, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+
+	// signature key alone does not prove box key of the mailbox
+	claimed, err := NewRegistration(other, server.MainPublicKey, now)
+	if err != nil {
+		t.Fatalf("NewRegistration() failed: %s", err)
+	}
+	claimed.PublicKey = keychain.MainPublicKey.String()
+	data, err := signedRegistrationData(claimed)
+	if err != nil {
+		t.Fatalf("signedRegistrationData() failed: %s", err)
+	}
+	if claimed.Signature, err = protocol.SignDetached(data, other); err != nil {
+		t.Fatalf("SignDetached() failed: %s", err)
+	}
+	if _, _, err := VerifyRegistration(claimed, server, now); err == nil ||
+		!strings.HasPrefix(err.Error(), ErrInvalidRegistration.Error()) {
+		t.Errorf("VerifyRegistration() without proof of box key returned %v", err)
+	}
+
+	if _, _, err := VerifyRegistration(registration, other, now); err == nil ||
+		!strings.HasPrefix(err.Error(), ErrInvalidRegistration.Error()) {
+		t.Errorf("VerifyRegistration() by other server returned %v", err)
+	}
+
+	registration.PublicKey = other.MainPublicKey.String()
+	if _, _, err := VerifyRegistration(registration, server, now); err == nil ||
+		!strings.HasPrefix(err.Error(), ErrInvalidRegistration.Error()) {
+		t.Errorf("VerifyRegistration() of tampered registration returned %v", err)
+	}
+}
+
+func TestClientRetry(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"reply_token":"token"}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	client.backoff = time.Millisecond
+
+	token, err := client.Put(cryptography.RandomKey32(), "transaction", []byte("payload"))
+	if err != nil || token != "token" {
+		t.Errorf("Put() returned %q %v", token, err)
+	}
+
+	if calls != 3 {
+		t.Errorf("server called %d times, expected 3", calls)
+	}
+
+	calls = -10
+	if _, err := client.Put(cryptography.RandomKey32(), "transaction", nil); err == nil {
+		t.Errorf("Put() succeeded although server kept failing")
+	}
+}
@@ -0,0 +1,108 @@
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+	"github.com/odysseyhack/planet-society/protocol/protocol"
+)
+
+var (
+	ErrSealed           = errors.New("sealed payload cannot be opened")
+	ErrUnexpectedSender = errors.New("payload sealed by unexpected sender")
+)
+
+// Sealed is payload encrypted with cryptography.Box, notification server
+// routes it without being able to read it
+type Sealed struct {
+	// Sender is hex encoded box public key of sender
+	Sender string `json:"sender"`
+	Box    []byte `json:"box"`
+}
+
+// SealNotification encrypts notification from responder to device
+func SealNotification(notification *models.PermissionNotificationRequest, responder *cryptography.Keychain, device cryptography.Key32) ([]byte, error) {
+	data, err := json.Marshal(notification)
+	if err != nil {
+		return nil, err
+	}
+	return seal(data, responder, device)
+}
+
+// OpenNotification decrypts notification sealed to device, it returns notification and responder key
+func OpenNotification(payload []byte, device *cryptography.Keychain) (*models.PermissionNotificationRequest, cryptography.Key32, error) {
+	data, responder, err := open(payload, device)
+	if err != nil {
+		return nil, responder, err
+	}
+
+	var notification models.PermissionNotificationRequest
+	if err := json.Unmarshal(data, &notification); err != nil {
+		return nil, responder, fmt.Errorf("%s: %s", ErrSealed, err)
+	}
+	return &notification, responder, nil
+}
+
+// SealReply signs response with device keychain and encrypts it to responder
+func SealReply(response *models.PermissionNotificationResponse, device *cryptography.Keychain, responder cryptography.Key32) ([]byte, error) {
+	decision, err := protocol.SignDecision(response, device)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(decision)
+	if err != nil {
+		return nil, err
+	}
+	return seal(data, device, responder)
+}
+
+// OpenReply decrypts reply sealed to responder and verifies it was signed by paired device
+func OpenReply(payload []byte, responder *cryptography.Keychain, devices protocol.DeviceStore) (*models.PermissionNotificationResponse, error) {
+	data, sender, err := open(payload, responder)
+	if err != nil {
+		return nil, err
+	}
+
+	var decision protocol.SignedDecision
+	if err := json.Unmarshal(data, &decision); err != nil {
+		return nil, fmt.Errorf("%s: %s", ErrSealed, err)
+	}
+
+	if sender.String() != decision.Device {
+		return nil, fmt.Errorf("%s: %s", ErrUnexpectedSender, sender.String())
+	}
+	return protocol.VerifyDecision(&decision, devices)
+}
+
+func seal(data []byte, sender *cryptography.Keychain, recipient cryptography.Key32) ([]byte, error) {
+	encrypted, err := cryptography.BoxEncrypt(data, &recipient, &sender.MainPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&Sealed{Sender: sender.MainPublicKey.String(), Box: encrypted})
+}
+
+func open(payload []byte, recipient *cryptography.Keychain) (data []byte, sender cryptography.Key32, err error) {
+	var sealed Sealed
+	if err := json.Unmarshal(payload, &sealed); err != nil {
+		return nil, sender, fmt.Errorf("%s: %s", ErrSealed, err)
+	}
+
+	if sender, err = cryptography.Key32FromString(sealed.Sender); err != nil {
+		return nil, sender, fmt.Errorf("%s: sender: %s", ErrSealed, err)
+	}
+
+	// nonce is prepended to box
+	if len(sealed.Box) < 24 {
+		return nil, sender, fmt.Errorf("%s: box too short", ErrSealed)
+	}
+
+	if data, err = cryptography.BoxDecrypt(sealed.Box, &recipient.MainPrivateKey, &sender); err != nil {
+		return nil, sender, fmt.Errorf("%s: %s", ErrSealed, err)
+	}
+	return data, sender, nil
+}
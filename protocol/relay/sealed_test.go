@@ -0,0 +1,149 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+	"github.com/odysseyhack/planet-society/protocol/protocol"
+)
+
+func testKeychains(t *testing.T, count int) (keychains []*cryptography.Keychain) {
+	for i := 0; i < count; i++ {
+		keychain, err := cryptography.OneShotKeychain()
+		if err != nil {
+			t.Fatalf("OneShotKeychain() failed: %s", err)
+		}
+		keychains = append(keychains, keychain)
+	}
+	return keychains
+}
+
+func TestSealNotification(t *testing.T) {
+	keychains := testKeychains(t, 3)
+	responder, device, other := keychains[0], keychains[1], keychains[2]
+
+	notification := &models.PermissionNotificationRequest{TransactionID: "transaction", Description: "passport"}
+	payload, err := SealNotification(notification, responder, device.MainPublicKey)
+	if err != nil {
+		t.Fatalf("SealNotification() failed: %s", err)
+	}
+
+	if strings.Contains(string(payload), "passport") {
+		t.Errorf("sealed payload contains plaintext: %s", payload)
+	}
+
+	opened, sender, err := OpenNotification(payload, device)
+	if err != nil {
+		t.Fatalf("OpenNotification() failed: %s", err)
+	}
+
+	if opened.Description != "passport" || !sender.Equal(responder.MainPublicKey) {
+		t.Errorf("OpenNotification() returned %+v from %x", opened, sender)
+	}
+
+	if _, _, err := OpenNotification(payload, other); err == nil || !strings.HasPrefix(err.Error(), ErrSealed.Error()) {
+		t.Errorf("OpenNotification() by other device returned %v", err)
+	}
+}
+
+// testDevices is in-memory protocol.DeviceStore
+type testDevices map[string]models.Device
+
+func (t testDevices) DevicePut(device *models.Device) error {
+	t[device.ID] = *device
+	return nil
+}
+
+func (t testDevices) Device(id string) (models.Device, error) {
+	device, ok := t[id]
+	if !ok {
+		return device, fmt.Errorf("device %s not found", id)
+	}
+	return device, nil
+}
+
+func (t testDevices) DeviceList() (devices []models.Device, err error) {
+	for _, device := range t {
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+func pairedDevice(keychain *cryptography.Keychain) *models.Device {
+	return &models.Device{
+		ID:           keychain.MainPublicKey.String(),
+		PublicKey:    models.Key32{Key: keychain.MainPublicKey},
+		SignatureKey: models.Key32{Key: keychain.SignaturePublicKey},
+	}
+}
+
+func TestSealReply(t *testing.T) {
+	keychains := testKeychains(t, 3)
+	responder, device, other := keychains[0], keychains[1], keychains[2]
+	devices := testDevices{}
+	devices.DevicePut(pairedDevice(device))
+
+	response := &models.PermissionNotificationResponse{TransactionID: "transaction", Accepted: true}
+	payload, err := SealReply(response, device, responder.MainPublicKey)
+	if err != nil {
+		t.Fatalf("SealReply() failed: %s", err)
+	}
+
+	opened, err := OpenReply(payload, responder, devices)
+	if err != nil {
+		t.Fatalf("OpenReply() failed: %s", err)
+	}
+
+	if opened.TransactionID != "transaction" || !opened.Accepted {
+		t.Errorf("OpenReply() returned %+v", opened)
+	}
+
+	forged, err := SealReply(response, other, responder.MainPublicKey)
+	if err != nil {
+		t.Fatalf("SealReply() failed: %s", err)
+	}
+	if _, err := OpenReply(forged, responder, devices); err == nil || !strings.HasPrefix(err.Error(), protocol.ErrUnknownDevice.Error()) {
+		t.Errorf("OpenReply() of unpaired device reply returned %v", err)
+	}
+
+	// reply signed with key other than paired signature key
+	impostor := *other
+	impostor.MainPublicKey, impostor.MainPrivateKey = device.MainPublicKey, device.MainPrivateKey
+	forged, err = SealReply(response, &impostor, responder.MainPublicKey)
+	if err != nil {
+		t.Fatalf("SealReply() failed: %s", err)
+	}
+	if _, err := OpenReply(forged, responder, devices); err == nil || !strings.HasPrefix(err.Error(), protocol.ErrDecisionSignature.Error()) {
+		t.Errorf("OpenReply() of reply with invalid signature returned %v", err)
+	}
+
+	// decision of paired device sealed by other device
+	decision, err := protocol.SignDecision(response, device)
+	if err != nil {
+		t.Fatalf("SignDecision() failed: %s", err)
+	}
+	data, _ := json.Marshal(decision)
+	if forged, err = seal(data, other, responder.MainPublicKey); err != nil {
+		t.Fatalf("seal() failed: %s", err)
+	}
+	if _, err := OpenReply(forged, responder, devices); err == nil || !strings.HasPrefix(err.Error(), ErrUnexpectedSender.Error()) {
+		t.Errorf("OpenReply() of reply sealed by other device returned %v", err)
+	}
+
+	revoked := "2019-04-01T00:00:00Z"
+	paired := pairedDevice(device)
+	paired.RevokedAt = &revoked
+	devices.DevicePut(paired)
+	if _, err := OpenReply(payload, responder, devices); err == nil || !strings.HasPrefix(err.Error(), protocol.ErrDeviceRevoked.Error()) {
+		t.Errorf("OpenReply() of revoked device reply returned %v", err)
+	}
+
+	if _, err := OpenReply([]byte(`{"sender":"`+device.MainPublicKey.String()+`","box":"AAAA"}`), responder, devices); err == nil ||
+		!strings.HasPrefix(err.Error(), ErrSealed.Error()) {
+		t.Errorf("OpenReply() of short box returned %v", err)
+	}
+}
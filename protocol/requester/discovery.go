@@ -0,0 +1,180 @@
+package requester
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/protocol"
+)
+
+// maxDiscoverySize limits size of fetched discovery document
+const maxDiscoverySize = 64 * 1024
+
+var (
+	ErrPinMismatch      = errors.New("responder keys differ from keys pinned on first use")
+	ErrLoopbackEndpoint = errors.New("remote responder published loopback endpoint")
+)
+
+// Pin is responder keys trusted on first use
+type Pin struct {
+	PublicKey    string `json:"public_key"`
+	SignatureKey string `json:"signature_key"`
+	Pinned       string `json:"pinned"`
+}
+
+// Pins keeps keys of responders discovered before in file, responder
+// discovered for the first time is trusted and pinned
+type Pins struct {
+	sync.Mutex
+	path   string
+	pins   map[string]Pin
+	client *http.Client
+}
+
+// LoadPins loads pins from path, missing file means no responder is pinned yet
+func LoadPins(path string) (*Pins, error) {
+	p := &Pins{
+		path:   path,
+		pins:   make(map[string]Pin),
+		client: &http.Client{Timeout: time.Second * 15},
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &p.pins); err != nil {
+		return nil, fmt.Errorf("pins %q: %s", path, err)
+	}
+	return p, nil
+}
+
+// Discover fetches discovery document of responder at address, e.g. http://127.0.0.1:15000,
+// and checks it against pinned keys. Keys of unknown responder are pinned.
+func (p *Pins) Discover(address string) (*protocol.Discovery, error) {
+	resp, err := p.client.Get(address + protocol.WellKnownPath)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discovery of %s returned %d", address, resp.StatusCode)
+	}
+
+	data, err := ioutil.ReadAll(http.MaxBytesReader(nil, resp.Body, maxDiscoverySize))
+	if err != nil {
+		return nil, err
+	}
+
+	var discovery protocol.Discovery
+	if err := json.Unmarshal(data, &discovery); err != nil {
+		return nil, fmt.Errorf("%s: %s", protocol.ErrInvalidDiscovery, err)
+	}
+
+	if err := p.Check(address, &discovery, time.Now()); err != nil {
+		return nil, err
+	}
+	return &discovery, nil
+}
+
+// Check verifies discovery document of responder at address and compares it with pinned keys
+func (p *Pins) Check(address string, discovery *protocol.Discovery, now time.Time) error {
+	publicKey, signatureKey, err := protocol.VerifyDiscovery(discovery)
+	if err != nil {
+		return err
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	if pin, ok := p.pins[address]; ok {
+		if pin.PublicKey != publicKey.String() || pin.SignatureKey != signatureKey.String() {
+			return fmt.Errorf("%s: %s pinned at %s", ErrPinMismatch, address, pin.Pinned)
+		}
+		return nil
+	}
+
+	p.pins[address] = Pin{
+		PublicKey:    publicKey.String(),
+		SignatureKey: signatureKey.String(),
+		Pinned:       now.Format(time.RFC3339),
+	}
+	return p.save()
+}
+
+// ProtocolEndpoint returns websocket endpoint of responder discovered at address. Loopback
+// endpoint is accepted only from responder discovered on loopback, remote responder
+// publishing it is misconfigured and requester would connect to itself.
+func ProtocolEndpoint(address string, discovery *protocol.Discovery) (string, error) {
+	endpoint, ok := discovery.Endpoints[protocol.EndpointProtocol]
+	if !ok {
+		return "", fmt.Errorf("%s: no %s endpoint", protocol.ErrInvalidDiscovery, protocol.EndpointProtocol)
+	}
+
+	if loopbackURL(endpoint) && !loopbackURL(address) {
+		return "", fmt.Errorf("%s: %s discovered at %s", ErrLoopbackEndpoint, endpoint, address)
+	}
+	return endpoint, nil
+}
+
+// loopbackURL reports if host of URL is loopback address
+func loopbackURL(raw string) bool {
+	address, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+
+	host := address.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Forget removes pin of responder which keys changed legitimately
+func (p *Pins) Forget(address string) error {
+	p.Lock()
+	defer p.Unlock()
+	delete(p.pins, address)
+	return p.save()
+}
+
+// Pinned returns keys pinned for responder at address
+func (p *Pins) Pinned(address string) (publicKey, signatureKey cryptography.Key32, ok bool) {
+	p.Lock()
+	pin, ok := p.pins[address]
+	p.Unlock()
+	if !ok {
+		return publicKey, signatureKey, false
+	}
+
+	publicKey, err := cryptography.Key32FromString(pin.PublicKey)
+	if err != nil {
+		return publicKey, signatureKey, false
+	}
+	signatureKey, err = cryptography.Key32FromString(pin.SignatureKey)
+	return publicKey, signatureKey, err == nil
+}
+
+func (p *Pins) save() error {
+	data, err := json.MarshalIndent(p.pins, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p.path, data, 0600)
+}
@@ -0,0 +1,131 @@
+package requester
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/protocol"
+)
+
+func discoveryServer(t *testing.T, keychain *cryptography.Keychain) *httptest.Server {
+	handler, err := protocol.DiscoveryHandler(keychain, []int{protocol.Version1}, map[string]string{protocol.EndpointProtocol: "ws://127.0.0.1:15000/"})
+	if err != nil {
+		t.Fatalf("DiscoveryHandler() failed: %s", err)
+	}
+	return httptest.NewServer(handler)
+}
+
+func TestPins(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Fatalf("failed to create temporary dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "pins.json")
+
+	responder, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("failed to create keychain: %s", err)
+	}
+
+	server := discoveryServer(t, responder)
+	defer server.Close()
+
+	pins, err := LoadPins(path)
+	if err != nil {
+		t.Fatalf("LoadPins() failed: %s", err)
+	}
+
+	discovery, err := pins.Discover(server.URL)
+	if err != nil {
+		t.Fatalf("Discover() failed: %s", err)
+	}
+	if discovery.PublicKey != responder.MainPublicKey.String() || discovery.Endpoints[protocol.EndpointProtocol] == "" {
+		t.Errorf("Discover() returned %+v", discovery)
+	}
+
+	// pins are kept between runs
+	if pins, err = LoadPins(path); err != nil {
+		t.Fatalf("LoadPins() failed: %s", err)
+	}
+	if publicKey, _, ok := pins.Pinned(server.URL); !ok || publicKey != responder.MainPublicKey {
+		t.Errorf("Pinned() returned %s, %v", publicKey.String(), ok)
+	}
+
+	impostor, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("failed to create keychain: %s", err)
+	}
+	other, err := protocol.NewDiscovery(impostor, []int{protocol.Version1}, nil, time.Now())
+	if err != nil {
+		t.Fatalf("NewDiscovery() failed: %s", err)
+	}
+	if err := pins.Check(server.URL, other, time.Now()); err == nil || !strings.HasPrefix(err.Error(), ErrPinMismatch.Error()) {
+		t.Errorf("Check() with changed keys returned %v", err)
+	}
+
+	if err := pins.Forget(server.URL); err != nil {
+		t.Fatalf("Forget() failed: %s", err)
+	}
+	if err := pins.Check(server.URL, other, time.Now()); err != nil {
+		t.Errorf("Check() after Forget() failed: %s", err)
+	}
+
+	other.Endpoints = map[string]string{protocol.EndpointProtocol: "ws://attacker/"}
+	if err := pins.Check("http://other", other, time.Now()); err == nil || !strings.HasPrefix(err.Error(), protocol.ErrDiscoverySignature.Error()) {
+		t.Errorf("Check() of tampered document returned %v", err)
+	}
+}
+
+func TestProtocolEndpoint(t *testing.T) {
+	responder, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("failed to create keychain: %s", err)
+	}
+
+	server := discoveryServer(t, responder)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Fatalf("failed to create temporary dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	pins, err := LoadPins(filepath.Join(dir, "pins.json"))
+	if err != nil {
+		t.Fatalf("LoadPins() failed: %s", err)
+	}
+
+	// responder on the same host may publish loopback endpoint
+	discovery, err := pins.Discover(server.URL)
+	if err != nil {
+		t.Fatalf("Discover() failed: %s", err)
+	}
+	if endpoint, err := ProtocolEndpoint(server.URL, discovery); err != nil || endpoint != "ws://127.0.0.1:15000/" {
+		t.Errorf("ProtocolEndpoint() of local responder returned %q, %v", endpoint, err)
+	}
+
+	// requester on other host would connect to its own loopback
+	if _, err := ProtocolEndpoint("https://wallet.example.com", discovery); err == nil || !strings.HasPrefix(err.Error(), ErrLoopbackEndpoint.Error()) {
+		t.Errorf("ProtocolEndpoint() of remote responder with loopback endpoint returned %v", err)
+	}
+
+	public, err := protocol.NewDiscovery(responder, []int{protocol.Version1}, map[string]string{protocol.EndpointProtocol: "wss://wallet.example.com/planet"}, time.Now())
+	if err != nil {
+		t.Fatalf("NewDiscovery() failed: %s", err)
+	}
+	if endpoint, err := ProtocolEndpoint("https://wallet.example.com", public); err != nil || endpoint != "wss://wallet.example.com/planet" {
+		t.Errorf("ProtocolEndpoint() of remote responder returned %q, %v", endpoint, err)
+	}
+
+	if _, err := ProtocolEndpoint("https://wallet.example.com", &protocol.Discovery{}); err == nil || !strings.HasPrefix(err.Error(), protocol.ErrInvalidDiscovery.Error()) {
+		t.Errorf("ProtocolEndpoint() without endpoint returned %v", err)
+	}
+}
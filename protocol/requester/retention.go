@@ -0,0 +1,155 @@
+package requester
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+	"github.com/odysseyhack/planet-society/protocol/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	retentionCheckInterval  = time.Minute
+	attestationReplyTimeout = time.Minute
+)
+
+// Retention erases data which retention ended and delivers signed deletion
+// attestations to owners, undelivered attestations are retried on next check
+type Retention struct {
+	store    *Store
+	keychain *cryptography.Keychain
+	dial     protocol.Dialer
+	quit     chan struct{}
+}
+
+// NewRetention creates retention enforcing data retention in store
+func NewRetention(store *Store, keychain *cryptography.Keychain, dial protocol.Dialer) *Retention {
+	return &Retention{
+		store:    store,
+		keychain: keychain,
+		dial:     dial,
+		quit:     make(chan struct{}),
+	}
+}
+
+// Check erases expired data and sends pending deletion attestations
+func (r *Retention) Check(now time.Time) error {
+	expired, err := r.store.Expired(now)
+	if err != nil {
+		return err
+	}
+
+	for i := range expired {
+		erased, err := r.store.Erase(expired[i].Owner, expired[i].OwnerSignatureKey, []string{expired[i].Transaction})
+		if err != nil {
+			return err
+		}
+
+		attestation, err := protocol.NewDeletionAttestation(r.keychain, expired[i].Owner, erased, models.DeletionReasonRetentionExpired, now)
+		if err != nil {
+			return err
+		}
+
+		if expired[i].OwnerEndpoint == "" {
+			continue
+		}
+
+		if err := protocol.CheckEndpoint(expired[i].OwnerEndpoint); err != nil {
+			log.Warningf("requester: deletion attestation of %s not sent: %s", expired[i].Transaction, err)
+			continue
+		}
+
+		if err := r.store.AttestationAdd(expired[i].OwnerEndpoint, attestation); err != nil {
+			return err
+		}
+	}
+
+	pending, err := r.store.Attestations()
+	if err != nil {
+		return err
+	}
+
+	for i := range pending {
+		if err := r.deliver(&pending[i]); err != nil {
+			log.Warningf("requester: deletion attestation %s not delivered: %s", pending[i].ID, err)
+			continue
+		}
+
+		if err := r.store.AttestationDel(pending[i].ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliver sends attestation to owner endpoint and waits for acceptance
+func (r *Retention) deliver(pending *PendingAttestation) error {
+	conn, err := r.dial(pending.Endpoint)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(&pending.Attestation); err != nil {
+		return err
+	}
+
+	if err := conn.Write(&protocol.Message{
+		Header: protocol.Header{
+			Source:      r.keychain.MainPublicKey,
+			Destination: pending.Attestation.OwnerPublicKey.Key,
+			Topic:       protocol.TopicDeletionAttestation,
+			Version:     protocol.Version1,
+		},
+		Body: protocol.Body{Payload: buffer.Bytes()},
+	}); err != nil {
+		return err
+	}
+
+	msg, err := protocol.ReadTimeout(conn, attestationReplyTimeout)
+	if err != nil {
+		return err
+	}
+
+	if msg.Header.Topic != protocol.TopicDeletionReply {
+		return fmt.Errorf("%s: unexpected topic", protocol.ErrUnknownAttestation)
+	}
+
+	var reply models.DeletionAttestationReply
+	if err := gob.NewDecoder(bytes.NewBuffer(msg.Body.Payload)).Decode(&reply); err != nil {
+		return err
+	}
+
+	if reply.Error != nil {
+		return fmt.Errorf("%s", *reply.Error)
+	}
+	return nil
+}
+
+// Loop checks retention periodically until Stop is called
+func (r *Retention) Loop() {
+	ticker := time.NewTicker(retentionCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.Check(time.Now()); err != nil {
+			log.Warningln("requester: retention check failed:", err)
+		}
+
+		select {
+		case <-r.quit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop stops retention loop
+func (r *Retention) Stop() {
+	r.quit <- struct{}{}
+}
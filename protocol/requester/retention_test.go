@@ -0,0 +1,129 @@
+package requester
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+	"github.com/odysseyhack/planet-society/protocol/protocol"
+)
+
+type testAttestationStore struct {
+	permissions []models.Permission
+	erased      map[string]string
+}
+
+func (s *testAttestationStore) PermissionList() ([]models.Permission, error) {
+	return s.permissions, nil
+}
+
+func (s *testAttestationStore) PermissionErased(transactionID, erasedAt, attestation string) error {
+	s.erased[transactionID] = attestation
+	return nil
+}
+
+func TestRetention(t *testing.T) {
+	const dir = "/tmp/test_dir_i2i/retention"
+
+	owner, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+
+	requesterKeychain, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatalf("MkdirAll() failed: %s", err)
+	}
+
+	store, err := OpenStore(filepath.Join(dir, "store.db"), requesterKeychain.StoragePrivateKey)
+	if err != nil {
+		t.Fatalf("OpenStore() failed: %s", err)
+	}
+
+	defer func() {
+		if err := store.Close(); err != nil {
+			t.Errorf("Close failed: %s", err)
+		}
+
+		if err := os.RemoveAll("/tmp/test_dir_i2i"); err != nil {
+			t.Errorf("failed to clean after test: %s", err)
+		}
+	}()
+
+	now := time.Now()
+	if err := store.Put(owner.MainPublicKey, owner.SignaturePublicKey, "ws://owner/", "expired", "passport", now.Add(-time.Hour)); err != nil {
+		t.Fatalf("Put() failed: %s", err)
+	}
+
+	if err := store.Put(owner.MainPublicKey, owner.SignaturePublicKey, "ws://owner/", "kept", "address", time.Time{}); err != nil {
+		t.Fatalf("Put() failed: %s", err)
+	}
+
+	held, err := store.Held(owner.MainPublicKey, owner.SignaturePublicKey, []string{"expired", "kept"})
+	if err != nil || held != "expired: passport\nkept: address" {
+		t.Fatalf("Held() returned %q, %v", held, err)
+	}
+
+	attestations := &testAttestationStore{
+		permissions: []models.Permission{{
+			TransactionID:         "expired",
+			RequesterPublicKey:    models.Key32{Key: requesterKeychain.MainPublicKey},
+			RequesterSignatureKey: models.Key32{Key: requesterKeychain.SignaturePublicKey},
+		}},
+		erased: make(map[string]string),
+	}
+
+	proto := protocol.NewProtocol(nil)
+	proto.SetAttestationStore(attestations)
+
+	available := false
+	dial := func(endpoint string) (protocol.Conn, error) {
+		local, remote := pipe()
+		if !available {
+			local.Close()
+			return local, nil
+		}
+		proto.Connections <- remote
+		return local, nil
+	}
+	go proto.Loop()
+	defer proto.Stop()
+
+	retention := NewRetention(store, requesterKeychain, dial)
+	if err := retention.Check(now); err != nil {
+		t.Fatalf("Check() failed: %s", err)
+	}
+
+	if _, err := store.Held(owner.MainPublicKey, owner.SignaturePublicKey, []string{"expired"}); err != protocol.ErrUnknownDataSubject {
+		t.Errorf("Held() of expired data returned %v", err)
+	}
+
+	pending, err := store.Attestations()
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("Attestations() returned %+v, %v, expected undelivered attestation", pending, err)
+	}
+
+	available = true
+	if err := retention.Check(now); err != nil {
+		t.Fatalf("Check() failed: %s", err)
+	}
+
+	if pending, err := store.Attestations(); err != nil || len(pending) != 0 {
+		t.Errorf("Attestations() returned %+v, %v, expected no pending attestations", pending, err)
+	}
+
+	if attestations.erased["expired"] != pending[0].Attestation.Statement {
+		t.Errorf("owner recorded %v", attestations.erased)
+	}
+
+	if held, err := store.Held(owner.MainPublicKey, owner.SignaturePublicKey, []string{"kept"}); err != nil || held != "kept: address" {
+		t.Errorf("Held() returned %q, %v", held, err)
+	}
+}
@@ -0,0 +1,233 @@
+package requester
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+	"github.com/odysseyhack/planet-society/protocol/protocol"
+)
+
+const (
+	bucketReceived     = "received"
+	bucketAttestations = "attestations"
+)
+
+// Received is data received from owner in single transaction
+type Received struct {
+	Owner cryptography.Key32
+	// OwnerSignatureKey is signature key of owner known when data was received,
+	// only requests signed with it can access or erase the data
+	OwnerSignatureKey cryptography.Key32
+	OwnerEndpoint     string
+	Transaction       string
+	// Content is encrypted with storage key of requester
+	Content []byte
+	// RetainUntil is RFC3339 time of data erasure, empty means until revocation
+	RetainUntil string
+}
+
+// PendingAttestation is deletion attestation which was not accepted by owner yet
+type PendingAttestation struct {
+	ID          string
+	Endpoint    string
+	Attestation models.DeletionAttestation
+}
+
+// Store keeps data received from owners encrypted on disk, it implements DataHolder
+type Store struct {
+	db  *bolt.DB
+	box *cryptography.SecretBox
+}
+
+// OpenStore opens store at path, received data is encrypted with key
+func OpenStore(path string, key cryptography.Key32) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range []string{bucketReceived, bucketAttestations} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db, box: cryptography.NewSecretBox(key)}, nil
+}
+
+// Close closes store
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Put stores content received from owner in transaction, zero retainUntil keeps content until revocation
+func (s *Store) Put(owner, ownerSignatureKey cryptography.Key32, ownerEndpoint, transaction, content string, retainUntil time.Time) error {
+	encrypted, err := s.box.Encrypt([]byte(content))
+	if err != nil {
+		return err
+	}
+
+	received := Received{
+		Owner:             owner,
+		OwnerSignatureKey: ownerSignatureKey,
+		OwnerEndpoint:     ownerEndpoint,
+		Transaction:       transaction,
+		Content:           encrypted,
+	}
+	if !retainUntil.IsZero() {
+		received.RetainUntil = retainUntil.Format(time.RFC3339)
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return put(tx.Bucket([]byte(bucketReceived)), []byte(transaction), &received)
+	})
+}
+
+// Held returns decrypted data of owner received in given transactions
+func (s *Store) Held(owner, ownerSignatureKey cryptography.Key32, transactions []string) (string, error) {
+	var held []string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(bucketReceived))
+		for _, transaction := range transactions {
+			var received Received
+			if err := get(bucket, []byte(transaction), &received); err != nil || !received.Owner.Equal(owner) {
+				continue
+			}
+
+			if !received.OwnerSignatureKey.Equal(ownerSignatureKey) {
+				return fmt.Errorf("%s: %s", protocol.ErrOwnerSignatureKey, transaction)
+			}
+
+			content, err := s.box.Decrypt(received.Content)
+			if err != nil {
+				return err
+			}
+			held = append(held, fmt.Sprintf("%s: %s", transaction, content))
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(held) == 0 {
+		return "", protocol.ErrUnknownDataSubject
+	}
+	return strings.Join(held, "\n"), nil
+}
+
+// Erase erases data of owner received in given transactions and returns erased transactions
+func (s *Store) Erase(owner, ownerSignatureKey cryptography.Key32, transactions []string) (erased []string, err error) {
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(bucketReceived))
+		for _, transaction := range transactions {
+			var received Received
+			if err := get(bucket, []byte(transaction), &received); err != nil || !received.Owner.Equal(owner) {
+				continue
+			}
+
+			if !received.OwnerSignatureKey.Equal(ownerSignatureKey) {
+				return fmt.Errorf("%s: %s", protocol.ErrOwnerSignatureKey, transaction)
+			}
+
+			if err := bucket.Delete([]byte(transaction)); err != nil {
+				return err
+			}
+			erased = append(erased, transaction)
+		}
+		return nil
+	})
+	return erased, err
+}
+
+// Expired returns received data which retention ended before now
+func (s *Store) Expired(now time.Time) (list []Received, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bucketReceived)).ForEach(func(k, v []byte) error {
+			var received Received
+			if err := gob.NewDecoder(bytes.NewBuffer(v)).Decode(&received); err != nil {
+				return err
+			}
+
+			if received.RetainUntil == "" {
+				return nil
+			}
+
+			retainUntil, err := time.Parse(time.RFC3339, received.RetainUntil)
+			if err != nil {
+				return err
+			}
+
+			if !now.Before(retainUntil) {
+				list = append(list, received)
+			}
+			return nil
+		})
+	})
+	return list, err
+}
+
+// AttestationAdd queues attestation to be sent to owner endpoint
+func (s *Store) AttestationAdd(endpoint string, attestation *models.DeletionAttestation) error {
+	id := cryptography.RandomKey32()
+	pending := PendingAttestation{
+		ID:          id.String(),
+		Endpoint:    endpoint,
+		Attestation: *attestation,
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return put(tx.Bucket([]byte(bucketAttestations)), []byte(pending.ID), &pending)
+	})
+}
+
+// Attestations returns attestations which were not accepted by owners yet
+func (s *Store) Attestations() (list []PendingAttestation, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bucketAttestations)).ForEach(func(k, v []byte) error {
+			var pending PendingAttestation
+			if err := gob.NewDecoder(bytes.NewBuffer(v)).Decode(&pending); err != nil {
+				return err
+			}
+			list = append(list, pending)
+			return nil
+		})
+	})
+	return list, err
+}
+
+// AttestationDel removes attestation accepted by owner
+func (s *Store) AttestationDel(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bucketAttestations)).Delete([]byte(id))
+	})
+}
+
+func put(bucket *bolt.Bucket, key []byte, value interface{}) error {
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(value); err != nil {
+		return err
+	}
+	return bucket.Put(key, buffer.Bytes())
+}
+
+func get(bucket *bolt.Bucket, key []byte, value interface{}) error {
+	data := bucket.Get(key)
+	if data == nil {
+		return fmt.Errorf("key %q not found", key)
+	}
+	return gob.NewDecoder(bytes.NewBuffer(data)).Decode(value)
+}
@@ -0,0 +1,156 @@
+// Package requester contains parts of the protocol run by requesters,
+// the organisations which receive data from owners.
+package requester
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+	"github.com/odysseyhack/planet-society/protocol/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// DataHolder gives access to data requester holds about owners. Data is bound to owner
+// signature key known when it was received, other signature key has to be rejected
+// with protocol.ErrOwnerSignatureKey, otherwise anyone knowing owner main key could sign requests.
+type DataHolder interface {
+	// Held returns data of owner received in given transactions
+	Held(owner, ownerSignatureKey cryptography.Key32, transactions []string) (string, error)
+	// Erase erases data of owner received in given transactions and returns erased transactions
+	Erase(owner, ownerSignatureKey cryptography.Key32, transactions []string) ([]string, error)
+}
+
+// DataSubjectHandler answers access, erasure and revocation requests sent by owners
+type DataSubjectHandler struct {
+	keychain *cryptography.Keychain
+	holder   DataHolder
+}
+
+// NewDataSubjectHandler creates handler signing replies with keychain
+func NewDataSubjectHandler(keychain *cryptography.Keychain, holder DataHolder) *DataSubjectHandler {
+	return &DataSubjectHandler{
+		keychain: keychain,
+		holder:   holder,
+	}
+}
+
+// Listen serves data subject requests on connections until channel is closed
+func (h *DataSubjectHandler) Listen(connections chan protocol.Conn) {
+	for conn := range connections {
+		go h.Serve(conn)
+	}
+}
+
+// Serve answers data subject requests sent over connection until it is closed
+func (h *DataSubjectHandler) Serve(conn protocol.Conn) {
+	defer conn.Close()
+
+	for {
+		msg, err := conn.Read()
+		if err != nil {
+			return
+		}
+
+		reply, err := h.Handle(msg)
+		if err != nil {
+			log.Warningln("requester: data subject request:", err)
+			return
+		}
+
+		if err := conn.Write(reply); err != nil {
+			log.Warningln("requester: writing data subject reply failed:", err)
+			return
+		}
+	}
+}
+
+// Handle verifies data subject request and returns signed reply
+func (h *DataSubjectHandler) Handle(msg *protocol.Message) (*protocol.Message, error) {
+	replyTopic, ok := protocol.DataSubjectReplyTopics[msg.Header.Topic]
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown topic", protocol.ErrInvalidDataSubjectMsg)
+	}
+
+	var request models.DataSubjectRequest
+	if err := gob.NewDecoder(bytes.NewBuffer(msg.Body.Payload)).Decode(&request); err != nil {
+		return nil, fmt.Errorf("%s: %s", protocol.ErrInvalidDataSubjectMsg, err)
+	}
+
+	if err := protocol.VerifyDataSubjectRequest(&request); err != nil {
+		return nil, err
+	}
+
+	if !request.OwnerPublicKey.Key.Equal(msg.Header.Source) {
+		return nil, fmt.Errorf("%s: owner key does not match message source", protocol.ErrInvalidDataSubjectMsg)
+	}
+
+	reply := h.answer(&request, time.Now())
+	if err := protocol.SignDataSubjectReply(reply, h.keychain); err != nil {
+		return nil, err
+	}
+
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(reply); err != nil {
+		return nil, err
+	}
+
+	return &protocol.Message{
+		Header: protocol.Header{
+			Source:      h.keychain.MainPublicKey,
+			Destination: msg.Header.Source,
+			Topic:       replyTopic,
+			Version:     msg.Header.Version,
+		},
+		Body: protocol.Body{Payload: buffer.Bytes()},
+	}, nil
+}
+
+// answer runs request against data holder, failures are reported inside of the reply
+func (h *DataSubjectHandler) answer(request *models.DataSubjectRequest, now time.Time) *models.DataSubjectReply {
+	reply := &models.DataSubjectReply{
+		RequestID: request.RequestID,
+		Type:      request.Type,
+		Created:   now.Format(time.RFC3339),
+	}
+
+	owner, signatureKey := request.OwnerPublicKey.Key, request.OwnerSignatureKey.Key
+	switch request.Type {
+	case models.DataSubjectRequestTypeAccess:
+		content, err := h.holder.Held(owner, signatureKey, request.Transactions)
+		if err != nil {
+			reply.Error = errorString(err)
+			return reply
+		}
+
+		// content travels only to the owner, signature alone would expose it on the way
+		encrypted, err := protocol.EncryptContent(content, owner, h.keychain)
+		if err != nil {
+			reply.Error = errorString(err)
+			return reply
+		}
+		reply.Content = &encrypted
+	case models.DataSubjectRequestTypeErasure, models.DataSubjectRequestTypeRevocation:
+		erased, err := h.holder.Erase(owner, signatureKey, request.Transactions)
+		if err != nil {
+			reply.Error = errorString(err)
+			return reply
+		}
+		reason := models.DeletionReasonErasureRequested
+		if request.Type == models.DataSubjectRequestTypeRevocation {
+			reason = models.DeletionReasonRevoked
+		}
+		reply.Erased = erased
+		attestation := protocol.DeletionStatement(h.keychain.MainPublicKey, owner, erased, reason, now)
+		reply.Attestation = &attestation
+	}
+	return reply
+}
+
+func errorString(err error) *string {
+	message := err.Error()
+	return &message
+}
@@ -0,0 +1,284 @@
+package requester
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/odysseyhack/planet-society/protocol/cryptography"
+	"github.com/odysseyhack/planet-society/protocol/models"
+	"github.com/odysseyhack/planet-society/protocol/protocol"
+)
+
+// pipeConn is one side of in-memory connection
+type pipeConn struct {
+	in   chan *protocol.Message
+	out  chan *protocol.Message
+	once *sync.Once
+	done chan struct{}
+}
+
+func pipe() (*pipeConn, *pipeConn) {
+	a, b := make(chan *protocol.Message, 1), make(chan *protocol.Message, 1)
+	once, done := &sync.Once{}, make(chan struct{})
+	return &pipeConn{in: a, out: b, once: once, done: done}, &pipeConn{in: b, out: a, once: once, done: done}
+}
+
+func (p *pipeConn) Read() (*protocol.Message, error) {
+	select {
+	case msg := <-p.in:
+		return msg, nil
+	case <-p.done:
+		return nil, fmt.Errorf("closed")
+	}
+}
+
+func (p *pipeConn) Write(msg *protocol.Message) error {
+	p.out <- msg
+	return nil
+}
+
+func (p *pipeConn) Close() error {
+	p.once.Do(func() { close(p.done) })
+	return nil
+}
+
+func (p *pipeConn) RemoteAddr() string {
+	return "pipe"
+}
+
+type testHolder struct {
+	data map[string]string
+}
+
+func (h *testHolder) Held(owner, ownerSignatureKey cryptography.Key32, transactions []string) (string, error) {
+	return h.data[transactions[0]], nil
+}
+
+func (h *testHolder) Erase(owner, ownerSignatureKey cryptography.Key32, transactions []string) ([]string, error) {
+	var erased []string
+	for _, transaction := range transactions {
+		if _, ok := h.data[transaction]; ok {
+			delete(h.data, transaction)
+			erased = append(erased, transaction)
+		}
+	}
+	return erased, nil
+}
+
+type testStore struct {
+	sync.Mutex
+	permissions []models.Permission
+	records     map[string]models.DataSubjectRequestRecord
+	erased      map[string]string
+}
+
+func (s *testStore) PermissionList() ([]models.Permission, error) {
+	return s.permissions, nil
+}
+
+func (s *testStore) PermissionErased(transactionID, erasedAt, attestation string) error {
+	s.Lock()
+	defer s.Unlock()
+	s.erased[transactionID] = attestation
+	return nil
+}
+
+func (s *testStore) DataSubjectRequestPut(record *models.DataSubjectRequestRecord) error {
+	s.Lock()
+	defer s.Unlock()
+	s.records[record.ID] = *record
+	return nil
+}
+
+func (s *testStore) DataSubjectRequestList() (list []models.DataSubjectRequestRecord, err error) {
+	s.Lock()
+	defer s.Unlock()
+	for _, record := range s.records {
+		list = append(list, record)
+	}
+	return list, nil
+}
+
+func TestDataSubjectErasure(t *testing.T) {
+	testDataSubjectErasure(t, models.DataSubjectRequestTypeErasure)
+}
+
+func TestDataSubjectRevocation(t *testing.T) {
+	testDataSubjectErasure(t, models.DataSubjectRequestTypeRevocation)
+}
+
+func testDataSubjectErasure(t *testing.T, requestType models.DataSubjectRequestType) {
+	owner, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+
+	requesterKeychain, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+
+	holder := &testHolder{data: map[string]string{"transaction": "passport"}}
+	handler := NewDataSubjectHandler(requesterKeychain, holder)
+	dial := func(endpoint string) (protocol.Conn, error) {
+		local, remote := pipe()
+		go handler.Serve(remote)
+		return local, nil
+	}
+
+	store := &testStore{
+		permissions: []models.Permission{{
+			TransactionID:         "transaction",
+			RequesterPublicKey:    models.Key32{Key: requesterKeychain.MainPublicKey},
+			RequesterSignatureKey: models.Key32{Key: requesterKeychain.SignaturePublicKey},
+			RequesterEndpoint:     "ws://requester/",
+		}},
+		records: make(map[string]models.DataSubjectRequestRecord),
+		erased:  make(map[string]string),
+	}
+
+	subjects := protocol.NewDataSubjects(store, owner, dial)
+	var record *models.DataSubjectRequestRecord
+	if requestType == models.DataSubjectRequestTypeRevocation {
+		record, err = subjects.Revoke(&store.permissions[0])
+	} else {
+		record, err = subjects.Send(requesterKeychain.MainPublicKey, requestType)
+	}
+	if err != nil {
+		t.Fatalf("sending %s request failed: %s", requestType, err)
+	}
+
+	var answered models.DataSubjectRequestRecord
+	for i := 0; i < 100; i++ {
+		list, err := subjects.List(time.Now())
+		if err != nil {
+			t.Fatalf("List() failed: %s", err)
+		}
+		if len(list) == 1 && list[0].Status != models.DataSubjectRequestStatusPending {
+			answered = list[0]
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	if answered.ID != record.ID || answered.Status != models.DataSubjectRequestStatusAnswered {
+		t.Fatalf("List() returned %+v, expected answered request", answered)
+	}
+
+	if len(answered.Erased) != 1 || answered.Attestation == nil || len(holder.data) != 0 {
+		t.Errorf("erasure returned %+v, holder has %v", answered, holder.data)
+	}
+
+	store.Lock()
+	defer store.Unlock()
+	if store.erased["transaction"] != *answered.Attestation {
+		t.Errorf("permission attestation is %q, expected %q", store.erased["transaction"], *answered.Attestation)
+	}
+}
+
+// dataSubjectMessage returns message with data subject request sent from owner main key
+func dataSubjectMessage(t *testing.T, topic cryptography.Key32, request *models.DataSubjectRequest) *protocol.Message {
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(request); err != nil {
+		t.Fatalf("Encode() failed: %s", err)
+	}
+
+	return &protocol.Message{
+		Header: protocol.Header{Source: request.OwnerPublicKey.Key, Topic: topic, Version: protocol.Version1},
+		Body:   protocol.Body{Payload: buffer.Bytes()},
+	}
+}
+
+// handleDataSubject passes request to handler and returns decoded reply
+func handleDataSubject(t *testing.T, handler *DataSubjectHandler, topic cryptography.Key32, request *models.DataSubjectRequest) *models.DataSubjectReply {
+	msg, err := handler.Handle(dataSubjectMessage(t, topic, request))
+	if err != nil {
+		t.Fatalf("Handle() failed: %s", err)
+	}
+
+	var reply models.DataSubjectReply
+	if err := gob.NewDecoder(bytes.NewBuffer(msg.Body.Payload)).Decode(&reply); err != nil {
+		t.Fatalf("Decode() failed: %s", err)
+	}
+	return &reply
+}
+
+func TestDataSubjectForgedOwnerSignature(t *testing.T) {
+	dir, err := ioutil.TempDir("", "requester")
+	if err != nil {
+		t.Fatalf("failed to create temporary dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	owner, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+
+	requesterKeychain, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+
+	attacker, err := cryptography.OneShotKeychain()
+	if err != nil {
+		t.Fatalf("OneShotKeychain() failed: %s", err)
+	}
+
+	store, err := OpenStore(filepath.Join(dir, "store.db"), requesterKeychain.StoragePrivateKey)
+	if err != nil {
+		t.Fatalf("OpenStore() failed: %s", err)
+	}
+	defer store.Close()
+
+	if err := store.Put(owner.MainPublicKey, owner.SignaturePublicKey, "ws://owner/", "transaction", "passport", time.Time{}); err != nil {
+		t.Fatalf("Put() failed: %s", err)
+	}
+	handler := NewDataSubjectHandler(requesterKeychain, store)
+
+	// attacker knows public main key of the owner and signs requests with own signature key
+	forger := *attacker
+	forger.MainPublicKey = owner.MainPublicKey
+	for _, requestType := range []models.DataSubjectRequestType{models.DataSubjectRequestTypeAccess, models.DataSubjectRequestTypeErasure} {
+		forged, err := protocol.NewDataSubjectRequest(&forger, requestType, []string{"transaction"}, time.Now())
+		if err != nil {
+			t.Fatalf("NewDataSubjectRequest() failed: %s", err)
+		}
+
+		topic := protocol.TopicAccessRequest
+		if requestType == models.DataSubjectRequestTypeErasure {
+			topic = protocol.TopicErasureRequest
+		}
+
+		reply := handleDataSubject(t, handler, topic, forged)
+		if reply.Error == nil || !strings.HasPrefix(*reply.Error, protocol.ErrOwnerSignatureKey.Error()) || reply.Content != nil || len(reply.Erased) != 0 {
+			t.Errorf("forged %s request returned %+v", requestType, reply)
+		}
+	}
+
+	request, err := protocol.NewDataSubjectRequest(owner, models.DataSubjectRequestTypeAccess, []string{"transaction"}, time.Now())
+	if err != nil {
+		t.Fatalf("NewDataSubjectRequest() failed: %s", err)
+	}
+
+	reply := handleDataSubject(t, handler, protocol.TopicAccessRequest, request)
+	if reply.Error != nil || reply.Content == nil {
+		t.Fatalf("owner access request returned %+v", reply)
+	}
+
+	if *reply.Content == "transaction: passport" {
+		t.Errorf("access reply content is not encrypted")
+	}
+
+	if content, err := protocol.DecryptContent(*reply.Content, requesterKeychain.MainPublicKey, owner); err != nil || content != "transaction: passport" {
+		t.Errorf("DecryptContent() returned %q, %v", content, err)
+	}
+}
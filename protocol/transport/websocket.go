@@ -16,18 +16,35 @@ type Websocket struct {
 	upgrader   *websocket.Upgrader
 	connection chan protocol.Conn
 	server     *http.Server
+	readLimit  int64
+	handlers   map[string]http.Handler
 }
 
 func NewWebsocket(connection chan protocol.Conn) *Websocket {
 	return &Websocket{
 		connection: connection,
 		upgrader:   &websocket.Upgrader{},
+		handlers:   make(map[string]http.Handler),
 	}
 }
 
+// Handle serves handler at path next to websocket endpoint, it has to be called before Listen
+func (ws *Websocket) Handle(path string, handler http.Handler) {
+	ws.handlers[path] = handler
+}
+
+// SetReadLimit sets maximal size of message read from connection,
+// connections sending bigger messages are closed.
+func (ws *Websocket) SetReadLimit(limit int64) {
+	ws.readLimit = limit
+}
+
 func (ws *Websocket) Listen(addr string) error {
 	router := mux.NewRouter()
 	router.HandleFunc("/", ws.client)
+	for path, handler := range ws.handlers {
+		router.Handle(path, handler)
+	}
 
 	ws.server = &http.Server{
 		Addr: addr,
@@ -46,6 +63,9 @@ func (ws *Websocket) Listen(addr string) error {
 }
 
 func (ws *Websocket) Stop() error {
+	if ws.server == nil {
+		return nil
+	}
 	return ws.server.Close()
 }
 
@@ -55,6 +75,9 @@ func (ws *Websocket) client(w http.ResponseWriter, r *http.Request) {
 		log.Print("websocket upgrade failed:", err)
 		return
 	}
+	if ws.readLimit > 0 {
+		c.SetReadLimit(ws.readLimit)
+	}
 	ws.connection <- &Conn{Conn: c}
 }
 
@@ -90,3 +113,16 @@ func (c *Conn) Write(msg *protocol.Message) error {
 func (c *Conn) Close() error {
 	return c.Conn.Close()
 }
+
+func (c *Conn) RemoteAddr() string {
+	return c.Conn.RemoteAddr().String()
+}
+
+// Dial connects to websocket endpoint, e.g. ws://127.0.0.1:15001/
+func Dial(endpoint string) (protocol.Conn, error) {
+	c, _, err := websocket.DefaultDialer.Dial(endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{Conn: c}, nil
+}